@@ -42,14 +42,63 @@ func InitDB() {
 		&models.Category{},
 		&models.ContentCreatorInfo{},
 		&models.PrivateMessage{},
+		&models.Conversation{},
+		&models.ConversationParticipant{},
+		&models.MessageAttachment{},
+		&models.MessageUnlock{},
+		&models.Broadcast{},
+		&models.BroadcastRecipient{},
 		&models.Subscription{},
 		&models.SubscriptionPayment{},
 		&models.UserFollow{},
+		&models.UserBlock{},
+		&models.FollowRequest{},
+		&models.CreatorSuggestion{},
+		&models.SubscriptionTier{},
+		&models.PromoCode{},
+		&models.Tip{},
+		&models.LedgerTransaction{},
+		&models.LedgerEntry{},
+		&models.Payout{},
+		&models.CreatorTransfer{},
+		&models.StripeEvent{},
+		&models.Notification{},
+		&models.NotificationActor{},
 	)
 	if err != nil {
 		utils.LogError(err, "Error migrating database")
 		panic("Could not migrate database")
 	}
 
+	// Les préférences de notifications étaient dans une table séparée, elles sont maintenant dans users
+	migrateNotificationSettings()
+
 	utils.LogSuccess("Database connection successful")
 }
+
+func migrateNotificationSettings() {
+	if !DB.Migrator().HasTable("notification_settings") {
+		return
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE users SET
+			notify_post_liked = s.post_liked,
+			notify_new_comment = s.new_comment,
+			notify_comment_reply = s.comment_reply,
+			notify_new_follower = s.new_follower,
+			notify_new_subscriber = s.new_subscriber,
+			notify_payment_failed = s.payment_failed,
+			notify_creator_application = s.creator_application,
+			notify_report_outcome = s.report_outcome,
+			notify_digest_frequency = s.digest_frequency,
+			notify_digest_sent_at = s.digest_sent_at
+			FROM notification_settings s WHERE users.id = s.user_id`).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable("notification_settings")
+	})
+	if err != nil {
+		utils.LogError(err, "Error moving notification settings to users")
+	}
+}
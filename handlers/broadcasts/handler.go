@@ -0,0 +1,217 @@
+package broadcasts
+
+import (
+	"net/http"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	broadcastsService "pec2-backend/services/broadcasts"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// creatorID vérifie que l'utilisateur connecté est un créateur de contenu
+func creatorID(c *gin.Context, handlerName string) (string, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated in "+handlerName)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return "", false
+	}
+
+	role, _ := c.Get("role")
+	if role != string(models.ContentCreator) {
+		utils.LogError(nil, "Broadcasts reserved to content creators in "+handlerName)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only content creators can send broadcasts"})
+		return "", false
+	}
+
+	return userID.(string), true
+}
+
+// loadBroadcast récupère un message groupé du créateur connecté
+func loadBroadcast(c *gin.Context, userID string, handlerName string) (models.Broadcast, bool) {
+	var broadcast models.Broadcast
+	err := db.DB.Where("id = ? AND creator_id = ?", c.Param("id"), userID).First(&broadcast).Error
+	if err == gorm.ErrRecordNotFound {
+		utils.LogError(err, "Broadcast not found in "+handlerName)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Broadcast not found"})
+		return broadcast, false
+	}
+	if err != nil {
+		utils.LogError(err, "Error retrieving broadcast in "+handlerName)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving broadcast"})
+		return broadcast, false
+	}
+	return broadcast, true
+}
+
+// @Summary Send a broadcast
+// @Description Send one message to a segment of the creator's audience: active subscribers, followers, subscribers whose canceled subscription ends within N days, or lapsed subscribers. The message is delivered as individual private messages by a background job, skipping users who disabled private messages
+// @Tags broadcasts
+// @Accept json
+// @Produce json
+// @Param broadcast body models.BroadcastCreate true "Segment and message"
+// @Security BearerAuth
+// @Success 201 {object} models.Broadcast "Created broadcast"
+// @Failure 400 {object} map[string]string "error: Invalid data / no recipient in this segment"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Only content creators can send broadcasts"
+// @Failure 500 {object} map[string]string "error: Error creating broadcast"
+// @Router /broadcasts [post]
+func CreateBroadcast(c *gin.Context) {
+	userID, ok := creatorID(c, "CreateBroadcast")
+	if !ok {
+		return
+	}
+
+	var input models.BroadcastCreate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.LogError(err, "Invalid data in CreateBroadcast")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data: " + err.Error()})
+		return
+	}
+
+	broadcast, err := broadcastsService.Create(userID, input, time.Now())
+	if err == broadcastsService.ErrNoRecipients || err == broadcastsService.ErrMissingExpiry {
+		utils.LogError(err, "Invalid segment in CreateBroadcast")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		utils.LogError(err, "Error creating broadcast in CreateBroadcast")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating broadcast"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Broadcast created in CreateBroadcast")
+	c.JSON(http.StatusCreated, broadcast)
+}
+
+// @Summary Get my broadcasts
+// @Description List the broadcasts of the authenticated creator, most recent first, with their delivery stats
+// @Tags broadcasts
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of broadcasts per page" default(20)
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "broadcasts, pagination"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Only content creators can send broadcasts"
+// @Failure 500 {object} map[string]string "error: Error retrieving broadcasts"
+// @Router /broadcasts [get]
+func GetBroadcasts(c *gin.Context) {
+	userID, ok := creatorID(c, "GetBroadcasts")
+	if !ok {
+		return
+	}
+
+	page, limit := utils.GetPagination(c)
+	query := db.DB.Model(&models.Broadcast{}).Where("creator_id = ?", userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		utils.LogError(err, "Error counting broadcasts in GetBroadcasts")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving broadcasts"})
+		return
+	}
+
+	var broadcasts []models.Broadcast
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&broadcasts).Error; err != nil {
+		utils.LogError(err, "Error retrieving broadcasts in GetBroadcasts")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving broadcasts"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Broadcasts retrieved in GetBroadcasts")
+	c.JSON(http.StatusOK, gin.H{
+		"broadcasts": broadcasts,
+		"pagination": utils.PaginationResponse(total, page, limit),
+	})
+}
+
+// @Summary Get a broadcast
+// @Description Get a broadcast of the authenticated creator with its delivery stats (sent, skipped, failed and remaining)
+// @Tags broadcasts
+// @Produce json
+// @Param id path string true "Broadcast ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "broadcast, remaining"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Only content creators can send broadcasts"
+// @Failure 404 {object} map[string]string "error: Broadcast not found"
+// @Failure 500 {object} map[string]string "error: Error retrieving broadcast"
+// @Router /broadcasts/{id} [get]
+func GetBroadcast(c *gin.Context) {
+	userID, ok := creatorID(c, "GetBroadcast")
+	if !ok {
+		return
+	}
+
+	broadcast, ok := loadBroadcast(c, userID, "GetBroadcast")
+	if !ok {
+		return
+	}
+
+	var remaining int64
+	if err := db.DB.Model(&models.BroadcastRecipient{}).
+		Where("broadcast_id = ? AND status IN ?", broadcast.ID,
+			[]models.BroadcastRecipientStatus{models.BroadcastRecipientPending, models.BroadcastRecipientProcessing}).
+		Count(&remaining).Error; err != nil {
+		utils.LogError(err, "Error counting remaining recipients in GetBroadcast")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving broadcast"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Broadcast retrieved in GetBroadcast")
+	c.JSON(http.StatusOK, gin.H{"broadcast": broadcast, "remaining": remaining})
+}
+
+// @Summary Cancel a broadcast
+// @Description Stop a pending or in-progress broadcast. Messages already delivered are kept, the remaining recipients will not receive anything
+// @Tags broadcasts
+// @Produce json
+// @Param id path string true "Broadcast ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Broadcast "Canceled broadcast"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Only content creators can send broadcasts"
+// @Failure 404 {object} map[string]string "error: Broadcast not found"
+// @Failure 409 {object} map[string]string "error: Broadcast already completed or canceled"
+// @Failure 500 {object} map[string]string "error: Error canceling broadcast"
+// @Router /broadcasts/{id}/cancel [post]
+func CancelBroadcast(c *gin.Context) {
+	userID, ok := creatorID(c, "CancelBroadcast")
+	if !ok {
+		return
+	}
+
+	broadcast, ok := loadBroadcast(c, userID, "CancelBroadcast")
+	if !ok {
+		return
+	}
+
+	err := broadcastsService.Cancel(broadcast.ID, time.Now())
+	if err == broadcastsService.ErrNotCancelable {
+		utils.LogError(err, "Broadcast not cancelable in CancelBroadcast")
+		c.JSON(http.StatusConflict, gin.H{"error": "Broadcast already completed or canceled"})
+		return
+	}
+	if err != nil {
+		utils.LogError(err, "Error canceling broadcast in CancelBroadcast")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error canceling broadcast"})
+		return
+	}
+
+	if err := db.DB.First(&broadcast, "id = ?", broadcast.ID).Error; err != nil {
+		utils.LogError(err, "Error reloading broadcast in CancelBroadcast")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving broadcast"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Broadcast canceled in CancelBroadcast")
+	c.JSON(http.StatusOK, broadcast)
+}
@@ -0,0 +1,152 @@
+package broadcasts
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	testutils.InitTestMain()
+
+	log.SetOutput(io.Discard)
+
+	exitCode := m.Run()
+
+	log.SetOutput(os.Stdout)
+
+	os.Exit(exitCode)
+}
+
+func setupRouter(userID string, role models.Role) *gin.Engine {
+	r := testutils.SetupTestRouter()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("role", string(role))
+		c.Next()
+	})
+	r.POST("/broadcasts", CreateBroadcast)
+	r.POST("/broadcasts/:id/cancel", CancelBroadcast)
+	return r
+}
+
+func TestCreateBroadcast_NotCreator(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	body := `{"segment":"subscribers","content":"Bonjour à tous"}`
+	req, _ := http.NewRequest(http.MethodPost, "/broadcasts", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	setupRouter("user-uuid", models.UserRole).ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateBroadcast_Segments(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		expectQuery  func(mock sqlmock.Sqlmock)
+		expectedCode int
+	}{
+		{
+			name:         "Unknown segment",
+			body:         `{"segment":"everyone","content":"Bonjour à tous"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Expiring segment without days",
+			body:         `{"segment":"expiring","content":"Votre abonnement se termine bientôt"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name: "Empty followers segment",
+			body: `{"segment":"followers","content":"Bonjour à tous"}`,
+			expectQuery: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT DISTINCT "follower_id" FROM "user_follows" WHERE followed_id = \$1`).
+					WithArgs("creator-uuid").
+					WillReturnRows(sqlmock.NewRows([]string{"follower_id"}))
+				mock.ExpectQuery(`SELECT "blocked_id" FROM "user_blocks"`).
+					WillReturnRows(sqlmock.NewRows([]string{"blocked_id"}))
+				mock.ExpectQuery(`SELECT "blocker_id" FROM "user_blocks"`).
+					WillReturnRows(sqlmock.NewRows([]string{"blocker_id"}))
+			},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name: "Lapsed subscribers",
+			body: `{"segment":"lapsed","content":"Vous nous manquez"}`,
+			expectQuery: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT DISTINCT "user_id" FROM "subscriptions" WHERE \(content_creator_id = \$1 AND status = \$2 AND end_date <= \$3\) AND user_id NOT IN \(SELECT "user_id" FROM "subscriptions" WHERE content_creator_id = \$4 AND \(status = \$5 OR \(status = \$6 AND end_date > \$7\)\)\)`).
+					WithArgs("creator-uuid", models.SubscriptionCanceled, sqlmock.AnyArg(), "creator-uuid", models.SubscriptionActive, models.SubscriptionCanceled, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("user-1").AddRow("user-2").AddRow("user-3"))
+				// user-3 a bloqué le créateur
+				mock.ExpectQuery(`SELECT "blocked_id" FROM "user_blocks" WHERE blocker_id = \$1`).
+					WithArgs("creator-uuid").
+					WillReturnRows(sqlmock.NewRows([]string{"blocked_id"}))
+				mock.ExpectQuery(`SELECT "blocker_id" FROM "user_blocks" WHERE blocked_id = \$1`).
+					WithArgs("creator-uuid").
+					WillReturnRows(sqlmock.NewRows([]string{"blocker_id"}).AddRow("user-3"))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "broadcasts"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow("broadcast-uuid", "PENDING"))
+				mock.ExpectExec(`INSERT INTO "broadcast_recipients" \("broadcast_id","user_id","status","message_id","processed_at"\) VALUES \(\$1,\$2,\$3,\$4,\$5\),\(\$6,\$7,\$8,\$9,\$10\)`).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+			expectedCode: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, mock, cleanup := testutils.SetupTestDB(t)
+			defer cleanup()
+
+			if tt.expectQuery != nil {
+				tt.expectQuery(mock)
+			}
+
+			req, _ := http.NewRequest(http.MethodPost, "/broadcasts", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			setupRouter("creator-uuid", models.ContentCreator).ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.expectedCode, resp.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCancelBroadcast_AlreadyCompleted(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "broadcasts" WHERE id = \$1 AND creator_id = \$2`).
+		WithArgs("broadcast-uuid", "creator-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "creator_id", "status"}).AddRow("broadcast-uuid", "creator-uuid", "COMPLETED"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "broadcasts" SET "canceled_at"=\$1,"status"=\$2,"updated_at"=\$3 WHERE id = \$4 AND status IN \(\$5,\$6\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	req, _ := http.NewRequest(http.MethodPost, "/broadcasts/broadcast-uuid/cancel", nil)
+	resp := httptest.NewRecorder()
+	setupRouter("creator-uuid", models.ContentCreator).ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -30,6 +30,7 @@ import (
 func CreateCategory(c *gin.Context) {
 	fmt.Println("CreateCategory called")
 	var categoryCreate models.CategoryCreate
+	var pictureVariants models.ImageVariants
 	fmt.Println("categoryCreate initialized")
 
 	contentType := c.GetHeader("Content-Type")
@@ -54,13 +55,14 @@ func CreateCategory(c *gin.Context) {
 		file, err := c.FormFile("picture")
 		fmt.Println("File:", file != nil, "Error:", err)
 		if err == nil && file != nil {
-			imageURL, err := utils.UploadImage(file, "category_pictures", "category")
+			variants, err := utils.UploadPicture(file, "category_pictures", "category")
 			if err != nil {
 				utils.LogError(err, "Error when uploading picture in CreateCategory")
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error uploading picture: " + err.Error()})
 				return
 			}
-			categoryCreate.PictureURL = imageURL
+			categoryCreate.PictureURL = variants.Full
+			pictureVariants = variants
 		} else {
 			utils.LogError(errors.New("picture manquante"), "Picture is required for form data dans CreateCategory")
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Picture is required for form data"})
@@ -89,8 +91,9 @@ func CreateCategory(c *gin.Context) {
 	}
 
 	category := models.Category{
-		Name:       categoryCreate.Name,
-		PictureURL: categoryCreate.PictureURL,
+		Name:            categoryCreate.Name,
+		PictureURL:      categoryCreate.PictureURL,
+		PictureVariants: pictureVariants,
 	}
 	fmt.Println("Creating category:", category)
 
@@ -171,9 +174,7 @@ func DeleteCategory(c *gin.Context) {
 		return
 	}
 
-	if category.PictureURL != "" {
-		_ = utils.DeleteImage(category.PictureURL)
-	}
+	utils.DeletePicture(category.PictureURL, category.PictureVariants)
 
 	result = db.DB.Delete(&category)
 	if result.Error != nil {
@@ -234,17 +235,16 @@ func UpdateCategory(c *gin.Context) {
 
 	file, err := c.FormFile("picture")
 	if err == nil && file != nil {
-		if category.PictureURL != "" {
-			_ = utils.DeleteImage(category.PictureURL)
-		}
-
-		imageURL, err := utils.UploadImage(file, "category_pictures", "category")
+		variants, err := utils.UploadPicture(file, "category_pictures", "category")
 		if err != nil {
 			utils.LogError(err, "Error when uploading picture in UpdateCategory")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error uploading picture: " + err.Error()})
 			return
 		}
-		category.PictureURL = imageURL
+
+		utils.DeletePicture(category.PictureURL, category.PictureVariants)
+		category.PictureURL = variants.Full
+		category.PictureVariants = variants
 	}
 
 	result = db.DB.Save(&category)
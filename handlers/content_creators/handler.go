@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"pec2-backend/db"
 	"pec2-backend/models"
+	"pec2-backend/services/notifications"
 	"pec2-backend/utils"
 	mailsmodels "pec2-backend/utils/mails-models"
 	"strconv"
@@ -426,6 +427,14 @@ func UpdateContentCreatorStatus(c *gin.Context) {
 		Status:      statusUpdate.Status,
 	})
 
+	if statusUpdate.Status != models.ContentCreatorStatusPending {
+		notifications.Notify(notifications.Event{
+			UserID: user.ID,
+			Type:   models.NotificationCreatorApplication,
+			Detail: string(statusUpdate.Status),
+		})
+	}
+
 	utils.LogSuccessWithUser(user.ID, "Content creator status updated successfully in UpdateContentCreatorStatus")
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Status updated successfully",
@@ -692,7 +701,7 @@ func getThreeLastPost(userID any, isSubscriberSearch bool) []models.LastPost {
 }
 
 // @Summary Get advenced statistiques
-// @Description statistic for turnover and count subscribers per date
+// @Description statistic for turnover (subscriptions and tips) and count subscribers per date, with the revenue breakdown of the period
 // @Tags content-creators
 // @Accept json
 // @Produce json
@@ -731,11 +740,21 @@ func GetAdvencedStats(c *gin.Context) {
 	}
 
 	paymentResult := getPaymentsStats(userID, start, end, dateFormat, isGroupedByMonth)
+	tipsResult := getTipsStats(userID, start, end, dateFormat, isGroupedByMonth)
 	subscriptionResult := getSubscriptionCounts(userID, start, end, dateFormat, isGroupedByMonth)
 
+	subscriptionsRevenue := sumSeries(paymentResult)
+	tipsRevenue := sumSeries(tipsResult)
+
 	c.JSON(http.StatusOK, gin.H{
 		"monthlyRevenue": paymentResult,
-		"subscriptions":  subscriptionResult,
+		"tipsRevenue":    tipsResult,
+		"revenueBreakdown": gin.H{
+			"subscriptions": subscriptionsRevenue,
+			"tips":          tipsRevenue,
+			"total":         subscriptionsRevenue + tipsRevenue,
+		},
+		"subscriptions": subscriptionResult,
 	})
 }
 
@@ -765,6 +784,39 @@ func getPaymentsStats(userID any, start time.Time, end time.Time, dateFormat str
 		revenueMap[r.Period] = float64(r.Total) / 100.0
 	}
 
+	return periodSeries(revenueMap, start, end, isGroupedByMonth)
+}
+
+// getTipsStats renvoie les pourboires reçus par période, en euros
+func getTipsStats(userID any, start time.Time, end time.Time, dateFormat string, isGroupedByMonth bool) []models.MonthlyRevenue {
+	var rawResults []struct {
+		Period string
+		Total  int64
+	}
+
+	err := db.DB.
+		Table("tips").
+		Select("TO_CHAR(paid_at, ?) AS period, SUM(amount) AS total", dateFormat).
+		Where("creator_id = ? AND status = ? AND paid_at BETWEEN ? AND ?", userID, models.TipSucceeded, start, end).
+		Group("period").
+		Order("period").
+		Scan(&rawResults).Error
+
+	if err != nil {
+		utils.LogError(err, "Error while fetching tips stats")
+		return nil
+	}
+
+	tipsMap := make(map[string]float64)
+	for _, r := range rawResults {
+		tipsMap[r.Period] = float64(r.Total) / 100.0
+	}
+
+	return periodSeries(tipsMap, start, end, isGroupedByMonth)
+}
+
+// periodSeries renvoie une valeur par jour (ou par mois) de la période, à 0 quand elle manque
+func periodSeries(values map[string]float64, start time.Time, end time.Time, isGroupedByMonth bool) []models.MonthlyRevenue {
 	var results []models.MonthlyRevenue
 	current := start
 
@@ -778,16 +830,24 @@ func getPaymentsStats(userID any, start time.Time, end time.Time, dateFormat str
 			current = current.AddDate(0, 0, 1)
 		}
 
-		total := revenueMap[label]
 		results = append(results, models.MonthlyRevenue{
 			Month: label,
-			Total: total,
+			Total: values[label],
 		})
 	}
 
 	return results
 }
 
+// sumSeries additionne les valeurs d'une série
+func sumSeries(series []models.MonthlyRevenue) float64 {
+	total := 0.0
+	for _, point := range series {
+		total += point.Total
+	}
+	return total
+}
+
 func getSubscriptionCounts(userID any, start time.Time, end time.Time, dateFormat string, isGroupedByMonth bool) []models.MonthlyRevenue {
 	var rawResults []struct {
 		Period string
@@ -812,27 +872,7 @@ func getSubscriptionCounts(userID any, start time.Time, end time.Time, dateForma
 		subscriptionMap[r.Period] = float64(r.Count)
 	}
 
-	var results []models.MonthlyRevenue
-	current := start
-
-	for !current.After(end) {
-		var label string
-		if isGroupedByMonth {
-			label = current.Format("2006-01")
-			current = current.AddDate(0, 1, 0)
-		} else {
-			label = current.Format("2006-01-02")
-			current = current.AddDate(0, 0, 1)
-		}
-
-		count := subscriptionMap[label]
-		results = append(results, models.MonthlyRevenue{
-			Month: label,
-			Total: count,
-		})
-	}
-
-	return results
+	return periodSeries(subscriptionMap, start, end, isGroupedByMonth)
 }
 
 // @Summary Get creator inscription
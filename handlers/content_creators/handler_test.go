@@ -11,6 +11,7 @@ import (
 	"os"
 	"pec2-backend/testutils"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -404,3 +405,16 @@ func TestUpdateContentCreatorInfo_SiretAlreadyUsed(t *testing.T) {
 	json.Unmarshal(resp.Body.Bytes(), &response)
 	assert.Equal(t, "This SIRET number is already registered by another content creator", response["error"])
 }
+
+func TestPeriodSeries_FillsMissingDays(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC)
+
+	series := periodSeries(map[string]float64{"2026-03-02": 12.5}, start, end, false)
+
+	assert.Len(t, series, 3)
+	assert.Equal(t, "2026-03-01", series[0].Month)
+	assert.Equal(t, 0.0, series[0].Total)
+	assert.Equal(t, 12.5, series[1].Total)
+	assert.Equal(t, 12.5, sumSeries(series))
+}
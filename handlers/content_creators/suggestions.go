@@ -0,0 +1,52 @@
+package content_creators
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"pec2-backend/services/suggestions"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Suggested creators
+// @Description Creators suggested to the authenticated user, ranked by the people they follow, the categories of the posts they liked and the creators' popularity. Followed, blocked and disabled creators are never suggested
+// @Tags content-creators
+// @Produce json
+// @Param limit query integer false "Number of suggestions (default: 10, max: 20)"
+// @Security BearerAuth
+// @Success 200 {array} models.CreatorSuggestionResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 500 {object} map[string]string "error: Error retrieving suggestions"
+// @Router /content-creators/suggestions [get]
+func GetSuggestedCreators(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated in GetSuggestedCreators")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	limit := 10
+	if limitParam := c.Query("limit"); limitParam != "" {
+		fmt.Sscanf(limitParam, "%d", &limit)
+		if limit <= 0 {
+			limit = 10
+		}
+		if limit > 20 {
+			limit = 20
+		}
+	}
+
+	creators, err := suggestions.ForUser(userID.(string), limit, time.Now())
+	if err != nil {
+		utils.LogError(err, "Error retrieving suggestions in GetSuggestedCreators")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving suggestions"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Suggested creators retrieved in GetSuggestedCreators")
+	c.JSON(http.StatusOK, creators)
+}
@@ -0,0 +1,238 @@
+package media
+
+import (
+	"net/http"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/access"
+	mediaService "pec2-backend/services/media"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var allowedSizes = map[string]bool{
+	"full":      true,
+	"feed":      true,
+	"thumbnail": true,
+}
+
+// @Summary Get the picture of a post
+// @Description Serve the picture of a post, authenticated by JWT or by a short-lived signed URL (from post responses).
+// @Description Paid pictures are only delivered to entitled viewers, with a watermark (platform logo + viewer username)
+// @Tags media
+// @Produce image/jpeg,image/png
+// @Param id path string true "Post ID"
+// @Param size query string false "Picture size (full, feed, thumbnail)" default(full)
+// @Param token query string false "JWT Token for web clients (optional)"
+// @Param viewer query string false "Viewer ID bound to the signed URL"
+// @Param expires query int false "Expiration timestamp of the signed URL"
+// @Param sig query string false "HMAC signature of the URL"
+// @Security BearerAuth
+// @Success 200 {file} binary
+// @Success 302 "Redirect to the public picture for free posts"
+// @Failure 400 {object} map[string]string "error: Invalid size"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Subscription required / invalid signature / signed URL expired"
+// @Failure 404 {object} map[string]string "error: Post not found"
+// @Failure 500 {object} map[string]string "error: Error message"
+// @Router /media/posts/{id} [get]
+func GetPostMedia(c *gin.Context) {
+	postID := c.Param("id")
+	size := c.DefaultQuery("size", "full")
+	if !allowedSizes[size] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid size, expected: full, feed or thumbnail"})
+		return
+	}
+
+	role, _ := c.Get("role")
+	roleStr, _ := role.(string)
+	authUserID, _ := c.Get("user_id")
+	authUserIDStr, _ := authUserID.(string)
+
+	// URL signée : le lecteur est celui pour qui l'URL a été émise
+	viewerID := authUserIDStr
+	if signature := c.Query("sig"); signature != "" {
+		signedViewer := c.Query("viewer")
+		if err := mediaService.VerifySignedPostURL(postID, size, signedViewer, c.Query("expires"), signature); err != nil {
+			utils.LogError(err, "Invalid signed URL in GetPostMedia")
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if authUserIDStr != "" && authUserIDStr != signedViewer {
+			utils.LogError(nil, "Signed URL used by another user in GetPostMedia")
+			c.JSON(http.StatusForbidden, gin.H{"error": "Signed URL issued for another user"})
+			return
+		}
+		viewerID = signedViewer
+	}
+
+	if viewerID == "" {
+		utils.LogError(nil, "No token or signature in GetPostMedia")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var post models.Post
+	if err := db.DB.First(&post, "id = ?", postID).Error; err != nil {
+		utils.LogError(err, "Post not found in GetPostMedia")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	if post.PictureURL == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post has no picture"})
+		return
+	}
+
+	var viewer models.User
+	if err := db.DB.First(&viewer, "id = ?", viewerID).Error; err != nil {
+		utils.LogError(err, "Viewer not found in GetPostMedia")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Sans JWT (URL signée), le rôle vient de la base
+	if roleStr == "" {
+		roleStr = string(viewer.Role)
+	}
+
+	canView, err := access.CanViewPost(viewerID, roleStr, post)
+	if err != nil {
+		utils.LogError(err, "Error checking access in GetPostMedia")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking access: " + err.Error()})
+		return
+	}
+	if !canView {
+		utils.LogError(nil, "Access denied to post media in GetPostMedia")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Subscription required"})
+		return
+	}
+
+	// Les images gratuites restent publiques, pas besoin de filigrane
+	if post.IsFree {
+		c.Redirect(http.StatusFound, mediaService.SourceURL(post, size))
+		return
+	}
+
+	data, contentType, err := mediaService.WatermarkedPicture(post, size, viewer)
+	if err != nil {
+		utils.LogError(err, "Error rendering watermarked picture in GetPostMedia")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error rendering picture: " + err.Error()})
+		return
+	}
+
+	// Image propre à chaque abonné : aucun cache partagé (CDN, proxy)
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Header("Vary", "Authorization")
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// @Summary Get a private message attachment
+// @Description Serve the picture attached to a private message, authenticated by JWT or by a short-lived signed URL (from message responses).
+// @Description Only the sender and the receiver can see it; a paid picture must be unlocked by the receiver first and is watermarked for them
+// @Tags media
+// @Produce image/jpeg,image/png
+// @Param id path string true "Attachment ID"
+// @Param size query string false "Picture size (full, feed, thumbnail)" default(full)
+// @Param token query string false "JWT Token for web clients (optional)"
+// @Param viewer query string false "Viewer ID bound to the signed URL"
+// @Param expires query int false "Expiration timestamp of the signed URL"
+// @Param sig query string false "HMAC signature of the URL"
+// @Security BearerAuth
+// @Success 200 {file} binary
+// @Success 302 "Redirect to the picture for free attachments"
+// @Failure 400 {object} map[string]string "error: Invalid size"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Attachment locked / invalid signature / signed URL expired"
+// @Failure 404 {object} map[string]string "error: Attachment not found"
+// @Failure 500 {object} map[string]string "error: Error message"
+// @Router /media/messages/{id} [get]
+func GetMessageAttachmentMedia(c *gin.Context) {
+	attachmentID := c.Param("id")
+	size := c.DefaultQuery("size", "full")
+	if !allowedSizes[size] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid size, expected: full, feed or thumbnail"})
+		return
+	}
+
+	role, _ := c.Get("role")
+	roleStr, _ := role.(string)
+	authUserID, _ := c.Get("user_id")
+	authUserIDStr, _ := authUserID.(string)
+
+	viewerID := authUserIDStr
+	if signature := c.Query("sig"); signature != "" {
+		signedViewer := c.Query("viewer")
+		if err := mediaService.VerifySignedAttachmentURL(attachmentID, size, signedViewer, c.Query("expires"), signature); err != nil {
+			utils.LogError(err, "Invalid signed URL in GetMessageAttachmentMedia")
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if authUserIDStr != "" && authUserIDStr != signedViewer {
+			utils.LogError(nil, "Signed URL used by another user in GetMessageAttachmentMedia")
+			c.JSON(http.StatusForbidden, gin.H{"error": "Signed URL issued for another user"})
+			return
+		}
+		viewerID = signedViewer
+	}
+
+	if viewerID == "" {
+		utils.LogError(nil, "No token or signature in GetMessageAttachmentMedia")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var attachment models.MessageAttachment
+	if err := db.DB.First(&attachment, "id = ?", attachmentID).Error; err != nil {
+		utils.LogError(err, "Attachment not found in GetMessageAttachmentMedia")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+
+	var viewer models.User
+	if err := db.DB.First(&viewer, "id = ?", viewerID).Error; err != nil {
+		utils.LogError(err, "Viewer not found in GetMessageAttachmentMedia")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if roleStr == "" {
+		roleStr = string(viewer.Role)
+	}
+
+	// Une conversation privée ne se dévoile pas aux autres utilisateurs
+	if viewerID != attachment.SenderID && viewerID != attachment.ReceiverID && roleStr != string(models.AdminRole) {
+		utils.LogError(nil, "Attachment requested by a non participant in GetMessageAttachmentMedia")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+
+	canView, err := access.CanViewAttachment(viewerID, roleStr, attachment)
+	if err != nil {
+		utils.LogError(err, "Error checking access in GetMessageAttachmentMedia")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking access: " + err.Error()})
+		return
+	}
+	if !canView {
+		utils.LogError(nil, "Locked attachment in GetMessageAttachmentMedia")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Attachment locked, unlock it first"})
+		return
+	}
+
+	// Image gratuite, ou vue par son expéditeur : pas de filigrane
+	if attachment.Price == 0 || viewerID == attachment.SenderID {
+		c.Redirect(http.StatusFound, mediaService.AttachmentSourceURL(attachment, size))
+		return
+	}
+
+	data, contentType, err := mediaService.WatermarkedAttachment(attachment, size, viewer)
+	if err != nil {
+		utils.LogError(err, "Error rendering watermarked picture in GetMessageAttachmentMedia")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error rendering picture: " + err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Header("Vary", "Authorization")
+	c.Data(http.StatusOK, contentType, data)
+}
@@ -0,0 +1,376 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	mediaService "pec2-backend/services/media"
+	"pec2-backend/testutils"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	testutils.InitTestMain()
+
+	log.SetOutput(io.Discard)
+
+	exitCode := m.Run()
+
+	log.SetOutput(os.Stdout)
+
+	os.Exit(exitCode)
+}
+
+func setupMediaRouter(userID string, role string) *gin.Engine {
+	router := testutils.SetupTestRouter()
+	router.GET("/media/posts/:id", func(c *gin.Context) {
+		if userID != "" {
+			c.Set("user_id", userID)
+			c.Set("role", role)
+		}
+		GetPostMedia(c)
+	})
+	return router
+}
+
+func postRows(mock sqlmock.Sqlmock, pictureURL string, isFree bool) *sqlmock.Rows {
+	return mock.NewRows([]string{"id", "user_id", "name", "picture_url", "picture_full", "is_free", "enable"}).
+		AddRow("post-uuid", "creator-uuid", "Post", pictureURL, pictureURL, isFree, true)
+}
+
+func expectViewer(mock sqlmock.Sqlmock, userID string, role string) {
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).
+		WithArgs(userID, 1).
+		WillReturnRows(mock.NewRows([]string{"id", "user_name", "role"}).AddRow(userID, "subscriber42", role))
+}
+
+func expectNotBlocked(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks"`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+	expectOwner(mock, false)
+}
+
+func expectOwner(mock sqlmock.Sqlmock, privateProfile bool) {
+	mock.ExpectQuery(`SELECT "id","private_profile" FROM "users" WHERE id = \$1`).
+		WithArgs("creator-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "private_profile"}).AddRow("creator-uuid", privateProfile))
+}
+
+func TestGetPostMedia_FreePostRedirects(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "posts" WHERE id = \$1`).
+		WithArgs("post-uuid", 1).
+		WillReturnRows(postRows(mock, "http://example.com/free.jpg", true))
+	expectViewer(mock, "viewer-uuid", "USER")
+	expectNotBlocked(mock)
+
+	router := setupMediaRouter("viewer-uuid", "USER")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/media/posts/post-uuid", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "http://example.com/free.jpg", w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPostMedia_PaidPostWithoutSubscription(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "posts" WHERE id = \$1`).
+		WithArgs("post-uuid", 1).
+		WillReturnRows(postRows(mock, "http://example.com/paid.jpg", false))
+	expectViewer(mock, "viewer-uuid", "USER")
+	expectNotBlocked(mock)
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "subscriptions"`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+
+	router := setupMediaRouter("viewer-uuid", "USER")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/media/posts/post-uuid", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Subscription required")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPostMedia_PaidPostWatermarked(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	original := image.NewRGBA(image.Rect(0, 0, 600, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 600; x++ {
+			original.Set(x, y, color.RGBA{R: 20, G: 20, B: 20, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, original))
+
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(buf.Bytes())
+	}))
+	defer storage.Close()
+
+	mock.ExpectQuery(`SELECT \* FROM "posts" WHERE id = \$1`).
+		WithArgs("post-uuid", 1).
+		WillReturnRows(postRows(mock, storage.URL+"/paid.png", false))
+	expectViewer(mock, "viewer-uuid", "USER")
+	expectNotBlocked(mock)
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "subscriptions"`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+
+	router := setupMediaRouter("viewer-uuid", "USER")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/media/posts/post-uuid", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Cache-Control"), "private")
+	assert.NotEqual(t, buf.Bytes(), w.Body.Bytes())
+
+	rendered, _, err := image.Decode(bytes.NewReader(w.Body.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, 600, rendered.Bounds().Dx())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPostMedia_BlockedViewer(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "posts" WHERE id = \$1`).
+		WithArgs("post-uuid", 1).
+		WillReturnRows(postRows(mock, "http://example.com/free.jpg", true))
+	expectViewer(mock, "viewer-uuid", "USER")
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks"`).
+		WithArgs("viewer-uuid", "creator-uuid", "creator-uuid", "viewer-uuid").
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+
+	router := setupMediaRouter("viewer-uuid", "USER")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/media/posts/post-uuid", nil)
+	router.ServeHTTP(w, req)
+
+	// Même un post gratuit n'est pas servi entre utilisateurs bloqués
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPostMedia_PrivateProfile(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "posts" WHERE id = \$1`).
+		WithArgs("post-uuid", 1).
+		WillReturnRows(postRows(mock, "http://example.com/free.jpg", true))
+	expectViewer(mock, "viewer-uuid", "USER")
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks"`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+	expectOwner(mock, true)
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_follows"`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "subscriptions"`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+
+	router := setupMediaRouter("viewer-uuid", "USER")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/media/posts/post-uuid", nil)
+	router.ServeHTTP(w, req)
+
+	// Un post gratuit d'un profil privé reste réservé aux followers et abonnés
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPostMedia_SignedURL(t *testing.T) {
+	t.Setenv("MEDIA_SIGNING_SECRET", "test-secret")
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	signedURL := mediaService.SignedPostURL("post-uuid", "feed", "viewer-uuid")
+	path := strings.TrimPrefix(signedURL, os.Getenv("API_PUBLIC_URL"))
+
+	mock.ExpectQuery(`SELECT \* FROM "posts" WHERE id = \$1`).
+		WithArgs("post-uuid", 1).
+		WillReturnRows(postRows(mock, "http://example.com/paid.jpg", false))
+	expectViewer(mock, "viewer-uuid", "USER")
+	expectNotBlocked(mock)
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "subscriptions"`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+
+	// Pas de JWT : la signature suffit pour identifier le lecteur
+	router := setupMediaRouter("", "")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	router.ServeHTTP(w, req)
+
+	// Signature valide mais plus d'abonnement actif
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Subscription required")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPostMedia_SignedURLRejected(t *testing.T) {
+	t.Setenv("MEDIA_SIGNING_SECRET", "test-secret")
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	signedURL := mediaService.SignedPostURL("post-uuid", "feed", "viewer-uuid")
+	path := strings.TrimPrefix(signedURL, os.Getenv("API_PUBLIC_URL"))
+
+	tests := []struct {
+		name     string
+		userID   string
+		path     string
+		expected string
+	}{
+		{"Tampered size", "", strings.Replace(path, "size=feed", "size=full", 1), "invalid signature"},
+		{"Other viewer", "", strings.Replace(path, "viewer=viewer-uuid", "viewer=other-uuid", 1), "invalid signature"},
+		{"Forged signature", "", "/media/posts/post-uuid?size=full&viewer=viewer-uuid&expires=1&sig=abc", "invalid signature"},
+		{"Used by another user", "other-uuid", path, "Signed URL issued for another user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupMediaRouter(tt.userID, "")
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			assert.Contains(t, w.Body.String(), tt.expected)
+		})
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func setupAttachmentRouter(userID string, role string) *gin.Engine {
+	router := testutils.SetupTestRouter()
+	router.GET("/media/messages/:id", func(c *gin.Context) {
+		if userID != "" {
+			c.Set("user_id", userID)
+			c.Set("role", role)
+		}
+		GetMessageAttachmentMedia(c)
+	})
+	return router
+}
+
+func attachmentRows(mock sqlmock.Sqlmock, price int) *sqlmock.Rows {
+	return mock.NewRows([]string{"id", "message_id", "sender_id", "receiver_id", "picture_url", "picture_full", "price"}).
+		AddRow("attachment-uuid", "message-uuid", "creator-uuid", "receiver-uuid", "http://example.com/dm.jpg", "http://example.com/dm.jpg", price)
+}
+
+func TestGetMessageAttachmentMedia_LockedForReceiver(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "message_attachments" WHERE id = \$1`).
+		WithArgs("attachment-uuid", 1).
+		WillReturnRows(attachmentRows(mock, 500))
+	expectViewer(mock, "receiver-uuid", "USER")
+	mock.ExpectQuery(`SELECT "attachment_id" FROM "message_unlocks" WHERE user_id = \$1 AND attachment_id IN \(\$2\) AND status = \$3`).
+		WithArgs("receiver-uuid", "attachment-uuid", "SUCCEEDED").
+		WillReturnRows(mock.NewRows([]string{"attachment_id"}))
+
+	router := setupAttachmentRouter("receiver-uuid", "USER")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/media/messages/attachment-uuid", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetMessageAttachmentMedia_HiddenFromOtherUsers(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "message_attachments" WHERE id = \$1`).
+		WithArgs("attachment-uuid", 1).
+		WillReturnRows(attachmentRows(mock, 0))
+	expectViewer(mock, "stranger-uuid", "USER")
+
+	router := setupAttachmentRouter("stranger-uuid", "USER")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/media/messages/attachment-uuid", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetMessageAttachmentMedia_FreeAttachmentWithSignedURL(t *testing.T) {
+	t.Setenv("MEDIA_SIGNING_SECRET", "test-secret")
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "message_attachments" WHERE id = \$1`).
+		WithArgs("attachment-uuid", 1).
+		WillReturnRows(attachmentRows(mock, 0))
+	expectViewer(mock, "receiver-uuid", "USER")
+
+	// Une URL signée pour un post ne donne pas accès à une pièce jointe de même identifiant
+	postURL := mediaService.SignedPostURL("attachment-uuid", "full", "receiver-uuid")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/media/messages/attachment-uuid"+postURL[strings.Index(postURL, "?"):], nil)
+	setupAttachmentRouter("", "").ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	signedURL := mediaService.SignedAttachmentURL("attachment-uuid", "full", "receiver-uuid")
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/media/messages/attachment-uuid"+signedURL[strings.Index(signedURL, "?"):], nil)
+	setupAttachmentRouter("", "").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "http://example.com/dm.jpg", w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPostMedia_SubscriptionTierTooLow(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "posts" WHERE id = \$1`).
+		WithArgs("post-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "user_id", "name", "picture_url", "picture_full", "is_free", "enable", "min_tier_id"}).
+			AddRow("post-uuid", "creator-uuid", "Post", "http://example.com/vip.jpg", "http://example.com/vip.jpg", false, true, "vip-tier-uuid"))
+	expectViewer(mock, "viewer-uuid", "USER")
+	expectNotBlocked(mock)
+	mock.ExpectQuery(`SELECT \* FROM "subscription_tiers" WHERE id = \$1`).
+		WithArgs("vip-tier-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "creator_id", "rank"}).AddRow("vip-tier-uuid", "creator-uuid", 2))
+	// Abonné au niveau 1 seulement
+	mock.ExpectQuery(`SELECT \* FROM "subscriptions" WHERE user_id = \$1 AND content_creator_id = \$2`).
+		WillReturnRows(mock.NewRows([]string{"id", "user_id", "content_creator_id", "status", "tier_id"}).
+			AddRow("sub-uuid", "viewer-uuid", "creator-uuid", "ACTIVE", "premium-tier-uuid"))
+	mock.ExpectQuery(`SELECT \* FROM "subscription_tiers" WHERE id IN \(\$1\)`).
+		WithArgs("premium-tier-uuid").
+		WillReturnRows(mock.NewRows([]string{"id", "creator_id", "rank"}).AddRow("premium-tier-uuid", "creator-uuid", 1))
+
+	router := setupMediaRouter("viewer-uuid", "USER")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/media/posts/post-uuid", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,205 @@
+package notifications
+
+import (
+	"net/http"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	notificationsService "pec2-backend/services/notifications"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get my notifications
+// @Description Retrieve the notifications of the authenticated user, most recent activity first. Similar unread events are grouped (actorsCount) and a ready-to-display message is provided
+// @Tags notifications
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of notifications per page" default(20)
+// @Param unread query bool false "Only unread notifications"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "notifications, unreadCount, pagination"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 500 {object} map[string]string "error: Error retrieving notifications"
+// @Router /notifications [get]
+func GetNotifications(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not found in token in GetNotifications")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in token"})
+		return
+	}
+
+	page, limit := utils.GetPagination(c)
+
+	query := db.DB.Model(&models.Notification{}).Where("user_id = ?", userID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		utils.LogError(err, "Error counting notifications in GetNotifications")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving notifications"})
+		return
+	}
+
+	var notifications []models.Notification
+	if err := query.Order("updated_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&notifications).Error; err != nil {
+		utils.LogError(err, "Error retrieving notifications in GetNotifications")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving notifications"})
+		return
+	}
+
+	responses, err := notificationsService.BuildResponses(notifications)
+	if err != nil {
+		utils.LogError(err, "Error retrieving notification actors in GetNotifications")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving notifications"})
+		return
+	}
+
+	var unreadCount int64
+	if err := db.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unreadCount).Error; err != nil {
+		utils.LogError(err, "Error counting unread notifications in GetNotifications")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving notifications"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Notifications retrieved successfully in GetNotifications")
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": responses,
+		"unreadCount":   unreadCount,
+		"pagination":    utils.PaginationResponse(total, page, limit),
+	})
+}
+
+// @Summary Get my unread notifications count
+// @Description Number of unread notifications of the authenticated user (badge)
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]int64 "unreadCount"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 500 {object} map[string]string "error: Error counting notifications"
+// @Router /notifications/unread-count [get]
+func GetUnreadCount(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not found in token in GetUnreadCount")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in token"})
+		return
+	}
+
+	var unreadCount int64
+	if err := db.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unreadCount).Error; err != nil {
+		utils.LogError(err, "Error counting notifications in GetUnreadCount")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unreadCount": unreadCount})
+}
+
+// @Summary Mark a notification as read
+// @Description Mark one notification of the authenticated user as read
+// @Tags notifications
+// @Produce json
+// @Param id path string true "Notification ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message: Notification marked as read"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Notification not found"
+// @Failure 500 {object} map[string]string "error: Error updating notification"
+// @Router /notifications/{id}/read [patch]
+func MarkAsRead(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not found in token in MarkAsRead")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in token"})
+		return
+	}
+
+	var notification models.Notification
+	if err := db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&notification).Error; err != nil {
+		utils.LogError(err, "Notification not found in MarkAsRead")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	if notification.ReadAt == nil {
+		if err := db.DB.Model(&notification).UpdateColumn("read_at", time.Now()).Error; err != nil {
+			utils.LogError(err, "Error updating notification in MarkAsRead")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating notification"})
+			return
+		}
+	}
+
+	utils.LogSuccessWithUser(userID, "Notification marked as read in MarkAsRead")
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+// @Summary Mark all my notifications as read
+// @Description Mark every unread notification of the authenticated user as read
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "message, updated"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 500 {object} map[string]string "error: Error updating notifications"
+// @Router /notifications/read-all [patch]
+func MarkAllAsRead(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not found in token in MarkAllAsRead")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in token"})
+		return
+	}
+
+	result := db.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).UpdateColumn("read_at", time.Now())
+	if result.Error != nil {
+		utils.LogError(result.Error, "Error updating notifications in MarkAllAsRead")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating notifications"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Notifications marked as read in MarkAllAsRead")
+	c.JSON(http.StatusOK, gin.H{"message": "Notifications marked as read", "updated": result.RowsAffected})
+}
+
+// @Summary Unsubscribe from the activity digest
+// @Description One-click unsubscribe link included in the digest emails. The link is signed and expires after 60 days, no authentication is needed. POST is supported for mail clients implementing List-Unsubscribe-Post
+// @Tags notifications
+// @Produce html
+// @Param user query string true "User ID"
+// @Param expires query integer true "Expiration of the link (Unix timestamp)"
+// @Param token query string true "Signed unsubscribe token"
+// @Success 200 {string} string "Unsubscribed"
+// @Failure 400 {object} map[string]string "error: Invalid unsubscribe link"
+// @Failure 500 {object} map[string]string "error: Error updating notification settings"
+// @Router /notifications/digest/unsubscribe [get]
+func UnsubscribeFromDigest(c *gin.Context) {
+	userID := c.Query("user")
+	if !notificationsService.VerifyUnsubscribeToken(userID, c.Query("expires"), c.Query("token")) {
+		utils.LogError(nil, "Invalid unsubscribe link in UnsubscribeFromDigest")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid unsubscribe link"})
+		return
+	}
+
+	if err := notificationsService.UnsubscribeFromDigest(userID); err != nil {
+		utils.LogError(err, "Error updating notification settings in UnsubscribeFromDigest")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating notification settings"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "User unsubscribed from the digest in UnsubscribeFromDigest")
+	if c.Request.Method == http.MethodPost {
+		c.JSON(http.StatusOK, gin.H{"message": "Unsubscribed from the digest"})
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<!DOCTYPE html><html><body style="font-family: sans-serif; text-align: center; padding: 40px;">`+
+		`<h1 style="color: #722ED1;">Désinscription confirmée</h1>`+
+		`<p>Vous ne recevrez plus l'email récapitulatif de votre activité OnlyFlick. Vous pouvez le réactiver depuis vos paramètres.</p>`+
+		`</body></html>`))
+}
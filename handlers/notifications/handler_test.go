@@ -0,0 +1,218 @@
+package notifications
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	notificationsService "pec2-backend/services/notifications"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	testutils.InitTestMain()
+
+	log.SetOutput(io.Discard)
+
+	exitCode := m.Run()
+
+	log.SetOutput(os.Stdout)
+
+	os.Exit(exitCode)
+}
+
+func setupRouter(userID string) *gin.Engine {
+	r := testutils.SetupTestRouter()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Next()
+	})
+	r.GET("/notifications", GetNotifications)
+	r.GET("/notifications/unread-count", GetUnreadCount)
+	r.PATCH("/notifications/read-all", MarkAllAsRead)
+	r.PATCH("/notifications/:id/read", MarkAsRead)
+	return r
+}
+
+func TestGetNotifications(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "notifications" WHERE user_id = \$1 AND read_at IS NULL`).
+		WithArgs("user-uuid").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT \* FROM "notifications" WHERE user_id = \$1 AND read_at IS NULL ORDER BY updated_at DESC LIMIT \$2`).
+		WithArgs("user-uuid", 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "type", "actor_id", "actors_count", "post_id", "updated_at"}).
+			AddRow("notification-uuid", "user-uuid", "post_liked", "liker-uuid", 3, "post-uuid", time.Now()))
+	mock.ExpectQuery(`SELECT id, user_name, profile_picture FROM "users" WHERE id IN \(\$1\)`).
+		WithArgs("liker-uuid").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_name", "profile_picture"}).AddRow("liker-uuid", "alice", ""))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "notifications" WHERE user_id = \$1 AND read_at IS NULL`).
+		WithArgs("user-uuid").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	req, _ := http.NewRequest(http.MethodGet, "/notifications?unread=true", nil)
+	resp := httptest.NewRecorder()
+	setupRouter("user-uuid").ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var response struct {
+		Notifications []map[string]any `json:"notifications"`
+		UnreadCount   int              `json:"unreadCount"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.UnreadCount)
+	assert.Len(t, response.Notifications, 1)
+	assert.Equal(t, "alice and 2 others liked your post", response.Notifications[0]["message"])
+	assert.Equal(t, false, response.Notifications[0]["read"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetUnreadCount(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "notifications" WHERE user_id = \$1 AND read_at IS NULL`).
+		WithArgs("user-uuid").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+
+	req, _ := http.NewRequest(http.MethodGet, "/notifications/unread-count", nil)
+	resp := httptest.NewRecorder()
+	setupRouter("user-uuid").ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"unreadCount":4}`, resp.Body.String())
+}
+
+func TestMarkAsRead_NotFound(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "notifications" WHERE id = \$1 AND user_id = \$2`).
+		WithArgs("notification-uuid", "user-uuid", 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	req, _ := http.NewRequest(http.MethodPatch, "/notifications/notification-uuid/read", nil)
+	resp := httptest.NewRecorder()
+	setupRouter("user-uuid").ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMarkAllAsRead(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "notifications" SET "read_at"=\$1 WHERE user_id = \$2 AND read_at IS NULL`).
+		WithArgs(sqlmock.AnyArg(), "user-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	req, _ := http.NewRequest(http.MethodPatch, "/notifications/read-all", nil)
+	resp := httptest.NewRecorder()
+	setupRouter("user-uuid").ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"updated":3`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnsubscribeFromDigest(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+	t.Setenv("UNSUBSCRIBE_SECRET", "test-secret")
+
+	mock.ExpectQuery(`SELECT "id",.* FROM "users" WHERE id = \$1`).
+		WithArgs("user-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "notify_digest_frequency"}).AddRow("user-uuid", "weekly"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET "notify_digest_frequency"=\$1,"updated_at"=\$2 WHERE id = \$3`).
+		WithArgs("none", sqlmock.AnyArg(), "user-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	r := testutils.SetupTestRouter()
+	r.GET("/notifications/digest/unsubscribe", UnsubscribeFromDigest)
+
+	unsubscribeURL, err := notificationsService.UnsubscribeURL("user-uuid")
+	assert.NoError(t, err)
+	req, _ := http.NewRequest(http.MethodGet, strings.TrimPrefix(unsubscribeURL, os.Getenv("API_PUBLIC_URL")), nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "Désinscription confirmée")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnsubscribeFromDigest_InvalidToken(t *testing.T) {
+	t.Setenv("UNSUBSCRIBE_SECRET", "test-secret")
+
+	r := testutils.SetupTestRouter()
+	r.POST("/notifications/digest/unsubscribe", UnsubscribeFromDigest)
+
+	valid := time.Now().Add(time.Hour).Unix()
+	otherToken, _ := notificationsService.UnsubscribeToken("other-uuid", valid)
+	expired := time.Now().Add(-time.Hour).Unix()
+	expiredToken, _ := notificationsService.UnsubscribeToken("user-uuid", expired)
+
+	tests := []struct {
+		name    string
+		expires int64
+		token   string
+	}{
+		{"Token of another user", valid, otherToken},
+		{"Expired link", expired, expiredToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/notifications/digest/unsubscribe?user=user-uuid&expires=%d&token=%s", tt.expires, tt.token), nil)
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		})
+	}
+}
+
+func TestUnsubscribeFromDigest_NoSecret(t *testing.T) {
+	t.Setenv("UNSUBSCRIBE_SECRET", "")
+	t.Setenv("JWT_SECRET", "")
+
+	_, err := notificationsService.UnsubscribeURL("user-uuid")
+	assert.ErrorIs(t, err, notificationsService.ErrUnsubscribeDisabled)
+
+	// Un jeton calculé avec une clé vide est refusé
+	expires := time.Now().Add(time.Hour).Unix()
+	mac := hmac.New(sha256.New, nil)
+	fmt.Fprintf(mac, "digest-unsubscribe|%s|%d", "user-uuid", expires)
+	forged := hex.EncodeToString(mac.Sum(nil))
+
+	r := testutils.SetupTestRouter()
+	r.GET("/notifications/digest/unsubscribe", UnsubscribeFromDigest)
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/notifications/digest/unsubscribe?user=user-uuid&expires=%d&token=%s", expires, forged), nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
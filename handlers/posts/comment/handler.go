@@ -2,25 +2,24 @@ package comment
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"pec2-backend/db"
 	"pec2-backend/models"
+	"pec2-backend/services/access"
+	"pec2-backend/services/notifications"
+	"pec2-backend/services/realtime"
 	"pec2-backend/utils"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-var (
-	// Clients connectés au SSE, mappé par postID
-	clients = make(map[string]map[chan string]bool)
-
-	// Mutex pour protéger l'accès à la map clients
-	clientsMutex sync.RWMutex
-)
+// commentsTopic est le topic du broker temps réel pour les commentaires d'un post
+func commentsTopic(postID string) string {
+	return "post:" + postID + ":comments"
+}
 
 // Message SSE
 type SSEMessage struct {
@@ -30,15 +29,129 @@ type SSEMessage struct {
 
 // Commentaire à envoyer via SSE
 type SSEComment struct {
-	ID            string `json:"id"`
-	PostID        string `json:"postId"`
-	UserID        string `json:"userId"`
-	Content       string `json:"content"`
-	UserName      string `json:"userName"`
-	CreatedAt     string `json:"createdAt"`
-	CommentsCount int    `json:"commentsCount"`
+	ID       string  `json:"id"`
+	PostID   string  `json:"postId"`
+	UserID   string  `json:"userId"`
+	ParentID *string `json:"parentId"`
+	Depth    int     `json:"depth"`
+	Content  string  `json:"content"`
+	UserName string  `json:"userName"`
+	// Nombre de réponses directes au commentaire
+	RepliesCount int    `json:"repliesCount"`
+	CreatedAt    string `json:"createdAt"`
+	// Nombre total de commentaires du post, renseigné lors de la diffusion d'un nouveau commentaire
+	PostCommentsCount int     `json:"postCommentsCount"`
+	Edited            bool    `json:"edited"`
+	EditedAt          *string `json:"editedAt"`
+	Hidden            bool    `json:"hidden"`
+	Deleted           bool    `json:"deleted"`
+}
+
+// toSSEComments convertit des commentaires en réponse API en récupérant les noms d'utilisateurs en une requête
+func toSSEComments(comments []models.Comment) []SSEComment {
+	response := make([]SSEComment, 0, len(comments))
+	if len(comments) == 0 {
+		return response
+	}
+
+	userIDs := make([]string, 0, len(comments))
+	for _, comment := range comments {
+		userIDs = append(userIDs, comment.UserID)
+	}
+
+	var users []models.User
+	if err := db.DB.Select("id, user_name").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		utils.LogError(err, "Error retrieving comment authors in toSSEComments")
+	}
+	userNames := make(map[string]string, len(users))
+	for _, user := range users {
+		userNames[user.ID] = user.UserName
+	}
+
+	for _, comment := range comments {
+		response = append(response, toSSEComment(comment, userNames[comment.UserID]))
+	}
+	return response
+}
+
+func toSSEComment(comment models.Comment, userName string) SSEComment {
+	sseComment := SSEComment{
+		ID:           comment.ID,
+		PostID:       comment.PostID,
+		UserID:       comment.UserID,
+		ParentID:     comment.ParentID,
+		Depth:        comment.Depth,
+		Content:      comment.Content,
+		UserName:     userName,
+		RepliesCount: comment.CommentsCount,
+		CreatedAt:    comment.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Hidden:       comment.HiddenAt != nil,
+	}
+	if comment.EditedAt != nil {
+		editedAt := comment.EditedAt.Format("2006-01-02T15:04:05Z07:00")
+		sseComment.Edited = true
+		sseComment.EditedAt = &editedAt
+	}
+	// Commentaire supprimé conservé pour ses réponses : on n'expose plus ni le contenu ni l'auteur
+	if comment.DeletedAt != nil {
+		sseComment.Deleted = true
+		sseComment.Content = ""
+		sseComment.UserID = ""
+		sseComment.UserName = ""
+	}
+	return sseComment
+}
+
+// canModerate indique si l'utilisateur peut masquer ou supprimer les commentaires du post (auteur du post ou admin)
+func canModerate(post models.Post, userID string, role string) bool {
+	return userID != "" && (userID == post.UserID || role == string(models.AdminRole))
+}
+
+// visibleComments exclut les commentaires masqués, sauf pour les modérateurs du post et l'auteur du commentaire
+func visibleComments(query *gorm.DB, post models.Post, userID string, role string) *gorm.DB {
+	if canModerate(post, userID, role) {
+		return query
+	}
+	return query.Where("(hidden_at IS NULL OR user_id = ?)", userID)
+}
+
+// canReadComments applique aux commentaires les mêmes règles que l'accès au post
+// (post désactivé, blocage, profil privé, abonnement) et répond à la place du handler si l'accès est refusé
+func canReadComments(c *gin.Context, post models.Post, userID string, role string, origin string) bool {
+	canView, err := access.CanViewPost(userID, role, post)
+	if err != nil {
+		utils.LogError(err, "Error checking post access in "+origin)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comments"})
+		return false
+	}
+	if canView {
+		return true
+	}
+
+	// Un post désactivé n'existe pas pour les autres utilisateurs
+	if !post.Enable {
+		utils.LogError(nil, "Disabled post in "+origin)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return false
+	}
+	utils.LogError(nil, "Access denied to post comments in "+origin)
+	c.JSON(http.StatusForbidden, gin.H{"error": "You cannot view the comments of this post"})
+	return false
 }
 
+// @Summary Get the comments of a post
+// @Description Retrieve the top-level comments of a post (newest first) with their replies count
+// @Tags comments
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of comments per page" default(20)
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "comments, pagination"
+// @Failure 403 {object} map[string]string "error: Comments are disabled for this post / You cannot view the comments of this post"
+// @Failure 404 {object} map[string]string "error: Post not found"
+// @Failure 500 {object} map[string]string "error: Failed to retrieve comments"
+// @Router /posts/{id}/comments [get]
 func GetCommentsByPostID(c *gin.Context) {
 	postId := c.Param("id")
 	// Vérifier si les commentaires sont activés pour ce post
@@ -56,53 +169,127 @@ func GetCommentsByPostID(c *gin.Context) {
 		return
 	}
 
-	var comments []models.Comment
+	userID, exists := c.Get("user_id")
+	if !exists {
+		userID = "0"
+	}
+	role, _ := c.Get("role")
+	roleStr, _ := role.(string)
 
-	if err := db.DB.Where("post_id = ?", postId).Find(&comments).Error; err != nil {
+	if !canReadComments(c, post, userID.(string), roleStr, "GetCommentsByPostID") {
+		return
+	}
+
+	page, limit := utils.GetPagination(c)
+	query := visibleComments(db.DB.Model(&models.Comment{}).Where("post_id = ? AND parent_id IS NULL", postId), post, userID.(string), roleStr)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		utils.LogError(err, "Failed to count comments in GetCommentsByPostID")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comments"})
+		return
+	}
+
+	var comments []models.Comment
+	if err := query.Order("created_at DESC").Limit(limit).Offset((page - 1) * limit).Find(&comments).Error; err != nil {
 		utils.LogError(err, "Failed to retrieve comments in GetCommentsByPostID")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comments"})
 		return
 	}
 
-	var commentsResponse []SSEComment
+	utils.LogSuccessWithUser(userID, "Comments retrieved successfully in GetCommentsByPostID")
+	c.JSON(http.StatusOK, gin.H{
+		"comments":   toSSEComments(comments),
+		"pagination": utils.PaginationResponse(total, page, limit),
+	})
+}
+
+// @Summary Get the replies of a comment
+// @Description Retrieve the direct replies of a comment (oldest first) with their own replies count
+// @Tags comments
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param commentId path string true "Comment ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of replies per page" default(20)
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "replies, pagination"
+// @Failure 403 {object} map[string]string "error: Comments are disabled for this post / You cannot view the comments of this post"
+// @Failure 404 {object} map[string]string "error: Post not found / Comment not found"
+// @Failure 500 {object} map[string]string "error: Failed to retrieve replies"
+// @Router /posts/{id}/comments/{commentId}/replies [get]
+func GetCommentReplies(c *gin.Context) {
+	postID := c.Param("id")
+	commentID := c.Param("commentId")
+
+	var post models.Post
+	if err := db.DB.Preload("User").First(&post, "id = ?", postID).Error; err != nil {
+		utils.LogError(err, "Post not found in GetCommentReplies")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	if !post.User.CommentsEnable {
+		utils.LogError(nil, "Comments disabled for post in GetCommentReplies")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Comments are disabled for this post"})
+		return
+	}
 
-	// If no comments, commentsResponse remains an empty slice
-	if len(comments) > 0 {
-		for _, comment := range comments {
-			var user models.User
-			db.DB.Select("user_name").Where("id = ?", comment.UserID).First(&user)
+	userID, _ := c.Get("user_id")
+	userIDStr, _ := userID.(string)
+	role, _ := c.Get("role")
+	roleStr, _ := role.(string)
 
-			sseComment := SSEComment{
-				ID:        comment.ID,
-				PostID:    comment.PostID,
-				UserID:    comment.UserID,
-				Content:   comment.Content,
-				UserName:  user.UserName,
-				CreatedAt: comment.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			}
-			commentsResponse = append(commentsResponse, sseComment)
-		}
+	if !canReadComments(c, post, userIDStr, roleStr, "GetCommentReplies") {
+		return
 	}
 
-	fmt.Println("Comments retrieved:", commentsResponse)
+	var parent models.Comment
+	if err := db.DB.First(&parent, "id = ? AND post_id = ?", commentID, postID).Error; err != nil {
+		utils.LogError(err, "Comment not found in GetCommentReplies")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
 
-	userID, exists := c.Get("user_id")
-	if !exists {
-		userID = "0"
+	page, limit := utils.GetPagination(c)
+	query := visibleComments(db.DB.Model(&models.Comment{}).Where("parent_id = ?", commentID), post, userIDStr, roleStr)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		utils.LogError(err, "Failed to count replies in GetCommentReplies")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve replies"})
+		return
 	}
-	utils.LogSuccessWithUser(userID, "Comments retrieved successfully in GetCommentsByPostID")
-	c.JSON(http.StatusOK, gin.H{"comments": commentsResponse})
+
+	var replies []models.Comment
+	if err := query.Order("created_at ASC").Limit(limit).Offset((page - 1) * limit).Find(&replies).Error; err != nil {
+		utils.LogError(err, "Failed to retrieve replies in GetCommentReplies")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve replies"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Replies retrieved successfully in GetCommentReplies")
+	c.JSON(http.StatusOK, gin.H{
+		"replies":    toSSEComments(replies),
+		"pagination": utils.PaginationResponse(total, page, limit),
+	})
 }
 
 // @Summary Handle SSE connection for comments
-// @Description Connect to SSE to receive comments in real-time for a specific post
+// @Description Connect to SSE to receive comments in real-time for a specific post.
+// @Description Events carry an id: reconnecting with the Last-Event-ID header (or lastEventId parameter) only sends the missed events.
+// @Description A "resync" event means the missed events are no longer available and the full list follows. Heartbeat comments are sent every 15 seconds.
 // @Tags comments
 // @Param id path string true "Post ID"
 // @Param token query string false "JWT Token for web clients (optional)"
+// @Param Last-Event-ID header string false "Id of the last event received, to resume the stream"
+// @Param lastEventId query string false "Same as the Last-Event-ID header, for clients that cannot send headers"
 // @Security BearerAuth
 // @Success 200 {object} map[string]string "Connected to SSE"
 // @Failure 400 {object} map[string]string "error: Invalid post ID"
 // @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: You cannot view the comments of this post"
+// @Failure 404 {object} map[string]string "error: Post not found"
 // @Failure 500 {object} map[string]string "error: Error setting up SSE"
 // @Router /posts/{id}/comments/sse [get]
 func HandleSSE(c *gin.Context) {
@@ -111,16 +298,19 @@ func HandleSSE(c *gin.Context) {
 	// Pour l'instant j'ai pas trouver comment passer de header
 	// Donc je vais la vérif dans l'URL
 	tokenFromQuery := c.Query("token")
-	_, exists := c.Get("user_id")
+	viewerID, exists := c.Get("user_id")
+	viewerRole, _ := c.Get("role")
 
 	// Si l'ID utilisateur n'a pas été défini par le middleware (car param dans URL) mais qu'un token est présent dans l'URL
 	if !exists && tokenFromQuery != "" {
-		_, err := utils.DecodeJWT(tokenFromQuery)
+		claims, err := utils.DecodeJWT(tokenFromQuery)
 		if err != nil {
 			utils.LogError(err, "Invalid token in URL in HandleSSE")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token in URL"})
 			return
 		}
+		viewerID = claims["user_id"]
+		viewerRole = claims["role"]
 		exists = true
 	}
 
@@ -134,111 +324,46 @@ func HandleSSE(c *gin.Context) {
 
 	var post models.Post
 
-	if err := db.DB.First(&post, "id = ?", postID).Error; err != nil {
+	if err := db.DB.Preload("User").First(&post, "id = ?", postID).Error; err != nil {
 		utils.LogError(err, "Post not found in HandleSSE")
 		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
 		return
 	}
 
-	// ça c'est pour les en-têtes pour le SSE
-	c.Writer.Header().Set("Content-Type", "text/event-stream")
-	c.Writer.Header().Set("Cache-Control", "no-cache")
-	c.Writer.Header().Set("Connection", "keep-alive")
-	c.Writer.Header().Set("Transfer-Encoding", "chunked")
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-
-	// là je crée un channel pour chaque client qui se connecte
-	messageChan := make(chan string)
-
-	// Là je mets le channel dans la map clients
-	// clients est mappé par postID et chaque postID a un channel
-	// Et je bloque l'accès à la map clients pendant les modifs
-	clientsMutex.Lock()
-	if clients[postID] == nil {
-		clients[postID] = make(map[chan string]bool)
-	}
-	clients[postID][messageChan] = true
-	clientsMutex.Unlock()
-
-	flusher, ok := c.Writer.(http.Flusher)
-	if !ok {
-		utils.LogError(nil, "Streaming not supported in HandleSSE")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming not supported"})
+	viewerIDStr, _ := viewerID.(string)
+	viewerRoleStr, _ := viewerRole.(string)
+	if !canReadComments(c, post, viewerIDStr, viewerRoleStr, "HandleSSE") {
 		return
 	}
-
-	c.Writer.Write([]byte("event: connected\ndata: {\"status\":\"connected\"}\n\n"))
-
-	flusher.Flush()
-
-	var comments []models.Comment
-	if err := db.DB.Where("post_id = ?", postID).Find(&comments).Error; err != nil {
-		utils.LogError(err, "Error retrieving comments in HandleSSE")
-		log.Printf("Error retrieving comments: %v", err)
-	} else {
-		for _, comment := range comments {
-			var user models.User
-			db.DB.Select("user_name").Where("id = ?", comment.UserID).First(&user)
-
-			sseComment := SSEComment{
-				ID:        comment.ID,
-				PostID:    comment.PostID,
-				UserID:    comment.UserID,
-				Content:   comment.Content,
-				UserName:  user.UserName,
-				CreatedAt: comment.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			}
-
-			msg := SSEMessage{
-				Type:    "existing_comment",
-				Payload: sseComment,
+	utils.LogSuccessWithUser(viewerID, "SSE connection established in HandleSSE")
+
+	// Les commentaires publiés sur n'importe quelle instance arrivent par le broker.
+	// À la reconnexion (Last-Event-ID), seuls les évènements manqués sont renvoyés.
+	realtime.ServeSSE(c.Writer, c.Request, commentsTopic(postID), realtime.SSEOptions{
+		EventName: "comment",
+		Snapshot: func(send func(data []byte)) {
+			// Envoi des commentaires existants (réponses comprises) dans l'ordre chronologique,
+			// le parentId permet au client de reconstruire les fils
+			var comments []models.Comment
+			existingQuery := visibleComments(db.DB.Where("post_id = ?", postID), post, viewerIDStr, viewerRoleStr)
+			if err := existingQuery.Order("created_at ASC").Find(&comments).Error; err != nil {
+				utils.LogError(err, "Error retrieving comments in HandleSSE")
+				return
 			}
 
-			jsonData, err := json.Marshal(msg)
-			if err != nil {
-				utils.LogError(err, "Error marshaling SSE message in HandleSSE")
-				log.Printf("Error marshaling SSE message: %v", err)
-				continue
+			for _, sseComment := range toSSEComments(comments) {
+				jsonData, err := json.Marshal(SSEMessage{
+					Type:    "existing_comment",
+					Payload: sseComment,
+				})
+				if err != nil {
+					utils.LogError(err, "Error marshaling SSE message in HandleSSE")
+					continue
+				}
+				send(jsonData)
 			}
-
-			c.Writer.Write(fmt.Appendf(nil, "event: comment\ndata: %s\n\n", jsonData))
-			flusher.Flush()
-		}
-	}
-
-	userID, exists := c.Get("user_id")
-	if !exists {
-		userID = "0"
-	}
-	utils.LogSuccessWithUser(userID, "SSE connection established in HandleSSE")
-
-	ctx := c.Request.Context()
-
-	defer func() {
-		clientsMutex.Lock()
-		delete(clients[postID], messageChan)
-		if len(clients[postID]) == 0 {
-			delete(clients, postID)
-		}
-		clientsMutex.Unlock()
-		close(messageChan)
-	}()
-
-	for {
-		select {
-		case message, ok := <-messageChan:
-			if !ok {
-				return
-			}
-			c.Writer.Write([]byte(message))
-			flusher.Flush()
-		case <-ctx.Done():
-			return
-		case <-time.After(30 * time.Second):
-			c.Writer.Write([]byte("event: ping\ndata: {}\n\n"))
-			flusher.Flush()
-		}
-	}
+		},
+	})
 }
 
 // @Summary Create a new comment for a post
@@ -248,11 +373,13 @@ func HandleSSE(c *gin.Context) {
 // @Produce json
 // @Param id path string true "Post ID"
 // @Param token query string false "JWT Token for web clients (optional)"
-// @Param comment body map[string]string true "Comment content"
+// @Param comment body map[string]string true "Comment content and optional parentId to reply to a comment"
 // @Security BearerAuth
 // @Success 201 {object} map[string]string "Comment created"
 // @Failure 400 {object} map[string]string "error: Invalid request"
 // @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Comments are disabled for this post / You cannot comment on this post"
+// @Failure 404 {object} map[string]string "error: Parent comment not found"
 // @Failure 500 {object} map[string]string "error: Server error"
 // @Router /posts/{id}/comments [post]
 func CreateComment(c *gin.Context) {
@@ -295,9 +422,23 @@ func CreateComment(c *gin.Context) {
 		return
 	}
 
+	// Un utilisateur bloqué par l'auteur (ou qui l'a bloqué) ne peut pas commenter ses posts
+	blocked, err := access.IsBlocked(userID.(string), post.UserID)
+	if err != nil {
+		utils.LogError(err, "Error checking blocks in CreateComment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save comment"})
+		return
+	}
+	if blocked {
+		utils.LogError(nil, "Blocked user in CreateComment")
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot comment on this post"})
+		return
+	}
+
 	// Récupérer le contenu du commentaire
 	var commentData struct {
-		Content string `json:"content" binding:"required"`
+		Content  string  `json:"content" binding:"required"`
+		ParentID *string `json:"parentId"`
 	}
 
 	if err := c.BindJSON(&commentData); err != nil {
@@ -313,8 +454,39 @@ func CreateComment(c *gin.Context) {
 		Content: commentData.Content,
 	}
 
-	// Enregistrer dans la base de données
-	if err := db.DB.Create(&comment).Error; err != nil {
+	// Réponse à un commentaire : au-delà de la profondeur max, on rattache la réponse au parent du commentaire visé
+	var parent models.Comment
+	if commentData.ParentID != nil && *commentData.ParentID != "" {
+		if err := db.DB.First(&parent, "id = ? AND post_id = ?", *commentData.ParentID, postID).Error; err != nil {
+			utils.LogError(err, "Parent comment not found in CreateComment")
+			c.JSON(http.StatusNotFound, gin.H{"error": "Parent comment not found"})
+			return
+		}
+		if parent.DeletedAt != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot reply to a deleted comment"})
+			return
+		}
+		if parent.Depth >= models.MaxCommentDepth && parent.ParentID != nil {
+			comment.ParentID = parent.ParentID
+			comment.Depth = parent.Depth
+		} else {
+			comment.ParentID = &parent.ID
+			comment.Depth = parent.Depth + 1
+		}
+	}
+
+	// Enregistrer dans la base de données et mettre à jour le nombre de réponses du parent
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		if comment.ParentID != nil {
+			return tx.Model(&models.Comment{}).Where("id = ?", *comment.ParentID).
+				UpdateColumn("comments_count", gorm.Expr("comments_count + 1")).Error
+		}
+		return nil
+	})
+	if err != nil {
 		utils.LogError(err, "Failed to save comment in CreateComment")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save comment"})
 		return
@@ -326,24 +498,35 @@ func CreateComment(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count comments"})
 		return
 	}
-	comment.CommentsCount = int(count)
 
 	// Récupérer le nom d'utilisateur
 	var user models.User
 	db.DB.Select("user_name").Where("id = ?", userID).First(&user)
 	// Créer la réponse SSE
-	sseComment := SSEComment{
-		ID:            comment.ID,
-		PostID:        comment.PostID,
-		UserID:        comment.UserID,
-		Content:       comment.Content,
-		UserName:      user.UserName,
-		CreatedAt:     comment.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		CommentsCount: comment.CommentsCount,
-	}
+	sseComment := toSSEComment(comment, user.UserName)
+	sseComment.PostCommentsCount = int(count)
 
 	// Diffuser à tous les clients connectés pour ce post
-	broadcastComment(postID, sseComment)
+	broadcastComment(postID, "new_comment", sseComment)
+
+	notifications.Notify(notifications.Event{
+		UserID:    post.UserID,
+		Type:      models.NotificationNewComment,
+		GroupKey:  "post:" + postID,
+		ActorID:   comment.UserID,
+		PostID:    postID,
+		CommentID: comment.ID,
+	})
+	if parent.ID != "" && parent.UserID != post.UserID {
+		notifications.Notify(notifications.Event{
+			UserID:    parent.UserID,
+			Type:      models.NotificationCommentReply,
+			GroupKey:  "comment:" + parent.ID,
+			ActorID:   comment.UserID,
+			PostID:    postID,
+			CommentID: parent.ID,
+		})
+	}
 
 	userID, exists = c.Get("user_id")
 	if !exists {
@@ -353,10 +536,24 @@ func CreateComment(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"comment": sseComment})
 }
 
-// Diffuser un commentaire à tous les clients connectés pour un post spécifique
-func broadcastComment(postID string, comment SSEComment) {
+// Prévenir l'auteur d'un commentaire qu'un modérateur a agi dessus
+func notifyModeration(comment models.Comment, moderatorID string, action string) {
+	if comment.UserID == moderatorID {
+		return
+	}
+	realtime.PublishToUser(comment.UserID, realtime.EventModerationDecision, gin.H{
+		"target":    "comment",
+		"action":    action,
+		"postId":    comment.PostID,
+		"commentId": comment.ID,
+	})
+}
+
+// Diffuser un évènement de commentaire (new_comment, comment_updated, comment_deleted)
+// à tous les clients connectés pour un post spécifique, sur toutes les instances
+func broadcastComment(postID string, eventType string, comment SSEComment) {
 	msg := SSEMessage{
-		Type:    "new_comment",
+		Type:    eventType,
 		Payload: comment,
 	}
 
@@ -367,26 +564,232 @@ func broadcastComment(postID string, comment SSEComment) {
 		return
 	}
 
-	// Construire le message SSE
-	sseData := fmt.Sprintf("event: comment\ndata: %s\n\n", jsonData)
+	if err := realtime.Publish(commentsTopic(postID), jsonData); err != nil {
+		utils.LogError(err, "Error broadcasting comment in broadcastComment")
+	}
+}
+
+// loadPostComment récupère le post et le commentaire ciblés par la route, ainsi que l'utilisateur connecté
+func loadPostComment(c *gin.Context, handlerName string) (models.Post, models.Comment, string, string, bool) {
+	var post models.Post
+	var comment models.Comment
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not found in token in "+handlerName)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in token"})
+		return post, comment, "", "", false
+	}
+	role, _ := c.Get("role")
+	roleStr, _ := role.(string)
+
+	if err := db.DB.First(&post, "id = ?", c.Param("id")).Error; err != nil {
+		utils.LogError(err, "Post not found in "+handlerName)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return post, comment, "", "", false
+	}
 
-	clientsMutex.RLock()
-	defer clientsMutex.RUnlock()
+	if err := db.DB.First(&comment, "id = ? AND post_id = ?", c.Param("commentId"), post.ID).Error; err != nil {
+		utils.LogError(err, "Comment not found in "+handlerName)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return post, comment, "", "", false
+	}
+	if comment.DeletedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return post, comment, "", "", false
+	}
+
+	return post, comment, userID.(string), roleStr, true
+}
+
+// commentAuthorName récupère le nom de l'auteur d'un commentaire pour les évènements SSE
+func commentAuthorName(comment models.Comment) string {
+	var user models.User
+	db.DB.Select("user_name").Where("id = ?", comment.UserID).First(&user)
+	return user.UserName
+}
 
-	// Si aucun client n'est connecté pour ce post, on sort
-	if _, exists := clients[postID]; !exists {
+// @Summary Edit a comment
+// @Description Edit the content of a comment (author of the comment only). The comment is marked as edited and a comment_updated event is broadcast via SSE
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param commentId path string true "Comment ID"
+// @Param comment body map[string]string true "New content"
+// @Security BearerAuth
+// @Success 200 {object} SSEComment
+// @Failure 400 {object} map[string]string "error: Invalid comment data"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: You can only edit your own comments"
+// @Failure 404 {object} map[string]string "error: Comment not found"
+// @Failure 500 {object} map[string]string "error: Failed to update comment"
+// @Router /posts/{id}/comments/{commentId} [put]
+func UpdateComment(c *gin.Context) {
+	post, comment, userID, _, ok := loadPostComment(c, "UpdateComment")
+	if !ok {
 		return
 	}
 
-	// Envoyer le message à tous les clients connectés pour ce post
-	for clientChan := range clients[postID] {
-		select {
-		case clientChan <- sseData:
-		default:
-			log.Printf("Error broadcasting comment: channel full or closed")
-			clientsMutex.Lock()
-			delete(clients[postID], clientChan)
-			clientsMutex.Unlock()
+	if comment.UserID != userID {
+		utils.LogError(nil, "User is not the author of the comment in UpdateComment")
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own comments"})
+		return
+	}
+
+	var commentData struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&commentData); err != nil {
+		utils.LogError(err, "Invalid comment data in UpdateComment")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment data"})
+		return
+	}
+
+	now := time.Now()
+	comment.Content = commentData.Content
+	comment.EditedAt = &now
+	if err := db.DB.Model(&comment).Updates(map[string]any{"content": comment.Content, "edited_at": now}).Error; err != nil {
+		utils.LogError(err, "Failed to update comment in UpdateComment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
+	sseComment := toSSEComment(comment, commentAuthorName(comment))
+	// Un commentaire masqué reste masqué : on ne diffuse pas son nouveau contenu
+	if !sseComment.Hidden {
+		broadcastComment(post.ID, "comment_updated", sseComment)
+	}
+
+	utils.LogSuccessWithUser(userID, "Comment updated successfully in UpdateComment")
+	c.JSON(http.StatusOK, sseComment)
+}
+
+// @Summary Delete a comment
+// @Description Delete a comment (author of the comment, author of the post or admin). A comment with replies is kept as an empty placeholder. A comment_deleted event is broadcast via SSE
+// @Tags comments
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param commentId path string true "Comment ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message: Comment deleted successfully"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: You are not allowed to delete this comment"
+// @Failure 404 {object} map[string]string "error: Comment not found"
+// @Failure 500 {object} map[string]string "error: Failed to delete comment"
+// @Router /posts/{id}/comments/{commentId} [delete]
+func DeleteComment(c *gin.Context) {
+	post, comment, userID, role, ok := loadPostComment(c, "DeleteComment")
+	if !ok {
+		return
+	}
+
+	if comment.UserID != userID && !canModerate(post, userID, role) {
+		utils.LogError(nil, "User not allowed to delete comment in DeleteComment")
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to delete this comment"})
+		return
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// Des réponses existent : on garde le commentaire vide pour ne pas casser le fil
+		if comment.CommentsCount > 0 {
+			now := time.Now()
+			comment.DeletedAt = &now
+			comment.Content = ""
+			return tx.Model(&comment).Updates(map[string]any{"content": "", "deleted_at": now}).Error
 		}
+
+		if err := tx.Delete(&comment).Error; err != nil {
+			return err
+		}
+		if comment.ParentID != nil {
+			return tx.Model(&models.Comment{}).Where("id = ? AND comments_count > 0", *comment.ParentID).
+				UpdateColumn("comments_count", gorm.Expr("comments_count - 1")).Error
+		}
+		return nil
+	})
+	if err != nil {
+		utils.LogError(err, "Failed to delete comment in DeleteComment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
 	}
+
+	sseComment := toSSEComment(comment, "")
+	sseComment.Deleted = true
+	sseComment.Content = ""
+	broadcastComment(post.ID, "comment_deleted", sseComment)
+	notifyModeration(comment, userID, "deleted")
+
+	utils.LogSuccessWithUser(userID, "Comment deleted successfully in DeleteComment")
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
+}
+
+// @Summary Hide or unhide a comment
+// @Description Hide a comment (author of the post or admin). A hidden comment stays visible to its author and to moderators only. A comment_updated event is broadcast via SSE
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param commentId path string true "Comment ID"
+// @Param hidden body map[string]bool true "hidden: true to hide, false to unhide"
+// @Security BearerAuth
+// @Success 200 {object} SSEComment
+// @Failure 400 {object} map[string]string "error: Invalid data"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Only the author of the post or an admin can hide comments"
+// @Failure 404 {object} map[string]string "error: Comment not found"
+// @Failure 500 {object} map[string]string "error: Failed to update comment"
+// @Router /posts/{id}/comments/{commentId}/hide [patch]
+func HideComment(c *gin.Context) {
+	post, comment, userID, role, ok := loadPostComment(c, "HideComment")
+	if !ok {
+		return
+	}
+
+	if !canModerate(post, userID, role) {
+		utils.LogError(nil, "User not allowed to hide comment in HideComment")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author of the post or an admin can hide comments"})
+		return
+	}
+
+	var hideData struct {
+		Hidden *bool `json:"hidden" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&hideData); err != nil {
+		utils.LogError(err, "Invalid data in HideComment")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	updates := map[string]any{"hidden_at": nil, "hidden_by": nil}
+	comment.HiddenAt = nil
+	comment.HiddenBy = nil
+	if *hideData.Hidden {
+		now := time.Now()
+		comment.HiddenAt = &now
+		comment.HiddenBy = &userID
+		updates = map[string]any{"hidden_at": now, "hidden_by": userID}
+	}
+
+	if err := db.DB.Model(&comment).Updates(updates).Error; err != nil {
+		utils.LogError(err, "Failed to update comment in HideComment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
+	sseComment := toSSEComment(comment, commentAuthorName(comment))
+	event := sseComment
+	// Le contenu d'un commentaire masqué n'est pas diffusé à tous les clients
+	if event.Hidden {
+		event.Content = ""
+	}
+	broadcastComment(post.ID, "comment_updated", event)
+	if sseComment.Hidden {
+		notifyModeration(comment, userID, "hidden")
+	} else {
+		notifyModeration(comment, userID, "unhidden")
+	}
+
+	utils.LogSuccessWithUser(userID, "Comment visibility updated successfully in HideComment")
+	c.JSON(http.StatusOK, sseComment)
 }
@@ -0,0 +1,588 @@
+package comment
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"pec2-backend/services/realtime"
+	"pec2-backend/testutils"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	testutils.InitTestMain()
+
+	log.SetOutput(io.Discard)
+
+	exitCode := m.Run()
+
+	log.SetOutput(os.Stdout)
+
+	os.Exit(exitCode)
+}
+
+func setupCommentRouter(userID string) *gin.Engine {
+	router := testutils.SetupTestRouter()
+	authenticated := func(handler gin.HandlerFunc) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("user_id", userID)
+			handler(c)
+		}
+	}
+	router.POST("/posts/:id/comments", authenticated(CreateComment))
+	router.GET("/posts/:id/comments", authenticated(GetCommentsByPostID))
+	router.GET("/posts/:id/comments/:commentId/replies", authenticated(GetCommentReplies))
+	router.GET("/posts/:id/comments/sse", authenticated(HandleSSE))
+	router.PUT("/posts/:id/comments/:commentId", authenticated(UpdateComment))
+	router.DELETE("/posts/:id/comments/:commentId", authenticated(DeleteComment))
+	router.PATCH("/posts/:id/comments/:commentId/hide", authenticated(HideComment))
+	return router
+}
+
+func expectPostWithComments(mock sqlmock.Sqlmock, postID string) {
+	mock.ExpectQuery(`SELECT \* FROM "posts" WHERE id = \$1`).
+		WithArgs(postID, 1).
+		WillReturnRows(mock.NewRows([]string{"id", "user_id", "enable", "is_free"}).AddRow(postID, "creator-uuid", true, true))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs("creator-uuid").
+		WillReturnRows(mock.NewRows([]string{"id", "comments_enable"}).AddRow("creator-uuid", true))
+}
+
+// expectRestrictedPost charge un post actif, gratuit ou non, dont l'auteur a un profil public ou privé
+func expectRestrictedPost(mock sqlmock.Sqlmock, isFree bool, privateProfile bool) {
+	mock.ExpectQuery(`SELECT \* FROM "posts" WHERE id = \$1`).
+		WithArgs("post-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "user_id", "enable", "is_free"}).AddRow("post-uuid", "creator-uuid", true, isFree))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs("creator-uuid").
+		WillReturnRows(mock.NewRows([]string{"id", "comments_enable", "private_profile"}).AddRow("creator-uuid", true, privateProfile))
+}
+
+func expectNoSubscription(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "subscriptions"`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+}
+
+func expectBlockCheck(mock sqlmock.Sqlmock, blocked int) {
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks" WHERE \(blocker_id = \$1 AND blocked_id = \$2\) OR \(blocker_id = \$3 AND blocked_id = \$4\)`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(blocked))
+}
+
+func TestCreateComment_Reply(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectPostWithComments(mock, "post-uuid")
+	expectBlockCheck(mock, 0)
+	mock.ExpectQuery(`SELECT \* FROM "comments" WHERE id = \$1 AND post_id = \$2`).
+		WithArgs("parent-uuid", "post-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "post_id", "depth"}).AddRow("parent-uuid", "post-uuid", 0))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "comments"`).
+		WillReturnRows(mock.NewRows([]string{"id", "depth", "comments_count"}).AddRow("reply-uuid", 1, 0))
+	mock.ExpectExec(`UPDATE "comments" SET "comments_count"=comments_count \+ 1 WHERE id = \$1`).
+		WithArgs("parent-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "comments" WHERE post_id = \$1`).
+		WithArgs("post-uuid").
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`SELECT "user_name" FROM "users"`).
+		WillReturnRows(mock.NewRows([]string{"user_name"}).AddRow("replier"))
+
+	router := setupCommentRouter("user-uuid")
+	body, _ := json.Marshal(map[string]string{"content": "Bien vu !", "parentId": "parent-uuid"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/posts/post-uuid/comments", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response struct {
+		Comment SSEComment `json:"comment"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "parent-uuid", *response.Comment.ParentID)
+	assert.Equal(t, 1, response.Comment.Depth)
+	assert.Equal(t, 2, response.Comment.PostCommentsCount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateComment_ReplyBeyondMaxDepth(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectPostWithComments(mock, "post-uuid")
+	expectBlockCheck(mock, 0)
+	// Le commentaire visé est déjà au niveau max : la réponse est rattachée à son parent
+	mock.ExpectQuery(`SELECT \* FROM "comments" WHERE id = \$1 AND post_id = \$2`).
+		WithArgs("deep-uuid", "post-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "post_id", "parent_id", "depth"}).
+			AddRow("deep-uuid", "post-uuid", "level1-uuid", 2))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "comments"`).
+		WillReturnRows(mock.NewRows([]string{"id", "depth", "comments_count"}).AddRow("reply-uuid", 2, 0))
+	mock.ExpectExec(`UPDATE "comments" SET "comments_count"=comments_count \+ 1 WHERE id = \$1`).
+		WithArgs("level1-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "comments" WHERE post_id = \$1`).
+		WithArgs("post-uuid").
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(4))
+	mock.ExpectQuery(`SELECT "user_name" FROM "users"`).
+		WillReturnRows(mock.NewRows([]string{"user_name"}).AddRow("replier"))
+
+	router := setupCommentRouter("user-uuid")
+	body, _ := json.Marshal(map[string]string{"content": "Encore une réponse", "parentId": "deep-uuid"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/posts/post-uuid/comments", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response struct {
+		Comment SSEComment `json:"comment"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "level1-uuid", *response.Comment.ParentID)
+	assert.Equal(t, 2, response.Comment.Depth)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateComment_ParentNotFound(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectPostWithComments(mock, "post-uuid")
+	expectBlockCheck(mock, 0)
+	mock.ExpectQuery(`SELECT \* FROM "comments" WHERE id = \$1 AND post_id = \$2`).
+		WithArgs("unknown-uuid", "post-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id"}))
+
+	router := setupCommentRouter("user-uuid")
+	body, _ := json.Marshal(map[string]string{"content": "Réponse", "parentId": "unknown-uuid"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/posts/post-uuid/comments", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateComment_BlockedByAuthor(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectPostWithComments(mock, "post-uuid")
+	expectBlockCheck(mock, 1)
+
+	router := setupCommentRouter("user-uuid")
+	body, _ := json.Marshal(map[string]string{"content": "Bonjour"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/posts/post-uuid/comments", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetCommentsByPostID_TopLevelPaginated(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectPostWithComments(mock, "post-uuid")
+	expectBlockCheck(mock, 0)
+	// Les commentaires masqués ne sont visibles que par leur auteur
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "comments" WHERE \(post_id = \$1 AND parent_id IS NULL\) AND \(\(hidden_at IS NULL OR user_id = \$2\)\)`).
+		WithArgs("post-uuid", "user-uuid").
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`SELECT \* FROM "comments" WHERE \(post_id = \$1 AND parent_id IS NULL\) AND \(\(hidden_at IS NULL OR user_id = \$2\)\) ORDER BY created_at DESC LIMIT \$3 OFFSET \$4`).
+		WithArgs("post-uuid", "user-uuid", 2, 2).
+		WillReturnRows(mock.NewRows([]string{"id", "post_id", "user_id", "content", "comments_count", "created_at"}).
+			AddRow("comment-uuid", "post-uuid", "user-uuid", "Premier", 5, time.Now()))
+	mock.ExpectQuery(`SELECT id, user_name FROM "users" WHERE id IN \(\$1\)`).
+		WithArgs("user-uuid").
+		WillReturnRows(mock.NewRows([]string{"id", "user_name"}).AddRow("user-uuid", "alice"))
+
+	router := setupCommentRouter("user-uuid")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/posts/post-uuid/comments?page=2&limit=2", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Comments   []SSEComment   `json:"comments"`
+		Pagination map[string]int `json:"pagination"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Comments, 1)
+	assert.Equal(t, "alice", response.Comments[0].UserName)
+	assert.Equal(t, 5, response.Comments[0].RepliesCount)
+	assert.Equal(t, 3, response.Pagination["total"])
+	assert.Equal(t, 2, response.Pagination["total_pages"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetCommentReplies(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	// L'auteur du post voit aussi les réponses masquées
+	mock.ExpectQuery(`SELECT \* FROM "posts" WHERE id = \$1`).
+		WithArgs("post-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "user_id"}).AddRow("post-uuid", "user-uuid"))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs("user-uuid").
+		WillReturnRows(mock.NewRows([]string{"id", "comments_enable"}).AddRow("user-uuid", true))
+	mock.ExpectQuery(`SELECT \* FROM "comments" WHERE id = \$1 AND post_id = \$2`).
+		WithArgs("comment-uuid", "post-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "post_id"}).AddRow("comment-uuid", "post-uuid"))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "comments" WHERE parent_id = \$1$`).
+		WithArgs("comment-uuid").
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT \* FROM "comments" WHERE parent_id = \$1 ORDER BY created_at ASC LIMIT \$2`).
+		WithArgs("comment-uuid", 20).
+		WillReturnRows(mock.NewRows([]string{"id", "post_id", "user_id", "parent_id", "depth", "content", "created_at"}).
+			AddRow("reply-uuid", "post-uuid", "user-uuid", "comment-uuid", 1, "Réponse", time.Now()))
+	mock.ExpectQuery(`SELECT id, user_name FROM "users" WHERE id IN \(\$1\)`).
+		WithArgs("user-uuid").
+		WillReturnRows(mock.NewRows([]string{"id", "user_name"}).AddRow("user-uuid", "bob"))
+
+	router := setupCommentRouter("user-uuid")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/posts/post-uuid/comments/comment-uuid/replies", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Replies []SSEComment `json:"replies"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Replies, 1)
+	assert.Equal(t, "comment-uuid", *response.Replies[0].ParentID)
+	assert.Equal(t, "bob", response.Replies[0].UserName)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetCommentsByPostID_PaidPostWithoutSubscription(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectRestrictedPost(mock, false, false)
+	expectBlockCheck(mock, 0)
+	expectNoSubscription(mock)
+
+	router := setupCommentRouter("user-uuid")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/posts/post-uuid/comments", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetCommentsByPostID_PrivateProfile(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	// Post gratuit, mais l'auteur a un profil privé et le lecteur ne le suit pas
+	expectRestrictedPost(mock, true, true)
+	expectBlockCheck(mock, 0)
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_follows"`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+	expectNoSubscription(mock)
+
+	router := setupCommentRouter("user-uuid")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/posts/post-uuid/comments", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetCommentReplies_CommentsDisabled(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "posts" WHERE id = \$1`).
+		WithArgs("post-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "user_id", "enable", "is_free"}).AddRow("post-uuid", "creator-uuid", true, true))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs("creator-uuid").
+		WillReturnRows(mock.NewRows([]string{"id", "comments_enable"}).AddRow("creator-uuid", false))
+
+	router := setupCommentRouter("user-uuid")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/posts/post-uuid/comments/comment-uuid/replies", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetCommentReplies_BlockedViewer(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectRestrictedPost(mock, true, false)
+	expectBlockCheck(mock, 1)
+
+	router := setupCommentRouter("user-uuid")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/posts/post-uuid/comments/comment-uuid/replies", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleSSE_PaidPostWithoutSubscription(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	// Le flux n'est pas ouvert : ni les commentaires existants ni les nouveaux ne sont envoyés
+	expectRestrictedPost(mock, false, false)
+	expectBlockCheck(mock, 0)
+	expectNoSubscription(mock)
+
+	router := setupCommentRouter("user-uuid")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/posts/post-uuid/comments/sse", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleSSE_DisabledPost(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "posts" WHERE id = \$1`).
+		WithArgs("post-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "user_id", "enable"}).AddRow("post-uuid", "creator-uuid", false))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs("creator-uuid").
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow("creator-uuid"))
+
+	router := setupCommentRouter("user-uuid")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/posts/post-uuid/comments/sse", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func expectPostAndComment(mock sqlmock.Sqlmock, commentRows *sqlmock.Rows) {
+	mock.ExpectQuery(`SELECT \* FROM "posts" WHERE id = \$1`).
+		WithArgs("post-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "user_id"}).AddRow("post-uuid", "creator-uuid"))
+	mock.ExpectQuery(`SELECT \* FROM "comments" WHERE id = \$1 AND post_id = \$2`).
+		WithArgs("comment-uuid", "post-uuid", 1).
+		WillReturnRows(commentRows)
+}
+
+func TestUpdateComment(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	subscription := realtime.Subscribe(commentsTopic("post-uuid"), 0)
+	defer subscription.Close()
+
+	expectPostAndComment(mock, mock.NewRows([]string{"id", "post_id", "user_id", "content"}).
+		AddRow("comment-uuid", "post-uuid", "user-uuid", "Ancien contenu"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "comments" SET "content"=\$1,"edited_at"=\$2 WHERE "id" = \$3`).
+		WithArgs("Nouveau contenu", sqlmock.AnyArg(), "comment-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT "user_name" FROM "users"`).
+		WillReturnRows(mock.NewRows([]string{"user_name"}).AddRow("alice"))
+
+	router := setupCommentRouter("user-uuid")
+	body, _ := json.Marshal(map[string]string{"content": "Nouveau contenu"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPut, "/posts/post-uuid/comments/comment-uuid", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response SSEComment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Nouveau contenu", response.Content)
+	assert.True(t, response.Edited)
+	assert.NotNil(t, response.EditedAt)
+
+	event := string((<-subscription.C).Data)
+	assert.Contains(t, event, `"type":"comment_updated"`)
+	assert.Contains(t, event, "Nouveau contenu")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateComment_NotAuthor(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectPostAndComment(mock, mock.NewRows([]string{"id", "post_id", "user_id", "content"}).
+		AddRow("comment-uuid", "post-uuid", "someone-else", "Contenu"))
+
+	// Même l'auteur du post ne peut pas modifier le commentaire d'un autre
+	router := setupCommentRouter("creator-uuid")
+	body, _ := json.Marshal(map[string]string{"content": "Modifié"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPut, "/posts/post-uuid/comments/comment-uuid", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteComment_ByPostAuthor(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	subscription := realtime.Subscribe(commentsTopic("post-uuid"), 0)
+	defer subscription.Close()
+
+	expectPostAndComment(mock, mock.NewRows([]string{"id", "post_id", "user_id", "parent_id", "depth", "content", "comments_count"}).
+		AddRow("comment-uuid", "post-uuid", "user-uuid", "parent-uuid", 1, "Spam", 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "comments" WHERE "comments"."id" = \$1`).
+		WithArgs("comment-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "comments" SET "comments_count"=comments_count - 1 WHERE id = \$1 AND comments_count > 0`).
+		WithArgs("parent-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	router := setupCommentRouter("creator-uuid")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodDelete, "/posts/post-uuid/comments/comment-uuid", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	event := string((<-subscription.C).Data)
+	assert.Contains(t, event, `"type":"comment_deleted"`)
+	assert.Contains(t, event, `"parentId":"parent-uuid"`)
+	assert.NotContains(t, event, "Spam")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteComment_WithRepliesKeepsPlaceholder(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectPostAndComment(mock, mock.NewRows([]string{"id", "post_id", "user_id", "content", "comments_count"}).
+		AddRow("comment-uuid", "post-uuid", "user-uuid", "Contenu", 2))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "comments" SET "content"=\$1,"deleted_at"=\$2 WHERE "id" = \$3`).
+		WithArgs("", sqlmock.AnyArg(), "comment-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	router := setupCommentRouter("user-uuid")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodDelete, "/posts/post-uuid/comments/comment-uuid", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteComment_Forbidden(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectPostAndComment(mock, mock.NewRows([]string{"id", "post_id", "user_id", "content"}).
+		AddRow("comment-uuid", "post-uuid", "user-uuid", "Contenu"))
+
+	router := setupCommentRouter("stranger-uuid")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodDelete, "/posts/post-uuid/comments/comment-uuid", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHideComment(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	subscription := realtime.Subscribe(commentsTopic("post-uuid"), 0)
+	defer subscription.Close()
+
+	expectPostAndComment(mock, mock.NewRows([]string{"id", "post_id", "user_id", "content"}).
+		AddRow("comment-uuid", "post-uuid", "user-uuid", "Contenu gênant"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "comments" SET "hidden_at"=\$1,"hidden_by"=\$2 WHERE "id" = \$3`).
+		WithArgs(sqlmock.AnyArg(), "creator-uuid", "comment-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT "user_name" FROM "users"`).
+		WillReturnRows(mock.NewRows([]string{"user_name"}).AddRow("alice"))
+
+	router := setupCommentRouter("creator-uuid")
+	body, _ := json.Marshal(map[string]bool{"hidden": true})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPatch, "/posts/post-uuid/comments/comment-uuid/hide", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response SSEComment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Hidden)
+	assert.Equal(t, "Contenu gênant", response.Content)
+
+	// L'évènement diffusé à tous ne contient pas le contenu masqué
+	event := string((<-subscription.C).Data)
+	assert.Contains(t, event, `"type":"comment_updated"`)
+	assert.Contains(t, event, `"hidden":true`)
+	assert.NotContains(t, event, "Contenu gênant")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHideComment_NotModerator(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectPostAndComment(mock, mock.NewRows([]string{"id", "post_id", "user_id", "content"}).
+		AddRow("comment-uuid", "post-uuid", "user-uuid", "Contenu"))
+
+	// L'auteur du commentaire ne peut pas le masquer lui-même
+	router := setupCommentRouter("user-uuid")
+	body, _ := json.Marshal(map[string]bool{"hidden": true})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPatch, "/posts/post-uuid/comments/comment-uuid/hide", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
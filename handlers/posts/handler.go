@@ -6,6 +6,10 @@ import (
 	"net/http"
 	"pec2-backend/db"
 	"pec2-backend/models"
+	"pec2-backend/services/access"
+	"pec2-backend/services/media"
+	"pec2-backend/services/notifications"
+	"pec2-backend/services/realtime"
 	"pec2-backend/utils"
 	"strings"
 	"time"
@@ -23,6 +27,7 @@ import (
 // @Param isFree formData boolean false "Is the post free"
 // @Param enable formData boolean false "Is the post enabled"
 // @Param categories formData []string false "Category IDs"
+// @Param minTierId formData string false "Minimum subscription tier required to see a paid post"
 // @Param file formData file false "Post picture"
 // @Security BearerAuth
 // @Success 201 {object} models.Post
@@ -73,23 +78,35 @@ func CreatePost(c *gin.Context) {
 	}
 	description := c.Request.FormValue("description")
 
+	var minTierID *string
+	if tierID := c.Request.FormValue("minTierId"); tierID != "" && !isFree {
+		if err := checkPostTier(userID.(string), tierID); err != nil {
+			utils.LogError(err, "Invalid tier in CreatePost")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription tier"})
+			return
+		}
+		minTierID = &tierID
+	}
+
 	post := models.Post{
 		UserID:      userID.(string),
 		Name:        name,
 		Description: description,
 		IsFree:      isFree,
 		Enable:      true,
+		MinTierID:   minTierID,
 	}
 
 	file, err := c.FormFile("postPicture")
 	if err == nil && file != nil {
-		imageURL, err := utils.UploadImage(file, "post_pictures", "post")
+		variants, err := utils.UploadPicture(file, "post_pictures", "post")
 		if err != nil {
 			utils.LogError(err, "Error uploading picture in CreatePost")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error uploading picture: " + err.Error()})
 			return
 		}
-		post.PictureURL = imageURL
+		post.PictureURL = variants.Full
+		post.PictureVariants = variants
 	} else {
 		utils.LogError(nil, "Picture is required in CreatePost")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Picture is required"})
@@ -204,7 +221,20 @@ func GetAllPosts(c *gin.Context) {
 			}
 
 			if len(creatorIDs) > 0 {
-				query = query.Where("user_id IN ? AND is_free = ?", creatorIDs, false)
+				// Un post réservé à un niveau n'apparaît qu'aux abonnés de ce niveau ou d'un niveau supérieur
+				ranks, err := access.SubscriptionRanks(subscriptions)
+				if err != nil {
+					utils.LogError(err, "Error computing subscription tiers in GetAllPosts")
+				}
+				tierIDs, err := access.AccessibleTierIDs(ranks)
+				if err != nil {
+					utils.LogError(err, "Error finding accessible tiers in GetAllPosts")
+				}
+				if len(tierIDs) > 0 {
+					query = query.Where("user_id IN ? AND is_free = ? AND (min_tier_id IS NULL OR min_tier_id IN ?)", creatorIDs, false, tierIDs)
+				} else {
+					query = query.Where("user_id IN ? AND is_free = ? AND min_tier_id IS NULL", creatorIDs, false)
+				}
 				utils.LogSuccess(fmt.Sprintf("Filtering for %d creators with paid posts", len(creatorIDs)))
 			} else {
 				// Si aucun abonnement actif, ne retourner aucun post
@@ -240,6 +270,20 @@ func GetAllPosts(c *gin.Context) {
 		}
 	}
 
+	// Exclure les posts des utilisateurs bloqués (dans un sens ou dans l'autre)
+	if exists && userID != nil {
+		blockedIDs, err := access.BlockedUserIDs(userID.(string))
+		if err != nil {
+			utils.LogError(err, "Error retrieving blocked users in GetAllPosts")
+		} else if len(blockedIDs) > 0 {
+			query = query.Where("posts.user_id NOT IN ?", blockedIDs)
+		}
+	}
+
+	// Exclure les posts des profils privés que l'utilisateur ne suit pas
+	viewerID, _ := userID.(string)
+	query = query.Where("posts.user_id NOT IN (?)", access.HiddenProfilesQuery(viewerID))
+
 	// Compter le nombre total de posts pour la pagination
 	var total int64
 	if err := query.Model(&models.Post{}).Count(&total).Error; err != nil {
@@ -274,6 +318,8 @@ func GetAllPosts(c *gin.Context) {
 	}
 
 	var response []models.PostResponse = make([]models.PostResponse, 0, len(posts))
+	viewerRole, _ := c.Get("role")
+	viewerRoleStr, _ := viewerRole.(string)
 	for _, post := range posts {
 		// Compter le nombre de likes
 		var likesCount int64
@@ -297,15 +343,18 @@ func GetAllPosts(c *gin.Context) {
 		// Créer la réponse pour ce post
 		postResponse := models.PostResponse{
 			ID: post.ID, Name: post.Name, Description: post.Description, PictureURL: post.PictureURL,
-			IsFree:     post.IsFree,
-			Enable:     post.Enable,
-			Categories: post.Categories,
-			CreatedAt:  post.CreatedAt,
-			UpdatedAt:  post.UpdatedAt,
+			PictureVariants: post.PictureVariants,
+			IsFree:          post.IsFree,
+			Enable:          post.Enable,
+			MinTierID:       post.MinTierID,
+			Categories:      post.Categories,
+			CreatedAt:       post.CreatedAt,
+			UpdatedAt:       post.UpdatedAt,
 			User: models.UserInfo{
-				ID:             post.User.ID,
-				UserName:       post.User.UserName,
-				ProfilePicture: post.User.ProfilePicture,
+				ID:                     post.User.ID,
+				UserName:               post.User.UserName,
+				ProfilePicture:         post.User.ProfilePicture,
+				ProfilePictureVariants: post.User.ProfilePictureVariants,
 			},
 			LikesCount:     int(likesCount),
 			CommentsCount:  int(commentsCount),
@@ -314,6 +363,12 @@ func GetAllPosts(c *gin.Context) {
 			MessageEnabled: post.User.MessageEnable,
 			IsLikedByUser:  isLikedByUser,
 		}
+		// Les images payantes passent par des URLs signées vers l'endpoint média (contrôle d'accès + filigrane)
+		canView, err := access.CanViewPost(viewerID, viewerRoleStr, post)
+		if err != nil {
+			utils.LogError(err, "Error checking post access in GetAllPosts")
+		}
+		media.ProtectPostResponse(&postResponse, viewerID, canView)
 
 		response = append(response, postResponse)
 	}
@@ -396,6 +451,33 @@ func GetPostByID(c *gin.Context) {
 		return
 	}
 
+	// Les posts d'un utilisateur bloqué (ou qui nous a bloqués) n'existent pas pour nous
+	if exists && userID != nil {
+		blocked, err := access.IsBlocked(userID.(string), post.UserID)
+		if err != nil {
+			utils.LogError(err, "Error checking blocks in GetPostByID")
+		}
+		if blocked {
+			utils.LogError(nil, "Post hidden by a block in GetPostByID")
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			return
+		}
+	}
+
+	// Les posts d'un profil privé sont réservés à ses followers et abonnés
+	viewerID, _ := userID.(string)
+	viewerRole, _ := c.Get("role")
+	viewerRoleStr, _ := viewerRole.(string)
+	canSee, err := access.CanSeeProfile(viewerID, viewerRoleStr, post.User)
+	if err != nil {
+		utils.LogError(err, "Error checking profile privacy in GetPostByID")
+	}
+	if !canSee {
+		utils.LogError(nil, "Post hidden by a private profile in GetPostByID")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
 	// Compter le nombre de likes
 	var likesCount int64
 	db.DB.Model(&models.Like{}).Where("post_id = ?", post.ID).Count(&likesCount)
@@ -418,15 +500,18 @@ func GetPostByID(c *gin.Context) {
 	// Créer la réponse pour ce post
 	postResponse := models.PostResponse{
 		ID: post.ID, Name: post.Name, Description: post.Description, PictureURL: post.PictureURL,
-		IsFree:     post.IsFree,
-		Enable:     post.Enable,
-		Categories: post.Categories,
-		CreatedAt:  post.CreatedAt,
-		UpdatedAt:  post.UpdatedAt,
+		PictureVariants: post.PictureVariants,
+		IsFree:          post.IsFree,
+		Enable:          post.Enable,
+		MinTierID:       post.MinTierID,
+		Categories:      post.Categories,
+		CreatedAt:       post.CreatedAt,
+		UpdatedAt:       post.UpdatedAt,
 		User: models.UserInfo{
-			ID:             post.User.ID,
-			UserName:       post.User.UserName,
-			ProfilePicture: post.User.ProfilePicture,
+			ID:                     post.User.ID,
+			UserName:               post.User.UserName,
+			ProfilePicture:         post.User.ProfilePicture,
+			ProfilePictureVariants: post.User.ProfilePictureVariants,
 		},
 		LikesCount:     int(likesCount),
 		CommentsCount:  int(commentsCount),
@@ -435,6 +520,11 @@ func GetPostByID(c *gin.Context) {
 		MessageEnabled: post.User.MessageEnable,
 		IsLikedByUser:  isLikedByUser,
 	}
+	canView, err := access.CanViewPost(viewerID, viewerRoleStr, post)
+	if err != nil {
+		utils.LogError(err, "Error checking post access in GetPostByID")
+	}
+	media.ProtectPostResponse(&postResponse, viewerID, canView)
 
 	utils.LogSuccess("Post retrieved successfully in GetPostByID")
 	c.JSON(http.StatusOK, postResponse)
@@ -494,6 +584,15 @@ func UpdatePost(c *gin.Context) {
 	post.Name = input.Name
 	post.IsFree = input.IsFree
 	post.Description = input.Description
+	post.MinTierID = nil
+	if input.MinTierID != nil && *input.MinTierID != "" && !input.IsFree {
+		if err := checkPostTier(post.UserID, *input.MinTierID); err != nil {
+			utils.LogError(err, "Invalid tier in UpdatePost")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription tier"})
+			return
+		}
+		post.MinTierID = input.MinTierID
+	}
 
 	categoryIDs := input.Categories
 	var categories []models.Category
@@ -556,15 +655,22 @@ func DeletePost(c *gin.Context) {
 	}
 
 	// Vérifier que l'utilisateur est propriétaire du post ou admin
-	userRole, _ := c.Get("user_role")
-	if post.UserID != userID.(string) && userRole.(string) != string(models.AdminRole) {
+	userRole, _ := c.Get("role")
+	role, _ := userRole.(string)
+	if post.UserID != userID.(string) && role != string(models.AdminRole) {
 		utils.LogError(nil, "Not authorized to delete this post in DeletePost")
 		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to delete this post"})
 		return
 	}
 
-	if post.PictureURL != "" {
-		_ = utils.DeleteImage(post.PictureURL)
+	utils.DeletePicture(post.PictureURL, post.PictureVariants)
+
+	// Post retiré par la modération : les utilisateurs qui l'ont signalé seront prévenus
+	var reporters []string
+	if post.UserID != userID.(string) {
+		if err := db.DB.Model(&models.Report{}).Where("post_id = ?", postID).Distinct().Pluck("reported_by", &reporters).Error; err != nil {
+			utils.LogError(err, "Error retrieving post reporters in DeletePost")
+		}
 	}
 
 	// Supprimer tous les rapports associés à ce post
@@ -602,6 +708,22 @@ func DeletePost(c *gin.Context) {
 		return
 	}
 
+	// Post supprimé par la modération : on prévient son auteur
+	if post.UserID != userID.(string) {
+		realtime.PublishToUser(post.UserID, realtime.EventModerationDecision, gin.H{
+			"target": "post",
+			"action": "deleted",
+			"postId": post.ID,
+		})
+	}
+	for _, reporterID := range reporters {
+		notifications.Notify(notifications.Event{
+			UserID: reporterID,
+			Type:   models.NotificationReportOutcome,
+			Detail: "post_deleted",
+		})
+	}
+
 	utils.LogSuccess("Post deleted successfully in DeletePost")
 	c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
 }
@@ -733,3 +855,9 @@ func GetPostsStatistics(c *gin.Context) {
 		"category_data": categoryData,
 	})
 }
+
+// checkPostTier vérifie que le niveau minimum d'un post est un niveau actif de son auteur
+func checkPostTier(creatorID string, tierID string) error {
+	var tier models.SubscriptionTier
+	return db.DB.Where("id = ? AND creator_id = ? AND archived = ?", tierID, creatorID, false).First(&tier).Error
+}
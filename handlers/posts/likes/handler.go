@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"pec2-backend/db"
 	"pec2-backend/models"
+	"pec2-backend/services/notifications"
+	"pec2-backend/services/realtime"
 	"pec2-backend/utils"
 	"time"
 
@@ -80,6 +82,21 @@ func ToggleLike(c *gin.Context) {
 	var likesCount int64
 	db.DB.Model(&models.Like{}).Where("post_id = ?", postID).Count(&likesCount)
 
+	if post.UserID != like.UserID {
+		realtime.PublishToUser(post.UserID, realtime.EventPostLiked, gin.H{
+			"postId":     postID,
+			"userId":     like.UserID,
+			"likesCount": likesCount,
+		})
+	}
+	notifications.Notify(notifications.Event{
+		UserID:   post.UserID,
+		Type:     models.NotificationPostLiked,
+		GroupKey: "post:" + postID,
+		ActorID:  like.UserID,
+		PostID:   postID,
+	})
+
 	utils.LogSuccessWithUser(userID, "Like added successfully in ToggleLike")
 	c.JSON(http.StatusOK, gin.H{
 		"message":    "Like added successfully",
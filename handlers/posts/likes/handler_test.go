@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"pec2-backend/services/realtime"
 	"pec2-backend/testutils"
 	"testing"
 	"time"
@@ -74,6 +75,10 @@ func TestToggleLike_Add(t *testing.T) {
 		ToggleLike(c)
 	})
 
+	// L'auteur du post est prévenu sur son flux /events
+	subscription := realtime.Subscribe(realtime.UserTopic("author-uuid"), 0)
+	defer subscription.Close()
+
 	req, _ := http.NewRequest(http.MethodPost, "/posts/"+postID+"/like", nil)
 	resp := httptest.NewRecorder()
 
@@ -85,6 +90,11 @@ func TestToggleLike_Add(t *testing.T) {
 	assert.Equal(t, "Like added successfully", response["message"])
 	assert.Equal(t, "added", response["action"])
 	assert.Equal(t, float64(1), response["likesCount"])
+
+	var event realtime.UserEvent
+	assert.NoError(t, json.Unmarshal((<-subscription.C).Data, &event))
+	assert.Equal(t, realtime.EventPostLiked, event.Type)
+	assert.Equal(t, userID, event.Payload.(map[string]interface{})["userId"])
 }
 
 // Test la suppression d'un like existant
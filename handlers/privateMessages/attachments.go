@@ -0,0 +1,135 @@
+package privateMessages
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/access"
+	"pec2-backend/services/messaging"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary Send a private message with a picture
+// @Description Send a private message with a picture attachment. Content creators can lock the picture behind a one-off price (in cents) that the receiver pays to unlock it
+// @Tags private-messages
+// @Accept multipart/form-data
+// @Produce json
+// @Param receiverUserName formData string true "Username of the receiver"
+// @Param content formData string false "Message content"
+// @Param price formData int false "Unlock price in cents (content creators only, 0 for a free picture)"
+// @Param attachment formData file true "Picture"
+// @Security BearerAuth
+// @Success 201 {object} models.PrivateMessage "Created message"
+// @Failure 400 {object} map[string]string "error: Invalid request data"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Only content creators can send paid pictures / Receiver has disabled private messages / You cannot send a message to this user"
+// @Failure 404 {object} map[string]string "error: Receiver not found"
+// @Failure 500 {object} map[string]string "error: Error creating message"
+// @Router /private-messages/attachments [post]
+func CreatePrivateMessageWithAttachment(c *gin.Context) {
+	senderID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated in CreatePrivateMessageWithAttachment")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	receiverUserName := c.PostForm("receiverUserName")
+	if receiverUserName == "" {
+		utils.LogError(nil, "Receiver missing in CreatePrivateMessageWithAttachment")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "receiverUserName is required"})
+		return
+	}
+
+	price := 0
+	if priceParam := c.PostForm("price"); priceParam != "" {
+		var err error
+		if price, err = strconv.Atoi(priceParam); err != nil || price < 0 {
+			utils.LogError(err, "Invalid price in CreatePrivateMessageWithAttachment")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price"})
+			return
+		}
+	}
+	if price > 0 {
+		role, _ := c.Get("role")
+		if role != string(models.ContentCreator) {
+			utils.LogError(nil, "Paid picture sent by a non creator in CreatePrivateMessageWithAttachment")
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only content creators can send paid pictures"})
+			return
+		}
+		if price < models.MinAttachmentPrice || price > models.MaxAttachmentPrice {
+			utils.LogError(nil, "Price out of range in CreatePrivateMessageWithAttachment")
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Price must be between %d and %d cents", models.MinAttachmentPrice, models.MaxAttachmentPrice)})
+			return
+		}
+	}
+
+	file, err := c.FormFile("attachment")
+	if err != nil {
+		utils.LogError(err, "Attachment missing in CreatePrivateMessageWithAttachment")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "attachment is required"})
+		return
+	}
+
+	var receiver models.User
+	if result := db.DB.Where("user_name = ?", receiverUserName).First(&receiver); result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			utils.LogError(result.Error, "Receiver not found in CreatePrivateMessageWithAttachment")
+			c.JSON(http.StatusNotFound, gin.H{"error": "Receiver not found"})
+		} else {
+			utils.LogError(result.Error, "Error verifying receiver in CreatePrivateMessageWithAttachment")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying receiver: " + result.Error.Error()})
+		}
+		return
+	}
+	if receiver.ID == senderID.(string) {
+		utils.LogError(messaging.ErrSelfMessage, "Message to self in CreatePrivateMessageWithAttachment")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot send a message to yourself"})
+		return
+	}
+	if !receiver.MessageEnable {
+		utils.LogError(nil, "Receiver has disabled private messages in CreatePrivateMessageWithAttachment")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Receiver has disabled private messages"})
+		return
+	}
+	blocked, err := access.IsBlocked(senderID.(string), receiver.ID)
+	if err != nil {
+		utils.LogError(err, "Error checking blocks in CreatePrivateMessageWithAttachment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying receiver"})
+		return
+	}
+	if blocked {
+		utils.LogError(nil, "Blocked user in CreatePrivateMessageWithAttachment")
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot send a message to this user"})
+		return
+	}
+
+	variants, err := utils.UploadPicture(file, "message_attachments", "message")
+	if err != nil {
+		utils.LogError(err, "Error uploading picture in CreatePrivateMessageWithAttachment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error uploading picture: " + err.Error()})
+		return
+	}
+
+	attachment := models.MessageAttachment{
+		PictureURL:      variants.Full,
+		PictureVariants: variants,
+		Price:           price,
+	}
+	privateMessage, err := messaging.SendMessageWithAttachment(senderID.(string), receiver, c.PostForm("content"), &attachment)
+	if err != nil {
+		utils.DeletePicture(attachment.PictureURL, attachment.PictureVariants)
+		utils.LogError(err, "Error creating private message in CreatePrivateMessageWithAttachment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating message: " + err.Error()})
+		return
+	}
+
+	utils.LogSuccessWithUser(senderID, "Private message with attachment created successfully in CreatePrivateMessageWithAttachment")
+	c.JSON(http.StatusCreated, privateMessage)
+}
@@ -0,0 +1,61 @@
+package privateMessages
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pec2-backend/testutils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func attachmentRequest(fields map[string]string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, value := range fields {
+		writer.WriteField(key, value)
+	}
+	part, _ := writer.CreateFormFile("attachment", "picture.png")
+	part.Write([]byte("fake image"))
+	writer.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, "/private-messages/attachments", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func setupAttachmentRouter(role string) *gin.Engine {
+	r := testutils.SetupTestRouter()
+	r.POST("/private-messages/attachments", func(c *gin.Context) {
+		c.Set("user_id", "aaaa")
+		c.Set("role", role)
+		CreatePrivateMessageWithAttachment(c)
+	})
+	return r
+}
+
+func TestCreatePrivateMessageWithAttachment_PaidReservedToCreators(t *testing.T) {
+	resp := httptest.NewRecorder()
+	setupAttachmentRouter("USER").ServeHTTP(resp, attachmentRequest(map[string]string{
+		"receiverUserName": "bob",
+		"price":            "500",
+	}))
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Contains(t, resp.Body.String(), "Only content creators")
+}
+
+func TestCreatePrivateMessageWithAttachment_PriceOutOfRange(t *testing.T) {
+	resp := httptest.NewRecorder()
+	setupAttachmentRouter("CONTENT_CREATOR").ServeHTTP(resp, attachmentRequest(map[string]string{
+		"receiverUserName": "bob",
+		"price":            "10",
+	}))
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), "Price must be between")
+}
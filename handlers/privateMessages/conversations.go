@@ -0,0 +1,353 @@
+package privateMessages
+
+import (
+	"net/http"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/messaging"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadConversation récupère la conversation de l'URL en vérifiant que l'utilisateur y participe
+func loadConversation(c *gin.Context, handlerName string) (models.Conversation, models.ConversationParticipant, string, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated in "+handlerName)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return models.Conversation{}, models.ConversationParticipant{}, "", false
+	}
+
+	conversation, participant, err := messaging.GetParticipant(c.Param("id"), userID.(string))
+	if err == messaging.ErrConversationNotFound {
+		utils.LogError(err, "Conversation not found in "+handlerName)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return conversation, participant, "", false
+	}
+	if err != nil {
+		utils.LogError(err, "Error retrieving conversation in "+handlerName)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving conversation"})
+		return conversation, participant, "", false
+	}
+
+	return conversation, participant, userID.(string), true
+}
+
+// @Summary Get my conversations
+// @Description List the conversations of the authenticated user, most recent first, with the other participant, the last message and the unread count. Archived conversations are listed separately with archived=true
+// @Tags private-messages
+// @Produce json
+// @Param archived query bool false "List the archived conversations"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of conversations per page" default(20)
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "conversations, unreadCount, pagination"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 500 {object} map[string]string "error: Error retrieving conversations"
+// @Router /private-messages/conversations [get]
+func GetConversations(c *gin.Context) {
+	listConversations(c, "GetConversations", models.MessageRequestAccepted)
+}
+
+// @Summary Get my message requests
+// @Description List the conversations opened by users the authenticated user does not follow (and who are not subscribers, depending on the directMessages setting), most recent first. They can be accepted, declined or blocked
+// @Tags private-messages
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of conversations per page" default(20)
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "conversations, unreadCount, pagination"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 500 {object} map[string]string "error: Error retrieving conversations"
+// @Router /private-messages/requests [get]
+func GetMessageRequests(c *gin.Context) {
+	listConversations(c, "GetMessageRequests", models.MessageRequestPending)
+}
+
+// listConversations liste les conversations de l'utilisateur dans la boîte principale ou dans les demandes
+func listConversations(c *gin.Context, handlerName string, requestStatus models.MessageRequestStatus) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated in "+handlerName)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	page, limit := utils.GetPagination(c)
+
+	query := db.DB.Table("conversation_participants").
+		Joins("JOIN conversations ON conversations.id = conversation_participants.conversation_id").
+		Where("conversation_participants.user_id = ? AND conversations.last_message_at IS NOT NULL", userID).
+		Where("conversation_participants.cleared_at IS NULL OR conversations.last_message_at > conversation_participants.cleared_at").
+		Where("conversation_participants.request_status = ?", requestStatus)
+	if c.Query("archived") == "true" {
+		query = query.Where("conversation_participants.archived_at IS NOT NULL")
+	} else {
+		query = query.Where("conversation_participants.archived_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		utils.LogError(err, "Error counting conversations in "+handlerName)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving conversations"})
+		return
+	}
+
+	var rows []struct {
+		models.Conversation
+		ArchivedAt *time.Time
+	}
+	if err := query.Select("conversations.*, conversation_participants.archived_at").
+		Order("conversations.last_message_at DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Scan(&rows).Error; err != nil {
+		utils.LogError(err, "Error retrieving conversations in "+handlerName)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving conversations"})
+		return
+	}
+
+	conversationIDs := []string{}
+	lastMessageIDs := []string{}
+	otherIDs := []string{}
+	for _, row := range rows {
+		conversationIDs = append(conversationIDs, row.ID)
+		otherIDs = append(otherIDs, row.OtherUserID(userID.(string)))
+		if row.LastMessageID != nil {
+			lastMessageIDs = append(lastMessageIDs, *row.LastMessageID)
+		}
+	}
+
+	// Derniers messages, participants et non lus en une requête chacun
+	lastMessages := map[string]models.PrivateMessage{}
+	unreadCounts := map[string]int64{}
+	participants := map[string]models.ConversationUser{}
+	if len(rows) > 0 {
+		var messages []models.PrivateMessage
+		if err := db.DB.Where("id IN ?", lastMessageIDs).Find(&messages).Error; err != nil {
+			utils.LogError(err, "Error retrieving last messages in "+handlerName)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving conversations"})
+			return
+		}
+		for _, message := range messages {
+			lastMessages[message.ID] = message
+		}
+
+		var users []models.ConversationUser
+		if err := db.DB.Model(&models.User{}).Select("id, user_name, profile_picture, message_enable").
+			Where("id IN ?", otherIDs).Find(&users).Error; err != nil {
+			utils.LogError(err, "Error retrieving participants in "+handlerName)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving conversations"})
+			return
+		}
+		for _, user := range users {
+			participants[user.ID] = user
+		}
+
+		var counts []struct {
+			ConversationID string
+			Count          int64
+		}
+		if err := db.DB.Model(&models.PrivateMessage{}).Select("conversation_id, COUNT(*) AS count").
+			Where("conversation_id IN ? AND receiver_id = ? AND status = ? AND deleted_at IS NULL",
+				conversationIDs, userID, models.MessageStatusUnread).
+			Group("conversation_id").Scan(&counts).Error; err != nil {
+			utils.LogError(err, "Error counting unread messages in "+handlerName)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving conversations"})
+			return
+		}
+		for _, count := range counts {
+			unreadCounts[count.ConversationID] = count.Count
+		}
+	}
+
+	conversations := make([]models.ConversationResponse, 0, len(rows))
+	for _, row := range rows {
+		response := models.ConversationResponse{
+			ID:          row.ID,
+			UnreadCount: unreadCounts[row.ID],
+			Archived:    row.ArchivedAt != nil,
+			UpdatedAt:   row.LastMessageAt,
+		}
+		if participant, ok := participants[row.OtherUserID(userID.(string))]; ok {
+			response.Participant = &participant
+		}
+		if row.LastMessageID != nil {
+			if message, ok := lastMessages[*row.LastMessageID]; ok {
+				response.LastMessage = &message
+			}
+		}
+		conversations = append(conversations, response)
+	}
+
+	// Non lus de la boîte affichée uniquement : les demandes ne comptent pas dans la boîte principale
+	var unreadCount int64
+	if err := db.DB.Model(&models.PrivateMessage{}).
+		Where("receiver_id = ? AND status = ? AND deleted_at IS NULL", userID, models.MessageStatusUnread).
+		Where("conversation_id IN (?)", db.DB.Model(&models.ConversationParticipant{}).Select("conversation_id").
+			Where("user_id = ? AND request_status = ?", userID, requestStatus)).
+		Count(&unreadCount).Error; err != nil {
+		utils.LogError(err, "Error counting unread messages in "+handlerName)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving conversations"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Conversations retrieved successfully in "+handlerName)
+	c.JSON(http.StatusOK, gin.H{
+		"conversations": conversations,
+		"unreadCount":   unreadCount,
+		"pagination":    utils.PaginationResponse(total, page, limit),
+	})
+}
+
+// @Summary Get the messages of a conversation
+// @Description Paginated history of a conversation, newest first. Messages sent before the user deleted the conversation are not returned
+// @Tags private-messages
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of messages per page" default(20)
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "messages, pagination"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Conversation not found"
+// @Failure 500 {object} map[string]string "error: Error retrieving messages"
+// @Router /private-messages/conversations/{id}/messages [get]
+func GetConversationMessages(c *gin.Context) {
+	conversation, participant, userID, ok := loadConversation(c, "GetConversationMessages")
+	if !ok {
+		return
+	}
+
+	page, limit := utils.GetPagination(c)
+
+	query := db.DB.Model(&models.PrivateMessage{}).Where("conversation_id = ? AND deleted_at IS NULL", conversation.ID)
+	if participant.ClearedAt != nil {
+		query = query.Where("created_at > ?", *participant.ClearedAt)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		utils.LogError(err, "Error counting messages in GetConversationMessages")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving messages"})
+		return
+	}
+
+	var messages []models.PrivateMessage
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&messages).Error; err != nil {
+		utils.LogError(err, "Error retrieving messages in GetConversationMessages")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving messages"})
+		return
+	}
+	if err := messaging.LoadAttachments(messages, userID); err != nil {
+		utils.LogError(err, "Error retrieving attachments in GetConversationMessages")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving messages"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Conversation messages retrieved successfully in GetConversationMessages")
+	c.JSON(http.StatusOK, gin.H{
+		"messages":   messages,
+		"pagination": utils.PaginationResponse(total, page, limit),
+	})
+}
+
+// @Summary Mark a conversation as read
+// @Description Mark every unread message received in the conversation as read
+// @Tags private-messages
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "message, updated"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Conversation not found"
+// @Failure 500 {object} map[string]string "error: Error updating messages"
+// @Router /private-messages/conversations/{id}/read [patch]
+func MarkConversationAsRead(c *gin.Context) {
+	conversation, _, userID, ok := loadConversation(c, "MarkConversationAsRead")
+	if !ok {
+		return
+	}
+
+	messageIDs, err := messaging.MarkConversationRead(conversation, userID)
+	if err != nil {
+		utils.LogError(err, "Error updating messages in MarkConversationAsRead")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating messages"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Conversation marked as read in MarkConversationAsRead")
+	c.JSON(http.StatusOK, gin.H{"message": "Conversation marked as read", "updated": len(messageIDs)})
+}
+
+// @Summary Archive or unarchive a conversation
+// @Description Archive a conversation for the authenticated user only. The received messages get the ARCHIVED status (READ when unarchived). A new message brings the conversation back
+// @Tags private-messages
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param archived body map[string]bool true "archived: true to archive, false to unarchive"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message"
+// @Failure 400 {object} map[string]string "error: Invalid data"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Conversation not found"
+// @Failure 500 {object} map[string]string "error: Error updating conversation"
+// @Router /private-messages/conversations/{id}/archive [patch]
+func ArchiveConversation(c *gin.Context) {
+	conversation, _, userID, ok := loadConversation(c, "ArchiveConversation")
+	if !ok {
+		return
+	}
+
+	var archiveData struct {
+		Archived *bool `json:"archived" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&archiveData); err != nil {
+		utils.LogError(err, "Invalid data in ArchiveConversation")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	if err := messaging.ArchiveConversation(conversation.ID, userID, *archiveData.Archived); err != nil {
+		utils.LogError(err, "Error updating conversation in ArchiveConversation")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating conversation"})
+		return
+	}
+
+	message := "Conversation unarchived"
+	if *archiveData.Archived {
+		message = "Conversation archived"
+	}
+	utils.LogSuccessWithUser(userID, message+" in ArchiveConversation")
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// @Summary Delete a conversation
+// @Description Delete a conversation for the authenticated user only: its history is hidden and the received messages get the DELETED status. The other participant keeps the conversation
+// @Tags private-messages
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message: Conversation deleted"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Conversation not found"
+// @Failure 500 {object} map[string]string "error: Error deleting conversation"
+// @Router /private-messages/conversations/{id} [delete]
+func DeleteConversation(c *gin.Context) {
+	conversation, _, userID, ok := loadConversation(c, "DeleteConversation")
+	if !ok {
+		return
+	}
+
+	if err := messaging.DeleteConversation(conversation.ID, userID); err != nil {
+		utils.LogError(err, "Error deleting conversation in DeleteConversation")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting conversation"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Conversation deleted in DeleteConversation")
+	c.JSON(http.StatusOK, gin.H{"message": "Conversation deleted"})
+}
@@ -0,0 +1,207 @@
+package privateMessages
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	testutils.InitTestMain()
+
+	log.SetOutput(io.Discard)
+
+	exitCode := m.Run()
+
+	log.SetOutput(os.Stdout)
+
+	os.Exit(exitCode)
+}
+
+func setupRouter(userID string) *gin.Engine {
+	r := testutils.SetupTestRouter()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Next()
+	})
+	r.GET("/private-messages/conversations", GetConversations)
+	r.GET("/private-messages/conversations/:id/messages", GetConversationMessages)
+	return r
+}
+
+func TestGetConversations(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "conversation_participants" JOIN conversations ON conversations.id = conversation_participants.conversation_id WHERE .* AND conversation_participants.archived_at IS NULL`).
+		WithArgs("aaaa", models.MessageRequestAccepted).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT conversations.\*, conversation_participants.archived_at FROM "conversation_participants" .* ORDER BY conversations.last_message_at DESC LIMIT \$3`).
+		WithArgs("aaaa", models.MessageRequestAccepted, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_a_id", "user_b_id", "last_message_id", "last_message_at", "archived_at"}).
+			AddRow("conversation-uuid", "aaaa", "bbbb", "message-uuid", now, nil))
+	mock.ExpectQuery(`SELECT \* FROM "private_messages" WHERE id IN \(\$1\)`).
+		WithArgs("message-uuid").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "conversation_id", "sender_id", "receiver_id", "content", "status"}).
+			AddRow("message-uuid", "conversation-uuid", "bbbb", "aaaa", "Salut", "UNREAD"))
+	mock.ExpectQuery(`SELECT id, user_name, profile_picture, message_enable FROM "users" WHERE id IN \(\$1\)`).
+		WithArgs("bbbb").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_name", "profile_picture", "message_enable"}).
+			AddRow("bbbb", "bob", "", true))
+	mock.ExpectQuery(`SELECT conversation_id, COUNT\(\*\) AS count FROM "private_messages" WHERE conversation_id IN \(\$1\) AND receiver_id = \$2 AND status = \$3 AND deleted_at IS NULL GROUP BY "conversation_id"`).
+		WithArgs("conversation-uuid", "aaaa", "UNREAD").
+		WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "count"}).AddRow("conversation-uuid", 2))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "private_messages" WHERE \(receiver_id = \$1 AND status = \$2 AND deleted_at IS NULL\) AND conversation_id IN \(SELECT "conversation_id" FROM "conversation_participants" WHERE user_id = \$3 AND request_status = \$4\)`).
+		WithArgs("aaaa", "UNREAD", "aaaa", models.MessageRequestAccepted).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+
+	req, _ := http.NewRequest(http.MethodGet, "/private-messages/conversations", nil)
+	resp := httptest.NewRecorder()
+	setupRouter("aaaa").ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var response struct {
+		Conversations []struct {
+			ID          string `json:"id"`
+			UnreadCount int64  `json:"unreadCount"`
+			Archived    bool   `json:"archived"`
+			Participant struct {
+				UserName string `json:"userName"`
+			} `json:"participant"`
+			LastMessage struct {
+				Content string `json:"content"`
+			} `json:"lastMessage"`
+		} `json:"conversations"`
+		UnreadCount int64 `json:"unreadCount"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &response))
+	assert.Len(t, response.Conversations, 1)
+	assert.Equal(t, "conversation-uuid", response.Conversations[0].ID)
+	assert.Equal(t, "bob", response.Conversations[0].Participant.UserName)
+	assert.Equal(t, "Salut", response.Conversations[0].LastMessage.Content)
+	assert.Equal(t, int64(2), response.Conversations[0].UnreadCount)
+	assert.False(t, response.Conversations[0].Archived)
+	assert.Equal(t, int64(5), response.UnreadCount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetConversationMessages_NotParticipant(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "conversation_participants" WHERE conversation_id = \$1 AND user_id = \$2`).
+		WithArgs("conversation-uuid", "cccc", 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	req, _ := http.NewRequest(http.MethodGet, "/private-messages/conversations/conversation-uuid/messages", nil)
+	resp := httptest.NewRecorder()
+	setupRouter("cccc").ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetConversationMessages_HidesClearedHistory(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	clearedAt := time.Now().Add(-time.Hour)
+
+	mock.ExpectQuery(`SELECT \* FROM "conversation_participants" WHERE conversation_id = \$1 AND user_id = \$2`).
+		WithArgs("conversation-uuid", "aaaa", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "user_id", "cleared_at"}).
+			AddRow("conversation-uuid", "aaaa", clearedAt))
+	mock.ExpectQuery(`SELECT \* FROM "conversations" WHERE id = \$1`).
+		WithArgs("conversation-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_a_id", "user_b_id"}).AddRow("conversation-uuid", "aaaa", "bbbb"))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "private_messages" WHERE \(conversation_id = \$1 AND deleted_at IS NULL\) AND created_at > \$2`).
+		WithArgs("conversation-uuid", clearedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT \* FROM "private_messages" WHERE \(conversation_id = \$1 AND deleted_at IS NULL\) AND created_at > \$2 ORDER BY created_at DESC LIMIT \$3`).
+		WithArgs("conversation-uuid", clearedAt, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content"}).AddRow("message-uuid", "Nouveau message"))
+	mock.ExpectQuery(`SELECT \* FROM "message_attachments" WHERE message_id IN \(\$1\)`).
+		WithArgs("message-uuid").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "message_id"}))
+
+	req, _ := http.NewRequest(http.MethodGet, "/private-messages/conversations/conversation-uuid/messages", nil)
+	resp := httptest.NewRecorder()
+	setupRouter("aaaa").ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "Nouveau message")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetConversationMessages_LockedAttachment(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "conversation_participants" WHERE conversation_id = \$1 AND user_id = \$2`).
+		WithArgs("conversation-uuid", "aaaa", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "user_id"}).AddRow("conversation-uuid", "aaaa"))
+	mock.ExpectQuery(`SELECT \* FROM "conversations" WHERE id = \$1`).
+		WithArgs("conversation-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_a_id", "user_b_id"}).AddRow("conversation-uuid", "aaaa", "bbbb"))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "private_messages"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`SELECT \* FROM "private_messages" WHERE conversation_id = \$1 AND deleted_at IS NULL ORDER BY created_at DESC LIMIT \$2`).
+		WithArgs("conversation-uuid", 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "receiver_id", "content"}).
+			AddRow("message-1", "bbbb", "aaaa", "Exclu").
+			AddRow("message-2", "bbbb", "aaaa", "Cadeau"))
+	mock.ExpectQuery(`SELECT \* FROM "message_attachments" WHERE message_id IN \(\$1,\$2\) ORDER BY created_at`).
+		WithArgs("message-1", "message-2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "message_id", "sender_id", "receiver_id", "picture_url", "price"}).
+			AddRow("attachment-paid", "message-1", "bbbb", "aaaa", "http://example.com/paid.jpg", 500).
+			AddRow("attachment-unlocked", "message-2", "bbbb", "aaaa", "http://example.com/unlocked.jpg", 300))
+	mock.ExpectQuery(`SELECT "attachment_id" FROM "message_unlocks" WHERE user_id = \$1 AND attachment_id IN \(\$2,\$3\) AND status = \$4`).
+		WithArgs("aaaa", "attachment-paid", "attachment-unlocked", "SUCCEEDED").
+		WillReturnRows(sqlmock.NewRows([]string{"attachment_id"}).AddRow("attachment-unlocked"))
+
+	req, _ := http.NewRequest(http.MethodGet, "/private-messages/conversations/conversation-uuid/messages", nil)
+	resp := httptest.NewRecorder()
+	setupRouter("aaaa").ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var response struct {
+		Messages []struct {
+			ID          string `json:"id"`
+			Attachments []struct {
+				Price      int    `json:"price"`
+				Locked     bool   `json:"locked"`
+				PictureURL string `json:"pictureUrl"`
+			} `json:"attachments"`
+		} `json:"messages"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &response))
+	assert.Len(t, response.Messages, 2)
+
+	locked := response.Messages[0].Attachments[0]
+	assert.True(t, locked.Locked)
+	assert.Empty(t, locked.PictureURL)
+	assert.Equal(t, 500, locked.Price)
+
+	unlocked := response.Messages[1].Attachments[0]
+	assert.False(t, unlocked.Locked)
+	assert.Contains(t, unlocked.PictureURL, "/media/messages/attachment-unlocked?")
+	assert.NotContains(t, resp.Body.String(), "example.com")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"pec2-backend/db"
 	"pec2-backend/models"
+	"pec2-backend/services/messaging"
 	"pec2-backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -20,6 +21,7 @@ import (
 // @Success 201 {object} models.PrivateMessage "Created message"
 // @Failure 400 {object} map[string]string "error: Invalid request data"
 // @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Receiver has disabled private messages / You cannot send a message to this user"
 // @Failure 404 {object} map[string]string "error: Receiver not found"
 // @Failure 500 {object} map[string]string "error: Error creating message"
 // @Router /private-messages [post]
@@ -50,22 +52,25 @@ func CreatePrivateMessage(c *gin.Context) {
 		return
 	}
 
-	if !receiver.MessageEnable {
+	privateMessage, err := messaging.SendMessage(senderID.(string), receiver, messageCreate.Content)
+	if err == messaging.ErrSelfMessage {
+		utils.LogError(err, "Message to self in CreatePrivateMessage")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot send a message to yourself"})
+		return
+	}
+	if err == messaging.ErrMessagesDisabled {
 		utils.LogError(nil, "Receiver has disabled private messages in CreatePrivateMessage")
 		c.JSON(http.StatusForbidden, gin.H{"error": "Receiver has disabled private messages"})
 		return
 	}
-
-	privateMessage := models.PrivateMessage{
-		SenderID:   senderID.(string),
-		ReceiverID: receiver.ID,
-		Content:    messageCreate.Content,
-		Status:     models.MessageStatusUnread,
+	if err == messaging.ErrBlocked {
+		utils.LogError(err, "Blocked user in CreatePrivateMessage")
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot send a message to this user"})
+		return
 	}
-
-	if result := db.DB.Create(&privateMessage); result.Error != nil {
-		utils.LogError(result.Error, "Error creating private message in CreatePrivateMessage")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating message: " + result.Error.Error()})
+	if err != nil {
+		utils.LogError(err, "Error creating private message in CreatePrivateMessage")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating message: " + err.Error()})
 		return
 	}
 
@@ -73,6 +78,24 @@ func CreatePrivateMessage(c *gin.Context) {
 	c.JSON(http.StatusCreated, privateMessage)
 }
 
+// usersByID récupère en une requête les utilisateurs des messages
+func usersByID(ids []string) map[string]models.User {
+	users := map[string]models.User{}
+	if len(ids) == 0 {
+		return users
+	}
+
+	var list []models.User
+	if err := db.DB.Select("id, user_name, profile_picture, message_enable").Where("id IN ?", ids).Find(&list).Error; err != nil {
+		utils.LogError(err, "Error retrieving message users in usersByID")
+		return users
+	}
+	for _, user := range list {
+		users[user.ID] = user
+	}
+	return users
+}
+
 // @Summary Get user messages
 // @Description Get all messages sent and received by the authenticated user
 // @Tags private-messages
@@ -102,6 +125,12 @@ func GetUserMessages(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving messages: " + result.Error.Error()})
 		return
 	}
+
+	if err := messaging.LoadAttachments(messages, userID.(string)); err != nil {
+		utils.LogError(err, "Error retrieving attachments in GetUserMessages")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving messages: " + err.Error()})
+		return
+	}
 	type EnhancedMessage struct {
 		models.PrivateMessage
 		SenderName          string `json:"senderName"`
@@ -113,12 +142,14 @@ func GetUserMessages(c *gin.Context) {
 
 	var enhancedMessages []EnhancedMessage
 
+	ids := []string{}
 	for _, msg := range messages {
-		var sender, receiver models.User
-
-		db.DB.Select("user_name, message_enable").Where("id = ?", msg.SenderID).First(&sender)
+		ids = append(ids, msg.SenderID, msg.ReceiverID)
+	}
+	users := usersByID(ids)
 
-		db.DB.Select("user_name, message_enable").Where("id = ?", msg.ReceiverID).First(&receiver)
+	for _, msg := range messages {
+		sender, receiver := users[msg.SenderID], users[msg.ReceiverID]
 
 		enhancedMsg := EnhancedMessage{
 			PrivateMessage: msg,
@@ -166,6 +197,12 @@ func GetReceivedMessages(c *gin.Context) {
 		return
 	}
 
+	if err := messaging.LoadAttachments(messages, userID.(string)); err != nil {
+		utils.LogError(err, "Error retrieving attachments in GetReceivedMessages")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving messages: " + err.Error()})
+		return
+	}
+
 	type EnhancedMessage struct {
 		models.PrivateMessage
 		SenderName string `json:"senderName"`
@@ -173,10 +210,14 @@ func GetReceivedMessages(c *gin.Context) {
 
 	var enhancedMessages []EnhancedMessage
 
+	ids := []string{}
 	for _, msg := range messages {
-		var sender models.User
+		ids = append(ids, msg.SenderID)
+	}
+	users := usersByID(ids)
 
-		db.DB.Select("user_name").Where("id = ?", msg.SenderID).First(&sender)
+	for _, msg := range messages {
+		sender := users[msg.SenderID]
 
 		enhancedMsg := EnhancedMessage{
 			PrivateMessage: msg,
@@ -220,6 +261,12 @@ func GetSentMessages(c *gin.Context) {
 		return
 	}
 
+	if err := messaging.LoadAttachments(messages, userID.(string)); err != nil {
+		utils.LogError(err, "Error retrieving attachments in GetSentMessages")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving messages: " + err.Error()})
+		return
+	}
+
 	type EnhancedMessage struct {
 		models.PrivateMessage
 		ReceiverName string `json:"receiverName"`
@@ -227,10 +274,14 @@ func GetSentMessages(c *gin.Context) {
 
 	var enhancedMessages []EnhancedMessage
 
+	ids := []string{}
 	for _, msg := range messages {
-		var receiver models.User
+		ids = append(ids, msg.ReceiverID)
+	}
+	users := usersByID(ids)
 
-		db.DB.Select("user_name").Where("id = ?", msg.ReceiverID).First(&receiver)
+	for _, msg := range messages {
+		receiver := users[msg.ReceiverID]
 
 		enhancedMsg := EnhancedMessage{
 			PrivateMessage: msg,
@@ -303,6 +354,10 @@ func MarkMessageAsRead(c *gin.Context) {
 		return
 	}
 
+	if message.ConversationID != nil {
+		messaging.PublishReadReceipt(*message.ConversationID, message.ReceiverID, message.SenderID, []string{message.ID})
+	}
+
 	utils.LogSuccessWithUser(userID, "Message marked as read successfully in MarkMessageAsRead")
 	c.JSON(http.StatusOK, gin.H{"message": "Message marked as read"})
 }
@@ -0,0 +1,115 @@
+package privateMessages
+
+import (
+	"net/http"
+
+	"pec2-backend/models"
+	"pec2-backend/services/access"
+	"pec2-backend/services/messaging"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadMessageRequest récupère une demande de message (en attente ou refusée) de l'utilisateur connecté
+func loadMessageRequest(c *gin.Context, handlerName string) (models.Conversation, string, bool) {
+	conversation, participant, userID, ok := loadConversation(c, handlerName)
+	if !ok {
+		return conversation, "", false
+	}
+	if participant.RequestStatus != models.MessageRequestPending && participant.RequestStatus != models.MessageRequestDeclined {
+		utils.LogError(nil, "Conversation is not a message request in "+handlerName)
+		c.JSON(http.StatusConflict, gin.H{"error": "Conversation is not a message request"})
+		return conversation, "", false
+	}
+	return conversation, userID, true
+}
+
+// @Summary Accept a message request
+// @Description Move a pending or declined message request to the main inbox. Replying to a request also accepts it
+// @Tags private-messages
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message: Message request accepted"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Conversation not found"
+// @Failure 409 {object} map[string]string "error: Conversation is not a message request"
+// @Failure 500 {object} map[string]string "error: Error updating conversation"
+// @Router /private-messages/requests/{id}/accept [post]
+func AcceptMessageRequest(c *gin.Context) {
+	conversation, userID, ok := loadMessageRequest(c, "AcceptMessageRequest")
+	if !ok {
+		return
+	}
+
+	if err := messaging.SetRequestStatus(conversation.ID, userID, models.MessageRequestAccepted); err != nil {
+		utils.LogError(err, "Error updating conversation in AcceptMessageRequest")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating conversation"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Message request accepted in AcceptMessageRequest")
+	c.JSON(http.StatusOK, gin.H{"message": "Message request accepted"})
+}
+
+// @Summary Decline a message request
+// @Description Hide a pending message request. The sender is not told, and their next messages stay hidden without notification
+// @Tags private-messages
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message: Message request declined"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Conversation not found"
+// @Failure 409 {object} map[string]string "error: Conversation is not a message request"
+// @Failure 500 {object} map[string]string "error: Error updating conversation"
+// @Router /private-messages/requests/{id}/decline [post]
+func DeclineMessageRequest(c *gin.Context) {
+	conversation, userID, ok := loadMessageRequest(c, "DeclineMessageRequest")
+	if !ok {
+		return
+	}
+
+	if err := messaging.SetRequestStatus(conversation.ID, userID, models.MessageRequestDeclined); err != nil {
+		utils.LogError(err, "Error updating conversation in DeclineMessageRequest")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating conversation"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Message request declined in DeclineMessageRequest")
+	c.JSON(http.StatusOK, gin.H{"message": "Message request declined"})
+}
+
+// @Summary Block the sender of a message request
+// @Description Decline the message request and block its sender
+// @Tags private-messages
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message: Sender blocked"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Conversation not found"
+// @Failure 409 {object} map[string]string "error: Conversation is not a message request"
+// @Failure 500 {object} map[string]string "error: Error updating conversation"
+// @Router /private-messages/requests/{id}/block [post]
+func BlockMessageRequest(c *gin.Context) {
+	conversation, userID, ok := loadMessageRequest(c, "BlockMessageRequest")
+	if !ok {
+		return
+	}
+
+	if err := messaging.SetRequestStatus(conversation.ID, userID, models.MessageRequestDeclined); err != nil {
+		utils.LogError(err, "Error updating conversation in BlockMessageRequest")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating conversation"})
+		return
+	}
+	if err := access.Block(userID, conversation.OtherUserID(userID)); err != nil {
+		utils.LogError(err, "Error blocking sender in BlockMessageRequest")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error blocking sender"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Message request sender blocked in BlockMessageRequest")
+	c.JSON(http.StatusOK, gin.H{"message": "Sender blocked"})
+}
@@ -0,0 +1,67 @@
+package privateMessages
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRequestsRouter(userID string) *gin.Engine {
+	r := testutils.SetupTestRouter()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Next()
+	})
+	r.POST("/private-messages/requests/:id/accept", AcceptMessageRequest)
+	r.POST("/private-messages/requests/:id/decline", DeclineMessageRequest)
+	return r
+}
+
+func expectParticipant(mock sqlmock.Sqlmock, status models.MessageRequestStatus) {
+	mock.ExpectQuery(`SELECT \* FROM "conversation_participants" WHERE conversation_id = \$1 AND user_id = \$2`).
+		WithArgs("conversation-uuid", "bbbb", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "user_id", "request_status"}).AddRow("conversation-uuid", "bbbb", status))
+	mock.ExpectQuery(`SELECT \* FROM "conversations" WHERE id = \$1`).
+		WithArgs("conversation-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_a_id", "user_b_id"}).AddRow("conversation-uuid", "aaaa", "bbbb"))
+}
+
+func TestDeclineMessageRequest(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectParticipant(mock, models.MessageRequestPending)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "conversation_participants" SET "request_status"=\$1 WHERE conversation_id = \$2 AND user_id = \$3`).
+		WithArgs(models.MessageRequestDeclined, "conversation-uuid", "bbbb").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	req, _ := http.NewRequest(http.MethodPost, "/private-messages/requests/conversation-uuid/decline", nil)
+	resp := httptest.NewRecorder()
+	setupRequestsRouter("bbbb").ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAcceptMessageRequest_AlreadyInInbox(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectParticipant(mock, models.MessageRequestAccepted)
+
+	req, _ := http.NewRequest(http.MethodPost, "/private-messages/requests/conversation-uuid/accept", nil)
+	resp := httptest.NewRecorder()
+	setupRequestsRouter("bbbb").ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
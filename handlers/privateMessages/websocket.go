@@ -0,0 +1,281 @@
+package privateMessages
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/messaging"
+	"pec2-backend/services/realtime"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+const (
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = 50 * time.Second
+	wsMaxMessageSize = 16 * 1024
+)
+
+// Types des trames échangées sur la WebSocket, en plus des évènements messaging.Chat*
+const (
+	wsSend  = "send"
+	wsAck   = "ack"
+	wsError = "error"
+)
+
+// L'authentification passe par le token JWT (header ou ?token=) et non par un cookie :
+// toutes les origines sont acceptées, comme pour le CORS de l'API
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// wsFrame est une trame envoyée par le client
+type wsFrame struct {
+	Type             string `json:"type"`
+	RequestID        string `json:"requestId"`
+	ConversationID   string `json:"conversationId"`
+	ReceiverUserName string `json:"receiverUserName"`
+	Content          string `json:"content"`
+	Typing           bool   `json:"typing"`
+}
+
+// wsReply répond à une trame du client, identifiée par son requestId
+type wsReply struct {
+	Type       string                 `json:"type"`
+	RequestID  string                 `json:"requestId,omitempty"`
+	Message    *models.PrivateMessage `json:"message,omitempty"`
+	MessageIDs []string               `json:"messageIds,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+type wsClient struct {
+	conn   *websocket.Conn
+	userID string
+	send   chan wsReply
+	done   chan struct{}
+}
+
+// @Summary Private messages WebSocket
+// @Description Open a WebSocket for the authenticated user (token in the Authorization header or the token query parameter). The server pushes "message", "typing" and "read" events to every connected device of the user. The client can send frames {"type":"send","requestId","receiverUserName"|"conversationId","content"}, {"type":"typing","conversationId","typing"} and {"type":"read","requestId","conversationId"}; each frame with a requestId is answered by an "ack" or an "error" frame
+// @Tags private-messages
+// @Security BearerAuth
+// @Param token query string false "JWT token, for clients that cannot set headers"
+// @Success 101 "Switching Protocols"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Router /private-messages/ws [get]
+func MessagesWebSocket(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated in MessagesWebSocket")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// En cas d'échec, l'upgrader a déjà répondu au client
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		utils.LogError(err, "Error upgrading connection in MessagesWebSocket")
+		return
+	}
+
+	client := &wsClient{
+		conn:   conn,
+		userID: userID.(string),
+		send:   make(chan wsReply, 16),
+		done:   make(chan struct{}),
+	}
+
+	// Un abonnement par connexion : chaque appareil reçoit tous les évènements de l'utilisateur
+	subscription := realtime.Subscribe(messaging.ChatTopic(client.userID), 0)
+	writerDone := make(chan struct{})
+	go func() {
+		client.writeLoop(subscription)
+		close(writerDone)
+	}()
+
+	client.readLoop()
+
+	close(client.done)
+	subscription.Close()
+	<-writerDone
+	conn.Close()
+}
+
+// writeLoop est le seul à écrire sur la connexion : évènements, réponses et pings
+func (client *wsClient) writeLoop(subscription *realtime.Subscription) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-subscription.C:
+			if !ok {
+				// Client trop lent : il se reconnecte et recharge les conversations
+				client.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+				client.conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "slow consumer"))
+				client.conn.Close()
+				return
+			}
+			client.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := client.conn.WriteMessage(websocket.TextMessage, event.Data); err != nil {
+				client.conn.Close()
+				return
+			}
+		case reply := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := client.conn.WriteJSON(reply); err != nil {
+				client.conn.Close()
+				return
+			}
+		case <-ticker.C:
+			client.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				client.conn.Close()
+				return
+			}
+		case <-client.done:
+			client.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			client.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+	}
+}
+
+// readLoop traite les trames du client jusqu'à la déconnexion
+func (client *wsClient) readLoop() {
+	client.conn.SetReadLimit(wsMaxMessageSize)
+	client.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := client.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				utils.LogError(err, "Unexpected close in MessagesWebSocket")
+			}
+			return
+		}
+		client.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		var frame wsFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			client.reply(wsReply{Type: wsError, Error: "Invalid frame"})
+			continue
+		}
+		client.handle(frame)
+	}
+}
+
+func (client *wsClient) reply(reply wsReply) {
+	select {
+	case client.send <- reply:
+	case <-client.done:
+	}
+}
+
+func (client *wsClient) fail(frame wsFrame, message string) {
+	client.reply(wsReply{Type: wsError, RequestID: frame.RequestID, Error: message})
+}
+
+func (client *wsClient) handle(frame wsFrame) {
+	switch frame.Type {
+	case wsSend:
+		client.handleSend(frame)
+	case messaging.ChatTyping:
+		conversation, ok := client.conversation(frame)
+		if ok {
+			messaging.PublishTyping(conversation, client.userID, frame.Typing)
+		}
+	case messaging.ChatRead:
+		conversation, ok := client.conversation(frame)
+		if !ok {
+			return
+		}
+		messageIDs, err := messaging.MarkConversationRead(conversation, client.userID)
+		if err != nil {
+			utils.LogError(err, "Error marking conversation as read in MessagesWebSocket")
+			client.fail(frame, "Error marking conversation as read")
+			return
+		}
+		client.reply(wsReply{Type: wsAck, RequestID: frame.RequestID, MessageIDs: messageIDs})
+	default:
+		client.fail(frame, "Unknown frame type")
+	}
+}
+
+// conversation vérifie que l'utilisateur participe à la conversation de la trame
+func (client *wsClient) conversation(frame wsFrame) (models.Conversation, bool) {
+	conversation, _, err := messaging.GetParticipant(frame.ConversationID, client.userID)
+	if err == messaging.ErrConversationNotFound {
+		client.fail(frame, "Conversation not found")
+		return conversation, false
+	}
+	if err != nil {
+		utils.LogError(err, "Error retrieving conversation in MessagesWebSocket")
+		client.fail(frame, "Error retrieving conversation")
+		return conversation, false
+	}
+	return conversation, true
+}
+
+func (client *wsClient) handleSend(frame wsFrame) {
+	if strings.TrimSpace(frame.Content) == "" {
+		client.fail(frame, "Content is required")
+		return
+	}
+
+	var receiver models.User
+	var err error
+	switch {
+	case frame.ConversationID != "":
+		conversation, ok := client.conversation(frame)
+		if !ok {
+			return
+		}
+		err = db.DB.First(&receiver, "id = ?", conversation.OtherUserID(client.userID)).Error
+	case frame.ReceiverUserName != "":
+		err = db.DB.Where("user_name = ?", frame.ReceiverUserName).First(&receiver).Error
+	default:
+		client.fail(frame, "conversationId or receiverUserName is required")
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		client.fail(frame, "Receiver not found")
+		return
+	}
+	if err != nil {
+		utils.LogError(err, "Error verifying receiver in MessagesWebSocket")
+		client.fail(frame, "Error verifying receiver")
+		return
+	}
+
+	message, err := messaging.SendMessage(client.userID, receiver, frame.Content)
+	switch {
+	case err == messaging.ErrSelfMessage:
+		client.fail(frame, "You cannot send a message to yourself")
+	case err == messaging.ErrMessagesDisabled:
+		client.fail(frame, "Receiver has disabled private messages")
+	case err == messaging.ErrBlocked:
+		client.fail(frame, "You cannot send a message to this user")
+	case err != nil:
+		utils.LogError(err, "Error creating private message in MessagesWebSocket")
+		client.fail(frame, "Error creating message")
+	default:
+		utils.LogSuccessWithUser(client.userID, "Private message sent in MessagesWebSocket")
+		client.reply(wsReply{Type: wsAck, RequestID: frame.RequestID, Message: &message})
+	}
+}
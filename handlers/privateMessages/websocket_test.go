@@ -0,0 +1,158 @@
+package privateMessages
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pec2-backend/models"
+	"pec2-backend/services/messaging"
+	"pec2-backend/services/realtime"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+type wsTestFrame struct {
+	Type       string                 `json:"type"`
+	RequestID  string                 `json:"requestId"`
+	UserID     string                 `json:"userId"`
+	Typing     *bool                  `json:"typing"`
+	Message    *models.PrivateMessage `json:"message"`
+	MessageIDs []string               `json:"messageIds"`
+	Error      string                 `json:"error"`
+}
+
+func dialMessagesWebSocket(t *testing.T, userID string) *websocket.Conn {
+	r := setupRouter(userID)
+	r.GET("/private-messages/ws", MessagesWebSocket)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/private-messages/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	// Une première réponse garantit que l'abonnement de la connexion est en place
+	if err := conn.WriteJSON(map[string]string{"type": "ping"}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "error", readFrame(t, conn).Type)
+	return conn
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) wsTestFrame {
+	var frame wsTestFrame
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func TestMessagesWebSocket_DeliversToEveryDevice(t *testing.T) {
+	realtime.SetBroker(realtime.NewMemoryBroker())
+
+	phone := dialMessagesWebSocket(t, "aaaa")
+	laptop := dialMessagesWebSocket(t, "aaaa")
+
+	messaging.PublishTyping(models.Conversation{ID: "conversation-uuid", UserAID: "aaaa", UserBID: "bbbb"}, "bbbb", true)
+
+	for _, conn := range []*websocket.Conn{phone, laptop} {
+		frame := readFrame(t, conn)
+		assert.Equal(t, messaging.ChatTyping, frame.Type)
+		assert.Equal(t, "bbbb", frame.UserID)
+		assert.True(t, *frame.Typing)
+	}
+}
+
+func TestMessagesWebSocket_SendIsAcknowledged(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	realtime.SetBroker(realtime.NewMemoryBroker())
+	receiver := realtime.Subscribe(messaging.ChatTopic("bbbb"), 0)
+	defer receiver.Close()
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE user_name = \$1`).
+		WithArgs("bob", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_name", "message_enable"}).AddRow("bbbb", "bob", true))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "conversations" WHERE user_a_id = \$1 AND user_b_id = \$2`).
+		WithArgs("aaaa", "bbbb", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_a_id", "user_b_id", "last_message_id"}).
+			AddRow("conversation-uuid", "aaaa", "bbbb", "previous-message-uuid"))
+	mock.ExpectExec(`UPDATE "conversation_participants" SET "request_status"=\$1`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT \* FROM "conversation_participants" WHERE conversation_id = \$1 AND user_id = \$2`).
+		WithArgs("conversation-uuid", "bbbb", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "user_id", "request_status"}).AddRow("conversation-uuid", "bbbb", "ACCEPTED"))
+	mock.ExpectQuery(`INSERT INTO "private_messages" .* RETURNING "id"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow("message-uuid", "UNREAD"))
+	mock.ExpectExec(`UPDATE "conversations" SET`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "conversation_participants" SET "archived_at"=\$1`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	conn := dialMessagesWebSocket(t, "aaaa")
+	if err := conn.WriteJSON(map[string]string{
+		"type":             "send",
+		"requestId":        "request-1",
+		"receiverUserName": "bob",
+		"content":          "Bonjour",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// L'accusé et la copie du message pour les appareils de l'expéditeur arrivent dans un ordre quelconque
+	frames := map[string]wsTestFrame{}
+	for i := 0; i < 2; i++ {
+		frame := readFrame(t, conn)
+		frames[frame.Type] = frame
+	}
+	assert.Equal(t, "request-1", frames["ack"].RequestID)
+	assert.Equal(t, "message-uuid", frames["ack"].Message.ID)
+	assert.Equal(t, "message-uuid", frames[messaging.ChatMessage].Message.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	select {
+	case event := <-receiver.C:
+		assert.Contains(t, string(event.Data), `"content":"Bonjour"`)
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered to the receiver")
+	}
+}
+
+func TestMessagesWebSocket_TypingInUnknownConversation(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	realtime.SetBroker(realtime.NewMemoryBroker())
+
+	mock.ExpectQuery(`SELECT \* FROM "conversation_participants" WHERE conversation_id = \$1 AND user_id = \$2`).
+		WithArgs("conversation-uuid", "cccc", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "user_id"}))
+
+	conn := dialMessagesWebSocket(t, "cccc")
+	if err := conn.WriteJSON(map[string]any{
+		"type":           "typing",
+		"requestId":      "request-1",
+		"conversationId": "conversation-uuid",
+		"typing":         true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	frame := readFrame(t, conn)
+	assert.Equal(t, "error", frame.Type)
+	assert.Equal(t, "Conversation not found", frame.Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
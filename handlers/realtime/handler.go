@@ -0,0 +1,47 @@
+package realtime
+
+import (
+	"net/http"
+
+	realtimeService "pec2-backend/services/realtime"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get realtime metrics (Admin)
+// @Description Counters of the SSE streams of this instance since its start: connections, resumes, events and slow consumers
+// @Tags realtime
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} realtimeService.Metrics
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Access denied: admin role required"
+// @Router /realtime/metrics [get]
+func GetMetrics(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	utils.LogSuccessWithUser(userID, "Realtime metrics retrieved successfully in GetMetrics")
+	c.JSON(http.StatusOK, realtimeService.GetMetrics())
+}
+
+// @Summary Stream the events of the logged-in user (SSE)
+// @Description Server-Sent Events stream of the user's own events. The SSE event name is the event type: private_message, post_liked, new_follower, new_subscriber, subscription_renewed, subscription_payment_failed, moderation_decision. Each data is {type, payload, createdAt}. The stream can be resumed with the Last-Event-ID header or the lastEventId query parameter.
+// @Tags realtime
+// @Produce text/event-stream
+// @Param token query string false "JWT token, when the Authorization header cannot be set (EventSource)"
+// @Param lastEventId query string false "Id of the last event received"
+// @Security BearerAuth
+// @Success 200 {string} string "SSE stream"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Router /events [get]
+func StreamUserEvents(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not found in token in StreamUserEvents")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in token"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "User event stream opened in StreamUserEvents")
+	realtimeService.ServeSSE(c.Writer, c.Request, realtimeService.UserTopic(userID.(string)), realtimeService.SSEOptions{})
+}
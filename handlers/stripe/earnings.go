@@ -0,0 +1,187 @@
+package stripe
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/ledger"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	stripe "github.com/stripe/stripe-go/v82"
+)
+
+func handleChargeRefunded(event stripe.Event) (string, error) {
+	var charge stripe.Charge
+	if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+		utils.LogError(err, "Error parsing Charge dans handleChargeRefunded")
+		return "", eventFailure(http.StatusBadRequest, "Error parsing Charge")
+	}
+
+	paymentIntentID := ""
+	if charge.PaymentIntent != nil {
+		paymentIntentID = charge.PaymentIntent.ID
+	}
+	if err := ledger.RecordRefund(paymentIntentID, charge.ID, int(charge.AmountRefunded)); err != nil {
+		if errors.Is(err, ledger.ErrChargeNotFound) {
+			utils.LogError(err, "Payment unknown to the ledger dans handleChargeRefunded: "+charge.ID)
+			return "Payment unknown to the ledger - event ignored", nil
+		}
+		utils.LogError(err, "Error recording refund dans handleChargeRefunded")
+		return "", eventFailure(http.StatusInternalServerError, "Error recording refund")
+	}
+
+	utils.LogSuccess("Refund recorded dans handleChargeRefunded")
+	return "Refund recorded", nil
+}
+
+func handleDisputeCreated(event stripe.Event) (string, error) {
+	var dispute stripe.Dispute
+	if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+		utils.LogError(err, "Error parsing Dispute dans handleDisputeCreated")
+		return "", eventFailure(http.StatusBadRequest, "Error parsing Dispute")
+	}
+
+	paymentIntentID := ""
+	if dispute.PaymentIntent != nil {
+		paymentIntentID = dispute.PaymentIntent.ID
+	}
+	if err := ledger.RecordChargeback(paymentIntentID, dispute.ID, int(dispute.Amount)); err != nil {
+		if errors.Is(err, ledger.ErrChargeNotFound) {
+			utils.LogError(err, "Payment unknown to the ledger dans handleDisputeCreated: "+dispute.ID)
+			return "Payment unknown to the ledger - event ignored", nil
+		}
+		utils.LogError(err, "Error recording chargeback dans handleDisputeCreated")
+		return "", eventFailure(http.StatusInternalServerError, "Error recording chargeback")
+	}
+
+	utils.LogSuccess("Chargeback recorded dans handleDisputeCreated")
+	return "Chargeback recorded", nil
+}
+
+func handleDisputeClosed(event stripe.Event) (string, error) {
+	var dispute stripe.Dispute
+	if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+		utils.LogError(err, "Error parsing Dispute dans handleDisputeClosed")
+		return "", eventFailure(http.StatusBadRequest, "Error parsing Dispute")
+	}
+
+	// Un litige perdu confirme les écritures enregistrées à son ouverture
+	if dispute.Status != stripe.DisputeStatusWon {
+		return "Dispute closed - logged", nil
+	}
+
+	if err := ledger.ReverseChargeback(dispute.ID); err != nil {
+		if errors.Is(err, ledger.ErrChargeNotFound) {
+			utils.LogError(err, "Chargeback unknown to the ledger dans handleDisputeClosed: "+dispute.ID)
+			return "Chargeback unknown to the ledger - event ignored", nil
+		}
+		utils.LogError(err, "Error reversing chargeback dans handleDisputeClosed")
+		return "", eventFailure(http.StatusInternalServerError, "Error reversing chargeback")
+	}
+
+	utils.LogSuccess("Chargeback reversed dans handleDisputeClosed")
+	return "Chargeback reversed", nil
+}
+
+// GetEarningsBalance returns the balance of the connected content creator
+// @Summary Get the creator balance
+// @Description Return the earnings of the authenticated content creator in cents: pending funds still in the refund window, available funds that can be paid out, and lifetime totals
+// @Tags earnings
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.CreatorBalance
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Only content creators have earnings"
+// @Failure 500 {object} map[string]string "error: Error computing the balance"
+// @Router /earnings/balance [get]
+func GetEarningsBalance(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans GetEarningsBalance")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if role, _ := c.Get("role"); role != string(models.ContentCreator) {
+		utils.LogErrorWithUser(userID, nil, "Only content creators have earnings dans GetEarningsBalance")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only content creators have earnings"})
+		return
+	}
+
+	balance, err := ledger.Balance(userID.(string))
+	if err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors du calcul du solde dans GetEarningsBalance")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error computing the balance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"balance":     balance,
+		"feePercent":  ledger.FeePercent(),
+		"holdingDays": int(ledger.HoldPeriod.Hours() / 24),
+	})
+}
+
+// GetEarningsTransactions lists the ledger transactions of the connected content creator
+// @Summary List the creator ledger transactions
+// @Description Return the charges, platform fees, refunds, chargebacks, releases and payouts of the authenticated content creator, most recent first
+// @Tags earnings
+// @Produce json
+// @Param limit query integer false "Number of transactions (default 50, max 200)"
+// @Security BearerAuth
+// @Success 200 {array} models.LedgerTransaction
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 500 {object} map[string]string "error: Error fetching transactions"
+// @Router /earnings/transactions [get]
+func GetEarningsTransactions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans GetEarningsTransactions")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, 200)
+	}
+
+	transactions := []models.LedgerTransaction{}
+	if err := db.DB.Preload("Entries").Where("creator_id = ?", userID).
+		Order("created_at DESC").Limit(limit).Find(&transactions).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la récupération des transactions dans GetEarningsTransactions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching transactions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, transactions)
+}
+
+// GetLedgerReconciliation checks the consistency of the earnings ledger (admin only)
+// @Summary Reconcile the earnings ledger
+// @Description Check that every ledger transaction is balanced, that all entries sum to zero and that every successful payment is recorded in the ledger (admin only)
+// @Tags earnings
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.LedgerReconciliation
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Access denied"
+// @Failure 500 {object} map[string]string "error: Error reconciling the ledger"
+// @Router /earnings/reconciliation [get]
+func GetLedgerReconciliation(c *gin.Context) {
+	report, err := ledger.Reconcile()
+	if err != nil {
+		utils.LogError(err, "Erreur lors du rapprochement du grand livre dans GetLedgerReconciliation")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reconciling the ledger"})
+		return
+	}
+
+	if !report.Balanced {
+		utils.LogError(nil, "Ledger out of balance dans GetLedgerReconciliation")
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,57 @@
+package stripe
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetEarningsBalance_SplitsPendingAndAvailable(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT ledger_transactions.kind, ledger_entries.account, SUM\(ledger_entries.amount\) AS total FROM "ledger_entries" JOIN ledger_transactions .* WHERE ledger_entries.creator_id = \$1 GROUP BY`).
+		WithArgs("creator-uuid").
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "account", "total"}).
+			AddRow(models.LedgerCharge, models.LedgerAccountCreatorPending, -3000).
+			AddRow(models.LedgerPlatformFee, models.LedgerAccountCreatorPending, 600).
+			AddRow(models.LedgerRefund, models.LedgerAccountCreatorPending, 400).
+			AddRow(models.LedgerRelease, models.LedgerAccountCreatorPending, 1200).
+			AddRow(models.LedgerRelease, models.LedgerAccountCreatorAvailable, -1200).
+			AddRow(models.LedgerPayout, models.LedgerAccountCreatorAvailable, 1000))
+
+	r := testutils.SetupTestRouter()
+	r.GET("/earnings/balance", func(c *gin.Context) {
+		c.Set("user_id", "creator-uuid")
+		c.Set("role", string(models.ContentCreator))
+		GetEarningsBalance(c)
+	})
+	req, _ := http.NewRequest(http.MethodGet, "/earnings/balance", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var body struct {
+		Balance models.CreatorBalance `json:"balance"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, models.CreatorBalance{
+		Pending:      800,
+		Available:    200,
+		PaidOut:      1000,
+		Gross:        3000,
+		PlatformFees: 600,
+		Refunded:     400,
+	}, body.Balance)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,231 @@
+package stripe
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/ledger"
+	"pec2-backend/services/messaging"
+	"pec2-backend/services/realtime"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	stripe "github.com/stripe/stripe-go/v82"
+	session "github.com/stripe/stripe-go/v82/checkout/session"
+	"github.com/stripe/stripe-go/v82/refund"
+	"gorm.io/gorm"
+)
+
+// Valeur de la metadata "purpose" des paiements ponctuels de déblocage de pièces jointes
+const messageUnlockPurpose = "message_unlock"
+
+// Remplacé dans les tests pour ne pas appeler Stripe
+var newStripeRefund = refund.New
+
+// CreateMessageUnlockCheckoutSession starts a one-off Stripe payment to unlock a paid picture received in a private message
+// @Summary Create a Stripe Checkout session to unlock a message attachment
+// @Description Start a one-off Stripe payment to unlock a paid picture received in a private message. The picture is unlocked when Stripe confirms the payment (webhook)
+// @Tags private-messages
+// @Produce json
+// @Param id path string true "Attachment ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "sessionId: ID of the Stripe Checkout session, url: Stripe Checkout URL"
+// @Failure 400 {object} map[string]string "error: Attachment is free"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Attachment not found"
+// @Failure 409 {object} map[string]string "error: Attachment already unlocked"
+// @Failure 500 {object} map[string]string "error: Stripe error or server error"
+// @Router /private-messages/attachments/{id}/unlock [post]
+func CreateMessageUnlockCheckoutSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans CreateMessageUnlockCheckoutSession")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var attachment models.MessageAttachment
+	if err := db.DB.First(&attachment, "id = ?", c.Param("id")).Error; err != nil || attachment.ReceiverID != userID.(string) {
+		utils.LogErrorWithUser(userID, err, "Attachment not found dans CreateMessageUnlockCheckoutSession")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	if attachment.Price == 0 {
+		utils.LogErrorWithUser(userID, nil, "Free attachment dans CreateMessageUnlockCheckoutSession")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Attachment is free"})
+		return
+	}
+
+	var unlock models.MessageUnlock
+	err := db.DB.Where("attachment_id = ? AND user_id = ?", attachment.ID, userID).First(&unlock).Error
+	if err == nil && unlock.Status == models.MessageUnlockSucceeded {
+		utils.LogErrorWithUser(userID, nil, "Attachment already unlocked dans CreateMessageUnlockCheckoutSession")
+		c.JSON(http.StatusConflict, gin.H{"error": "Attachment already unlocked"})
+		return
+	}
+	if err != nil && err != gorm.ErrRecordNotFound {
+		utils.LogErrorWithUser(userID, err, "Error retrieving unlock dans CreateMessageUnlockCheckoutSession")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving unlock"})
+		return
+	}
+
+	var payer, sender models.User
+	if err := db.DB.First(&payer, "id = ?", userID).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "User not found dans CreateMessageUnlockCheckoutSession")
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err := db.DB.First(&sender, "id = ?", attachment.SenderID).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Sender not found dans CreateMessageUnlockCheckoutSession")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sender not found"})
+		return
+	}
+
+	if err := ensureStripeCustomer(&payer); err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la création du client Stripe dans CreateMessageUnlockCheckoutSession")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la création du client Stripe"})
+		return
+	}
+
+	metadata := map[string]string{
+		"purpose":       messageUnlockPurpose,
+		"attachment_id": attachment.ID,
+		"user_id":       payer.ID,
+	}
+	params := &stripe.CheckoutSessionParams{
+		Customer:           stripe.String(payer.StripeCustomerId),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		Mode:               stripe.String(string(stripe.CheckoutSessionModePayment)),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+					Currency:   stripe.String(string(stripe.CurrencyEUR)),
+					UnitAmount: stripe.Int64(int64(attachment.Price)),
+					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+						Name: stripe.String("Message privé de " + sender.UserName),
+					},
+				},
+				Quantity: stripe.Int64(1),
+			},
+		},
+		Metadata:          metadata,
+		PaymentIntentData: &stripe.CheckoutSessionPaymentIntentDataParams{Metadata: metadata},
+		SuccessURL:        stripe.String(os.Getenv("STRIPE_REDIRECT_SUCCESS") + "?attachment=" + attachment.ID),
+		CancelURL:         stripe.String(os.Getenv("STRIPE_REDIRECT_ERROR") + "?attachment=" + attachment.ID),
+		ClientReferenceID: stripe.String(attachment.ID),
+	}
+
+	s, err := session.New(params)
+	if err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la création de la session Stripe dans CreateMessageUnlockCheckoutSession")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Une seule ligne par acheteur et pièce jointe : une nouvelle tentative remplace la session précédente
+	unlock.AttachmentID = attachment.ID
+	unlock.UserID = payer.ID
+	unlock.Amount = attachment.Price
+	unlock.Status = models.MessageUnlockPending
+	unlock.StripeSessionID = s.ID
+	if err := db.DB.Save(&unlock).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Error saving unlock dans CreateMessageUnlockCheckoutSession")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving unlock"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Session Stripe de déblocage créée avec succès dans CreateMessageUnlockCheckoutSession")
+	c.JSON(http.StatusOK, gin.H{"sessionId": s.ID, "url": s.URL})
+}
+
+// handleMessageUnlockCompleted débloque la pièce jointe une fois le paiement ponctuel confirmé
+func handleMessageUnlockCompleted(checkoutSession stripe.CheckoutSession) (string, error) {
+	if checkoutSession.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
+		utils.LogSuccess("Unlock waiting for payment dans handleMessageUnlockCompleted")
+		return "Unlock waiting for payment", nil
+	}
+
+	// Une session plus ancienne que la dernière tentative peut aussi être payée : repli sur la metadata
+	var unlock models.MessageUnlock
+	err := db.DB.First(&unlock, "stripe_session_id = ?", checkoutSession.ID).Error
+	if err == gorm.ErrRecordNotFound {
+		err = db.DB.Where("attachment_id = ? AND user_id = ?",
+			checkoutSession.Metadata["attachment_id"], checkoutSession.Metadata["user_id"]).First(&unlock).Error
+	}
+	if err != nil {
+		utils.LogError(err, "Unlock not found dans handleMessageUnlockCompleted")
+		return "", eventFailure(http.StatusNotFound, "Unlock not found")
+	}
+
+	paymentIntentID := ""
+	if checkoutSession.PaymentIntent != nil {
+		paymentIntentID = checkoutSession.PaymentIntent.ID
+	}
+
+	if unlock.Status == models.MessageUnlockSucceeded {
+		// La pièce jointe a déjà été payée par une autre session : ce second paiement est remboursé
+		if unlock.StripeSessionID != checkoutSession.ID && paymentIntentID != "" && paymentIntentID != unlock.StripePaymentIntentID {
+			params := &stripe.RefundParams{
+				PaymentIntent: stripe.String(paymentIntentID),
+				Reason:        stripe.String(string(stripe.RefundReasonDuplicate)),
+			}
+			params.SetIdempotencyKey("duplicate-unlock-" + checkoutSession.ID)
+			if _, err := newStripeRefund(params); err != nil {
+				utils.LogError(err, "Erreur lors du remboursement du paiement en double dans handleMessageUnlockCompleted")
+				return "", eventFailure(http.StatusInternalServerError, "Error refunding duplicate payment")
+			}
+			utils.LogSuccessWithUser(unlock.UserID, "Duplicate unlock payment refunded dans handleMessageUnlockCompleted")
+			return "Duplicate payment refunded", nil
+		}
+
+		utils.LogSuccess("Unlock already recorded dans handleMessageUnlockCompleted")
+		return "Unlock already recorded", nil
+	}
+
+	var attachment models.MessageAttachment
+	if err := db.DB.First(&attachment, "id = ?", unlock.AttachmentID).Error; err != nil {
+		utils.LogError(err, "Attachment not found dans handleMessageUnlockCompleted")
+		return "", eventFailure(http.StatusNotFound, "Attachment not found")
+	}
+
+	// Grand livre d'abord : l'enregistrement est idempotent, un échec laisse le déblocage
+	// en attente et l'évènement est rejoué
+	now := time.Now()
+	if err := ledger.RecordCharge(ledger.Charge{
+		CreatorID:       attachment.SenderID,
+		Reference:       unlock.ID,
+		PaymentIntentID: paymentIntentID,
+		Source:          models.LedgerSourceMessageUnlock,
+		Amount:          int(checkoutSession.AmountTotal),
+		At:              now,
+	}); err != nil {
+		utils.LogError(err, "Erreur lors de l'enregistrement du déblocage au grand livre dans handleMessageUnlockCompleted")
+		return "", eventFailure(http.StatusInternalServerError, "Error recording unlock in ledger")
+	}
+
+	// La session payée devient celle du déblocage : un paiement de l'autre session sera reconnu comme doublon
+	if err := db.DB.Model(&unlock).Updates(map[string]interface{}{
+		"status":                   models.MessageUnlockSucceeded,
+		"amount":                   checkoutSession.AmountTotal,
+		"stripe_session_id":        checkoutSession.ID,
+		"stripe_payment_intent_id": paymentIntentID,
+		"paid_at":                  now,
+	}).Error; err != nil {
+		utils.LogError(err, "Error updating unlock dans handleMessageUnlockCompleted")
+		return "", eventFailure(http.StatusInternalServerError, "Error updating unlock")
+	}
+
+	messaging.PublishUnlock(attachment, unlock.UserID)
+	realtime.PublishToUser(attachment.SenderID, realtime.EventMessageUnlocked, gin.H{
+		"attachmentId": attachment.ID,
+		"messageId":    attachment.MessageID,
+		"buyerId":      unlock.UserID,
+		"amount":       checkoutSession.AmountTotal,
+	})
+
+	utils.LogSuccess("Attachment unlocked dans handleMessageUnlockCompleted")
+	return "Attachment unlocked", nil
+}
@@ -0,0 +1,79 @@
+package stripe
+
+import (
+	"database/sql"
+	"testing"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	stripe "github.com/stripe/stripe-go/v82"
+)
+
+func TestHandleMessageUnlockCompleted_RefundsDuplicatePayment(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	var refunded *stripe.RefundParams
+	original := newStripeRefund
+	newStripeRefund = func(params *stripe.RefundParams) (*stripe.Refund, error) {
+		refunded = params
+		return &stripe.Refund{ID: "re_duplicate"}, nil
+	}
+	defer func() { newStripeRefund = original }()
+
+	// L'ancienne session, remplacée par une nouvelle tentative, est payée après la nouvelle
+	mock.ExpectQuery(`SELECT \* FROM "message_unlocks" WHERE stripe_session_id = \$1`).
+		WithArgs("cs_old", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT \* FROM "message_unlocks" WHERE attachment_id = \$1 AND user_id = \$2`).
+		WithArgs("attachment-uuid", "buyer-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "attachment_id", "user_id", "status", "stripe_session_id", "stripe_payment_intent_id"}).
+			AddRow("unlock-uuid", "attachment-uuid", "buyer-uuid", models.MessageUnlockSucceeded, "cs_new", "pi_new"))
+
+	message, err := handleMessageUnlockCompleted(stripe.CheckoutSession{
+		ID:            "cs_old",
+		PaymentStatus: stripe.CheckoutSessionPaymentStatusPaid,
+		AmountTotal:   500,
+		PaymentIntent: &stripe.PaymentIntent{ID: "pi_old"},
+		Metadata:      map[string]string{"purpose": messageUnlockPurpose, "attachment_id": "attachment-uuid", "user_id": "buyer-uuid"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Duplicate payment refunded", message)
+	if assert.NotNil(t, refunded) {
+		assert.Equal(t, "pi_old", *refunded.PaymentIntent)
+		assert.Equal(t, string(stripe.RefundReasonDuplicate), *refunded.Reason)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleMessageUnlockCompleted_LedgerFailureKeepsUnlockPending(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "message_unlocks" WHERE stripe_session_id = \$1`).
+		WithArgs("cs_unlock", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "attachment_id", "user_id", "status", "stripe_session_id"}).
+			AddRow("unlock-uuid", "attachment-uuid", "buyer-uuid", models.MessageUnlockPending, "cs_unlock"))
+	mock.ExpectQuery(`SELECT \* FROM "message_attachments" WHERE id = \$1`).
+		WithArgs("attachment-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "message_id", "sender_id", "receiver_id", "price"}).
+			AddRow("attachment-uuid", "message-uuid", "creator-uuid", "buyer-uuid", 500))
+	mock.ExpectQuery(`SELECT \* FROM "ledger_transactions" WHERE kind = \$1 AND reference = \$2`).
+		WillReturnError(sql.ErrConnDone)
+
+	_, err := handleMessageUnlockCompleted(stripe.CheckoutSession{
+		ID:            "cs_unlock",
+		PaymentStatus: stripe.CheckoutSessionPaymentStatusPaid,
+		AmountTotal:   500,
+		PaymentIntent: &stripe.PaymentIntent{ID: "pi_unlock"},
+		Metadata:      map[string]string{"purpose": messageUnlockPurpose, "attachment_id": "attachment-uuid", "user_id": "buyer-uuid"},
+	})
+
+	// Le déblocage reste en attente : l'évènement en échec sera rejoué
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,388 @@
+package stripe
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/ledger"
+	"pec2-backend/services/payouts"
+	"pec2-backend/services/realtime"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	stripe "github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/account"
+	"github.com/stripe/stripe-go/v82/accountlink"
+)
+
+// Remplacés dans les tests
+var (
+	newStripeAccount     = account.New
+	updateStripeAccount  = account.Update
+	newStripeAccountLink = accountlink.New
+)
+
+// payoutSchedule convertit le rythme de versement demandé par le créateur
+func payoutSchedule(input models.PayoutScheduleUpdate) *stripe.AccountSettingsPayoutsScheduleParams {
+	schedule := &stripe.AccountSettingsPayoutsScheduleParams{Interval: stripe.String(input.Interval)}
+	switch input.Interval {
+	case "weekly":
+		anchor := input.WeeklyAnchor
+		if anchor == "" {
+			anchor = "monday"
+		}
+		schedule.WeeklyAnchor = stripe.String(anchor)
+	case "monthly":
+		anchor := input.MonthlyAnchor
+		if anchor == 0 {
+			anchor = 1
+		}
+		schedule.MonthlyAnchor = stripe.Int64(int64(anchor))
+	}
+	return schedule
+}
+
+// CreatePayoutAccount starts the Stripe Connect onboarding of the connected content creator
+// @Summary Start payout onboarding
+// @Description Create the Stripe Connect account of the authenticated content creator with the IBAN of their approved application, and return the Stripe onboarding link where they complete their identity verification
+// @Tags payouts
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "url: Stripe onboarding link"
+// @Failure 400 {object} map[string]string "error: Invalid IBAN"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Only content creators can receive payouts"
+// @Failure 404 {object} map[string]string "error: No approved content creator application"
+// @Failure 500 {object} map[string]string "error: Error creating the payout account"
+// @Router /payouts/account [post]
+func CreatePayoutAccount(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans CreatePayoutAccount")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if role, _ := c.Get("role"); role != string(models.ContentCreator) {
+		utils.LogErrorWithUser(userID, nil, "Only content creators can receive payouts dans CreatePayoutAccount")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only content creators can receive payouts"})
+		return
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, "id = ?", userID).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "User not found dans CreatePayoutAccount")
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var info models.ContentCreatorInfo
+	if err := db.DB.Where("user_id = ? AND status = ?", user.ID, models.ContentCreatorStatusApproved).
+		Order("created_at DESC").First(&info).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "No approved application dans CreatePayoutAccount")
+		c.JSON(http.StatusNotFound, gin.H{"error": "No approved content creator application"})
+		return
+	}
+
+	// Le pays du compte est celui de l'IBAN
+	iban := strings.ToUpper(strings.ReplaceAll(info.Iban, " ", ""))
+	if len(iban) < 15 {
+		utils.LogErrorWithUser(userID, nil, "Invalid IBAN dans CreatePayoutAccount")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IBAN"})
+		return
+	}
+	country := iban[:2]
+
+	if user.StripeAccountID == "" {
+		params := &stripe.AccountParams{
+			Type:    stripe.String(string(stripe.AccountTypeCustom)),
+			Country: stripe.String(country),
+			Email:   stripe.String(user.Email),
+			Capabilities: &stripe.AccountCapabilitiesParams{
+				Transfers: &stripe.AccountCapabilitiesTransfersParams{Requested: stripe.Bool(true)},
+			},
+			ExternalAccount: &stripe.AccountExternalAccountParams{
+				AccountNumber:     stripe.String(iban),
+				AccountHolderName: stripe.String(info.CompanyName),
+				Country:           stripe.String(country),
+				Currency:          stripe.String(string(stripe.CurrencyEUR)),
+			},
+			Settings: &stripe.AccountSettingsParams{
+				Payouts: &stripe.AccountSettingsPayoutsParams{
+					Schedule: payoutSchedule(models.PayoutScheduleUpdate{Interval: "weekly"}),
+				},
+			},
+		}
+		params.AddMetadata("creator_id", user.ID)
+		params.SetIdempotencyKey("connect-account-" + user.ID)
+
+		acct, err := newStripeAccount(params)
+		if err != nil {
+			utils.LogErrorWithUser(userID, err, "Erreur lors de la création du compte Stripe Connect dans CreatePayoutAccount")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating the payout account"})
+			return
+		}
+		if err := db.DB.Model(&user).Update("stripe_account_id", acct.ID).Error; err != nil {
+			utils.LogErrorWithUser(userID, err, "Erreur lors de l'enregistrement du compte Stripe Connect dans CreatePayoutAccount")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating the payout account"})
+			return
+		}
+		user.StripeAccountID = acct.ID
+	}
+
+	// Un lien d'onboarding n'est valable qu'une fois : il est recréé à chaque demande
+	link, err := newStripeAccountLink(&stripe.AccountLinkParams{
+		Account:    stripe.String(user.StripeAccountID),
+		RefreshURL: stripe.String(os.Getenv("STRIPE_CONNECT_REFRESH_URL")),
+		ReturnURL:  stripe.String(os.Getenv("STRIPE_CONNECT_RETURN_URL")),
+		Type:       stripe.String("account_onboarding"),
+	})
+	if err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la création du lien d'onboarding dans CreatePayoutAccount")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating the onboarding link"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Payout onboarding started dans CreatePayoutAccount")
+	c.JSON(http.StatusOK, gin.H{"url": link.URL})
+}
+
+// GetPayoutAccount returns the payout status of the connected content creator
+// @Summary Get the payout status
+// @Description Return whether the Stripe Connect account of the authenticated content creator is verified, with their pending and available balance
+// @Tags payouts
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.PayoutAccountStatus
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 500 {object} map[string]string "error: Error computing the balance"
+// @Router /payouts/account [get]
+func GetPayoutAccount(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans GetPayoutAccount")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, "id = ?", userID).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "User not found dans GetPayoutAccount")
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	balance, err := ledger.Balance(user.ID)
+	if err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors du calcul du solde dans GetPayoutAccount")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error computing the balance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PayoutAccountStatus{
+		Connected:         user.StripeAccountID != "",
+		PayoutsEnabled:    user.PayoutsEnabled,
+		Balance:           balance,
+		MinTransferAmount: models.MinTransferAmount,
+	})
+}
+
+// UpdatePayoutSchedule changes how often Stripe pays the creator's IBAN
+// @Summary Update the payout schedule
+// @Description Set how often the funds of the Stripe Connect account of the authenticated content creator are paid out to their IBAN
+// @Tags payouts
+// @Accept json
+// @Produce json
+// @Param schedule body models.PayoutScheduleUpdate true "Payout schedule"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message: Payout schedule updated"
+// @Failure 400 {object} map[string]string "error: Invalid input"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: No payout account"
+// @Failure 500 {object} map[string]string "error: Error updating the payout schedule"
+// @Router /payouts/schedule [put]
+func UpdatePayoutSchedule(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans UpdatePayoutSchedule")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input models.PayoutScheduleUpdate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.LogErrorWithUser(userID, err, "Invalid input dans UpdatePayoutSchedule")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, "id = ?", userID).Error; err != nil || user.StripeAccountID == "" {
+		utils.LogErrorWithUser(userID, err, "No payout account dans UpdatePayoutSchedule")
+		c.JSON(http.StatusNotFound, gin.H{"error": "No payout account"})
+		return
+	}
+
+	if _, err := updateStripeAccount(user.StripeAccountID, &stripe.AccountParams{
+		Settings: &stripe.AccountSettingsParams{
+			Payouts: &stripe.AccountSettingsPayoutsParams{Schedule: payoutSchedule(input)},
+		},
+	}); err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la mise à jour du rythme de versement dans UpdatePayoutSchedule")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating the payout schedule"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Payout schedule updated dans UpdatePayoutSchedule")
+	c.JSON(http.StatusOK, gin.H{"message": "Payout schedule updated"})
+}
+
+// GetPayouts lists the payouts of the connected content creator
+// @Summary List payouts
+// @Description Return the payouts from the Stripe Connect account of the authenticated content creator to their IBAN, most recent first
+// @Tags payouts
+// @Produce json
+// @Param limit query integer false "Number of payouts (default 20, max 100)"
+// @Security BearerAuth
+// @Success 200 {array} models.Payout
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 500 {object} map[string]string "error: Error fetching payouts"
+// @Router /payouts [get]
+func GetPayouts(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans GetPayouts")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	limit := 20
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, 100)
+	}
+
+	payouts := []models.Payout{}
+	if err := db.DB.Where("creator_id = ?", userID).Order("created_at DESC").Limit(limit).Find(&payouts).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la récupération des versements dans GetPayouts")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching payouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, payouts)
+}
+
+// handlePayoutEvent suit un versement d'un compte connecté vers l'IBAN du créateur (payout.*)
+func handlePayoutEvent(event stripe.Event) (string, error) {
+	var stripePayout stripe.Payout
+	if err := json.Unmarshal(event.Data.Raw, &stripePayout); err != nil {
+		utils.LogError(err, "Error parsing Payout dans handlePayoutEvent")
+		return "", eventFailure(http.StatusBadRequest, "Error parsing Payout")
+	}
+
+	var creator models.User
+	if event.Account == "" || db.DB.First(&creator, "stripe_account_id = ?", event.Account).Error != nil {
+		utils.LogError(nil, "Creator not found for connected account dans handlePayoutEvent: "+event.Account)
+		return "Payout of an unknown account - event ignored", nil
+	}
+
+	var arrivalDate *time.Time
+	if stripePayout.ArrivalDate > 0 {
+		arrival := time.Unix(stripePayout.ArrivalDate, 0)
+		arrivalDate = &arrival
+	}
+
+	var payout models.Payout
+	if err := db.DB.First(&payout, "stripe_payout_id = ?", stripePayout.ID).Error; err != nil {
+		payout = models.Payout{
+			CreatorID:       creator.ID,
+			StripePayoutID:  stripePayout.ID,
+			StripeAccountID: event.Account,
+			Amount:          int(stripePayout.Amount),
+			Currency:        string(stripePayout.Currency),
+			Status:          models.PayoutStatus(stripePayout.Status),
+			ArrivalDate:     arrivalDate,
+			FailureMessage:  stripePayout.FailureMessage,
+		}
+		if err := db.DB.Create(&payout).Error; err != nil {
+			utils.LogError(err, "Error creating payout dans handlePayoutEvent")
+			return "", eventFailure(http.StatusInternalServerError, "Error recording payout")
+		}
+	} else if err := db.DB.Model(&payout).Updates(map[string]interface{}{
+		"status":          stripePayout.Status,
+		"arrival_date":    arrivalDate,
+		"failure_message": stripePayout.FailureMessage,
+	}).Error; err != nil {
+		utils.LogError(err, "Error updating payout dans handlePayoutEvent")
+		return "", eventFailure(http.StatusInternalServerError, "Error recording payout")
+	}
+
+	realtime.PublishToUser(creator.ID, realtime.EventPayoutUpdated, gin.H{
+		"payoutId":    payout.ID,
+		"amount":      stripePayout.Amount,
+		"status":      stripePayout.Status,
+		"arrivalDate": arrivalDate,
+	})
+
+	utils.LogSuccess("Payout " + string(stripePayout.Status) + " dans handlePayoutEvent")
+	return "Payout recorded", nil
+}
+
+// handleTransferEvent valide un transfert de gains vers un compte Connect,
+// ou rend au créateur les montants que Stripe a annulés
+func handleTransferEvent(event stripe.Event) (string, error) {
+	var tr stripe.Transfer
+	if err := json.Unmarshal(event.Data.Raw, &tr); err != nil {
+		utils.LogError(err, "Error parsing Transfer dans handleTransferEvent")
+		return "", eventFailure(http.StatusBadRequest, "Error parsing Transfer")
+	}
+
+	var sent models.CreatorTransfer
+	if tr.Metadata["transfer_id"] == "" || db.DB.First(&sent, "id = ?", tr.Metadata["transfer_id"]).Error != nil {
+		utils.LogError(nil, "Creator transfer not found dans handleTransferEvent: "+tr.ID)
+		return "Unknown transfer - event ignored", nil
+	}
+
+	if err := payouts.Confirm(sent.ID, tr.ID); err != nil {
+		utils.LogError(err, "Error confirming transfer dans handleTransferEvent")
+		return "", eventFailure(http.StatusInternalServerError, "Error recording transfer")
+	}
+	if err := payouts.RecordReversals(sent, tr); err != nil {
+		utils.LogError(err, "Error recording transfer reversal dans handleTransferEvent")
+		return "", eventFailure(http.StatusInternalServerError, "Error recording transfer")
+	}
+
+	utils.LogSuccessWithUser(sent.CreatorID, "Transfer "+string(event.Type)+" dans handleTransferEvent")
+	return "Transfer recorded", nil
+}
+
+// handleAccountUpdated suit la vérification du compte connecté d'un créateur
+func handleAccountUpdated(event stripe.Event) (string, error) {
+	var acct stripe.Account
+	if err := json.Unmarshal(event.Data.Raw, &acct); err != nil {
+		utils.LogError(err, "Error parsing Account dans handleAccountUpdated")
+		return "", eventFailure(http.StatusBadRequest, "Error parsing Account")
+	}
+
+	// Les gains ne peuvent être transférés qu'une fois la capacité transfers active
+	enabled := acct.PayoutsEnabled && acct.Capabilities != nil &&
+		acct.Capabilities.Transfers == stripe.AccountCapabilityStatusActive
+
+	result := db.DB.Model(&models.User{}).Where("stripe_account_id = ?", acct.ID).Update("payouts_enabled", enabled)
+	if result.Error != nil {
+		utils.LogError(result.Error, "Error updating payout account dans handleAccountUpdated")
+		return "", eventFailure(http.StatusInternalServerError, "Error updating payout account")
+	}
+	if result.RowsAffected == 0 {
+		utils.LogError(nil, "Creator not found for connected account dans handleAccountUpdated: "+acct.ID)
+		return "Unknown account - event ignored", nil
+	}
+
+	utils.LogSuccess("Payout account updated dans handleAccountUpdated")
+	return "Payout account updated", nil
+}
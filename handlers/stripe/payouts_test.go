@@ -0,0 +1,99 @@
+package stripe
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	stripe "github.com/stripe/stripe-go/v82"
+)
+
+func TestCreatePayoutAccount_UsesStoredIban(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	var accountParams *stripe.AccountParams
+	var linkParams *stripe.AccountLinkParams
+	originalAccount, originalLink := newStripeAccount, newStripeAccountLink
+	newStripeAccount = func(params *stripe.AccountParams) (*stripe.Account, error) {
+		accountParams = params
+		return &stripe.Account{ID: "acct_creator"}, nil
+	}
+	newStripeAccountLink = func(params *stripe.AccountLinkParams) (*stripe.AccountLink, error) {
+		linkParams = params
+		return &stripe.AccountLink{URL: "https://connect.stripe.com/setup/c/acct_creator"}, nil
+	}
+	t.Cleanup(func() { newStripeAccount, newStripeAccountLink = originalAccount, originalLink })
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).
+		WithArgs("creator-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "role"}).AddRow("creator-uuid", "creator@example.com", models.ContentCreator))
+	mock.ExpectQuery(`SELECT \* FROM "content_creator_info" WHERE user_id = \$1 AND status = \$2 ORDER BY created_at DESC`).
+		WithArgs("creator-uuid", models.ContentCreatorStatusApproved, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "company_name", "iban", "status"}).
+			AddRow("info-uuid", "creator-uuid", "Creative Studios", "fr76 3000 6000 0112 3456 7890 189", models.ContentCreatorStatusApproved))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET "stripe_account_id"=\$1,"updated_at"=\$2 WHERE "id" = \$3`).
+		WithArgs("acct_creator", sqlmock.AnyArg(), "creator-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	r := testutils.SetupTestRouter()
+	r.POST("/payouts/account", func(c *gin.Context) {
+		c.Set("user_id", "creator-uuid")
+		c.Set("role", string(models.ContentCreator))
+		CreatePayoutAccount(c)
+	})
+	req, _ := http.NewRequest(http.MethodPost, "/payouts/account", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	if accountParams == nil || linkParams == nil {
+		t.Fatal("expected a connected account and an onboarding link to be created")
+	}
+	assert.Equal(t, "FR7630006000011234567890189", *accountParams.ExternalAccount.AccountNumber)
+	assert.Equal(t, "FR", *accountParams.Country)
+	assert.Equal(t, "weekly", *accountParams.Settings.Payouts.Schedule.Interval)
+	assert.Equal(t, "acct_creator", *linkParams.Account)
+	assert.Contains(t, resp.Body.String(), "connect.stripe.com")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleAccountUpdated_EnablesPayouts(t *testing.T) {
+	tests := []struct {
+		name      string
+		transfers string
+		enabled   bool
+	}{
+		{"verified account", "active", true},
+		{"transfers still pending", "pending", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, mock, cleanup := testutils.SetupTestDB(t)
+			defer cleanup()
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`UPDATE "users" SET "payouts_enabled"=\$1,"updated_at"=\$2 WHERE stripe_account_id = \$3`).
+				WithArgs(tt.enabled, sqlmock.AnyArg(), "acct_creator").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			message, err := handleAccountUpdated(stripe.Event{Data: &stripe.EventData{
+				Raw: []byte(`{"id": "acct_creator", "payouts_enabled": true, "capabilities": {"transfers": "` + tt.transfers + `"}}`),
+			}})
+
+			assert.NoError(t, err)
+			assert.Equal(t, "Payout account updated", message)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package stripe
+
+import (
+	"fmt"
+	"net/http"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	stripe "github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/price"
+	"github.com/stripe/stripe-go/v82/product"
+)
+
+// Remplacés dans les tests pour ne pas appeler Stripe
+var (
+	newStripeProduct  = product.New
+	newStripePrice    = price.New
+	updateStripePrice = price.Update
+)
+
+// createCreatorPrice crée un prix Stripe mensuel pour le créateur, et son produit s'il n'existe pas encore
+func createCreatorPrice(creator *models.User, amount int) (string, error) {
+	if creator.StripeProductID == "" {
+		p, err := newStripeProduct(&stripe.ProductParams{
+			Name:     stripe.String("Abonnement à " + creator.UserName),
+			Metadata: map[string]string{"creator_id": creator.ID},
+		})
+		if err != nil {
+			return "", err
+		}
+		creator.StripeProductID = p.ID
+	}
+
+	p, err := newStripePrice(&stripe.PriceParams{
+		Product:    stripe.String(creator.StripeProductID),
+		Currency:   stripe.String(string(stripe.CurrencyEUR)),
+		UnitAmount: stripe.Int64(int64(amount)),
+		Recurring: &stripe.PriceRecurringParams{
+			Interval: stripe.String(string(stripe.PriceRecurringIntervalMonth)),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return p.ID, nil
+}
+
+// ensureCreatorPrice renvoie le prix Stripe actif du créateur, créé avec son prix actuel s'il n'existe pas encore
+func ensureCreatorPrice(creator *models.User) (string, error) {
+	if creator.StripePriceID != "" {
+		return creator.StripePriceID, nil
+	}
+	if creator.SubscriptionPrice == 0 {
+		creator.SubscriptionPrice = models.DefaultSubscriptionPrice
+	}
+
+	priceID, err := createCreatorPrice(creator, creator.SubscriptionPrice)
+	if err != nil {
+		return "", err
+	}
+	creator.StripePriceID = priceID
+
+	return priceID, db.DB.Model(creator).Updates(map[string]interface{}{
+		"stripe_product_id": creator.StripeProductID,
+		"stripe_price_id":   creator.StripePriceID,
+	}).Error
+}
+
+// UpdateSubscriptionPrice lets a content creator change the monthly price of their subscription
+// @Summary Set the subscription price
+// @Description Set the monthly price (in cents) of the authenticated content creator's subscription. A new Stripe price is created and the previous one archived: current subscribers keep the price they subscribed at, new subscribers pay the new price
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param price body models.SubscriptionPriceUpdate true "New monthly price in cents"
+// @Security BearerAuth
+// @Success 200 {object} map[string]int "subscriptionPrice: new monthly price in cents"
+// @Failure 400 {object} map[string]string "error: Price out of bounds"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Only content creators can set a subscription price"
+// @Failure 500 {object} map[string]string "error: Stripe error or server error"
+// @Router /subscriptions/price [put]
+func UpdateSubscriptionPrice(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans UpdateSubscriptionPrice")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if role, _ := c.Get("role"); role != string(models.ContentCreator) {
+		utils.LogErrorWithUser(userID, nil, "Not a content creator dans UpdateSubscriptionPrice")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only content creators can set a subscription price"})
+		return
+	}
+
+	var request models.SubscriptionPriceUpdate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.LogErrorWithUser(userID, err, "Invalid data dans UpdateSubscriptionPrice")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if !validSubscriptionPrice(request.Price) {
+		utils.LogErrorWithUser(userID, nil, "Price out of bounds dans UpdateSubscriptionPrice")
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Price must be between %d and %d cents", models.MinSubscriptionPrice, models.MaxSubscriptionPrice)})
+		return
+	}
+
+	var creator models.User
+	if err := db.DB.First(&creator, "id = ?", userID).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Creator not found dans UpdateSubscriptionPrice")
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if creator.SubscriptionPrice == request.Price && creator.StripePriceID != "" {
+		c.JSON(http.StatusOK, gin.H{"subscriptionPrice": creator.SubscriptionPrice})
+		return
+	}
+
+	previousPriceID := creator.StripePriceID
+	priceID, err := createCreatorPrice(&creator, request.Price)
+	if err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la création du prix Stripe dans UpdateSubscriptionPrice")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating the Stripe price"})
+		return
+	}
+
+	if err := db.DB.Model(&creator).Updates(map[string]interface{}{
+		"subscription_price": request.Price,
+		"stripe_product_id":  creator.StripeProductID,
+		"stripe_price_id":    priceID,
+	}).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la sauvegarde du prix dans UpdateSubscriptionPrice")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving the subscription price"})
+		return
+	}
+
+	// L'ancien prix n'est plus proposé mais les abonnements Stripe existants continuent de l'utiliser
+	if previousPriceID != "" {
+		if _, err := updateStripePrice(previousPriceID, &stripe.PriceParams{Active: stripe.Bool(false)}); err != nil {
+			utils.LogErrorWithUser(userID, err, "Erreur lors de l'archivage de l'ancien prix Stripe dans UpdateSubscriptionPrice")
+		}
+	}
+
+	utils.LogSuccessWithUser(userID, "Prix de l'abonnement mis à jour dans UpdateSubscriptionPrice")
+	c.JSON(http.StatusOK, gin.H{"subscriptionPrice": request.Price})
+}
@@ -0,0 +1,111 @@
+package stripe
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	stripe "github.com/stripe/stripe-go/v82"
+)
+
+func TestMain(m *testing.M) {
+	testutils.InitTestMain()
+
+	log.SetOutput(io.Discard)
+
+	exitCode := m.Run()
+
+	log.SetOutput(os.Stdout)
+
+	os.Exit(exitCode)
+}
+
+func setupPriceRouter(role models.Role) *gin.Engine {
+	r := testutils.SetupTestRouter()
+	r.PUT("/subscriptions/price", func(c *gin.Context) {
+		c.Set("user_id", "creator-uuid")
+		c.Set("role", string(role))
+		UpdateSubscriptionPrice(c)
+	})
+	return r
+}
+
+func TestUpdateSubscriptionPrice_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		role models.Role
+		body string
+		code int
+	}{
+		{"not a creator", models.UserRole, `{"price": 900}`, http.StatusForbidden},
+		{"below the minimum", models.ContentCreator, `{"price": 100}`, http.StatusBadRequest},
+		{"above the maximum", models.ContentCreator, `{"price": 100000}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, mock, cleanup := testutils.SetupTestDB(t)
+			defer cleanup()
+
+			req, _ := http.NewRequest(http.MethodPut, "/subscriptions/price", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			setupPriceRouter(tt.role).ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.code, resp.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdateSubscriptionPrice_ArchivesPreviousPrice(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	var created *stripe.PriceParams
+	var archived []string
+	originalNew, originalUpdate := newStripePrice, updateStripePrice
+	newStripePrice = func(params *stripe.PriceParams) (*stripe.Price, error) {
+		created = params
+		return &stripe.Price{ID: "price_new"}, nil
+	}
+	updateStripePrice = func(id string, params *stripe.PriceParams) (*stripe.Price, error) {
+		archived = append(archived, id)
+		return &stripe.Price{ID: id}, nil
+	}
+	t.Cleanup(func() { newStripePrice, updateStripePrice = originalNew, originalUpdate })
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).
+		WithArgs("creator-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "subscription_price", "stripe_product_id", "stripe_price_id"}).
+			AddRow("creator-uuid", 700, "prod_creator", "price_old"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET "stripe_price_id"=\$1,"stripe_product_id"=\$2,"subscription_price"=\$3,"updated_at"=\$4 WHERE "id" = \$5`).
+		WithArgs("price_new", "prod_creator", 900, sqlmock.AnyArg(), "creator-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	req, _ := http.NewRequest(http.MethodPut, "/subscriptions/price", bytes.NewBufferString(`{"price": 900}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	setupPriceRouter(models.ContentCreator).ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	if created == nil {
+		t.Fatal("expected a Stripe price to be created")
+	}
+	assert.Equal(t, int64(900), *created.UnitAmount)
+	assert.Equal(t, "prod_creator", *created.Product)
+	assert.Equal(t, []string{"price_old"}, archived)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,355 @@
+package stripe
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	stripe "github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/coupon"
+	"gorm.io/gorm"
+)
+
+// Remplacés dans les tests pour ne pas appeler Stripe
+var (
+	newStripeCoupon    = coupon.New
+	deleteStripeCoupon = coupon.Del
+)
+
+var (
+	errPromoCodeInvalid       = errors.New("Invalid or expired promo code")
+	errPromoCodeFirstTimeOnly = errors.New("This promo code is reserved to new subscribers")
+)
+
+// findPromoCode renvoie le code promo du créateur s'il est utilisable par l'utilisateur :
+// actif, dans sa période de validité, sous sa limite d'utilisations et, si besoin, premier abonnement au créateur
+func findPromoCode(code string, creatorID string, userID string, now time.Time) (*models.PromoCode, error) {
+	var promo models.PromoCode
+	if err := db.DB.Where("creator_id = ? AND code = ? AND active = ?", creatorID, strings.ToUpper(code), true).First(&promo).Error; err != nil {
+		return nil, errPromoCodeInvalid
+	}
+	if (promo.StartsAt != nil && now.Before(*promo.StartsAt)) || (promo.EndsAt != nil && !now.Before(*promo.EndsAt)) {
+		return nil, errPromoCodeInvalid
+	}
+	if promo.MaxRedemptions > 0 && promo.Redemptions >= promo.MaxRedemptions {
+		return nil, errPromoCodeInvalid
+	}
+
+	if promo.FirstTimeOnly {
+		var previous int64
+		if err := db.DB.Model(&models.Subscription{}).
+			Where("user_id = ? AND content_creator_id = ? AND status IN ?", userID, creatorID,
+				[]models.SubscriptionStatus{models.SubscriptionActive, models.SubscriptionCanceled}).
+			Count(&previous).Error; err != nil {
+			return nil, err
+		}
+		if previous > 0 {
+			return nil, errPromoCodeFirstTimeOnly
+		}
+	}
+	return &promo, nil
+}
+
+// reservePromoCode compte une utilisation du code dès la création de la session Checkout :
+// des paiements simultanés ne peuvent pas dépasser la limite. La session expirée rend l'utilisation
+func reservePromoCode(promoCodeID string) error {
+	result := db.DB.Model(&models.PromoCode{}).
+		Where("id = ? AND (max_redemptions = 0 OR redemptions < max_redemptions)", promoCodeID).
+		UpdateColumn("redemptions", gorm.Expr("redemptions + ?", 1))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errPromoCodeInvalid
+	}
+	return nil
+}
+
+// releasePromoCode rend l'utilisation réservée par une session Checkout qui n'a pas abouti
+func releasePromoCode(promoCodeID string) error {
+	return db.DB.Model(&models.PromoCode{}).
+		Where("id = ? AND redemptions > 0", promoCodeID).
+		UpdateColumn("redemptions", gorm.Expr("redemptions - ?", 1)).Error
+}
+
+// applyPromoCode ajoute l'essai gratuit ou la réduction du code promo à la session Checkout
+func applyPromoCode(params *stripe.CheckoutSessionParams, promo *models.PromoCode) {
+	params.Metadata["promo_code_id"] = promo.ID
+	switch promo.Kind {
+	case models.PromoCodeTrial:
+		params.SubscriptionData = &stripe.CheckoutSessionSubscriptionDataParams{
+			TrialPeriodDays: stripe.Int64(int64(promo.TrialDays)),
+		}
+	case models.PromoCodeDiscount:
+		params.Discounts = []*stripe.CheckoutSessionDiscountParams{
+			{Coupon: stripe.String(promo.StripeCouponID)},
+		}
+	}
+}
+
+// tagPromoPayment rattache le paiement d'une facture au code promo qui l'a réduit.
+// Les paiements d'abonnement sont enregistrés sous l'identifiant de leur facture
+func tagPromoPayment(invoiceID string, promoCodeID string, discount int) {
+	if invoiceID == "" {
+		return
+	}
+	if err := db.DB.Model(&models.SubscriptionPayment{}).
+		Where("stripe_payment_intent_id = ?", invoiceID).
+		Updates(map[string]interface{}{"promo_code_id": promoCodeID, "discount_amount": discount}).Error; err != nil {
+		utils.LogError(err, "Erreur lors du suivi du code promo dans tagPromoPayment")
+	}
+}
+
+// CreatePromoCode lets a content creator start a promotional campaign
+// @Summary Create a promo code
+// @Description Create a promo code giving either a free trial (kind TRIAL, trialDays) or a percentage off the first months (kind DISCOUNT, percentOff, durationMonths). The code can be limited in time, in number of redemptions and to users who never subscribed to the creator
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param promoCode body models.PromoCodeCreate true "Promo code to create"
+// @Security BearerAuth
+// @Success 201 {object} models.PromoCode
+// @Failure 400 {object} map[string]string "error: Invalid data"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Only content creators can create promo codes"
+// @Failure 409 {object} map[string]string "error: This code already exists"
+// @Failure 500 {object} map[string]string "error: Stripe error or server error"
+// @Router /subscriptions/promo-codes [post]
+func CreatePromoCode(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans CreatePromoCode")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if role, _ := c.Get("role"); role != string(models.ContentCreator) {
+		utils.LogErrorWithUser(userID, nil, "Not a content creator dans CreatePromoCode")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only content creators can create promo codes"})
+		return
+	}
+
+	var request models.PromoCodeCreate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.LogErrorWithUser(userID, err, "Invalid data dans CreatePromoCode")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if request.Kind == models.PromoCodeTrial && request.TrialDays == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "trialDays is required for a trial"})
+		return
+	}
+	if request.Kind == models.PromoCodeDiscount && request.PercentOff == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "percentOff is required for a discount"})
+		return
+	}
+	if request.StartsAt != nil && request.EndsAt != nil && !request.EndsAt.After(*request.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "endsAt must be after startsAt"})
+		return
+	}
+
+	promo := models.PromoCode{
+		CreatorID:      userID.(string),
+		Code:           strings.ToUpper(request.Code),
+		Kind:           request.Kind,
+		StartsAt:       request.StartsAt,
+		EndsAt:         request.EndsAt,
+		MaxRedemptions: request.MaxRedemptions,
+		FirstTimeOnly:  request.FirstTimeOnly,
+		Active:         true,
+	}
+
+	var existing int64
+	if err := db.DB.Model(&models.PromoCode{}).Where("creator_id = ? AND code = ?", promo.CreatorID, promo.Code).Count(&existing).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la vérification du code dans CreatePromoCode")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating the promo code"})
+		return
+	}
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This code already exists"})
+		return
+	}
+
+	if request.Kind == models.PromoCodeTrial {
+		promo.TrialDays = request.TrialDays
+	} else {
+		promo.PercentOff = request.PercentOff
+		promo.DurationMonths = max(request.DurationMonths, 1)
+
+		// La limite d'utilisations est appliquée par la plateforme, le coupon Stripe ne porte que la réduction
+		params := &stripe.CouponParams{
+			Name:       stripe.String(promo.Code),
+			PercentOff: stripe.Float64(float64(promo.PercentOff)),
+			Duration:   stripe.String(string(stripe.CouponDurationOnce)),
+		}
+		if promo.DurationMonths > 1 {
+			params.Duration = stripe.String(string(stripe.CouponDurationRepeating))
+			params.DurationInMonths = stripe.Int64(int64(promo.DurationMonths))
+		}
+		stripeCoupon, err := newStripeCoupon(params)
+		if err != nil {
+			utils.LogErrorWithUser(userID, err, "Erreur lors de la création du coupon Stripe dans CreatePromoCode")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating the Stripe coupon"})
+			return
+		}
+		promo.StripeCouponID = stripeCoupon.ID
+	}
+
+	if err := db.DB.Create(&promo).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la création du code promo dans CreatePromoCode")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating the promo code"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Code promo créé dans CreatePromoCode")
+	c.JSON(http.StatusCreated, promo)
+}
+
+// GetPromoCodes lists the promo codes of the connected content creator
+// @Summary List my promo codes
+// @Description Return the promo codes of the authenticated content creator, most recent first
+// @Tags subscriptions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.PromoCode
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 500 {object} map[string]string "error: Error fetching promo codes"
+// @Router /subscriptions/promo-codes [get]
+func GetPromoCodes(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans GetPromoCodes")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	promoCodes := []models.PromoCode{}
+	if err := db.DB.Where("creator_id = ?", userID).Order("created_at DESC").Find(&promoCodes).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la récupération des codes promo dans GetPromoCodes")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching promo codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, promoCodes)
+}
+
+// DeactivatePromoCode ends a promotional campaign
+// @Summary Deactivate a promo code
+// @Description Stop accepting a promo code. Subscribers who already used it keep their trial or discount
+// @Tags subscriptions
+// @Produce json
+// @Param id path string true "Promo code ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message: Promo code deactivated"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Promo code not found"
+// @Failure 500 {object} map[string]string "error: Error deactivating the promo code"
+// @Router /subscriptions/promo-codes/{id} [delete]
+func DeactivatePromoCode(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans DeactivatePromoCode")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var promo models.PromoCode
+	if err := db.DB.Where("id = ? AND creator_id = ?", c.Param("id"), userID).First(&promo).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Promo code not found dans DeactivatePromoCode")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promo code not found"})
+		return
+	}
+
+	if err := db.DB.Model(&promo).Update("active", false).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la désactivation du code promo dans DeactivatePromoCode")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deactivating the promo code"})
+		return
+	}
+
+	// Supprimer le coupon empêche de nouvelles utilisations sans retirer les réductions en cours
+	if promo.StripeCouponID != "" {
+		if _, err := deleteStripeCoupon(promo.StripeCouponID, nil); err != nil {
+			utils.LogErrorWithUser(userID, err, "Erreur lors de la suppression du coupon Stripe dans DeactivatePromoCode")
+		}
+	}
+
+	utils.LogSuccessWithUser(userID, "Code promo désactivé dans DeactivatePromoCode")
+	c.JSON(http.StatusOK, gin.H{"message": "Promo code deactivated"})
+}
+
+// GetPromoCodesReport returns the conversion report of each campaign of the connected content creator
+// @Summary Promo code conversion report
+// @Description For each promo code of the authenticated content creator: subscriptions started with the code, subscriptions converted (at least one full price payment after the trial or discount), conversion rate, subscriptions still active, revenue and total discount given (in cents)
+// @Tags subscriptions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.PromoCodeReport
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 500 {object} map[string]string "error: Error computing the report"
+// @Router /subscriptions/promo-codes/report [get]
+func GetPromoCodesReport(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans GetPromoCodesReport")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var promoCodes []models.PromoCode
+	if err := db.DB.Where("creator_id = ?", userID).Order("created_at DESC").Find(&promoCodes).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la récupération des codes promo dans GetPromoCodesReport")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error computing the report"})
+		return
+	}
+
+	var rows []struct {
+		PromoCodeID   string
+		Subscriptions int
+		Converted     int
+		StillActive   int
+		Revenue       int
+		DiscountGiven int
+	}
+	if err := db.DB.Table("subscriptions").
+		Select(`subscriptions.promo_code_id,
+			COUNT(DISTINCT subscriptions.id) AS subscriptions,
+			COUNT(DISTINCT CASE WHEN subscription_payments.status = ? AND subscription_payments.amount > 0 AND subscription_payments.promo_code_id IS NULL THEN subscriptions.id END) AS converted,
+			COUNT(DISTINCT CASE WHEN subscriptions.status = ? THEN subscriptions.id END) AS still_active,
+			COALESCE(SUM(CASE WHEN subscription_payments.status = ? THEN subscription_payments.amount ELSE 0 END), 0) AS revenue,
+			COALESCE(SUM(CASE WHEN subscription_payments.status = ? THEN subscription_payments.discount_amount ELSE 0 END), 0) AS discount_given`,
+			models.SubscriptionPaymentSucceeded, models.SubscriptionActive, models.SubscriptionPaymentSucceeded, models.SubscriptionPaymentSucceeded).
+		Joins("LEFT JOIN subscription_payments ON subscription_payments.subscription_id = subscriptions.id").
+		Where("subscriptions.promo_code_id IN (?)", db.DB.Model(&models.PromoCode{}).Select("id").Where("creator_id = ?", userID)).
+		Group("subscriptions.promo_code_id").
+		Scan(&rows).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors du calcul du rapport dans GetPromoCodesReport")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error computing the report"})
+		return
+	}
+
+	reports := make([]models.PromoCodeReport, 0, len(promoCodes))
+	for _, promo := range promoCodes {
+		report := models.PromoCodeReport{PromoCode: promo}
+		for _, row := range rows {
+			if row.PromoCodeID != promo.ID {
+				continue
+			}
+			report.Subscriptions = row.Subscriptions
+			report.Converted = row.Converted
+			report.StillActive = row.StillActive
+			report.Revenue = row.Revenue
+			report.DiscountGiven = row.DiscountGiven
+			if row.Subscriptions > 0 {
+				report.ConversionRate = float64(row.Converted) / float64(row.Subscriptions)
+			}
+		}
+		reports = append(reports, report)
+	}
+
+	c.JSON(http.StatusOK, reports)
+}
@@ -0,0 +1,192 @@
+package stripe
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	stripe "github.com/stripe/stripe-go/v82"
+	"gorm.io/gorm"
+)
+
+func TestFindPromoCode(t *testing.T) {
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+	yesterday := now.AddDate(0, 0, -1)
+
+	tests := []struct {
+		name          string
+		endsAt        *time.Time
+		max           int
+		redemptions   int
+		firstTimeOnly bool
+		previousSubs  int
+		expectedErr   error
+	}{
+		{"valid", nil, 10, 3, false, 0, nil},
+		{"expired", &yesterday, 0, 0, false, 0, errPromoCodeInvalid},
+		{"no redemption left", nil, 10, 10, false, 0, errPromoCodeInvalid},
+		{"new subscriber", nil, 0, 0, true, 0, nil},
+		{"former subscriber", nil, 0, 0, true, 1, errPromoCodeFirstTimeOnly},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, mock, cleanup := testutils.SetupTestDB(t)
+			defer cleanup()
+
+			mock.ExpectQuery(`SELECT \* FROM "promo_codes" WHERE creator_id = \$1 AND code = \$2 AND active = \$3`).
+				WithArgs("creator-uuid", "SUMMER50", true, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "creator_id", "code", "kind", "ends_at", "max_redemptions", "redemptions", "first_time_only"}).
+					AddRow("promo-uuid", "creator-uuid", "SUMMER50", "DISCOUNT", tt.endsAt, tt.max, tt.redemptions, tt.firstTimeOnly))
+			if tt.firstTimeOnly {
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "subscriptions" WHERE user_id = \$1 AND content_creator_id = \$2 AND status IN \(\$3,\$4\)`).
+					WithArgs("user-uuid", "creator-uuid", models.SubscriptionActive, models.SubscriptionCanceled).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.previousSubs))
+			}
+
+			promo, err := findPromoCode("summer50", "creator-uuid", "user-uuid", now)
+
+			assert.Equal(t, tt.expectedErr, err)
+			if tt.expectedErr == nil && assert.NotNil(t, promo) {
+				assert.Equal(t, "promo-uuid", promo.ID)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCreatePromoCode_DiscountCreatesRepeatingCoupon(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	var couponParams *stripe.CouponParams
+	originalNew := newStripeCoupon
+	newStripeCoupon = func(params *stripe.CouponParams) (*stripe.Coupon, error) {
+		couponParams = params
+		return &stripe.Coupon{ID: "coupon_summer"}, nil
+	}
+	t.Cleanup(func() { newStripeCoupon = originalNew })
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "promo_codes" WHERE creator_id = \$1 AND code = \$2`).
+		WithArgs("creator-uuid", "SUMMER50").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "promo_codes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("promo-uuid"))
+	mock.ExpectCommit()
+
+	r := testutils.SetupTestRouter()
+	r.POST("/subscriptions/promo-codes", func(c *gin.Context) {
+		c.Set("user_id", "creator-uuid")
+		c.Set("role", string(models.ContentCreator))
+		CreatePromoCode(c)
+	})
+	body := `{"code": "summer50", "kind": "DISCOUNT", "percentOff": 50, "durationMonths": 3, "maxRedemptions": 100}`
+	req, _ := http.NewRequest(http.MethodPost, "/subscriptions/promo-codes", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	if couponParams == nil {
+		t.Fatal("expected a Stripe coupon to be created")
+	}
+	assert.Equal(t, 50.0, *couponParams.PercentOff)
+	assert.Equal(t, "repeating", *couponParams.Duration)
+	assert.Equal(t, int64(3), *couponParams.DurationInMonths)
+	assert.Contains(t, resp.Body.String(), `"code":"SUMMER50"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReservePromoCode_LimitReached(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	// Une autre session a pris la dernière utilisation entre la vérification et la réservation
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "promo_codes" SET "redemptions"=redemptions \+ \$1 WHERE id = \$2 AND \(max_redemptions = 0 OR redemptions < max_redemptions\)`).
+		WithArgs(1, "promo-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	assert.Equal(t, errPromoCodeInvalid, reservePromoCode("promo-uuid"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleCheckoutSessionExpired_ReleasesPromoCode(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "promo_codes" SET "redemptions"=redemptions - \$1 WHERE id = \$2 AND redemptions > 0`).
+		WithArgs(1, "promo-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	event := stripe.Event{
+		Type: "checkout.session.expired",
+		Data: &stripe.EventData{Raw: []byte(`{"id": "cs_expired", "metadata": {"promo_code_id": "promo-uuid"}}`)},
+	}
+	message, err := dispatchEvent(event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Promo code released", message)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleInvoicePaymentSucceeded_TagsPromoPaymentOfTheInvoice(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	// Première facture réduite de moitié : c'est elle que le rapport des codes promo compte
+	mock.ExpectQuery(`SELECT \* FROM "subscriptions" WHERE stripe_subscription_id = \$1`).
+		WithArgs("sub_1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content_creator_id", "status", "promo_code_id"}).
+			AddRow("subscription-uuid", "user-uuid", "creator-uuid", models.SubscriptionPending, "promo-uuid"))
+	mock.ExpectQuery(`SELECT \* FROM "ledger_transactions" WHERE kind = \$1 AND reference = \$2`).
+		WithArgs(models.LedgerCharge, "in_1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payment_intent_id"}).AddRow("charge-uuid", "pi_1"))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "subscription_payments" WHERE stripe_payment_intent_id = \$1 AND status = \$2`).
+		WithArgs("in_1", models.SubscriptionPaymentSucceeded).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "subscriptions" SET "end_date"=\$1,"status"=\$2,"updated_at"=\$3 WHERE "id" = \$4`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "subscription_payments" WHERE stripe_payment_intent_id = \$1`).
+		WithArgs("in_1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "subscription_payments" \("subscription_id","amount","paid_at","stripe_payment_intent_id","status"`).
+		WithArgs("subscription-uuid", 350, sqlmock.AnyArg(), "in_1", models.SubscriptionPaymentSucceeded, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("payment-uuid"))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "subscription_payments" SET "discount_amount"=\$1,"promo_code_id"=\$2,"updated_at"=\$3 WHERE stripe_payment_intent_id = \$4`).
+		WithArgs(350, "promo-uuid", sqlmock.AnyArg(), "in_1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).
+		WithArgs("user-uuid", 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	// Version basil de l'API : la facture ne porte plus de payment_intent
+	event := stripe.Event{
+		Type: "invoice.payment_succeeded",
+		Data: &stripe.EventData{Raw: []byte(`{"id": "in_1", "amount_paid": 350, "billing_reason": "subscription_create",
+			"total_discount_amounts": [{"amount": 350}],
+			"parent": {"subscription_details": {"subscription": "sub_1"}}}`)},
+	}
+	_, err := dispatchEvent(event)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,12 +1,15 @@
 package stripe
 
 import (
+	"errors"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"pec2-backend/db"
 	"pec2-backend/models"
+	"pec2-backend/services/access"
 	"pec2-backend/utils"
 	mailsmodels "pec2-backend/utils/mails-models"
 
@@ -18,18 +21,45 @@ import (
 	stripeSubscription "github.com/stripe/stripe-go/v82/subscription"
 )
 
+// ensureStripeCustomer vérifie que le client Stripe de l'utilisateur existe, et le crée sinon
+func ensureStripeCustomer(payer *models.User) error {
+	if payer.StripeCustomerId != "" {
+		// Vérifie que le customer existe vraiment sur Stripe
+		_, err := customer.Get(payer.StripeCustomerId, nil)
+		if err != nil {
+			// S'il n'existe pas, on le recrée
+			payer.StripeCustomerId = ""
+		}
+	}
+	if payer.StripeCustomerId == "" {
+		custParams := &stripe.CustomerParams{
+			Name: stripe.String(payer.UserName),
+		}
+		cust, err := customer.New(custParams)
+		if err != nil {
+			return err
+		}
+		db.DB.Model(payer).Update("stripe_customer_id", cust.ID)
+		payer.StripeCustomerId = cust.ID
+	}
+	return nil
+}
+
 // CreateSubscriptionCheckoutSession start a stripe payment to subscribe to a content creator (verified role). Returns the Stripe session ID to use on the frontend.
 // @Summary Create a Stripe Checkout session for subscription
-// @Description Start a Stripe payment to subscribe to a content creator (verified role). Returns the Stripe session ID to use on the frontend.
+// @Description Start a Stripe payment to subscribe to a content creator (verified role) at the creator's monthly price, or at the price of one of the creator's tiers. Returns the Stripe session ID to use on the frontend.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
 // @Param contentCreatorId path string true "ID of the content creator"
+// @Param tierId query string false "ID of the subscription tier, the base subscription if omitted"
+// @Param promoCode query string false "Promo code of the creator (free trial or discount)"
 // @Security BearerAuth
 // @Success 200 {object} map[string]string "sessionId: ID of the Stripe Checkout session, url: Stripe Checkout URL"
+// @Failure 400 {object} map[string]string "error: Invalid or expired promo code / This promo code is reserved to new subscribers"
 // @Failure 401 {object} map[string]string "error: Unauthorized"
-// @Failure 403 {object} map[string]string "error: Can only subscribe to a content creator"
-// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 403 {object} map[string]string "error: Can only subscribe to a content creator / You cannot subscribe to this creator"
+// @Failure 404 {object} map[string]string "error: User not found / Subscription tier not found"
 // @Failure 500 {object} map[string]string "error: Stripe error or server error"
 // @Router /subscriptions/checkout/{contentCreatorId} [post]
 func CreateSubscriptionCheckoutSession(c *gin.Context) {
@@ -65,6 +95,18 @@ func CreateSubscriptionCheckoutSession(c *gin.Context) {
 		return
 	}
 
+	blocked, err := access.IsBlocked(payer.ID, creator.ID)
+	if err != nil {
+		utils.LogErrorWithUser(userID, err, "Error checking blocks dans CreateSubscriptionCheckoutSession")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking blocks"})
+		return
+	}
+	if blocked {
+		utils.LogErrorWithUser(userID, nil, "Blocked user dans CreateSubscriptionCheckoutSession")
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot subscribe to this creator"})
+		return
+	}
+
 	// Vérifier si le créateur de contenu a activé les abonnements
 	if !creator.SubscriptionEnable {
 		utils.LogErrorWithUser(userID, nil, "Ce créateur de contenu a désactivé les abonnements dans CreateSubscriptionCheckoutSession")
@@ -81,26 +123,50 @@ func CreateSubscriptionCheckoutSession(c *gin.Context) {
 		return
 	}
 
-	if payer.StripeCustomerId != "" {
-		// Vérifie que le customer existe vraiment sur Stripe
-		_, err := customer.Get(payer.StripeCustomerId, nil)
+	// Code promo de campagne : essai gratuit ou réduction sur les premiers mois
+	var promo *models.PromoCode
+	if code := c.Query("promoCode"); code != "" {
+		promo, err = findPromoCode(code, creator.ID, payer.ID, time.Now())
+		if errors.Is(err, errPromoCodeInvalid) || errors.Is(err, errPromoCodeFirstTimeOnly) {
+			utils.LogErrorWithUser(userID, err, "Code promo refusé dans CreateSubscriptionCheckoutSession")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
-			// S'il n'existe pas, on le recrée
-			payer.StripeCustomerId = ""
+			utils.LogErrorWithUser(userID, err, "Erreur lors de la vérification du code promo dans CreateSubscriptionCheckoutSession")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking the promo code"})
+			return
 		}
 	}
-	if payer.StripeCustomerId == "" {
-		custParams := &stripe.CustomerParams{
-			Name: stripe.String(payer.UserName),
+
+	if err := ensureStripeCustomer(&payer); err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la création du client Stripe dans CreateSubscriptionCheckoutSession")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la création du client Stripe"})
+		return
+	}
+
+	// Prix au moment du paiement, enregistré sur l'abonnement par le webhook
+	metadata := map[string]string{}
+	var priceID string
+	if tierID := c.Query("tierId"); tierID != "" {
+		var tier models.SubscriptionTier
+		if err := db.DB.Where("id = ? AND creator_id = ? AND archived = ?", tierID, creator.ID, false).First(&tier).Error; err != nil {
+			utils.LogErrorWithUser(userID, err, "Subscription tier not found dans CreateSubscriptionCheckoutSession")
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription tier not found"})
+			return
 		}
-		cust, err := customer.New(custParams)
+		priceID = tier.StripePriceID
+		metadata["tier_id"] = tier.ID
+		metadata["subscription_price"] = strconv.Itoa(tier.Price)
+	} else {
+		// Chaque créateur a son propre prix Stripe, créé au premier abonnement
+		priceID, err = ensureCreatorPrice(&creator)
 		if err != nil {
-			utils.LogErrorWithUser(userID, err, "Erreur lors de la création du client Stripe dans CreateSubscriptionCheckoutSession")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la création du client Stripe"})
+			utils.LogErrorWithUser(userID, err, "Erreur lors de la création du prix Stripe dans CreateSubscriptionCheckoutSession")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la création du prix Stripe"})
 			return
 		}
-		db.DB.Model(&payer).Update("stripe_customer_id", cust.ID)
-		payer.StripeCustomerId = cust.ID
+		metadata["subscription_price"] = strconv.Itoa(creator.SubscriptionPrice)
 	}
 
 	redirectSucces := os.Getenv("STRIPE_REDIRECT_SUCCESS")
@@ -112,17 +178,37 @@ func CreateSubscriptionCheckoutSession(c *gin.Context) {
 		Mode:               stripe.String(string(stripe.CheckoutSessionModeSubscription)),
 		LineItems: []*stripe.CheckoutSessionLineItemParams{
 			{
-				Price:    stripe.String("price_1RUBlC4PRo6qYhfZsvXhuq8y"),
+				Price:    stripe.String(priceID),
 				Quantity: stripe.Int64(1),
 			},
 		},
 		SuccessURL:        stripe.String(redirectSucces + "?creator=" + creator.UserName),
 		CancelURL:         stripe.String(redirectError + "?creator=" + creator.UserName),
 		ClientReferenceID: stripe.String(contentCreatorId),
+		Metadata:          metadata,
+	}
+
+	if promo != nil {
+		if err := reservePromoCode(promo.ID); err != nil {
+			if errors.Is(err, errPromoCodeInvalid) {
+				utils.LogErrorWithUser(userID, err, "Code promo épuisé dans CreateSubscriptionCheckoutSession")
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			utils.LogErrorWithUser(userID, err, "Erreur lors de la réservation du code promo dans CreateSubscriptionCheckoutSession")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking the promo code"})
+			return
+		}
+		applyPromoCode(params, promo)
 	}
 
 	s, err := session.New(params)
 	if err != nil {
+		if promo != nil {
+			if err := releasePromoCode(promo.ID); err != nil {
+				utils.LogErrorWithUser(userID, err, "Erreur lors de la libération du code promo dans CreateSubscriptionCheckoutSession")
+			}
+		}
 		utils.LogErrorWithUser(userID, err, "Erreur lors de la création de la session Stripe dans CreateSubscriptionCheckoutSession")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -199,7 +285,7 @@ func CancelSubscription(c *gin.Context) {
 	} else if err := db.DB.First(&user, "id = ?", userID).Error; err != nil {
 		utils.LogErrorWithUser(userID, err, "Erreur lors de la récupération des infos de l'utilisateur dans CancelSubscription")
 	} else {
-		go mailsmodels.SubscriptionCancellation(user.Email, creator.UserName)
+		go mailsmodels.SubscriptionCancellation(user.Email, creator.UserName, subscription.Price)
 	}
 
 	utils.LogSuccessWithUser(userID, "Abonnement annulé avec succès dans CancelSubscription")
@@ -243,6 +329,8 @@ func GetUserSubscriptions(c *gin.Context) {
 		simplifiedSub := map[string]interface{}{
 			"id":        subscription.ID,
 			"status":    subscription.Status,
+			"price":     subscription.Price,
+			"tierId":    subscription.TierID,
 			"startDate": subscription.StartDate,
 			"endDate":   subscription.EndDate,
 			"createdAt": subscription.CreatedAt,
@@ -0,0 +1,421 @@
+package stripe
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/access"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	stripe "github.com/stripe/stripe-go/v82"
+	stripeSubscription "github.com/stripe/stripe-go/v82/subscription"
+)
+
+// Remplacés dans les tests pour ne pas appeler Stripe
+var (
+	getStripeSubscription    = stripeSubscription.Get
+	updateStripeSubscription = stripeSubscription.Update
+)
+
+// validSubscriptionPrice vérifie qu'un prix mensuel est dans les bornes de la plateforme
+func validSubscriptionPrice(price int) bool {
+	return price >= models.MinSubscriptionPrice && price <= models.MaxSubscriptionPrice
+}
+
+// CreateSubscriptionTier lets a content creator add a subscription tier
+// @Summary Create a subscription tier
+// @Description Add a subscription tier (Basic, Premium, VIP...) with its own monthly price. Tiers are ranked: a post restricted to a tier is visible to subscribers of that tier or of a higher one, the base subscription has rank 0
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param tier body models.SubscriptionTierCreate true "Tier to create"
+// @Security BearerAuth
+// @Success 201 {object} models.SubscriptionTier
+// @Failure 400 {object} map[string]string "error: Invalid data / Price out of bounds"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Only content creators can create subscription tiers"
+// @Failure 409 {object} map[string]string "error: A tier already has this rank"
+// @Failure 500 {object} map[string]string "error: Stripe error or server error"
+// @Router /subscriptions/tiers [post]
+func CreateSubscriptionTier(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans CreateSubscriptionTier")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if role, _ := c.Get("role"); role != string(models.ContentCreator) {
+		utils.LogErrorWithUser(userID, nil, "Not a content creator dans CreateSubscriptionTier")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only content creators can create subscription tiers"})
+		return
+	}
+
+	var request models.SubscriptionTierCreate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.LogErrorWithUser(userID, err, "Invalid data dans CreateSubscriptionTier")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if !validSubscriptionPrice(request.Price) {
+		utils.LogErrorWithUser(userID, nil, "Price out of bounds dans CreateSubscriptionTier")
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Price must be between %d and %d cents", models.MinSubscriptionPrice, models.MaxSubscriptionPrice)})
+		return
+	}
+
+	var sameRank int64
+	if err := db.DB.Model(&models.SubscriptionTier{}).
+		Where("creator_id = ? AND rank = ? AND archived = ?", userID, request.Rank, false).
+		Count(&sameRank).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la vérification du rang dans CreateSubscriptionTier")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating the subscription tier"})
+		return
+	}
+	if sameRank > 0 {
+		utils.LogErrorWithUser(userID, nil, "Rank already used dans CreateSubscriptionTier")
+		c.JSON(http.StatusConflict, gin.H{"error": "A tier already has this rank"})
+		return
+	}
+
+	var creator models.User
+	if err := db.DB.First(&creator, "id = ?", userID).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Creator not found dans CreateSubscriptionTier")
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	productID := creator.StripeProductID
+	priceID, err := createCreatorPrice(&creator, request.Price)
+	if err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la création du prix Stripe dans CreateSubscriptionTier")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating the Stripe price"})
+		return
+	}
+	if creator.StripeProductID != productID {
+		if err := db.DB.Model(&creator).Update("stripe_product_id", creator.StripeProductID).Error; err != nil {
+			utils.LogErrorWithUser(userID, err, "Erreur lors de la sauvegarde du produit Stripe dans CreateSubscriptionTier")
+		}
+	}
+
+	tier := models.SubscriptionTier{
+		CreatorID:     creator.ID,
+		Name:          request.Name,
+		Description:   request.Description,
+		Price:         request.Price,
+		Rank:          request.Rank,
+		StripePriceID: priceID,
+	}
+	if err := db.DB.Create(&tier).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la création du niveau dans CreateSubscriptionTier")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating the subscription tier"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Niveau d'abonnement créé dans CreateSubscriptionTier")
+	c.JSON(http.StatusCreated, tier)
+}
+
+// GetSubscriptionTiers lists the subscription tiers offered by a content creator
+// @Summary List a creator's subscription tiers
+// @Description Return the base subscription price and the active tiers of a content creator, ordered by rank
+// @Tags subscriptions
+// @Produce json
+// @Param creatorId path string true "ID of the content creator"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "basePrice: monthly price of the base subscription, tiers: active tiers"
+// @Failure 404 {object} map[string]string "error: Content creator not found"
+// @Failure 500 {object} map[string]string "error: Error fetching subscription tiers"
+// @Router /subscriptions/tiers/{creatorId} [get]
+func GetSubscriptionTiers(c *gin.Context) {
+	creatorID := c.Param("creatorId")
+
+	var creator models.User
+	if err := db.DB.First(&creator, "id = ? AND role = ?", creatorID, models.ContentCreator).Error; err != nil {
+		utils.LogError(err, "Content creator not found dans GetSubscriptionTiers")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Content creator not found"})
+		return
+	}
+
+	tiers := []models.SubscriptionTier{}
+	if err := db.DB.Where("creator_id = ? AND archived = ?", creator.ID, false).Order("rank").Find(&tiers).Error; err != nil {
+		utils.LogError(err, "Erreur lors de la récupération des niveaux dans GetSubscriptionTiers")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching subscription tiers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"basePrice": creator.SubscriptionPrice, "tiers": tiers})
+}
+
+// loadCreatorTier charge un niveau actif du créateur connecté, ou répond 404
+func loadCreatorTier(c *gin.Context, userID any, caller string) (*models.SubscriptionTier, bool) {
+	var tier models.SubscriptionTier
+	if err := db.DB.Where("id = ? AND creator_id = ? AND archived = ?", c.Param("id"), userID, false).First(&tier).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Subscription tier not found dans "+caller)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription tier not found"})
+		return nil, false
+	}
+	return &tier, true
+}
+
+// UpdateSubscriptionTier lets a content creator edit one of their tiers
+// @Summary Update a subscription tier
+// @Description Update the name, description or price of a tier. A new price creates a new Stripe price and archives the previous one: current subscribers keep the price they subscribed at
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param id path string true "Tier ID"
+// @Param tier body models.SubscriptionTierUpdate true "Fields to update"
+// @Security BearerAuth
+// @Success 200 {object} models.SubscriptionTier
+// @Failure 400 {object} map[string]string "error: Invalid data / Price out of bounds"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Subscription tier not found"
+// @Failure 500 {object} map[string]string "error: Stripe error or server error"
+// @Router /subscriptions/tiers/{id} [put]
+func UpdateSubscriptionTier(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans UpdateSubscriptionTier")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var request models.SubscriptionTierUpdate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.LogErrorWithUser(userID, err, "Invalid data dans UpdateSubscriptionTier")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if request.Price != nil && !validSubscriptionPrice(*request.Price) {
+		utils.LogErrorWithUser(userID, nil, "Price out of bounds dans UpdateSubscriptionTier")
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Price must be between %d and %d cents", models.MinSubscriptionPrice, models.MaxSubscriptionPrice)})
+		return
+	}
+
+	tier, ok := loadCreatorTier(c, userID, "UpdateSubscriptionTier")
+	if !ok {
+		return
+	}
+
+	if request.Name != nil && *request.Name != "" {
+		tier.Name = *request.Name
+	}
+	if request.Description != nil {
+		tier.Description = *request.Description
+	}
+
+	previousPriceID := ""
+	if request.Price != nil && *request.Price != tier.Price {
+		var creator models.User
+		if err := db.DB.First(&creator, "id = ?", userID).Error; err != nil {
+			utils.LogErrorWithUser(userID, err, "Creator not found dans UpdateSubscriptionTier")
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		priceID, err := createCreatorPrice(&creator, *request.Price)
+		if err != nil {
+			utils.LogErrorWithUser(userID, err, "Erreur lors de la création du prix Stripe dans UpdateSubscriptionTier")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating the Stripe price"})
+			return
+		}
+		previousPriceID = tier.StripePriceID
+		tier.Price = *request.Price
+		tier.StripePriceID = priceID
+	}
+
+	if err := db.DB.Save(tier).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la sauvegarde du niveau dans UpdateSubscriptionTier")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating the subscription tier"})
+		return
+	}
+
+	// L'ancien prix n'est plus proposé mais les abonnements Stripe existants continuent de l'utiliser
+	if previousPriceID != "" {
+		if _, err := updateStripePrice(previousPriceID, &stripe.PriceParams{Active: stripe.Bool(false)}); err != nil {
+			utils.LogErrorWithUser(userID, err, "Erreur lors de l'archivage de l'ancien prix Stripe dans UpdateSubscriptionTier")
+		}
+	}
+
+	utils.LogSuccessWithUser(userID, "Niveau d'abonnement mis à jour dans UpdateSubscriptionTier")
+	c.JSON(http.StatusOK, tier)
+}
+
+// DeleteSubscriptionTier archives one of the creator's tiers
+// @Summary Archive a subscription tier
+// @Description Stop offering a tier. Its current subscribers keep it until they change tier or cancel, and posts restricted to it stay restricted to its rank
+// @Tags subscriptions
+// @Produce json
+// @Param id path string true "Tier ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message: Subscription tier archived"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Subscription tier not found"
+// @Failure 500 {object} map[string]string "error: Error archiving the subscription tier"
+// @Router /subscriptions/tiers/{id} [delete]
+func DeleteSubscriptionTier(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans DeleteSubscriptionTier")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tier, ok := loadCreatorTier(c, userID, "DeleteSubscriptionTier")
+	if !ok {
+		return
+	}
+
+	if err := db.DB.Model(tier).Update("archived", true).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de l'archivage du niveau dans DeleteSubscriptionTier")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error archiving the subscription tier"})
+		return
+	}
+
+	if _, err := updateStripePrice(tier.StripePriceID, &stripe.PriceParams{Active: stripe.Bool(false)}); err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de l'archivage du prix Stripe dans DeleteSubscriptionTier")
+	}
+
+	utils.LogSuccessWithUser(userID, "Niveau d'abonnement archivé dans DeleteSubscriptionTier")
+	c.JSON(http.StatusOK, gin.H{"message": "Subscription tier archived"})
+}
+
+// ChangeSubscriptionTier upgrades or downgrades the connected user's subscription to a creator
+// @Summary Change subscription tier
+// @Description Move an active subscription to another tier of the same creator, or back to the base subscription when tierId is omitted. An upgrade is charged right away for the rest of the period, a downgrade is credited on the next invoice (Stripe proration). If the upgrade cannot be paid, the tier is not changed
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param creatorId path string true "ID of the content creator"
+// @Param tier body models.SubscriptionTierChange true "Target tier"
+// @Security BearerAuth
+// @Success 200 {object} models.Subscription
+// @Failure 400 {object} map[string]string "error: Invalid data / Already subscribed to this tier"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 402 {object} map[string]string "error: Payment failed"
+// @Failure 404 {object} map[string]string "error: Subscription not found / Subscription tier not found"
+// @Failure 500 {object} map[string]string "error: Stripe error or server error"
+// @Router /subscriptions/{creatorId}/tier [put]
+func ChangeSubscriptionTier(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans ChangeSubscriptionTier")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var request models.SubscriptionTierChange
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.LogErrorWithUser(userID, err, "Invalid data dans ChangeSubscriptionTier")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if request.TierID != nil && *request.TierID == "" {
+		request.TierID = nil
+	}
+
+	var subscription models.Subscription
+	if err := db.DB.First(&subscription, "user_id = ? AND content_creator_id = ? AND status = ?",
+		userID, c.Param("creatorId"), models.SubscriptionActive).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Subscription not found dans ChangeSubscriptionTier")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
+	currentTier, targetTier := "", ""
+	if subscription.TierID != nil {
+		currentTier = *subscription.TierID
+	}
+	if request.TierID != nil {
+		targetTier = *request.TierID
+	}
+	if currentTier == targetTier {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Already subscribed to this tier"})
+		return
+	}
+
+	// Prix et rang du niveau visé, l'abonnement de base ayant le rang 0
+	var priceID string
+	var price, targetRank int
+	if request.TierID == nil {
+		var creator models.User
+		if err := db.DB.First(&creator, "id = ?", subscription.ContentCreatorID).Error; err != nil {
+			utils.LogErrorWithUser(userID, err, "Creator not found dans ChangeSubscriptionTier")
+			c.JSON(http.StatusNotFound, gin.H{"error": "Content creator not found"})
+			return
+		}
+		var err error
+		if priceID, err = ensureCreatorPrice(&creator); err != nil {
+			utils.LogErrorWithUser(userID, err, "Erreur lors de la création du prix Stripe dans ChangeSubscriptionTier")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating the Stripe price"})
+			return
+		}
+		price = creator.SubscriptionPrice
+	} else {
+		var tier models.SubscriptionTier
+		if err := db.DB.Where("id = ? AND creator_id = ? AND archived = ?", targetTier, subscription.ContentCreatorID, false).First(&tier).Error; err != nil {
+			utils.LogErrorWithUser(userID, err, "Subscription tier not found dans ChangeSubscriptionTier")
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription tier not found"})
+			return
+		}
+		priceID, price, targetRank = tier.StripePriceID, tier.Price, tier.Rank
+	}
+
+	ranks, err := access.SubscriptionRanks([]models.Subscription{subscription})
+	if err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la récupération du niveau actuel dans ChangeSubscriptionTier")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error changing the subscription tier"})
+		return
+	}
+
+	stripeSub, err := getStripeSubscription(subscription.StripeSubscriptionId, nil)
+	if err != nil || stripeSub.Items == nil || len(stripeSub.Items.Data) == 0 {
+		utils.LogErrorWithUser(userID, err, "Abonnement Stripe introuvable dans ChangeSubscriptionTier")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving the Stripe subscription"})
+		return
+	}
+
+	// Une montée de niveau est facturée tout de suite au prorata, une descente est créditée sur la prochaine facture.
+	// Si le paiement de la montée échoue, Stripe refuse le changement : le niveau n'est pas accordé sans paiement
+	prorationBehavior := "create_prorations"
+	if targetRank > ranks[subscription.ContentCreatorID] {
+		prorationBehavior = "always_invoice"
+	}
+	if _, err := updateStripeSubscription(subscription.StripeSubscriptionId, &stripe.SubscriptionParams{
+		Items: []*stripe.SubscriptionItemsParams{
+			{
+				ID:    stripe.String(stripeSub.Items.Data[0].ID),
+				Price: stripe.String(priceID),
+			},
+		},
+		ProrationBehavior: stripe.String(prorationBehavior),
+		PaymentBehavior:   stripe.String("error_if_incomplete"),
+	}); err != nil {
+		var stripeErr *stripe.Error
+		if errors.As(err, &stripeErr) && stripeErr.Type == stripe.ErrorTypeCard {
+			utils.LogErrorWithUser(userID, err, "Paiement refusé dans ChangeSubscriptionTier")
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Payment failed: " + stripeErr.Msg})
+			return
+		}
+		utils.LogErrorWithUser(userID, err, "Erreur lors du changement de prix Stripe dans ChangeSubscriptionTier")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error changing the Stripe subscription"})
+		return
+	}
+
+	if err := db.DB.Model(&subscription).Updates(map[string]interface{}{
+		"tier_id": request.TierID,
+		"price":   price,
+	}).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la mise à jour de l'abonnement dans ChangeSubscriptionTier")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error changing the subscription tier"})
+		return
+	}
+
+	subscription.TierID, subscription.Price = request.TierID, price
+
+	utils.LogSuccessWithUser(userID, "Niveau d'abonnement changé dans ChangeSubscriptionTier")
+	c.JSON(http.StatusOK, subscription)
+}
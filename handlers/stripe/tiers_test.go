@@ -0,0 +1,129 @@
+package stripe
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	stripe "github.com/stripe/stripe-go/v82"
+)
+
+func setupTierRouter() *gin.Engine {
+	r := testutils.SetupTestRouter()
+	r.POST("/subscriptions/tiers", func(c *gin.Context) {
+		c.Set("user_id", "creator-uuid")
+		c.Set("role", string(models.ContentCreator))
+		CreateSubscriptionTier(c)
+	})
+	r.PUT("/subscriptions/:creatorId/tier", func(c *gin.Context) {
+		c.Set("user_id", "subscriber-uuid")
+		c.Set("role", string(models.UserRole))
+		ChangeSubscriptionTier(c)
+	})
+	return r
+}
+
+func TestCreateSubscriptionTier_RankAlreadyUsed(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "subscription_tiers" WHERE creator_id = \$1 AND rank = \$2 AND archived = \$3`).
+		WithArgs("creator-uuid", 2, false).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	req, _ := http.NewRequest(http.MethodPost, "/subscriptions/tiers", bytes.NewBufferString(`{"name": "Premium", "price": 1500, "rank": 2}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	setupTierRouter().ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangeSubscriptionTier_UpgradeIsInvoicedRightAway(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	var updated *stripe.SubscriptionParams
+	originalGet, originalUpdate := getStripeSubscription, updateStripeSubscription
+	getStripeSubscription = func(id string, params *stripe.SubscriptionParams) (*stripe.Subscription, error) {
+		return &stripe.Subscription{ID: id, Items: &stripe.SubscriptionItemList{
+			Data: []*stripe.SubscriptionItem{{ID: "si_base"}},
+		}}, nil
+	}
+	updateStripeSubscription = func(id string, params *stripe.SubscriptionParams) (*stripe.Subscription, error) {
+		updated = params
+		return &stripe.Subscription{ID: id}, nil
+	}
+	t.Cleanup(func() { getStripeSubscription, updateStripeSubscription = originalGet, originalUpdate })
+
+	mock.ExpectQuery(`SELECT \* FROM "subscriptions" WHERE user_id = \$1 AND content_creator_id = \$2 AND status = \$3`).
+		WithArgs("subscriber-uuid", "creator-uuid", models.SubscriptionActive, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content_creator_id", "status", "stripe_subscription_id", "price"}).
+			AddRow("sub-uuid", "subscriber-uuid", "creator-uuid", "ACTIVE", "sub_stripe", 700))
+	mock.ExpectQuery(`SELECT \* FROM "subscription_tiers" WHERE id = \$1 AND creator_id = \$2 AND archived = \$3`).
+		WithArgs("vip-tier-uuid", "creator-uuid", false, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "creator_id", "price", "rank", "stripe_price_id"}).
+			AddRow("vip-tier-uuid", "creator-uuid", 2500, 3, "price_vip"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "subscriptions" SET "price"=\$1,"tier_id"=\$2,"updated_at"=\$3 WHERE "id" = \$4`).
+		WithArgs(2500, "vip-tier-uuid", sqlmock.AnyArg(), "sub-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	req, _ := http.NewRequest(http.MethodPut, "/subscriptions/creator-uuid/tier", bytes.NewBufferString(`{"tierId": "vip-tier-uuid"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	setupTierRouter().ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	if updated == nil {
+		t.Fatal("expected the Stripe subscription to be updated")
+	}
+	assert.Equal(t, "always_invoice", *updated.ProrationBehavior)
+	assert.Equal(t, "error_if_incomplete", *updated.PaymentBehavior)
+	assert.Equal(t, "si_base", *updated.Items[0].ID)
+	assert.Equal(t, "price_vip", *updated.Items[0].Price)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangeSubscriptionTier_DeclinedUpgradeKeepsCurrentTier(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	originalGet, originalUpdate := getStripeSubscription, updateStripeSubscription
+	getStripeSubscription = func(id string, params *stripe.SubscriptionParams) (*stripe.Subscription, error) {
+		return &stripe.Subscription{ID: id, Items: &stripe.SubscriptionItemList{
+			Data: []*stripe.SubscriptionItem{{ID: "si_base"}},
+		}}, nil
+	}
+	updateStripeSubscription = func(id string, params *stripe.SubscriptionParams) (*stripe.Subscription, error) {
+		return nil, &stripe.Error{Type: stripe.ErrorTypeCard, Code: stripe.ErrorCodeCardDeclined, Msg: "Your card was declined."}
+	}
+	t.Cleanup(func() { getStripeSubscription, updateStripeSubscription = originalGet, originalUpdate })
+
+	mock.ExpectQuery(`SELECT \* FROM "subscriptions" WHERE user_id = \$1 AND content_creator_id = \$2 AND status = \$3`).
+		WithArgs("subscriber-uuid", "creator-uuid", models.SubscriptionActive, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content_creator_id", "status", "stripe_subscription_id", "price"}).
+			AddRow("sub-uuid", "subscriber-uuid", "creator-uuid", "ACTIVE", "sub_stripe", 700))
+	mock.ExpectQuery(`SELECT \* FROM "subscription_tiers" WHERE id = \$1 AND creator_id = \$2 AND archived = \$3`).
+		WithArgs("vip-tier-uuid", "creator-uuid", false, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "creator_id", "price", "rank", "stripe_price_id"}).
+			AddRow("vip-tier-uuid", "creator-uuid", 2500, 3, "price_vip"))
+	// Aucune mise à jour de l'abonnement local : le niveau n'a pas été payé
+
+	req, _ := http.NewRequest(http.MethodPut, "/subscriptions/creator-uuid/tier", bytes.NewBufferString(`{"tierId": "vip-tier-uuid"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	setupTierRouter().ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusPaymentRequired, resp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
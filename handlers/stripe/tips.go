@@ -0,0 +1,344 @@
+package stripe
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/access"
+	"pec2-backend/services/ledger"
+	"pec2-backend/services/messaging"
+	"pec2-backend/services/notifications"
+	"pec2-backend/services/realtime"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	stripe "github.com/stripe/stripe-go/v82"
+	session "github.com/stripe/stripe-go/v82/checkout/session"
+)
+
+// Valeur de la metadata "purpose" des pourboires
+const tipPurpose = "tip"
+
+// GetTipAmounts returns the preset tip amounts and the bounds of a custom amount
+// @Summary Tip amounts
+// @Description Return the preset tip amounts and the minimum and maximum of a custom amount (in cents)
+// @Tags tips
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "presets, min, max"
+// @Router /tips/amounts [get]
+func GetTipAmounts(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"presets": models.TipPresetAmounts,
+		"min":     models.MinTipAmount,
+		"max":     models.MaxTipAmount,
+	})
+}
+
+// CreateTipCheckoutSession starts a one-off Stripe payment to tip a content creator
+// @Summary Tip a content creator
+// @Description Start a one-off Stripe payment to tip a content creator on a post, on their profile or in a private conversation, with an optional message. The tip is recorded when Stripe confirms the payment (webhook)
+// @Tags tips
+// @Accept json
+// @Produce json
+// @Param creatorId path string true "ID of the content creator"
+// @Param tip body models.TipCreate true "Amount in cents, context and optional message"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "sessionId: ID of the Stripe Checkout session, url: Stripe Checkout URL"
+// @Failure 400 {object} map[string]string "error: Invalid data / Amount out of bounds"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: You cannot tip this user"
+// @Failure 404 {object} map[string]string "error: Content creator not found / Post not found"
+// @Failure 500 {object} map[string]string "error: Stripe error or server error"
+// @Router /tips/{creatorId} [post]
+func CreateTipCheckoutSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans CreateTipCheckoutSession")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var request models.TipCreate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.LogErrorWithUser(userID, err, "Invalid data dans CreateTipCheckoutSession")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if request.Amount < models.MinTipAmount || request.Amount > models.MaxTipAmount {
+		utils.LogErrorWithUser(userID, nil, "Amount out of bounds dans CreateTipCheckoutSession")
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Amount must be between %d and %d cents", models.MinTipAmount, models.MaxTipAmount)})
+		return
+	}
+
+	var creator models.User
+	if err := db.DB.First(&creator, "id = ? AND role = ?", c.Param("creatorId"), models.ContentCreator).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Content creator not found dans CreateTipCheckoutSession")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Content creator not found"})
+		return
+	}
+	if creator.ID == userID.(string) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot tip yourself"})
+		return
+	}
+	blocked, err := access.IsBlocked(userID.(string), creator.ID)
+	if err != nil {
+		utils.LogErrorWithUser(userID, err, "Error checking blocks dans CreateTipCheckoutSession")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking blocks"})
+		return
+	}
+	if blocked {
+		utils.LogErrorWithUser(userID, nil, "Blocked user dans CreateTipCheckoutSession")
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot tip this user"})
+		return
+	}
+
+	switch request.Context {
+	case models.TipOnPost:
+		var post models.Post
+		if request.PostID == nil || db.DB.Where("id = ? AND user_id = ? AND enable = ?", *request.PostID, creator.ID, true).First(&post).Error != nil {
+			utils.LogErrorWithUser(userID, nil, "Post not found dans CreateTipCheckoutSession")
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			return
+		}
+	case models.TipInMessage:
+		// Le message du pourboire est déposé dans la conversation
+		if !creator.MessageEnable {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This creator does not accept messages"})
+			return
+		}
+		request.PostID = nil
+	default:
+		request.PostID = nil
+	}
+
+	var payer models.User
+	if err := db.DB.First(&payer, "id = ?", userID).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "User not found dans CreateTipCheckoutSession")
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err := ensureStripeCustomer(&payer); err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la création du client Stripe dans CreateTipCheckoutSession")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la création du client Stripe"})
+		return
+	}
+
+	tip := models.Tip{
+		SenderID:  payer.ID,
+		CreatorID: creator.ID,
+		Context:   request.Context,
+		PostID:    request.PostID,
+		Amount:    request.Amount,
+		Message:   request.Message,
+		Status:    models.TipPending,
+	}
+	if err := db.DB.Create(&tip).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Error saving tip dans CreateTipCheckoutSession")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving tip"})
+		return
+	}
+
+	metadata := map[string]string{
+		"purpose": tipPurpose,
+		"tip_id":  tip.ID,
+	}
+	params := &stripe.CheckoutSessionParams{
+		Customer:           stripe.String(payer.StripeCustomerId),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		Mode:               stripe.String(string(stripe.CheckoutSessionModePayment)),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+					Currency:   stripe.String(string(stripe.CurrencyEUR)),
+					UnitAmount: stripe.Int64(int64(tip.Amount)),
+					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+						Name: stripe.String("Pourboire pour " + creator.UserName),
+					},
+				},
+				Quantity: stripe.Int64(1),
+			},
+		},
+		Metadata:          metadata,
+		PaymentIntentData: &stripe.CheckoutSessionPaymentIntentDataParams{Metadata: metadata},
+		SuccessURL:        stripe.String(os.Getenv("STRIPE_REDIRECT_SUCCESS") + "?tip=" + tip.ID),
+		CancelURL:         stripe.String(os.Getenv("STRIPE_REDIRECT_ERROR") + "?tip=" + tip.ID),
+		ClientReferenceID: stripe.String(creator.ID),
+	}
+
+	s, err := session.New(params)
+	if err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la création de la session Stripe dans CreateTipCheckoutSession")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := db.DB.Model(&tip).Update("stripe_session_id", s.ID).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Error saving tip session dans CreateTipCheckoutSession")
+	}
+
+	utils.LogSuccessWithUser(userID, "Session Stripe de pourboire créée avec succès dans CreateTipCheckoutSession")
+	c.JSON(http.StatusOK, gin.H{"sessionId": s.ID, "url": s.URL})
+}
+
+// handleTipCompleted enregistre le pourboire une fois le paiement confirmé et prévient le créateur
+func handleTipCompleted(checkoutSession stripe.CheckoutSession) (string, error) {
+	if checkoutSession.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
+		utils.LogSuccess("Tip waiting for payment dans handleTipCompleted")
+		return "Tip waiting for payment", nil
+	}
+
+	var tip models.Tip
+	if err := db.DB.First(&tip, "id = ?", checkoutSession.Metadata["tip_id"]).Error; err != nil {
+		utils.LogError(err, "Tip not found dans handleTipCompleted")
+		return "", eventFailure(http.StatusNotFound, "Tip not found")
+	}
+	if tip.Status == models.TipSucceeded {
+		utils.LogSuccess("Tip already recorded dans handleTipCompleted")
+		return "Tip already recorded", nil
+	}
+
+	paymentIntentID := ""
+	if checkoutSession.PaymentIntent != nil {
+		paymentIntentID = checkoutSession.PaymentIntent.ID
+	}
+	now := time.Now()
+
+	// Grand livre d'abord : l'enregistrement est idempotent, un échec laisse le pourboire
+	// en attente et l'évènement est rejoué
+	if err := ledger.RecordCharge(ledger.Charge{
+		CreatorID:       tip.CreatorID,
+		Reference:       tip.ID,
+		PaymentIntentID: paymentIntentID,
+		Source:          models.LedgerSourceTip,
+		Amount:          int(checkoutSession.AmountTotal),
+		At:              now,
+	}); err != nil {
+		utils.LogError(err, "Erreur lors de l'enregistrement du pourboire au grand livre dans handleTipCompleted")
+		return "", eventFailure(http.StatusInternalServerError, "Error recording tip in ledger")
+	}
+
+	if err := db.DB.Model(&tip).Updates(map[string]interface{}{
+		"status":                   models.TipSucceeded,
+		"amount":                   checkoutSession.AmountTotal,
+		"stripe_payment_intent_id": paymentIntentID,
+		"paid_at":                  now,
+	}).Error; err != nil {
+		utils.LogError(err, "Error updating tip dans handleTipCompleted")
+		return "", eventFailure(http.StatusInternalServerError, "Error updating tip")
+	}
+
+	postID := ""
+	if tip.PostID != nil {
+		postID = *tip.PostID
+	}
+	notifications.Notify(notifications.Event{
+		UserID:  tip.CreatorID,
+		Type:    models.NotificationTipReceived,
+		ActorID: tip.SenderID,
+		PostID:  postID,
+		Detail:  strconv.FormatInt(checkoutSession.AmountTotal, 10),
+	})
+	realtime.PublishToUser(tip.CreatorID, realtime.EventTipReceived, gin.H{
+		"tipId":    tip.ID,
+		"senderId": tip.SenderID,
+		"context":  tip.Context,
+		"postId":   tip.PostID,
+		"amount":   checkoutSession.AmountTotal,
+		"message":  tip.Message,
+	})
+
+	// Un pourboire envoyé depuis une conversation y apparaît comme un message
+	if tip.Context == models.TipInMessage {
+		var creator models.User
+		if err := db.DB.First(&creator, "id = ?", tip.CreatorID).Error; err != nil {
+			utils.LogError(err, "Creator not found dans handleTipCompleted")
+		} else {
+			content := fmt.Sprintf("Sent a %.2f € tip", float64(checkoutSession.AmountTotal)/100)
+			if tip.Message != "" {
+				content += ": " + tip.Message
+			}
+			if _, err := messaging.SendMessage(tip.SenderID, creator, content); err != nil {
+				utils.LogError(err, "Erreur lors de l'envoi du message de pourboire dans handleTipCompleted")
+			}
+		}
+	}
+
+	utils.LogSuccess("Tip recorded dans handleTipCompleted")
+	return "Tip recorded", nil
+}
+
+// GetReceivedTips lists the tips received by the connected content creator
+// @Summary List received tips
+// @Description Return the paid tips received by the authenticated content creator, most recent first
+// @Tags tips
+// @Produce json
+// @Param limit query integer false "Number of tips (default 20, max 100)"
+// @Security BearerAuth
+// @Success 200 {array} models.TipResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 500 {object} map[string]string "error: Error fetching tips"
+// @Router /tips/received [get]
+func GetReceivedTips(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated dans GetReceivedTips")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	limit := 20
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, 100)
+	}
+
+	var tips []models.Tip
+	if err := db.DB.Where("creator_id = ? AND status = ?", userID, models.TipSucceeded).
+		Order("paid_at DESC").Limit(limit).Find(&tips).Error; err != nil {
+		utils.LogErrorWithUser(userID, err, "Erreur lors de la récupération des pourboires dans GetReceivedTips")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching tips"})
+		return
+	}
+
+	senders := map[string]models.User{}
+	if len(tips) > 0 {
+		senderIDs := make([]string, 0, len(tips))
+		for _, tip := range tips {
+			senderIDs = append(senderIDs, tip.SenderID)
+		}
+		var users []models.User
+		if err := db.DB.Where("id IN ?", senderIDs).Find(&users).Error; err != nil {
+			utils.LogErrorWithUser(userID, err, "Erreur lors de la récupération des fans dans GetReceivedTips")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching tips"})
+			return
+		}
+		for _, user := range users {
+			senders[user.ID] = user
+		}
+	}
+
+	response := make([]models.TipResponse, 0, len(tips))
+	for _, tip := range tips {
+		sender := senders[tip.SenderID]
+		response = append(response, models.TipResponse{
+			ID: tip.ID,
+			Sender: models.UserInfo{
+				ID:                     sender.ID,
+				UserName:               sender.UserName,
+				ProfilePicture:         sender.ProfilePicture,
+				ProfilePictureVariants: sender.ProfilePictureVariants,
+			},
+			Context: tip.Context,
+			PostID:  tip.PostID,
+			Amount:  tip.Amount,
+			Message: tip.Message,
+			PaidAt:  tip.PaidAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
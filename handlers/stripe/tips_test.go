@@ -0,0 +1,157 @@
+package stripe
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	stripe "github.com/stripe/stripe-go/v82"
+)
+
+func TestCreateTipCheckoutSession_Validation(t *testing.T) {
+	expectCreator := func(mock sqlmock.Sqlmock, id string) {
+		mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1 AND role = \$2`).
+			WithArgs(id, models.ContentCreator, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "role", "message_enable"}).AddRow(id, models.ContentCreator, true))
+	}
+
+	tests := []struct {
+		name      string
+		creatorID string
+		body      string
+		setup     func(mock sqlmock.Sqlmock)
+		code      int
+	}{
+		{
+			name:      "amount below the minimum",
+			creatorID: "creator-uuid",
+			body:      `{"amount": 50, "context": "PROFILE"}`,
+			setup:     func(mock sqlmock.Sqlmock) {},
+			code:      http.StatusBadRequest,
+		},
+		{
+			name:      "unknown context",
+			creatorID: "creator-uuid",
+			body:      `{"amount": 500, "context": "STORY"}`,
+			setup:     func(mock sqlmock.Sqlmock) {},
+			code:      http.StatusBadRequest,
+		},
+		{
+			name:      "tipping yourself",
+			creatorID: "fan-uuid",
+			body:      `{"amount": 500, "context": "PROFILE"}`,
+			setup:     func(mock sqlmock.Sqlmock) { expectCreator(mock, "fan-uuid") },
+			code:      http.StatusForbidden,
+		},
+		{
+			name:      "post of another creator",
+			creatorID: "creator-uuid",
+			body:      `{"amount": 500, "context": "POST", "postId": "other-post-uuid"}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectCreator(mock, "creator-uuid")
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks"`).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(`SELECT \* FROM "posts" WHERE id = \$1 AND user_id = \$2 AND enable = \$3`).
+					WithArgs("other-post-uuid", "creator-uuid", true, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+			code: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, mock, cleanup := testutils.SetupTestDB(t)
+			defer cleanup()
+			tt.setup(mock)
+
+			r := testutils.SetupTestRouter()
+			r.POST("/tips/:creatorId", func(c *gin.Context) {
+				c.Set("user_id", "fan-uuid")
+				CreateTipCheckoutSession(c)
+			})
+			req, _ := http.NewRequest(http.MethodPost, "/tips/"+tt.creatorID, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.code, resp.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestHandleTipCompleted_RecordsTip(t *testing.T) {
+	t.Setenv("PLATFORM_FEE_PERCENT", "20")
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "tips" WHERE id = \$1`).
+		WithArgs("tip-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "creator_id", "context", "amount", "status"}).
+			AddRow("tip-uuid", "fan-uuid", "creator-uuid", models.TipOnProfile, 500, models.TipPending))
+	mock.ExpectQuery(`SELECT \* FROM "ledger_transactions" WHERE kind = \$1 AND reference = \$2`).
+		WithArgs(models.LedgerCharge, "tip-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "ledger_transactions"`).
+		WithArgs(models.LedgerCharge, "tip-uuid", "creator-uuid", nil, models.LedgerSourceTip, "pi_tip", 500, sqlmock.AnyArg(), nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("charge-uuid"))
+	mock.ExpectQuery(`INSERT INTO "ledger_entries"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("entry-1").AddRow("entry-2"))
+	mock.ExpectQuery(`INSERT INTO "ledger_transactions"`).
+		WithArgs(models.LedgerPlatformFee, "tip-uuid", "creator-uuid", "charge-uuid", models.LedgerSourceTip, "", 100, nil, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("fee-uuid"))
+	mock.ExpectQuery(`INSERT INTO "ledger_entries"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("entry-3").AddRow("entry-4"))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "tips" SET "amount"=\$1,"paid_at"=\$2,"status"=\$3,"stripe_payment_intent_id"=\$4,"updated_at"=\$5 WHERE "id" = \$6`).
+		WithArgs(int64(500), sqlmock.AnyArg(), models.TipSucceeded, "pi_tip", sqlmock.AnyArg(), "tip-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	message, err := handleTipCompleted(stripe.CheckoutSession{
+		ID:            "cs_tip",
+		PaymentStatus: stripe.CheckoutSessionPaymentStatusPaid,
+		AmountTotal:   500,
+		PaymentIntent: &stripe.PaymentIntent{ID: "pi_tip"},
+		Metadata:      map[string]string{"purpose": tipPurpose, "tip_id": "tip-uuid"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Tip recorded", message)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleTipCompleted_LedgerFailureKeepsTipPending(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "tips" WHERE id = \$1`).
+		WithArgs("tip-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "creator_id", "context", "amount", "status"}).
+			AddRow("tip-uuid", "fan-uuid", "creator-uuid", models.TipOnProfile, 500, models.TipPending))
+	mock.ExpectQuery(`SELECT \* FROM "ledger_transactions" WHERE kind = \$1 AND reference = \$2`).
+		WillReturnError(sql.ErrConnDone)
+
+	_, err := handleTipCompleted(stripe.CheckoutSession{
+		ID:            "cs_tip",
+		PaymentStatus: stripe.CheckoutSessionPaymentStatusPaid,
+		AmountTotal:   500,
+		PaymentIntent: &stripe.PaymentIntent{ID: "pi_tip"},
+		Metadata:      map[string]string{"purpose": tipPurpose, "tip_id": "tip-uuid"},
+	})
+
+	// Pas de mise à jour du pourboire : l'évènement en échec sera rejoué
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
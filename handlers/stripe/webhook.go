@@ -2,20 +2,26 @@ package stripe
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"pec2-backend/db"
 	"pec2-backend/models"
+	"pec2-backend/services/ledger"
+	"pec2-backend/services/notifications"
+	"pec2-backend/services/realtime"
 	"pec2-backend/utils"
 	mailsmodels "pec2-backend/utils/mails-models"
 
 	"github.com/gin-gonic/gin"
 	stripe "github.com/stripe/stripe-go/v82"
 	"github.com/stripe/stripe-go/v82/webhook"
+	"gorm.io/gorm"
 )
 
 func StripeWebhookHandler(c *gin.Context) {
@@ -38,74 +44,140 @@ func StripeWebhookHandler(c *gin.Context) {
 
 	sig := c.GetHeader("Stripe-Signature")
 	event, err := webhook.ConstructEvent(payload, sig, secret)
+	// Les évènements des comptes connectés (versements, vérification) arrivent par l'endpoint Connect, qui a son propre secret
+	if connectSecret := os.Getenv("STRIPE_CONNECT_WEBHOOK_SECRET"); err != nil && connectSecret != "" {
+		event, err = webhook.ConstructEvent(payload, sig, connectSecret)
+	}
 	if err != nil {
 		utils.LogError(err, "Stripe signature verification failed dans StripeWebhookHandler")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Stripe signature verification failed"})
 		return
 	}
 
+	// L'évènement est enregistré avant d'être traité : Stripe le relivre tant qu'il n'est pas stocké,
+	// ensuite les échecs sont rejoués depuis la table
+	stored, err := storeEvent(event, payload)
+	if err != nil {
+		utils.LogError(err, "Error storing event dans StripeWebhookHandler")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error storing event"})
+		return
+	}
+	if stored.Status == models.StripeEventProcessed {
+		utils.LogSuccess("Event already processed dans StripeWebhookHandler: " + stored.ID)
+		c.JSON(http.StatusOK, gin.H{"message": "Event already processed"})
+		return
+	}
+
+	if err := processEvent(stored, false, time.Now()); err != nil {
+		utils.LogError(err, "Error processing event dans StripeWebhookHandler: "+stored.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Event received", "status": stored.Status})
+}
+
+// dispatchEvent traite un évènement Stripe selon son type. Une erreur marque l'évènement en échec
+func dispatchEvent(event stripe.Event) (string, error) {
 	switch event.Type {
 	case "checkout.session.completed":
-		handleCheckoutSessionCompleted(c, event)
+		return handleCheckoutSessionCompleted(event)
+	case "checkout.session.expired":
+		return handleCheckoutSessionExpired(event)
 	case "payment_intent.created":
-		handlePaymentIntentCreated(c, event)
+		return handlePaymentIntentCreated(event)
 	case "payment_intent.processing":
-		handlePaymentIntentProcessing(c, event)
+		return handlePaymentIntentProcessing(event)
 	// case "payment_intent.succeeded":
 	// 	handlePaymentIntentSucceeded(c, event)
 	case "payment_intent.failed":
-		handlePaymentIntentFailed(c, event)
+		return handlePaymentIntentFailed(event)
 	case "payment_intent.canceled":
-		handlePaymentIntentCanceled(c, event)
+		return handlePaymentIntentCanceled(event)
 	case "invoice.payment_succeeded":
-		handleInvoicePaymentSucceeded(c, event)
+		return handleInvoicePaymentSucceeded(event)
 	case "invoice.payment_failed":
-		handleInvoicePaymentFailed(c, event)
+		return handleInvoicePaymentFailed(event)
+	case "charge.refunded":
+		return handleChargeRefunded(event)
+	case "charge.dispute.created":
+		return handleDisputeCreated(event)
+	case "charge.dispute.closed":
+		return handleDisputeClosed(event)
+	case "payout.created", "payout.updated", "payout.paid", "payout.failed", "payout.canceled":
+		return handlePayoutEvent(event)
+	case "transfer.created", "transfer.updated", "transfer.reversed":
+		return handleTransferEvent(event)
+	case "account.updated":
+		return handleAccountUpdated(event)
 	default:
-		c.JSON(http.StatusOK, gin.H{"message": "Event ignored"})
+		return "Event ignored", nil
 	}
 }
 
-func handleCheckoutSessionCompleted(c *gin.Context, event stripe.Event) {
+// handleCheckoutSessionExpired rend l'utilisation du code promo réservée par une session abandonnée
+func handleCheckoutSessionExpired(event stripe.Event) (string, error) {
+	var session stripe.CheckoutSession
+	if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+		utils.LogError(err, "Error parsing CheckoutSession dans handleCheckoutSessionExpired")
+		return "", eventFailure(http.StatusBadRequest, "Error parsing CheckoutSession")
+	}
+
+	promoCodeID := session.Metadata["promo_code_id"]
+	if promoCodeID == "" {
+		return "No promo code to release", nil
+	}
+	if err := releasePromoCode(promoCodeID); err != nil {
+		utils.LogError(err, "Erreur lors de la libération du code promo dans handleCheckoutSessionExpired")
+		return "", eventFailure(http.StatusInternalServerError, "Error releasing the promo code")
+	}
+
+	utils.LogSuccess("Promo code released dans handleCheckoutSessionExpired")
+	return "Promo code released", nil
+}
+
+func handleCheckoutSessionCompleted(event stripe.Event) (string, error) {
 	var session stripe.CheckoutSession
 	if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
 		utils.LogError(err, "Error parsing CheckoutSession dans handleCheckoutSessionCompleted")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing CheckoutSession"})
-		return
+		return "", eventFailure(http.StatusBadRequest, "Error parsing CheckoutSession")
+	}
+
+	// Les paiements ponctuels (déblocage de pièces jointes) ne créent pas d'abonnement
+	if session.Metadata["purpose"] == messageUnlockPurpose {
+		return handleMessageUnlockCompleted(session)
+	}
+	if session.Metadata["purpose"] == tipPurpose {
+		return handleTipCompleted(session)
 	}
 
 	if session.Customer == nil {
 		utils.LogError(nil, "Customer missing in session dans handleCheckoutSessionCompleted")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Customer missing in session"})
-		return
+		return "", eventFailure(http.StatusBadRequest, "Customer missing in session")
 	}
 
 	customerID := session.Customer.ID
 	creatorID := session.ClientReferenceID
 	if creatorID == "" {
 		utils.LogError(nil, "ClientReferenceID missing dans handleCheckoutSessionCompleted")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ClientReferenceID missing"})
-		return
+		return "", eventFailure(http.StatusBadRequest, "ClientReferenceID missing")
 	}
 
 	var user models.User
 	if err := db.DB.First(&user, "stripe_customer_id = ?", customerID).Error; err != nil {
 		utils.LogError(err, "User not found for this customer dans handleCheckoutSessionCompleted")
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found for this customer"})
-		return
+		return "", eventFailure(http.StatusNotFound, "User not found for this customer")
 	}
 
 	var creator models.User
 	if err := db.DB.First(&creator, "id = ?", creatorID).Error; err != nil {
 		utils.LogError(err, "Creator not found dans handleCheckoutSessionCompleted")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Creator not found"})
-		return
+		return "", eventFailure(http.StatusNotFound, "Creator not found")
 	}
 
 	if creator.Role != models.ContentCreator {
 		utils.LogError(nil, "The target is not a content creator dans handleCheckoutSessionCompleted")
-		c.JSON(http.StatusForbidden, gin.H{"error": "The target is not a content creator"})
-		return
+		return "", eventFailure(http.StatusForbidden, "The target is not a content creator")
 	}
 
 	var stripeSubID string
@@ -114,13 +186,14 @@ func handleCheckoutSessionCompleted(c *gin.Context, event stripe.Event) {
 		var tmp models.Subscription
 		if err := db.DB.First(&tmp, "stripe_subscription_id = ?", stripeSubID).Error; err == nil {
 			utils.LogError(nil, "Stripe subscription already exists dans handleCheckoutSessionCompleted")
-			c.JSON(http.StatusOK, gin.H{"message": "Stripe subscription already exists"})
-			return
+			return "Stripe subscription already exists", nil
 		}
 	}
 
+	// Un essai gratuit ne demande aucun paiement à la souscription
+	paid := session.PaymentStatus == "paid" || session.PaymentStatus == "no_payment_required"
 	initialStatus := models.SubscriptionPending
-	if session.PaymentStatus == "paid" {
+	if paid {
 		initialStatus = models.SubscriptionActive
 	}
 
@@ -136,34 +209,87 @@ func handleCheckoutSessionCompleted(c *gin.Context, event stripe.Event) {
 		now := time.Now()
 		end := now.AddDate(0, 1, 0)
 
+		price := creator.SubscriptionPrice
+		if metadataPrice, err := strconv.Atoi(session.Metadata["subscription_price"]); err == nil && metadataPrice > 0 {
+			price = metadataPrice
+		}
+		var tierID *string
+		if metadataTier := session.Metadata["tier_id"]; metadataTier != "" {
+			tierID = &metadataTier
+		}
+
+		// Campagne promotionnelle : l'essai gratuit fixe la fin de la première période
+		var promoCodeID *string
+		if metadataPromo := session.Metadata["promo_code_id"]; metadataPromo != "" {
+			var promo models.PromoCode
+			if err := db.DB.First(&promo, "id = ?", metadataPromo).Error; err != nil {
+				utils.LogError(err, "Promo code not found dans handleCheckoutSessionCompleted")
+			} else {
+				promoCodeID = &promo.ID
+				if promo.Kind == models.PromoCodeTrial {
+					end = now.AddDate(0, 0, promo.TrialDays)
+				}
+			}
+		}
+
 		sub = models.Subscription{
 			UserID:               user.ID,
 			ContentCreatorID:     creator.ID,
 			Status:               initialStatus,
 			StripeSubscriptionId: stripeSubID,
+			Price:                price,
+			TierID:               tierID,
 			StartDate:            now,
 			EndDate:              &end,
+			PromoCodeID:          promoCodeID,
 		}
 
 		if err := db.DB.Create(&sub).Error; err != nil {
 			utils.LogError(err, "Error creating subscription dans handleCheckoutSessionCompleted")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating subscription"})
-			return
+			return "", eventFailure(http.StatusInternalServerError, "Error creating subscription")
 		}
+
+		realtime.PublishToUser(creator.ID, realtime.EventNewSubscriber, gin.H{
+			"subscriptionId":     sub.ID,
+			"subscriberId":       user.ID,
+			"subscriberUserName": user.UserName,
+			"status":             sub.Status,
+		})
+		notifications.Notify(notifications.Event{
+			UserID:   creator.ID,
+			Type:     models.NotificationNewSubscriber,
+			GroupKey: "subscribers",
+			ActorID:  user.ID,
+		})
 	}
 
 	if session.Invoice != nil {
 		utils.LogError(nil, "PaymentIntent présent dans handleCheckoutSessionCompleted")
-		if session.PaymentStatus == "paid" {
-			err1 := upsertSubscriptionPayment(sub.ID, int(session.AmountTotal), session.Invoice.ID, models.SubscriptionPaymentSucceeded)
-			if err1 != nil {
-				utils.LogError(err1, "Erreur upsertSubscriptionPayment (paid) dans handleCheckoutSessionCompleted")
+		status := models.SubscriptionPaymentPending
+		if paid {
+			status = models.SubscriptionPaymentSucceeded
+			if err := ledger.RecordCharge(ledger.Charge{
+				CreatorID: creator.ID,
+				Reference: session.Invoice.ID,
+				Source:    models.LedgerSourceSubscription,
+				Amount:    int(session.AmountTotal),
+				At:        time.Now(),
+			}); err != nil {
+				utils.LogError(err, "Erreur lors de l'enregistrement du paiement au grand livre dans handleCheckoutSessionCompleted")
+				return "", eventFailure(http.StatusInternalServerError, "Error recording payment in ledger")
 			}
-		} else {
-			err2 := upsertSubscriptionPayment(sub.ID, int(session.AmountTotal), session.Invoice.ID, models.SubscriptionPaymentPending)
-			if err2 != nil {
-				utils.LogError(err2, "Erreur upsertSubscriptionPayment (pending) dans handleCheckoutSessionCompleted")
+		}
+		// La facture a pu arriver avant la session : le paiement est alors déjà enregistré
+		if err := upsertSubscriptionPayment(sub.ID, int(session.AmountTotal), session.Invoice.ID, status); err != nil && !errors.Is(err, errPaymentAlreadyRecorded) {
+			utils.LogError(err, "Erreur upsertSubscriptionPayment dans handleCheckoutSessionCompleted")
+			return "", eventFailure(http.StatusInternalServerError, "Error recording payment")
+		}
+		if sub.PromoCodeID != nil {
+			var discount int
+			if session.TotalDetails != nil {
+				discount = int(session.TotalDetails.AmountDiscount)
 			}
+			tagPromoPayment(session.Invoice.ID, *sub.PromoCodeID, discount)
 		}
 	} else {
 		utils.LogError(nil, "Pas d'invoice dans la session dans handleCheckoutSessionCompleted")
@@ -171,10 +297,10 @@ func handleCheckoutSessionCompleted(c *gin.Context, event stripe.Event) {
 
 	if initialStatus == models.SubscriptionActive {
 		utils.LogSuccess("Subscription created and activated dans handleCheckoutSessionCompleted")
-		c.JSON(http.StatusOK, gin.H{"message": "Subscription created and activated"})
+		return "Subscription created and activated", nil
 	} else {
 		utils.LogSuccess("Subscription created, waiting for payment dans handleCheckoutSessionCompleted")
-		c.JSON(http.StatusOK, gin.H{"message": "Subscription created, waiting for payment"})
+		return "Subscription created, waiting for payment", nil
 	}
 }
 
@@ -210,6 +336,8 @@ func findSubscriptionByStripeID(stripeSubID string) (*models.Subscription, error
 	return &sub, nil
 }
 
+var errPaymentAlreadyRecorded = errors.New("payment already recorded")
+
 func upsertSubscriptionPayment(subscriptionID string, amount int, invoiceID string, status models.SubscriptionPaymentStatus) error {
 	if invoiceID == "" {
 		return nil
@@ -217,13 +345,16 @@ func upsertSubscriptionPayment(subscriptionID string, amount int, invoiceID stri
 
 	var payment models.SubscriptionPayment
 	err := db.DB.First(&payment, "stripe_payment_intent_id = ?", invoiceID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
 
 	if err == nil {
 		// Le paiement existe déjà
 		if payment.Status == models.SubscriptionPaymentSucceeded && status == models.SubscriptionPaymentSucceeded {
 			// Éviter de mettre à jour un paiement déjà réussi
 			utils.LogError(err, "payment already recorded")
-			return fmt.Errorf("payment already recorded")
+			return errPaymentAlreadyRecorded
 		}
 
 		// Mettre à jour uniquement si le nouveau statut est différent
@@ -245,50 +376,63 @@ func upsertSubscriptionPayment(subscriptionID string, amount int, invoiceID stri
 		StripePaymentIntentId: invoiceID,
 		Status:                status,
 	}
-	err2 := db.DB.Create(&payment).Error
-	if err2 != nil {
-		utils.LogError(err2, "can't create subscriptionPayment")
+	if err := db.DB.Create(&payment).Error; err != nil {
+		utils.LogError(err, "can't create subscriptionPayment")
+		return err
 	}
 
 	utils.LogSuccess(string(payment.Status))
 	return nil
 }
 
-func updateSubscriptionStatus(sub *models.Subscription) {
-	newEnd := time.Now().AddDate(0, 1, 0)
+// paymentAlreadyRecorded indique si le paiement réussi d'une facture est déjà enregistré
+func paymentAlreadyRecorded(invoiceID string) (bool, error) {
+	var count int64
+	err := db.DB.Model(&models.SubscriptionPayment{}).
+		Where("stripe_payment_intent_id = ? AND status = ?", invoiceID, models.SubscriptionPaymentSucceeded).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// updateSubscriptionStatus active ou prolonge un abonnement jusqu'à la fin de la période payée,
+// un mois à partir de maintenant si la facture ne la donne pas
+func updateSubscriptionStatus(sub *models.Subscription, periodEnd time.Time) error {
+	newEnd := periodEnd
+	if newEnd.IsZero() {
+		newEnd = time.Now().AddDate(0, 1, 0)
+	}
 
 	if sub.Status == models.SubscriptionPending {
-		db.DB.Model(sub).Updates(map[string]interface{}{
+		return db.DB.Model(sub).Updates(map[string]interface{}{
 			"status":   models.SubscriptionActive,
 			"end_date": newEnd,
-		})
+		}).Error
 	} else if sub.Status == models.SubscriptionActive {
-		db.DB.Model(sub).Update("end_date", newEnd)
+		return db.DB.Model(sub).Update("end_date", newEnd).Error
 	}
+	return nil
 }
 
-func handlePaymentIntentCreated(c *gin.Context, event stripe.Event) {
+func handlePaymentIntentCreated(event stripe.Event) (string, error) {
 	var pi stripe.PaymentIntent
 	if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
 		utils.LogError(err, "Error parsing PaymentIntent created dans handlePaymentIntentCreated")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing PaymentIntent created"})
-		return
+		return "", eventFailure(http.StatusBadRequest, "Error parsing PaymentIntent created")
 	}
 
 	utils.LogSuccess("PaymentIntent created dans handlePaymentIntentCreated")
-	c.JSON(http.StatusOK, gin.H{"message": "PaymentIntent created - logged"})
+	return "PaymentIntent created - logged", nil
 }
 
-func handlePaymentIntentProcessing(c *gin.Context, event stripe.Event) {
+func handlePaymentIntentProcessing(event stripe.Event) (string, error) {
 	var pi stripe.PaymentIntent
 	if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
 		utils.LogError(err, "Error parsing PaymentIntent processing dans handlePaymentIntentProcessing")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing PaymentIntent processing"})
-		return
+		return "", eventFailure(http.StatusBadRequest, "Error parsing PaymentIntent processing")
 	}
 
 	utils.LogSuccess("PaymentIntent processing dans handlePaymentIntentProcessing")
-	c.JSON(http.StatusOK, gin.H{"message": "PaymentIntent processing - logged"})
+	return "PaymentIntent processing - logged", nil
 }
 
 // func handlePaymentIntentSucceeded(c *gin.Context, event stripe.Event) {
@@ -329,25 +473,28 @@ func handlePaymentIntentProcessing(c *gin.Context, event stripe.Event) {
 // 	c.JSON(http.StatusOK, gin.H{"message": "Subscription activated via payment_intent.succeeded"})
 // }
 
-func handlePaymentIntentFailed(c *gin.Context, event stripe.Event) {
+func handlePaymentIntentFailed(event stripe.Event) (string, error) {
 	var pi stripe.PaymentIntent
 	if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
 		utils.LogError(err, "Error parsing PaymentIntent failed dans handlePaymentIntentFailed")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing PaymentIntent failed"})
-		return
+		return "", eventFailure(http.StatusBadRequest, "Error parsing PaymentIntent failed")
 	}
 
 	if pi.Customer == nil || pi.ID == "" {
 		utils.LogError(nil, "PaymentIntent missing customer or ID dans handlePaymentIntentFailed")
-		c.JSON(http.StatusOK, gin.H{"message": "PaymentIntent missing customer or ID"})
-		return
+		return "PaymentIntent missing customer or ID", nil
+	}
+	if pi.Metadata["purpose"] == messageUnlockPurpose {
+		return "Unlock payment failed - logged", nil
+	}
+	if pi.Metadata["purpose"] == tipPurpose {
+		return "Tip payment failed - logged", nil
 	}
 
 	sub, err := findSubscriptionByCustomer(pi.Customer.ID, true)
 	if err != nil {
 		utils.LogError(err, "Subscription not found, will retry dans handlePaymentIntentFailed")
-		c.JSON(http.StatusOK, gin.H{"message": "Subscription not ready, will retry"})
-		return
+		return "", eventFailure(http.StatusConflict, "Subscription not ready, will retry")
 	}
 
 	_ = upsertSubscriptionPayment(sub.ID, int(pi.Amount), pi.ID, models.SubscriptionPaymentFailed)
@@ -359,28 +506,31 @@ func handlePaymentIntentFailed(c *gin.Context, event stripe.Event) {
 	}
 
 	utils.LogSuccess("Payment failed - subscription canceled if pending dans handlePaymentIntentFailed")
-	c.JSON(http.StatusOK, gin.H{"message": "Payment failed - subscription canceled if pending"})
+	return "Payment failed - subscription canceled if pending", nil
 }
 
-func handlePaymentIntentCanceled(c *gin.Context, event stripe.Event) {
+func handlePaymentIntentCanceled(event stripe.Event) (string, error) {
 	var pi stripe.PaymentIntent
 	if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
 		utils.LogError(err, "Error parsing PaymentIntent canceled dans handlePaymentIntentCanceled")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing PaymentIntent canceled"})
-		return
+		return "", eventFailure(http.StatusBadRequest, "Error parsing PaymentIntent canceled")
 	}
 
 	if pi.Customer == nil || pi.ID == "" {
 		utils.LogError(nil, "PaymentIntent missing customer or ID dans handlePaymentIntentCanceled")
-		c.JSON(http.StatusOK, gin.H{"message": "PaymentIntent missing customer or ID"})
-		return
+		return "PaymentIntent missing customer or ID", nil
+	}
+	if pi.Metadata["purpose"] == messageUnlockPurpose {
+		return "Unlock payment canceled - logged", nil
+	}
+	if pi.Metadata["purpose"] == tipPurpose {
+		return "Tip payment canceled - logged", nil
 	}
 
 	sub, err := findSubscriptionByCustomer(pi.Customer.ID, true)
 	if err != nil {
 		utils.LogError(err, "Subscription not found, will retry dans handlePaymentIntentCanceled")
-		c.JSON(http.StatusOK, gin.H{"message": "Subscription not ready, will retry"})
-		return
+		return "", eventFailure(http.StatusConflict, "Subscription not ready, will retry")
 	}
 
 	_ = upsertSubscriptionPayment(sub.ID, int(pi.Amount), pi.ID, models.SubscriptionPaymentCanceled)
@@ -392,15 +542,14 @@ func handlePaymentIntentCanceled(c *gin.Context, event stripe.Event) {
 	}
 
 	utils.LogSuccess("Payment canceled - subscription canceled if pending dans handlePaymentIntentCanceled")
-	c.JSON(http.StatusOK, gin.H{"message": "Payment canceled - subscription canceled if pending"})
+	return "Payment canceled - subscription canceled if pending", nil
 }
 
-func handleInvoicePaymentSucceeded(c *gin.Context, event stripe.Event) {
+func handleInvoicePaymentSucceeded(event stripe.Event) (string, error) {
 	var invoiceData map[string]interface{}
 	if err := json.Unmarshal(event.Data.Raw, &invoiceData); err != nil {
 		utils.LogError(err, "Error parsing Invoice dans handleInvoicePaymentSucceeded")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing Invoice"})
-		return
+		return "", eventFailure(http.StatusBadRequest, "Error parsing Invoice")
 	}
 
 	utils.LogSuccess("Received invoiceData dans handleInvoicePaymentSucceeded")
@@ -416,20 +565,13 @@ func handleInvoicePaymentSucceeded(c *gin.Context, event stripe.Event) {
 
 	if stripeSubID == "" {
 		utils.LogError(nil, "Impossible to retrieve subscription ID dans handleInvoicePaymentSucceeded")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
-		return
+		return "", eventFailure(http.StatusBadRequest, "Invalid subscription ID")
 	}
 
 	sub, err := findSubscriptionByStripeID(stripeSubID)
 	if err != nil {
 		utils.LogError(err, "Subscription not found, will retry dans handleInvoicePaymentSucceeded")
-		c.JSON(http.StatusOK, gin.H{"message": "Subscription not ready, will retry"})
-		return
-	}
-
-	var paymentIntentID string
-	if pi, ok := invoiceData["payment_intent"].(string); ok {
-		paymentIntentID = pi
+		return "", eventFailure(http.StatusConflict, "Subscription not ready, will retry")
 	}
 
 	var amount int
@@ -437,23 +579,81 @@ func handleInvoicePaymentSucceeded(c *gin.Context, event stripe.Event) {
 		amount = int(amountPaid)
 	} else {
 		utils.LogError(nil, "amount_paid missing or invalid dans handleInvoicePaymentSucceeded")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid amount"})
-		return
+		return "", eventFailure(http.StatusBadRequest, "Invalid amount")
+	}
+
+	// Le paiement est identifié par sa facture, comme dans la session Checkout :
+	// le PaymentIntent n'est plus un champ de la facture depuis la version basil de l'API
+	invoiceID, _ := invoiceData["id"].(string)
+	if invoiceID == "" {
+		utils.LogError(nil, "Invoice ID missing dans handleInvoicePaymentSucceeded")
+		return "", eventFailure(http.StatusBadRequest, "Invalid invoice ID")
 	}
 
-	if err := upsertSubscriptionPayment(sub.ID, amount, paymentIntentID, models.SubscriptionPaymentSucceeded); err != nil {
-		if err.Error() == "payment already recorded" {
+	// Enregistré avant le paiement local, qui s'arrête si la session Checkout l'a déjà créé
+	if err := ledger.RecordCharge(ledger.Charge{
+		CreatorID:       sub.ContentCreatorID,
+		Reference:       invoiceID,
+		PaymentIntentID: invoicePaymentIntentID(invoiceData),
+		Source:          models.LedgerSourceSubscription,
+		Amount:          amount,
+		At:              time.Now(),
+	}); err != nil {
+		utils.LogError(err, "Erreur lors de l'enregistrement du paiement au grand livre dans handleInvoicePaymentSucceeded")
+		return "", eventFailure(http.StatusInternalServerError, "Error recording payment in ledger")
+	}
+
+	// Facture déjà réglée (évènement rejoué, ou session Checkout traitée avant) : l'abonnement n'est pas touché
+	recorded, err := paymentAlreadyRecorded(invoiceID)
+	if err != nil {
+		utils.LogError(err, "Error checking payment dans handleInvoicePaymentSucceeded")
+		return "", eventFailure(http.StatusInternalServerError, "Error creating payment")
+	}
+	if recorded {
+		utils.LogError(nil, "Payment already recorded dans handleInvoicePaymentSucceeded")
+		return "Payment already recorded", nil
+	}
+
+	// Une facture de prorata (changement de niveau) ou de début d'essai ne change pas la période en cours.
+	// Sinon la fin de l'abonnement est celle de la période facturée, ce qui rend la mise à jour rejouable
+	reason, _ := invoiceData["billing_reason"].(string)
+	proration := reason == "subscription_update"
+	trialStart := reason == "subscription_create" && amount == 0
+	wasPending := sub.Status == models.SubscriptionPending
+	if !proration && !trialStart {
+		if err := updateSubscriptionStatus(sub, invoicePeriodEnd(invoiceData)); err != nil {
+			utils.LogError(err, "Error updating subscription dans handleInvoicePaymentSucceeded")
+			return "", eventFailure(http.StatusInternalServerError, "Error updating subscription")
+		}
+	}
+
+	if err := upsertSubscriptionPayment(sub.ID, amount, invoiceID, models.SubscriptionPaymentSucceeded); err != nil {
+		if errors.Is(err, errPaymentAlreadyRecorded) {
 			utils.LogError(err, "Payment already recorded dans handleInvoicePaymentSucceeded")
-			c.JSON(http.StatusOK, gin.H{"message": "Payment already recorded"})
-			return
+			return "Payment already recorded", nil
 		}
 		utils.LogError(err, "Error creating payment dans handleInvoicePaymentSucceeded")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating payment"})
-		return
+		return "", eventFailure(http.StatusInternalServerError, "Error creating payment")
+	}
+
+	// Réduction ou essai d'un code promo : le paiement est rattaché à la campagne
+	discount := invoiceDiscount(invoiceData)
+	if sub.PromoCodeID != nil && (discount > 0 || amount == 0) {
+		tagPromoPayment(invoiceID, *sub.PromoCodeID, discount)
+	}
+
+	if proration {
+		utils.LogSuccess("Proration paid for a tier change dans handleInvoicePaymentSucceeded")
+		return "Tier change proration recorded", nil
+	}
+
+	// Facture à 0 € du début d'un essai : l'accès court jusqu'à la fin de l'essai fixée à la souscription
+	if trialStart {
+		utils.LogSuccess("Trial started dans handleInvoicePaymentSucceeded")
+		return "Trial started", nil
 	}
 
 	utils.LogSuccess("Subscription activated via invoice.payment_succeeded dans handleInvoicePaymentSucceeded")
-	updateSubscriptionStatus(sub)
 
 	// Envoi du mail de confirmation pour tous les paiements réussis
 	var user models.User
@@ -463,25 +663,83 @@ func handleInvoicePaymentSucceeded(c *gin.Context, event stripe.Event) {
 	} else if err := db.DB.First(&creator, "id = ?", sub.ContentCreatorID).Error; err != nil {
 		utils.LogError(err, "Erreur lors de la récupération des infos du créateur dans handleInvoicePaymentSucceeded")
 	} else {
-		go mailsmodels.SubscriptionConfirmation(user.Email, creator.UserName)
+		go mailsmodels.SubscriptionConfirmation(user.Email, creator.UserName, sub.Price)
+	}
+
+	// Renouvellement mensuel : on prévient l'abonné sur son flux
+	if reason == "subscription_cycle" {
+		realtime.PublishToUser(sub.UserID, realtime.EventSubscriptionRenewed, gin.H{
+			"subscriptionId":   sub.ID,
+			"contentCreatorId": sub.ContentCreatorID,
+			"amount":           amount,
+		})
 	}
 
 	var message string
-	if sub.Status == models.SubscriptionPending {
+	if wasPending {
 		message = "Subscription activated via invoice.payment_succeeded"
 	} else {
 		message = "Subscription renewed via invoice.payment_succeeded"
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": message})
+	return message, nil
+}
+
+// invoiceDiscount renvoie le total des réductions appliquées à une facture
+func invoiceDiscount(invoiceData map[string]interface{}) int {
+	total := 0
+	discounts, _ := invoiceData["total_discount_amounts"].([]interface{})
+	for _, d := range discounts {
+		if discount, ok := d.(map[string]interface{}); ok {
+			if amount, ok := discount["amount"].(float64); ok {
+				total += int(amount)
+			}
+		}
+	}
+	return total
+}
+
+// invoicePeriodEnd renvoie la fin de la période facturée : la plus tardive des lignes de la facture
+func invoicePeriodEnd(invoiceData map[string]interface{}) time.Time {
+	var end int64
+	lines, _ := invoiceData["lines"].(map[string]interface{})
+	data, _ := lines["data"].([]interface{})
+	for _, l := range data {
+		line, _ := l.(map[string]interface{})
+		period, _ := line["period"].(map[string]interface{})
+		if lineEnd, ok := period["end"].(float64); ok && int64(lineEnd) > end {
+			end = int64(lineEnd)
+		}
+	}
+	if end == 0 {
+		return time.Time{}
+	}
+	return time.Unix(end, 0)
 }
 
-func handleInvoicePaymentFailed(c *gin.Context, event stripe.Event) {
+// invoicePaymentIntentID renvoie le PaymentIntent qui a réglé une facture : un champ de la facture
+// dans les anciennes versions de l'API, la liste des paiements depuis la version basil
+func invoicePaymentIntentID(invoiceData map[string]interface{}) string {
+	if pi, ok := invoiceData["payment_intent"].(string); ok && pi != "" {
+		return pi
+	}
+	payments, _ := invoiceData["payments"].(map[string]interface{})
+	data, _ := payments["data"].([]interface{})
+	for _, p := range data {
+		invoicePayment, _ := p.(map[string]interface{})
+		payment, _ := invoicePayment["payment"].(map[string]interface{})
+		if pi, ok := payment["payment_intent"].(string); ok && pi != "" {
+			return pi
+		}
+	}
+	return ""
+}
+
+func handleInvoicePaymentFailed(event stripe.Event) (string, error) {
 	var invoiceData map[string]interface{}
 	if err := json.Unmarshal(event.Data.Raw, &invoiceData); err != nil {
 		utils.LogError(err, "Error parsing Invoice failed dans handleInvoicePaymentFailed")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing Invoice"})
-		return
+		return "", eventFailure(http.StatusBadRequest, "Error parsing Invoice")
 	}
 
 	var stripeSubID string
@@ -493,8 +751,7 @@ func handleInvoicePaymentFailed(c *gin.Context, event stripe.Event) {
 
 	if stripeSubID == "" {
 		utils.LogError(nil, "Impossible to retrieve subscription ID for failed payment dans handleInvoicePaymentFailed")
-		c.JSON(http.StatusOK, gin.H{"message": "Invalid subscription ID - event ignored"})
-		return
+		return "Invalid subscription ID - event ignored", nil
 	}
 
 	var paymentIntentID string
@@ -504,10 +761,20 @@ func handleInvoicePaymentFailed(c *gin.Context, event stripe.Event) {
 
 	sub, err := findSubscriptionByStripeID(stripeSubID)
 	if err == nil {
-		_ = upsertSubscriptionPayment(sub.ID, 0, paymentIntentID, models.SubscriptionPaymentFailed)
+		invoiceID, _ := invoiceData["id"].(string)
+		_ = upsertSubscriptionPayment(sub.ID, 0, invoiceID, models.SubscriptionPaymentFailed)
+		realtime.PublishToUser(sub.UserID, realtime.EventSubscriptionFailed, gin.H{
+			"subscriptionId":   sub.ID,
+			"contentCreatorId": sub.ContentCreatorID,
+		})
+		notifications.Notify(notifications.Event{
+			UserID:  sub.UserID,
+			Type:    models.NotificationPaymentFailed,
+			ActorID: sub.ContentCreatorID,
+		})
 	}
 
 	utils.LogError(nil, "Failed payment for subscription: "+stripeSubID+", PaymentIntent: "+paymentIntentID)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Invoice payment failed - logged"})
+	return "Invoice payment failed - logged", nil
 }
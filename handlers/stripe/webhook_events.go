@@ -0,0 +1,260 @@
+package stripe
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	stripe "github.com/stripe/stripe-go/v82"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// Au-delà, un évènement en échec n'est plus rejoué automatiquement
+	maxEventAttempts = 10
+	// Un traitement plus long a été interrompu (arrêt de l'instance) : l'évènement est repris
+	stuckEventAfter = 10 * time.Minute
+	// Évènements rejoués à chaque passage du job
+	retryBatchSize = 50
+)
+
+// eventRetryDelay double le délai à chaque tentative, de 1 minute à 6 heures
+func eventRetryDelay(attempts int) time.Duration {
+	delay := time.Minute << min(max(attempts-1, 0), 9)
+	return min(delay, 6*time.Hour)
+}
+
+// storeEvent enregistre un évènement reçu, ou renvoie celui déjà enregistré pour une nouvelle livraison
+func storeEvent(event stripe.Event, payload []byte) (*models.StripeEvent, error) {
+	received := models.StripeEvent{
+		ID:      event.ID,
+		Type:    string(event.Type),
+		Account: event.Account,
+		Payload: string(payload),
+		Status:  models.StripeEventReceived,
+	}
+	if err := db.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&received).Error; err != nil {
+		return nil, err
+	}
+
+	var stored models.StripeEvent
+	if err := db.DB.First(&stored, "id = ?", event.ID).Error; err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// claimEvent réserve un évènement pour le traiter : une seule instance le traite à la fois.
+// force permet de rejouer un évènement déjà traité
+func claimEvent(id string, force bool, now time.Time) (bool, error) {
+	statuses := []models.StripeEventStatus{models.StripeEventReceived, models.StripeEventFailed}
+	if force {
+		statuses = append(statuses, models.StripeEventProcessed)
+	}
+
+	result := db.DB.Model(&models.StripeEvent{}).
+		Where("id = ? AND (status IN ? OR (status = ? AND updated_at < ?))",
+			id, statuses, models.StripeEventProcessing, now.Add(-stuckEventAfter)).
+		Updates(map[string]interface{}{
+			"status":   models.StripeEventProcessing,
+			"attempts": gorm.Expr("attempts + 1"),
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// eventError est l'échec du traitement d'un évènement, avec le code HTTP qui le décrit
+type eventError struct {
+	code    int
+	message string
+}
+
+func (e *eventError) Error() string {
+	return e.message
+}
+
+// eventFailure renvoie l'échec d'un gestionnaire d'évènement : l'évènement sera rejoué
+func eventFailure(code int, message string) error {
+	return &eventError{code: code, message: message}
+}
+
+// processEvent traite un évènement enregistré et met à jour son statut selon l'issue du gestionnaire
+func processEvent(stored *models.StripeEvent, force bool, now time.Time) error {
+	claimed, err := claimEvent(stored.ID, force, now)
+	if err != nil || !claimed {
+		return err
+	}
+	stored.Attempts++
+
+	var event stripe.Event
+	if err := json.Unmarshal([]byte(stored.Payload), &event); err != nil {
+		return finishEvent(stored, "", eventFailure(http.StatusBadRequest, "Error parsing event: "+err.Error()), now)
+	}
+
+	message, handlerErr := dispatchEvent(event)
+	return finishEvent(stored, message, handlerErr, now)
+}
+
+// finishEvent enregistre l'issue d'un traitement et programme la prochaine tentative en cas d'échec
+func finishEvent(stored *models.StripeEvent, message string, handlerErr error, now time.Time) error {
+	updates := map[string]interface{}{}
+	if handlerErr == nil {
+		stored.Status = models.StripeEventProcessed
+		stored.ProcessedAt = &now
+		stored.NextAttemptAt = nil
+		stored.LastError = ""
+		stored.Result = message
+		updates["processed_at"] = now
+	} else {
+		code := http.StatusInternalServerError
+		var failure *eventError
+		if errors.As(handlerErr, &failure) {
+			code = failure.code
+		}
+		stored.Status = models.StripeEventFailed
+		stored.LastError = fmt.Sprintf("%d: %s", code, handlerErr.Error())
+		stored.NextAttemptAt = nil
+		if stored.Attempts < maxEventAttempts {
+			next := now.Add(eventRetryDelay(stored.Attempts))
+			stored.NextAttemptAt = &next
+		}
+		utils.LogError(nil, "Stripe event "+stored.ID+" ("+stored.Type+") failed: "+stored.LastError)
+	}
+
+	updates["status"] = stored.Status
+	updates["last_error"] = stored.LastError
+	updates["result"] = stored.Result
+	updates["next_attempt_at"] = stored.NextAttemptAt
+	return db.DB.Model(&models.StripeEvent{}).Where("id = ?", stored.ID).Updates(updates).Error
+}
+
+// RetryWebhookEvents rejoue les évènements en échec dont la prochaine tentative est passée,
+// ainsi que ceux dont le traitement a été interrompu
+func RetryWebhookEvents(now time.Time) (int, error) {
+	var events []models.StripeEvent
+	if err := db.DB.
+		Where("(status = ? AND next_attempt_at <= ?) OR (status IN ? AND updated_at < ?)",
+			models.StripeEventFailed, now,
+			[]models.StripeEventStatus{models.StripeEventReceived, models.StripeEventProcessing}, now.Add(-stuckEventAfter)).
+		Order("created_at").Limit(retryBatchSize).Find(&events).Error; err != nil {
+		return 0, err
+	}
+
+	for i := range events {
+		if err := processEvent(&events[i], false, now); err != nil {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
+
+// GetWebhookEvents lists the received Stripe events (admin only)
+// @Summary List Stripe webhook events
+// @Description Return the Stripe events received by the webhook with their processing status, most recent first (admin only)
+// @Tags stripe
+// @Produce json
+// @Param status query string false "Filter by status (RECEIVED, PROCESSING, PROCESSED, FAILED)"
+// @Param type query string false "Filter by event type, e.g. invoice.payment_succeeded"
+// @Param limit query integer false "Number of events (default 50, max 200)"
+// @Security BearerAuth
+// @Success 200 {array} models.StripeEvent
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Access denied"
+// @Failure 500 {object} map[string]string "error: Error fetching events"
+// @Router /stripe/events [get]
+func GetWebhookEvents(c *gin.Context) {
+	limit := 50
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, 200)
+	}
+
+	query := db.DB.Omit("payload").Order("created_at DESC").Limit(limit)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if eventType := c.Query("type"); eventType != "" {
+		query = query.Where("type = ?", eventType)
+	}
+
+	events := []models.StripeEvent{}
+	if err := query.Find(&events).Error; err != nil {
+		utils.LogError(err, "Erreur lors de la récupération des évènements dans GetWebhookEvents")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// GetWebhookEvent returns a received Stripe event with its payload (admin only)
+// @Summary Get a Stripe webhook event
+// @Description Return a Stripe event received by the webhook, with its payload and processing status (admin only)
+// @Tags stripe
+// @Produce json
+// @Param id path string true "Stripe event ID"
+// @Security BearerAuth
+// @Success 200 {object} models.StripeEvent
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Access denied"
+// @Failure 404 {object} map[string]string "error: Event not found"
+// @Router /stripe/events/{id} [get]
+func GetWebhookEvent(c *gin.Context) {
+	var event models.StripeEvent
+	if err := db.DB.First(&event, "id = ?", c.Param("id")).Error; err != nil {
+		utils.LogError(err, "Event not found dans GetWebhookEvent")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
+// ReplayWebhookEvent processes a stored Stripe event again (admin only)
+// @Summary Replay a Stripe webhook event
+// @Description Process a stored Stripe event again, even if it already succeeded, and return its new status (admin only)
+// @Tags stripe
+// @Produce json
+// @Param id path string true "Stripe event ID"
+// @Security BearerAuth
+// @Success 200 {object} models.StripeEvent
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Access denied"
+// @Failure 404 {object} map[string]string "error: Event not found"
+// @Failure 409 {object} map[string]string "error: Event is being processed"
+// @Failure 500 {object} map[string]string "error: Error replaying the event"
+// @Router /stripe/events/{id}/replay [post]
+func ReplayWebhookEvent(c *gin.Context) {
+	var event models.StripeEvent
+	if err := db.DB.First(&event, "id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.LogError(err, "Event not found dans ReplayWebhookEvent")
+			c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+			return
+		}
+		utils.LogError(err, "Erreur lors de la récupération de l'évènement dans ReplayWebhookEvent")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error replaying the event"})
+		return
+	}
+
+	before := event.Attempts
+	if err := processEvent(&event, true, time.Now()); err != nil {
+		utils.LogError(err, "Erreur lors du rejeu de l'évènement dans ReplayWebhookEvent")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error replaying the event"})
+		return
+	}
+	if event.Attempts == before {
+		c.JSON(http.StatusConflict, gin.H{"error": "Event is being processed"})
+		return
+	}
+
+	utils.LogSuccess("Stripe event " + event.ID + " replayed dans ReplayWebhookEvent")
+	c.JSON(http.StatusOK, event)
+}
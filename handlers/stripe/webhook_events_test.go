@@ -0,0 +1,193 @@
+package stripe
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	stripe "github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/webhook"
+)
+
+func TestStripeWebhookHandler_SkipsAlreadyProcessedEvent(t *testing.T) {
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_test")
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	payload := []byte(`{"id": "evt_1", "object": "event", "type": "invoice.payment_succeeded", "api_version": "` + stripe.APIVersion + `", "data": {"object": {"id": "in_1"}}}`)
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{Payload: payload, Secret: "whsec_test"})
+
+	// Nouvelle livraison d'un évènement déjà traité : il n'est ni réenregistré ni retraité
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "stripe_events" .* ON CONFLICT DO NOTHING`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "stripe_events" WHERE id = \$1`).
+		WithArgs("evt_1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "status", "attempts"}).
+			AddRow("evt_1", "invoice.payment_succeeded", models.StripeEventProcessed, 1))
+
+	r := testutils.SetupTestRouter()
+	r.POST("/stripe/webhook", StripeWebhookHandler)
+	req, _ := http.NewRequest(http.MethodPost, "/stripe/webhook", bytes.NewReader(signed.Payload))
+	req.Header.Set("Stripe-Signature", signed.Header)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "Event already processed")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessEvent(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		eventType     string
+		object        string
+		attempts      int
+		status        models.StripeEventStatus
+		nextAttemptAt interface{}
+	}{
+		// Le gestionnaire répond 400 : nouvelle tentative une minute plus tard
+		{"failure is retried", "invoice.payment_succeeded", `{"id": "in_1", "amount_paid": 700}`, 0, models.StripeEventFailed, now.Add(time.Minute)},
+		{"last attempt failed", "invoice.payment_succeeded", `{"id": "in_1", "amount_paid": 700}`, maxEventAttempts - 1, models.StripeEventFailed, nil},
+		{"success", "customer.created", `{"id": "cus_1"}`, 0, models.StripeEventProcessed, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, mock, cleanup := testutils.SetupTestDB(t)
+			defer cleanup()
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`UPDATE "stripe_events" SET "attempts"=attempts \+ 1,"status"=\$1,"updated_at"=\$2 WHERE id = \$3 AND \(status IN \(\$4,\$5\) OR \(status = \$6 AND updated_at < \$7\)\)`).
+				WithArgs(models.StripeEventProcessing, sqlmock.AnyArg(), "evt_1", models.StripeEventReceived, models.StripeEventFailed, models.StripeEventProcessing, now.Add(-stuckEventAfter)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			mock.ExpectBegin()
+			if tt.status == models.StripeEventProcessed {
+				mock.ExpectExec(`UPDATE "stripe_events" SET "last_error"=\$1,"next_attempt_at"=\$2,"processed_at"=\$3,"result"=\$4,"status"=\$5,"updated_at"=\$6 WHERE id = \$7`).
+					WithArgs("", nil, now, "Event ignored", tt.status, sqlmock.AnyArg(), "evt_1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			} else {
+				mock.ExpectExec(`UPDATE "stripe_events" SET "last_error"=\$1,"next_attempt_at"=\$2,"result"=\$3,"status"=\$4,"updated_at"=\$5 WHERE id = \$6`).
+					WithArgs("400: Invalid subscription ID", tt.nextAttemptAt, "", tt.status, sqlmock.AnyArg(), "evt_1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectCommit()
+
+			stored := &models.StripeEvent{
+				ID:       "evt_1",
+				Type:     tt.eventType,
+				Payload:  `{"id": "evt_1", "object": "event", "type": "` + tt.eventType + `", "data": {"object": ` + tt.object + `}}`,
+				Status:   models.StripeEventFailed,
+				Attempts: tt.attempts,
+			}
+			err := processEvent(stored, false, now)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, stored.Status)
+			assert.Equal(t, tt.attempts+1, stored.Attempts)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestProcessEvent_LedgerFailureIsRetried(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "stripe_events" SET "attempts"=attempts \+ 1`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "subscriptions" WHERE stripe_subscription_id = \$1`).
+		WithArgs("sub_1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content_creator_id", "status"}).
+			AddRow("subscription-uuid", "user-uuid", "creator-uuid", models.SubscriptionActive))
+	mock.ExpectQuery(`SELECT \* FROM "ledger_transactions" WHERE kind = \$1 AND reference = \$2`).
+		WillReturnError(sql.ErrConnDone)
+	// Le paiement n'est pas enregistré : l'évènement rejoué refera tout le traitement
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "stripe_events" SET "last_error"=\$1,"next_attempt_at"=\$2,"result"=\$3,"status"=\$4,"updated_at"=\$5 WHERE id = \$6`).
+		WithArgs("500: Error recording payment in ledger", now.Add(time.Minute), "", models.StripeEventFailed, sqlmock.AnyArg(), "evt_1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	object := `{"id": "in_1", "amount_paid": 700, "billing_reason": "subscription_cycle", "parent": {"subscription_details": {"subscription": "sub_1"}}}`
+	stored := &models.StripeEvent{
+		ID:      "evt_1",
+		Type:    "invoice.payment_succeeded",
+		Payload: `{"id": "evt_1", "object": "event", "type": "invoice.payment_succeeded", "data": {"object": ` + object + `}}`,
+		Status:  models.StripeEventReceived,
+	}
+	err := processEvent(stored, false, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.StripeEventFailed, stored.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleInvoicePaymentSucceeded_ReplayedInvoiceKeepsPeriod(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	periodEnd := time.Unix(1782864000, 0)
+	expectInvoice := func(recorded int) {
+		mock.ExpectQuery(`SELECT \* FROM "subscriptions" WHERE stripe_subscription_id = \$1`).
+			WithArgs("sub_1", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content_creator_id", "status"}).
+				AddRow("subscription-uuid", "user-uuid", "creator-uuid", models.SubscriptionActive))
+		mock.ExpectQuery(`SELECT \* FROM "ledger_transactions" WHERE kind = \$1 AND reference = \$2`).
+			WithArgs(models.LedgerCharge, "in_1", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "payment_intent_id"}).AddRow("charge-uuid", "pi_1"))
+		mock.ExpectQuery(`SELECT count\(\*\) FROM "subscription_payments" WHERE stripe_payment_intent_id = \$1 AND status = \$2`).
+			WithArgs("in_1", models.SubscriptionPaymentSucceeded).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(recorded))
+	}
+
+	// Premier passage : l'abonnement court jusqu'à la fin de la période facturée et le paiement est enregistré
+	expectInvoice(0)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "subscriptions" SET "end_date"=\$1,"updated_at"=\$2 WHERE "id" = \$3`).
+		WithArgs(periodEnd, sqlmock.AnyArg(), "subscription-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "subscription_payments" WHERE stripe_payment_intent_id = \$1`).
+		WithArgs("in_1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "subscription_payments"`).
+		WithArgs("subscription-uuid", 700, sqlmock.AnyArg(), "in_1", models.SubscriptionPaymentSucceeded, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("payment-uuid"))
+	mock.ExpectCommit()
+
+	// Second passage : la facture est reconnue avant de toucher à l'abonnement
+	expectInvoice(1)
+
+	event := stripe.Event{
+		Type: "invoice.payment_succeeded",
+		Data: &stripe.EventData{Raw: []byte(`{"id": "in_1", "amount_paid": 700, "billing_reason": "subscription_cycle",
+			"lines": {"data": [{"period": {"start": 1780272000, "end": 1782864000}}]},
+			"parent": {"subscription_details": {"subscription": "sub_1"}}}`)},
+	}
+	message, err := dispatchEvent(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "Subscription renewed via invoice.payment_succeeded", message)
+
+	message, err = dispatchEvent(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "Payment already recorded", message)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"pec2-backend/db"
 	"pec2-backend/models"
+	"pec2-backend/services/access"
 	"pec2-backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -14,6 +15,11 @@ type UpdateSettingsRequest struct {
 	CommentEnabled *bool `json:"commentEnabled"`
 	MessageEnabled *bool `json:"messageEnabled"`
 	SubscriptionEnabled *bool `json:"subscriptionEnabled"`
+	// Réservé aux créateurs : qui peut leur écrire sans passer par les demandes de messages
+	DirectMessages *models.DirectMessages `json:"directMessages" binding:"omitempty,oneof=everyone subscribers following"`
+	// Profil privé : les nouveaux follows doivent être acceptés
+	PrivateProfile *bool `json:"privateProfile"`
+	Notifications *models.NotificationSettingsUpdate `json:"notifications"`
 }
 
 // Structure pour uniformiser la réponse
@@ -21,10 +27,13 @@ type UserSettingsResponse struct {
 	CommentEnabled bool `json:"commentEnabled"`
 	MessageEnabled bool `json:"messageEnabled"`
 	SubscriptionEnabled bool `json:"subscriptionEnabled"`
+	DirectMessages models.DirectMessages `json:"directMessages"`
+	PrivateProfile bool `json:"privateProfile"`
+	Notifications models.NotificationSettings `json:"notifications"`
 }
 
 // @Summary Get user settings
-// @Description Retrieves the settings for the authenticated user
+// @Description Retrieves the settings for the authenticated user, including the notification preferences per type
 // @Tags user-settings
 // @Accept json
 // @Produce json
@@ -57,13 +66,16 @@ func GetUserSettings(c *gin.Context) {
 		CommentEnabled: user.CommentsEnable,
 		MessageEnabled: user.MessageEnable,
 		SubscriptionEnabled: user.SubscriptionEnable,
+		DirectMessages: user.DirectMessages,
+		PrivateProfile: user.PrivateProfile,
+		Notifications: user.NotificationSettings,
 	}
 
 	c.JSON(http.StatusOK, settings)
 }
 
 // @Summary Update user settings
-// @Description Updates the settings for the authenticated user
+// @Description Updates the settings for the authenticated user. Notification preferences can be updated partially through the notifications object. Making a private profile public approves its pending follow requests
 // @Tags user-settings
 // @Accept json
 // @Produce json
@@ -72,6 +84,7 @@ func GetUserSettings(c *gin.Context) {
 // @Success 200 {object} UserSettingsResponse
 // @Failure 400 {object} map[string]string "error: Bad request"
 // @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Only content creators can set directMessages"
 // @Failure 500 {object} map[string]string "error: error message"
 // @Router /user-settings [put]
 func UpdateUserSettings(c *gin.Context) {
@@ -110,6 +123,21 @@ func UpdateUserSettings(c *gin.Context) {
 	if request.SubscriptionEnabled != nil {
 		user.SubscriptionEnable = *request.SubscriptionEnabled
 	}
+	if request.DirectMessages != nil {
+		if user.Role != models.ContentCreator {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Seuls les créateurs de contenu peuvent choisir qui peut leur écrire directement"})
+			return
+		}
+		user.DirectMessages = *request.DirectMessages
+	}
+
+	wasPrivate := user.PrivateProfile
+	if request.PrivateProfile != nil {
+		user.PrivateProfile = *request.PrivateProfile
+	}
+	if request.Notifications != nil {
+		request.Notifications.Apply(&user.NotificationSettings)
+	}
 
 	// Enregistrer les modifications
 	if err := db.DB.Save(&user).Error; err != nil {
@@ -118,11 +146,23 @@ func UpdateUserSettings(c *gin.Context) {
 		return
 	}
 
+	// Un profil qui repasse en public accepte les demandes de follow en attente
+	if wasPrivate && !user.PrivateProfile {
+		if err := access.ApproveAllFollowRequests(user.ID); err != nil {
+			utils.LogError(err, "Erreur lors de l'acceptation des demandes de follow")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la sauvegarde des paramètres"})
+			return
+		}
+	}
+
 	// Préparer la réponse
 	response := UserSettingsResponse{
 		CommentEnabled:      user.CommentsEnable,
 		MessageEnabled:      user.MessageEnable,
 		SubscriptionEnabled: user.SubscriptionEnable,
+		DirectMessages:      user.DirectMessages,
+		PrivateProfile:      user.PrivateProfile,
+		Notifications:       user.NotificationSettings,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -0,0 +1,132 @@
+package users
+
+import (
+	"net/http"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/access"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Block a user
+// @Description Block a user: they can no longer message you, comment on your posts, follow you, subscribe to you or see your posts. Existing follows between the two users are removed
+// @Tags users
+// @Produce json
+// @Param id path string true "ID of the user to block"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message: User blocked successfully"
+// @Failure 400 {object} map[string]string "error: You cannot block yourself"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 500 {object} map[string]string "error: Server error"
+// @Router /users/{id}/block [post]
+func BlockUser(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated in BlockUser")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	blockedID := c.Param("id")
+	if blockedID == userID {
+		utils.LogError(nil, "Self block in BlockUser")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot block yourself"})
+		return
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, "id = ?", blockedID).Error; err != nil {
+		utils.LogError(err, "User to block not found in BlockUser")
+		c.JSON(http.StatusNotFound, gin.H{"error": "User to block not found"})
+		return
+	}
+
+	if err := access.Block(userID.(string), blockedID); err != nil {
+		utils.LogError(err, "Error blocking user in BlockUser")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error when blocking the user"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "User blocked successfully in BlockUser")
+	c.JSON(http.StatusOK, gin.H{"message": "User blocked successfully"})
+}
+
+// @Summary Unblock a user
+// @Description Remove a user from the authenticated user's block list. Follows removed by the block are not restored
+// @Tags users
+// @Produce json
+// @Param id path string true "ID of the user to unblock"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message: User unblocked successfully"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: User is not blocked"
+// @Failure 500 {object} map[string]string "error: Server error"
+// @Router /users/{id}/block [delete]
+func UnblockUser(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated in UnblockUser")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	result := db.DB.Where("blocker_id = ? AND blocked_id = ?", userID, c.Param("id")).Delete(&models.UserBlock{})
+	if result.Error != nil {
+		utils.LogError(result.Error, "Error unblocking user in UnblockUser")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error when unblocking the user"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.LogError(nil, "User is not blocked in UnblockUser")
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not blocked"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "User unblocked successfully in UnblockUser")
+	c.JSON(http.StatusOK, gin.H{"message": "User unblocked successfully"})
+}
+
+// @Summary List of blocked users
+// @Description List the users blocked by the authenticated user, most recently blocked first
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.UserInfo "List of blocked users"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 500 {object} map[string]string "error: Server error"
+// @Router /users/blocked [get]
+func GetBlockedUsers(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated in GetBlockedUsers")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var blockedUsers []models.User
+	if err := db.DB.Select("users.*").Joins("JOIN user_blocks ON user_blocks.blocked_id = users.id").
+		Where("user_blocks.blocker_id = ?", userID).
+		Order("user_blocks.created_at DESC").
+		Find(&blockedUsers).Error; err != nil {
+		utils.LogError(err, "Error fetching blocked users in GetBlockedUsers")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching blocked users"})
+		return
+	}
+
+	users := make([]models.UserInfo, 0, len(blockedUsers))
+	for _, user := range blockedUsers {
+		users = append(users, models.UserInfo{
+			ID:                     user.ID,
+			UserName:               user.UserName,
+			ProfilePicture:         user.ProfilePicture,
+			ProfilePictureVariants: user.ProfilePictureVariants,
+		})
+	}
+
+	utils.LogSuccessWithUser(userID, "Blocked users retrieved in GetBlockedUsers")
+	c.JSON(http.StatusOK, users)
+}
@@ -0,0 +1,263 @@
+package users
+
+import (
+	"errors"
+	"net/http"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/access"
+	"pec2-backend/services/notifications"
+	"pec2-backend/services/realtime"
+	"pec2-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// sendFollowRequest crée une demande de follow vers un profil privé
+func sendFollowRequest(c *gin.Context, followerID string, followedID string) {
+	var count int64
+	if err := db.DB.Model(&models.FollowRequest{}).
+		Where("follower_id = ? AND followed_id = ?", followerID, followedID).
+		Count(&count).Error; err != nil {
+		utils.LogError(err, "Error checking follow requests in FollowUser")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error when checking the follow"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already sent a follow request to this user"})
+		return
+	}
+
+	request := models.FollowRequest{FollowerID: followerID, FollowedID: followedID}
+	if err := db.DB.Create(&request).Error; err != nil {
+		utils.LogError(err, "Error creating follow request in FollowUser")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error when following the user"})
+		return
+	}
+
+	realtime.PublishToUser(followedID, realtime.EventFollowRequest, gin.H{"requestId": request.ID, "followerId": followerID})
+	notifications.Notify(notifications.Event{
+		UserID:   followedID,
+		Type:     models.NotificationFollowRequest,
+		GroupKey: "follow_requests",
+		ActorID:  followerID,
+	})
+
+	utils.LogSuccessWithUser(followerID, "Follow request sent in FollowUser")
+	c.JSON(http.StatusAccepted, gin.H{"message": "Follow request sent"})
+}
+
+// canSeeFollows vérifie que l'utilisateur connecté peut voir les follows de userSearch (profil privé)
+func canSeeFollows(c *gin.Context, userID any, userSearch string) bool {
+	viewerID, _ := userID.(string)
+	if userSearch == viewerID {
+		return true
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, "id = ?", userSearch).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return false
+		}
+		utils.LogError(err, "Error retrieving user to check profile privacy")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving user"})
+		return false
+	}
+
+	role, _ := c.Get("role")
+	roleStr, _ := role.(string)
+	canSee, err := access.CanSeeProfile(viewerID, roleStr, user)
+	if err != nil {
+		utils.LogError(err, "Error checking profile privacy")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving user"})
+		return false
+	}
+	if !canSee {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This profile is private"})
+		return false
+	}
+	return true
+}
+
+// loadFollowRequest récupère une demande de follow reçue par l'utilisateur connecté
+func loadFollowRequest(c *gin.Context, handlerName string) (models.FollowRequest, any, bool) {
+	var request models.FollowRequest
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated in "+handlerName)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return request, nil, false
+	}
+
+	if err := db.DB.Where("id = ? AND followed_id = ?", c.Param("id"), userID).First(&request).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.LogError(err, "Follow request not found in "+handlerName)
+			c.JSON(http.StatusNotFound, gin.H{"error": "Follow request not found"})
+			return request, nil, false
+		}
+		utils.LogError(err, "Error retrieving follow request in "+handlerName)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving follow request"})
+		return request, nil, false
+	}
+	return request, userID, true
+}
+
+// @Summary List of follow requests
+// @Description List the pending follow requests received by the authenticated user, most recent first
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.FollowRequestResponse "List of follow requests"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 500 {object} map[string]string "error: Server error"
+// @Router /users/follow-requests [get]
+func GetFollowRequests(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated in GetFollowRequests")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var requests []models.FollowRequest
+	if err := db.DB.Where("followed_id = ?", userID).Order("created_at DESC").Find(&requests).Error; err != nil {
+		utils.LogError(err, "Error fetching follow requests in GetFollowRequests")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching follow requests"})
+		return
+	}
+
+	followers := map[string]models.User{}
+	if len(requests) > 0 {
+		followerIDs := make([]string, 0, len(requests))
+		for _, request := range requests {
+			followerIDs = append(followerIDs, request.FollowerID)
+		}
+
+		var users []models.User
+		if err := db.DB.Where("id IN ?", followerIDs).Find(&users).Error; err != nil {
+			utils.LogError(err, "Error fetching followers in GetFollowRequests")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching follow requests"})
+			return
+		}
+		for _, user := range users {
+			followers[user.ID] = user
+		}
+	}
+
+	response := make([]models.FollowRequestResponse, 0, len(requests))
+	for _, request := range requests {
+		follower := followers[request.FollowerID]
+		response = append(response, models.FollowRequestResponse{
+			ID: request.ID,
+			Follower: models.UserInfo{
+				ID:                     request.FollowerID,
+				UserName:               follower.UserName,
+				ProfilePicture:         follower.ProfilePicture,
+				ProfilePictureVariants: follower.ProfilePictureVariants,
+			},
+			CreatedAt: request.CreatedAt,
+		})
+	}
+
+	utils.LogSuccessWithUser(userID, "Follow requests retrieved in GetFollowRequests")
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary Approve a follow request
+// @Description Approve a pending follow request: the requester becomes a follower
+// @Tags users
+// @Produce json
+// @Param id path string true "ID of the follow request"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message: Follow request approved"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Follow request not found"
+// @Failure 500 {object} map[string]string "error: Server error"
+// @Router /users/follow-requests/{id}/approve [post]
+func ApproveFollowRequest(c *gin.Context) {
+	request, userID, ok := loadFollowRequest(c, "ApproveFollowRequest")
+	if !ok {
+		return
+	}
+
+	if err := access.ApproveFollowRequest(request); err != nil {
+		utils.LogError(err, "Error approving follow request in ApproveFollowRequest")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error when approving the follow request"})
+		return
+	}
+
+	notifications.Notify(notifications.Event{
+		UserID:   request.FollowerID,
+		Type:     models.NotificationFollowAccepted,
+		GroupKey: "follow_accepted",
+		ActorID:  request.FollowedID,
+	})
+
+	utils.LogSuccessWithUser(userID, "Follow request approved in ApproveFollowRequest")
+	c.JSON(http.StatusOK, gin.H{"message": "Follow request approved"})
+}
+
+// @Summary Reject a follow request
+// @Description Reject a pending follow request. The requester is not notified and can ask again
+// @Tags users
+// @Produce json
+// @Param id path string true "ID of the follow request"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message: Follow request rejected"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Follow request not found"
+// @Failure 500 {object} map[string]string "error: Server error"
+// @Router /users/follow-requests/{id}/reject [post]
+func RejectFollowRequest(c *gin.Context) {
+	request, userID, ok := loadFollowRequest(c, "RejectFollowRequest")
+	if !ok {
+		return
+	}
+
+	if err := db.DB.Delete(&request).Error; err != nil {
+		utils.LogError(err, "Error rejecting follow request in RejectFollowRequest")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error when rejecting the follow request"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Follow request rejected in RejectFollowRequest")
+	c.JSON(http.StatusOK, gin.H{"message": "Follow request rejected"})
+}
+
+// @Summary Cancel a follow request
+// @Description Cancel the follow request the authenticated user sent to a private profile
+// @Tags users
+// @Produce json
+// @Param id path string true "ID of the user the request was sent to"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "message: Follow request canceled"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 404 {object} map[string]string "error: Follow request not found"
+// @Failure 500 {object} map[string]string "error: Server error"
+// @Router /users/{id}/follow-request [delete]
+func CancelFollowRequest(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.LogError(nil, "User not authenticated in CancelFollowRequest")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	result := db.DB.Where("follower_id = ? AND followed_id = ?", userID, c.Param("id")).Delete(&models.FollowRequest{})
+	if result.Error != nil {
+		utils.LogError(result.Error, "Error canceling follow request in CancelFollowRequest")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error when canceling the follow request"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.LogError(nil, "Follow request not found in CancelFollowRequest")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Follow request not found"})
+		return
+	}
+
+	utils.LogSuccessWithUser(userID, "Follow request canceled in CancelFollowRequest")
+	c.JSON(http.StatusOK, gin.H{"message": "Follow request canceled"})
+}
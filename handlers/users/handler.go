@@ -6,6 +6,9 @@ import (
 	"net/http"
 	"pec2-backend/db"
 	"pec2-backend/models"
+	"pec2-backend/services/access"
+	"pec2-backend/services/notifications"
+	"pec2-backend/services/realtime"
 	"pec2-backend/utils"
 	mailsmodels "pec2-backend/utils/mails-models"
 	"time"
@@ -229,19 +232,19 @@ func UpdateUserProfile(c *gin.Context) {
 	file, err := c.FormFile("profilePicture")
 	if err == nil && file != nil {
 		oldImageURL := user.ProfilePicture
+		oldVariants := user.ProfilePictureVariants
 
-		imageURL, err := utils.UploadImage(file, "profile_pictures", "profile")
+		variants, err := utils.UploadPicture(file, "profile_pictures", "profile")
 		if err != nil {
 			utils.LogError(err, "Error when uploading profile picture in UpdateUserProfile")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error uploading profile picture: " + err.Error()})
 			return
 		}
 
-		user.ProfilePicture = imageURL
+		user.ProfilePicture = variants.Full
+		user.ProfilePictureVariants = variants
 
-		if oldImageURL != "" {
-			_ = utils.DeleteImage(oldImageURL)
-		}
+		utils.DeletePicture(oldImageURL, oldVariants)
 	}
 
 	if result := db.DB.Save(&user); result.Error != nil {
@@ -296,7 +299,7 @@ func GetUserProfile(c *gin.Context) {
 // @Produce json
 // @Security BearerAuth
 // @Param        username   path      string  true  "search userName"
-// @Success      200  {object}  map[string]interface{}  "User is found"
+// @Success      200  {object}  map[string]interface{}  "User is found. A private profile the viewer cannot see only returns its identity with isPrivate set"
 // @Failure      400  {object}  map[string]string  "error: Invalid request data"
 // @Failure      401  {object}  map[string]string  "error: Unauthorized"
 // @Failure      404  {object}  map[string]string  "error: User not found"
@@ -330,6 +333,61 @@ func GetUserByUsername(c *gin.Context) {
 		userID = "0"
 	}
 
+	// Un utilisateur qui nous a bloqués n'existe plus pour nous ; à l'inverse on garde l'accès au profil pour pouvoir le débloquer
+	viewerID, _ := userID.(string)
+	blockedByUser, err := access.HasBlocked(searchUser.ID, viewerID)
+	if err != nil {
+		utils.LogError(err, "Error checking blocks in GetUserByUsername")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving user"})
+		return
+	}
+	if blockedByUser {
+		utils.LogError(nil, "Profile hidden by a block in GetUserByUsername")
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	blockedByMe, err := access.HasBlocked(viewerID, searchUser.ID)
+	if err != nil {
+		utils.LogError(err, "Error checking blocks in GetUserByUsername")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving user"})
+		return
+	}
+
+	// Un profil privé ne montre que son identité à ceux qui ne le suivent pas
+	role, _ := c.Get("role")
+	roleStr, _ := role.(string)
+	canSee, err := access.CanSeeProfile(viewerID, roleStr, searchUser)
+	if err != nil {
+		utils.LogError(err, "Error checking profile privacy in GetUserByUsername")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving user"})
+		return
+	}
+	if !canSee {
+		var requests int64
+		if err := db.DB.Model(&models.FollowRequest{}).
+			Where("follower_id = ? AND followed_id = ?", viewerID, searchUser.ID).
+			Count(&requests).Error; err != nil {
+			utils.LogError(err, "Error checking follow requests in GetUserByUsername")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving user"})
+			return
+		}
+
+		utils.LogSuccessWithUser(userID, "Private profile retrieved by username in GetUserByUsername")
+		c.JSON(http.StatusOK, gin.H{
+			"user": models.UserInfo{
+				ID:                     searchUser.ID,
+				UserName:               searchUser.UserName,
+				ProfilePicture:         searchUser.ProfilePicture,
+				ProfilePictureVariants: searchUser.ProfilePictureVariants,
+			},
+			"isPrivate":         true,
+			"followRequested":   requests > 0,
+			"isBlocked":         blockedByMe,
+			"subscriptionPrice": searchUser.SubscriptionPrice,
+		})
+		return
+	}
+
 	var subs []models.Subscription
 	today := time.Now()
 
@@ -373,6 +431,8 @@ func GetUserByUsername(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"user":                     searchUser,
 		"isSubscriberToSearchUser": isSubscriber,
+		"isBlocked":                blockedByMe,
+		"isPrivate":                false,
 		"canceledSubscription": func() *bool {
 			if lastSubscription == nil {
 				return nil
@@ -680,17 +740,19 @@ func ConfirmPasswordReset(c *gin.Context) {
 }
 
 // @Summary Follow a user
-// @Description Allows an authenticated user to follow another user
+// @Description Allows an authenticated user to follow another user. Following a private profile sends a follow request instead
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param id path string true "ID of the user to follow"
 // @Security BearerAuth
 // @Success 200 {object} map[string]string "message: Follow successful"
+// @Success 202 {object} map[string]string "message: Follow request sent"
 // @Failure 400 {object} map[string]string "error: Bad request"
 // @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: You cannot follow this user"
 // @Failure 404 {object} map[string]string "error: User not found"
-// @Failure 409 {object} map[string]string "error: Already followed"
+// @Failure 409 {object} map[string]string "error: Already followed or follow request already sent"
 // @Failure 500 {object} map[string]string "error: Server error"
 // @Router /users/{id}/follow [post]
 func FollowUser(c *gin.Context) {
@@ -716,8 +778,18 @@ func FollowUser(c *gin.Context) {
 		return
 	}
 
+	blocked, err := access.IsBlocked(followerID.(string), followedID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error when checking the follow"})
+		return
+	}
+	if blocked {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot follow this user"})
+		return
+	}
+
 	var existingFollow models.UserFollow
-	err := db.DB.Where("follower_id = ? AND followed_id = ?", followerID, followedID).First(&existingFollow).Error
+	err = db.DB.Where("follower_id = ? AND followed_id = ?", followerID, followedID).First(&existingFollow).Error
 	if err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "You already follow this user"})
 		return
@@ -727,6 +799,12 @@ func FollowUser(c *gin.Context) {
 		return
 	}
 
+	// Un profil privé doit accepter la demande avant que le follow ne soit créé
+	if user.PrivateProfile {
+		sendFollowRequest(c, followerID.(string), followedID)
+		return
+	}
+
 	follow := models.UserFollow{
 		FollowerID: followerID.(string),
 		FollowedID: followedID,
@@ -736,6 +814,14 @@ func FollowUser(c *gin.Context) {
 		return
 	}
 
+	realtime.PublishToUser(followedID, realtime.EventNewFollower, gin.H{"followerId": follow.FollowerID})
+	notifications.Notify(notifications.Event{
+		UserID:   followedID,
+		Type:     models.NotificationNewFollower,
+		GroupKey: "followers",
+		ActorID:  follow.FollowerID,
+	})
+
 	c.JSON(http.StatusOK, gin.H{"message": "User followed successfully"})
 }
 
@@ -797,6 +883,8 @@ func UnfollowUser(c *gin.Context) {
 // @Param userSearch query string  false  "id of user search (not required)"
 // @Success 200 {array} models.User "List of users followed"
 // @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: This profile is private"
+// @Failure 404 {object} map[string]string "error: User not found"
 // @Failure 500 {object} map[string]string "error: Server error"
 // @Router /users/followings [get]
 func GetMyFollowings(c *gin.Context) {
@@ -816,6 +904,10 @@ func GetMyFollowings(c *gin.Context) {
 		userSearch = userSearchStr
 	}
 
+	if !canSeeFollows(c, userId, userSearch) {
+		return
+	}
+
 	var follows []models.UserFollow
 	if err := db.DB.Where("follower_id = ?", userSearch).Find(&follows).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching followings"})
@@ -843,6 +935,8 @@ func GetMyFollowings(c *gin.Context) {
 // @Success 200 {array} models.User "List of followers"
 // @Param userSearch query string  false  "id of user search (not required)"
 // @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: This profile is private"
+// @Failure 404 {object} map[string]string "error: User not found"
 // @Failure 500 {object} map[string]string "error: Server error"
 // @Router /users/followers [get]
 func GetMyFollowers(c *gin.Context) {
@@ -862,6 +956,10 @@ func GetMyFollowers(c *gin.Context) {
 		userSearch = userSearchStr
 	}
 
+	if !canSeeFollows(c, userId, userSearch) {
+		return
+	}
+
 	var follows []models.UserFollow
 	if err := db.DB.Where("followed_id = ?", userSearch).Find(&follows).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching followers"})
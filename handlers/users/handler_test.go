@@ -13,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
@@ -196,3 +197,174 @@ func TestUpdatePassword_SamePassword(t *testing.T) {
 	json.Unmarshal(resp.Body.Bytes(), &respBody)
 	assert.Equal(t, "The new password must be different from the old password", respBody["error"])
 }
+
+func TestBlockUser_RemovesFollows(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).
+		WithArgs("blocked-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow("blocked-uuid"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "user_blocks" .* ON CONFLICT DO NOTHING RETURNING "id"`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow("block-uuid"))
+	mock.ExpectExec(`DELETE FROM "user_follows" WHERE \(follower_id = \$1 AND followed_id = \$2\) OR \(follower_id = \$3 AND followed_id = \$4\)`).
+		WithArgs("user-uuid", "blocked-uuid", "blocked-uuid", "user-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM "follow_requests" WHERE \(follower_id = \$1 AND followed_id = \$2\) OR \(follower_id = \$3 AND followed_id = \$4\)`).
+		WithArgs("user-uuid", "blocked-uuid", "blocked-uuid", "user-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	r := testutils.SetupTestRouter()
+	r.POST("/users/:id/block", func(c *gin.Context) {
+		c.Set("user_id", "user-uuid")
+		BlockUser(c)
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/users/blocked-uuid/block", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFollowUser_Blocked(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).
+		WithArgs("creator-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow("creator-uuid"))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks"`).
+		WithArgs("user-uuid", "creator-uuid", "creator-uuid", "user-uuid").
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+
+	r := testutils.SetupTestRouter()
+	r.POST("/users/:id/follow", func(c *gin.Context) {
+		c.Set("user_id", "user-uuid")
+		FollowUser(c)
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/users/creator-uuid/follow", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnblockUser_NotBlocked(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "user_blocks" WHERE blocker_id = \$1 AND blocked_id = \$2`).
+		WithArgs("user-uuid", "other-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	r := testutils.SetupTestRouter()
+	r.DELETE("/users/:id/block", func(c *gin.Context) {
+		c.Set("user_id", "user-uuid")
+		UnblockUser(c)
+	})
+
+	req, _ := http.NewRequest(http.MethodDelete, "/users/other-uuid/block", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFollowUser_PrivateProfileSendsRequest(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).
+		WithArgs("private-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "private_profile"}).AddRow("private-uuid", true))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks"`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`SELECT \* FROM "user_follows" WHERE follower_id = \$1 AND followed_id = \$2`).
+		WithArgs("user-uuid", "private-uuid", 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "follow_requests" WHERE follower_id = \$1 AND followed_id = \$2`).
+		WithArgs("user-uuid", "private-uuid").
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "follow_requests"`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow("request-uuid"))
+	mock.ExpectCommit()
+
+	r := testutils.SetupTestRouter()
+	r.POST("/users/:id/follow", func(c *gin.Context) {
+		c.Set("user_id", "user-uuid")
+		FollowUser(c)
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/users/private-uuid/follow", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetMyFollowers_PrivateProfile(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).
+		WithArgs("private-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "private_profile"}).AddRow("private-uuid", true))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_follows" WHERE follower_id = \$1 AND followed_id = \$2`).
+		WithArgs("user-uuid", "private-uuid").
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "subscriptions"`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+
+	r := testutils.SetupTestRouter()
+	r.GET("/users/followers", func(c *gin.Context) {
+		c.Set("user_id", "user-uuid")
+		GetMyFollowers(c)
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/users/followers?userSearch=private-uuid", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApproveFollowRequest(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "follow_requests" WHERE id = \$1 AND followed_id = \$2`).
+		WithArgs("request-uuid", "user-uuid", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "follower_id", "followed_id"}).AddRow("request-uuid", "follower-uuid", "user-uuid"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "user_follows"`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow("follow-uuid"))
+	mock.ExpectExec(`DELETE FROM "follow_requests" WHERE "follow_requests"."id" = \$1`).
+		WithArgs("request-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	r := testutils.SetupTestRouter()
+	r.POST("/users/follow-requests/:id/approve", func(c *gin.Context) {
+		c.Set("user_id", "user-uuid")
+		ApproveFollowRequest(c)
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/users/follow-requests/request-uuid/approve", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,133 @@
+package jobs
+
+import (
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/messaging"
+	"pec2-backend/services/realtime"
+	"pec2-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// Débit d'envoi : un lot par message groupé à chaque exécution du job
+const broadcastBatchSize = 100
+
+var (
+	// Pause entre deux messages d'un lot, pour ne pas saturer la base et les flux temps réel
+	broadcastSendInterval = 50 * time.Millisecond
+	// Remplacé dans les tests
+	sendBroadcastMessage = messaging.SendMessage
+)
+
+// DeliverBroadcasts envoie le lot suivant de chaque message groupé en attente ou en cours
+func DeliverBroadcasts(now time.Time) {
+	var broadcasts []models.Broadcast
+	if err := db.DB.Where("status IN ?", []models.BroadcastStatus{models.BroadcastPending, models.BroadcastSending}).
+		Order("created_at").Find(&broadcasts).Error; err != nil {
+		utils.LogError(err, "Error retrieving broadcasts in DeliverBroadcasts")
+		return
+	}
+
+	for _, broadcast := range broadcasts {
+		deliverBroadcast(broadcast, now)
+	}
+}
+
+func deliverBroadcast(broadcast models.Broadcast, now time.Time) {
+	if broadcast.Status == models.BroadcastPending {
+		if err := db.DB.Model(&models.Broadcast{}).
+			Where("id = ? AND status = ?", broadcast.ID, models.BroadcastPending).
+			UpdateColumns(map[string]any{"status": models.BroadcastSending, "started_at": now}).Error; err != nil {
+			utils.LogError(err, "Error starting broadcast in DeliverBroadcasts")
+			return
+		}
+	}
+
+	var recipients []models.BroadcastRecipient
+	if err := db.DB.Where("broadcast_id = ? AND status = ?", broadcast.ID, models.BroadcastRecipientPending).
+		Limit(broadcastBatchSize).Find(&recipients).Error; err != nil {
+		utils.LogError(err, "Error retrieving broadcast recipients in DeliverBroadcasts")
+		return
+	}
+	if len(recipients) == 0 {
+		finishBroadcast(broadcast, now)
+		return
+	}
+
+	userIDs := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		userIDs = append(userIDs, recipient.UserID)
+	}
+	var users []models.User
+	if err := db.DB.Where("id IN ? AND deleted_at IS NULL", userIDs).Find(&users).Error; err != nil {
+		utils.LogError(err, "Error retrieving broadcast receivers in DeliverBroadcasts")
+		return
+	}
+	usersByID := map[string]models.User{}
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	for _, recipient := range recipients {
+		// Annulé entre temps, ou déjà pris par une autre instance
+		claimed := db.DB.Model(&models.BroadcastRecipient{}).
+			Where("broadcast_id = ? AND user_id = ? AND status = ?", broadcast.ID, recipient.UserID, models.BroadcastRecipientPending).
+			UpdateColumn("status", models.BroadcastRecipientProcessing)
+		if claimed.Error != nil {
+			utils.LogError(claimed.Error, "Error claiming broadcast recipient in DeliverBroadcasts")
+			continue
+		}
+		if claimed.RowsAffected == 0 {
+			continue
+		}
+
+		status, counter := models.BroadcastRecipientSent, "sent_count"
+		var messageID *string
+		if user, ok := usersByID[recipient.UserID]; !ok || !user.MessageEnable {
+			status, counter = models.BroadcastRecipientSkipped, "skipped_count"
+		} else if message, err := sendBroadcastMessage(broadcast.CreatorID, user, broadcast.Content); err == messaging.ErrBlocked {
+			// Bloqué après la création du message groupé
+			status, counter = models.BroadcastRecipientSkipped, "skipped_count"
+		} else if err != nil {
+			utils.LogError(err, "Error sending broadcast message in DeliverBroadcasts")
+			status, counter = models.BroadcastRecipientFailed, "failed_count"
+		} else {
+			messageID = &message.ID
+			time.Sleep(broadcastSendInterval)
+		}
+
+		if err := db.DB.Model(&models.BroadcastRecipient{}).
+			Where("broadcast_id = ? AND user_id = ?", broadcast.ID, recipient.UserID).
+			UpdateColumns(map[string]any{"status": status, "message_id": messageID, "processed_at": time.Now()}).Error; err != nil {
+			utils.LogError(err, "Error updating broadcast recipient in DeliverBroadcasts")
+		}
+		if err := db.DB.Model(&models.Broadcast{}).Where("id = ?", broadcast.ID).
+			UpdateColumn(counter, gorm.Expr(counter+" + 1")).Error; err != nil {
+			utils.LogError(err, "Error updating broadcast stats in DeliverBroadcasts")
+		}
+	}
+}
+
+// finishBroadcast clôt le message groupé quand tous ses destinataires ont été traités et prévient le créateur
+func finishBroadcast(broadcast models.Broadcast, now time.Time) {
+	finished := db.DB.Model(&models.Broadcast{}).
+		Where("id = ? AND status = ?", broadcast.ID, models.BroadcastSending).
+		UpdateColumns(map[string]any{"status": models.BroadcastCompleted, "completed_at": now})
+	if finished.Error != nil {
+		utils.LogError(finished.Error, "Error completing broadcast in DeliverBroadcasts")
+		return
+	}
+	if finished.RowsAffected == 0 {
+		return
+	}
+
+	if err := db.DB.First(&broadcast, "id = ?", broadcast.ID).Error; err != nil {
+		utils.LogError(err, "Error reloading broadcast in DeliverBroadcasts")
+		return
+	}
+	realtime.PublishToUser(broadcast.CreatorID, realtime.EventBroadcastCompleted, broadcast)
+	utils.LogSuccessWithUser(broadcast.CreatorID, "Broadcast delivered in DeliverBroadcasts")
+}
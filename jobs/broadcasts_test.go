@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func captureBroadcastMessages(t *testing.T, failFor string) *[]string {
+	sent := []string{}
+	original, interval := sendBroadcastMessage, broadcastSendInterval
+	broadcastSendInterval = 0
+	sendBroadcastMessage = func(senderID string, receiver models.User, content string) (models.PrivateMessage, error) {
+		if receiver.ID == failFor {
+			return models.PrivateMessage{}, errors.New("database unavailable")
+		}
+		sent = append(sent, receiver.ID)
+		return models.PrivateMessage{ID: "message-" + receiver.ID, SenderID: senderID, ReceiverID: receiver.ID, Content: content}, nil
+	}
+	t.Cleanup(func() { sendBroadcastMessage, broadcastSendInterval = original, interval })
+	return &sent
+}
+
+func expectRecipientDone(mock sqlmock.Sqlmock, userID string, status models.BroadcastRecipientStatus, counter string) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "broadcast_recipients" SET "message_id"=\$1,"processed_at"=\$2,"status"=\$3 WHERE broadcast_id = \$4 AND user_id = \$5`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), status, "broadcast-uuid", userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "broadcasts" SET "` + counter + `"=` + counter + ` \+ 1 WHERE id = \$1`).
+		WithArgs("broadcast-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestDeliverBroadcasts_Batch(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+	sent := captureBroadcastMessages(t, "user-failing")
+
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT \* FROM "broadcasts" WHERE status IN \(\$1,\$2\) ORDER BY created_at`).
+		WithArgs(models.BroadcastPending, models.BroadcastSending).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "creator_id", "content", "status"}).
+			AddRow("broadcast-uuid", "creator-uuid", "Nouveau shooting ce soir !", "PENDING"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "broadcasts" SET "started_at"=\$1,"status"=\$2 WHERE id = \$3 AND status = \$4`).
+		WithArgs(now, models.BroadcastSending, "broadcast-uuid", models.BroadcastPending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "broadcast_recipients" WHERE broadcast_id = \$1 AND status = \$2 LIMIT \$3`).
+		WithArgs("broadcast-uuid", models.BroadcastRecipientPending, broadcastBatchSize).
+		WillReturnRows(sqlmock.NewRows([]string{"broadcast_id", "user_id", "status"}).
+			AddRow("broadcast-uuid", "user-open", "PENDING").
+			AddRow("broadcast-uuid", "user-closed", "PENDING").
+			AddRow("broadcast-uuid", "user-canceled", "PENDING").
+			AddRow("broadcast-uuid", "user-failing", "PENDING"))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE id IN \(\$1,\$2,\$3,\$4\) AND deleted_at IS NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "message_enable"}).
+			AddRow("user-open", true).
+			AddRow("user-closed", false).
+			AddRow("user-canceled", true).
+			AddRow("user-failing", true))
+
+	claim := func(userID string, rows int64) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "broadcast_recipients" SET "status"=\$1 WHERE broadcast_id = \$2 AND user_id = \$3 AND status = \$4`).
+			WithArgs(models.BroadcastRecipientProcessing, "broadcast-uuid", userID, models.BroadcastRecipientPending).
+			WillReturnResult(sqlmock.NewResult(0, rows))
+		mock.ExpectCommit()
+	}
+	claim("user-open", 1)
+	expectRecipientDone(mock, "user-open", models.BroadcastRecipientSent, "sent_count")
+	claim("user-closed", 1)
+	expectRecipientDone(mock, "user-closed", models.BroadcastRecipientSkipped, "skipped_count")
+	// Annulé par le créateur pendant l'envoi du lot
+	claim("user-canceled", 0)
+	claim("user-failing", 1)
+	expectRecipientDone(mock, "user-failing", models.BroadcastRecipientFailed, "failed_count")
+
+	DeliverBroadcasts(now)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []string{"user-open"}, *sent)
+}
+
+func TestDeliverBroadcasts_Completes(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+	sent := captureBroadcastMessages(t, "")
+
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT \* FROM "broadcasts" WHERE status IN \(\$1,\$2\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "creator_id", "status"}).AddRow("broadcast-uuid", "creator-uuid", "SENDING"))
+	mock.ExpectQuery(`SELECT \* FROM "broadcast_recipients" WHERE broadcast_id = \$1 AND status = \$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"broadcast_id", "user_id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "broadcasts" SET "completed_at"=\$1,"status"=\$2 WHERE id = \$3 AND status = \$4`).
+		WithArgs(now, models.BroadcastCompleted, "broadcast-uuid", models.BroadcastSending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "broadcasts" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "creator_id", "status", "sent_count"}).
+			AddRow("broadcast-uuid", "creator-uuid", "COMPLETED", 12))
+
+	DeliverBroadcasts(now)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Empty(t, *sent)
+}
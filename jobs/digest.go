@@ -0,0 +1,140 @@
+package jobs
+
+import (
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/notifications"
+	"pec2-backend/utils"
+	mailsmodels "pec2-backend/utils/mails-models"
+)
+
+// Nombre de posts listés dans l'email, les autres sont seulement comptés
+const maxDigestPosts = 5
+
+// Remplacé dans les tests pour ne pas envoyer d'email
+var sendDigestMail = mailsmodels.ActivityDigest
+
+// SendDigests envoie l'email récapitulatif aux utilisateurs dont le digest quotidien ou hebdomadaire est dû
+func SendDigests(now time.Time) {
+	for _, frequency := range []models.DigestFrequency{models.DigestDaily, models.DigestWeekly} {
+		dueBefore := now.Add(-frequency.Period())
+
+		var due []models.User
+		if err := db.DB.Select("id", "notify_digest_sent_at").
+			Where("notify_digest_frequency = ? AND (notify_digest_sent_at IS NULL OR notify_digest_sent_at <= ?)", frequency, dueBefore).
+			Find(&due).Error; err != nil {
+			utils.LogError(err, "Error retrieving due digests in SendDigests")
+			continue
+		}
+
+		for _, user := range due {
+			since := dueBefore
+			if user.NotificationSettings.DigestSentAt != nil {
+				since = *user.NotificationSettings.DigestSentAt
+			}
+
+			// Une autre instance peut avoir déjà pris ce digest
+			claimed := db.DB.Model(&models.User{}).
+				Where("id = ? AND notify_digest_frequency = ? AND (notify_digest_sent_at IS NULL OR notify_digest_sent_at <= ?)", user.ID, frequency, dueBefore).
+				UpdateColumn("notify_digest_sent_at", now)
+			if claimed.Error != nil {
+				utils.LogError(claimed.Error, "Error claiming digest in SendDigests")
+				continue
+			}
+			if claimed.RowsAffected == 0 {
+				continue
+			}
+
+			data, ok, err := buildDigest(user.ID, since, now)
+			if err != nil {
+				utils.LogError(err, "Error building digest in SendDigests")
+				continue
+			}
+			if !ok {
+				continue
+			}
+			data.Weekly = frequency == models.DigestWeekly
+			sendDigestMail(data)
+			utils.LogSuccessWithUser(user.ID, "Activity digest sent in SendDigests")
+		}
+	}
+}
+
+// buildDigest rassemble l'activité de l'utilisateur depuis since. ok est faux s'il n'y a rien à envoyer
+func buildDigest(userID string, since time.Time, now time.Time) (mailsmodels.ActivityDigestData, bool, error) {
+	var data mailsmodels.ActivityDigestData
+
+	var user models.User
+	if err := db.DB.Where("id = ? AND deleted_at IS NULL", userID).First(&user).Error; err != nil {
+		return data, false, err
+	}
+	if !user.Enable {
+		return data, false, nil
+	}
+
+	data.Email = user.Email
+	data.FirstName = user.FirstName
+	// Pas de digest sans lien de désinscription valide
+	unsubscribeURL, err := notifications.UnsubscribeURL(user.ID)
+	if err != nil {
+		return data, false, err
+	}
+	data.UnsubscribeURL = unsubscribeURL
+
+	// Créateurs suivis ou auxquels l'utilisateur est abonné
+	var followed []string
+	if err := db.DB.Model(&models.UserFollow{}).Where("follower_id = ?", user.ID).Pluck("followed_id", &followed).Error; err != nil {
+		return data, false, err
+	}
+	var subscribed []string
+	if err := db.DB.Model(&models.Subscription{}).
+		Where("user_id = ? AND (status = ? OR (status = ? AND end_date > ?))", user.ID, models.SubscriptionActive, models.SubscriptionCanceled, now).
+		Pluck("content_creator_id", &subscribed).Error; err != nil {
+		return data, false, err
+	}
+	creators := append(followed, subscribed...)
+
+	if len(creators) > 0 {
+		posts := db.DB.Table("posts").
+			Where("posts.user_id IN ? AND posts.enable = ? AND posts.created_at > ?", creators, true, since)
+		if err := posts.Count(&data.NewPostsCount).Error; err != nil {
+			return data, false, err
+		}
+		if data.NewPostsCount > 0 {
+			if err := posts.Select("users.user_name AS creator_name, posts.name AS post_name").
+				Joins("JOIN users ON users.id = posts.user_id").
+				Order("posts.created_at DESC").Limit(maxDigestPosts).
+				Scan(&data.Posts).Error; err != nil {
+				return data, false, err
+			}
+		}
+	}
+
+	if err := db.DB.Model(&models.PrivateMessage{}).
+		Where("receiver_id = ? AND status = ? AND deleted_at IS NULL", user.ID, models.MessageStatusUnread).
+		Count(&data.UnreadMessages).Error; err != nil {
+		return data, false, err
+	}
+
+	if user.Role == models.ContentCreator {
+		data.IsCreator = true
+		if err := db.DB.Model(&models.Subscription{}).
+			Where("content_creator_id = ? AND status = ? AND created_at > ?", user.ID, models.SubscriptionActive, since).
+			Count(&data.NewSubscribers).Error; err != nil {
+			return data, false, err
+		}
+		if err := db.DB.Table("subscription_payments").
+			Select("COALESCE(SUM(subscription_payments.amount), 0)").
+			Joins("JOIN subscriptions ON subscriptions.id = subscription_payments.subscription_id").
+			Where("subscriptions.content_creator_id = ? AND subscription_payments.status = ? AND subscription_payments.created_at > ?",
+				user.ID, models.SubscriptionPaymentSucceeded, since).
+			Scan(&data.Revenue).Error; err != nil {
+			return data, false, err
+		}
+	}
+
+	empty := data.NewPostsCount == 0 && data.UnreadMessages == 0 && data.NewSubscribers == 0 && data.Revenue == 0
+	return data, !empty, nil
+}
@@ -0,0 +1,121 @@
+package jobs
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+	mailsmodels "pec2-backend/utils/mails-models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	testutils.InitTestMain()
+
+	log.SetOutput(io.Discard)
+
+	exitCode := m.Run()
+
+	log.SetOutput(os.Stdout)
+
+	os.Exit(exitCode)
+}
+
+func captureDigests(t *testing.T) *[]mailsmodels.ActivityDigestData {
+	sent := []mailsmodels.ActivityDigestData{}
+	original := sendDigestMail
+	sendDigestMail = func(data mailsmodels.ActivityDigestData) {
+		sent = append(sent, data)
+	}
+	t.Cleanup(func() { sendDigestMail = original })
+	return &sent
+}
+
+func TestSendDigests_Daily(t *testing.T) {
+	t.Setenv("UNSUBSCRIBE_SECRET", "test-secret")
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+	sent := captureDigests(t)
+
+	now := time.Now()
+	lastSent := now.Add(-25 * time.Hour)
+
+	mock.ExpectQuery(`SELECT "id","notify_digest_sent_at" FROM "users" WHERE notify_digest_frequency = \$1 AND \(notify_digest_sent_at IS NULL OR notify_digest_sent_at <= \$2\)`).
+		WithArgs(models.DigestDaily, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "notify_digest_sent_at"}).
+			AddRow("user-uuid", lastSent))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET "notify_digest_sent_at"=\$1 WHERE id = \$2 AND notify_digest_frequency = \$3`).
+		WithArgs(now, "user-uuid", models.DigestDaily, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs("user-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "role", "enable"}).
+			AddRow("user-uuid", "user@example.com", "Jean", "USER", true))
+	mock.ExpectQuery(`SELECT "followed_id" FROM "user_follows" WHERE follower_id = \$1`).
+		WithArgs("user-uuid").
+		WillReturnRows(sqlmock.NewRows([]string{"followed_id"}).AddRow("creator-1"))
+	mock.ExpectQuery(`SELECT "content_creator_id" FROM "subscriptions" WHERE user_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"content_creator_id"}).AddRow("creator-2"))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "posts" WHERE posts.user_id IN \(\$1,\$2\) AND posts.enable = \$3 AND posts.created_at > \$4`).
+		WithArgs("creator-1", "creator-2", true, lastSent).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`SELECT users.user_name AS creator_name, posts.name AS post_name FROM "posts" JOIN users ON users.id = posts.user_id WHERE .* ORDER BY posts.created_at DESC LIMIT \$5`).
+		WillReturnRows(sqlmock.NewRows([]string{"creator_name", "post_name"}).
+			AddRow("creator1", "Nouveau post").
+			AddRow("creator2", "Coulisses"))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "private_messages" WHERE receiver_id = \$1 AND status = \$2`).
+		WithArgs("user-uuid", models.MessageStatusUnread).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	mock.ExpectQuery(`SELECT "id","notify_digest_sent_at" FROM "users" WHERE notify_digest_frequency = \$1`).
+		WithArgs(models.DigestWeekly, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	SendDigests(now)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Len(t, *sent, 1)
+	digest := (*sent)[0]
+	assert.Equal(t, "user@example.com", digest.Email)
+	assert.False(t, digest.Weekly)
+	assert.Equal(t, int64(2), digest.NewPostsCount)
+	assert.Equal(t, []mailsmodels.DigestPost{{CreatorName: "creator1", PostName: "Nouveau post"}, {CreatorName: "creator2", PostName: "Coulisses"}}, digest.Posts)
+	assert.Equal(t, int64(3), digest.UnreadMessages)
+	assert.False(t, digest.IsCreator)
+	assert.Contains(t, digest.UnsubscribeURL, "/notifications/digest/unsubscribe?")
+}
+
+func TestSendDigests_AlreadyClaimed(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+	sent := captureDigests(t)
+
+	mock.ExpectQuery(`SELECT "id","notify_digest_sent_at" FROM "users" WHERE notify_digest_frequency = \$1`).
+		WithArgs(models.DigestDaily, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "notify_digest_sent_at"}).AddRow("user-uuid", nil))
+
+	// Une autre instance a envoyé le digest entre temps
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET "notify_digest_sent_at"=\$1`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(`SELECT "id","notify_digest_sent_at" FROM "users" WHERE notify_digest_frequency = \$1`).
+		WithArgs(models.DigestWeekly, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	SendDigests(time.Now())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Empty(t, *sent)
+}
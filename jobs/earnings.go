@@ -0,0 +1,20 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"pec2-backend/services/ledger"
+	"pec2-backend/utils"
+)
+
+// ReleaseEarnings rend disponibles les gains des créateurs sortis de la période de rétention
+func ReleaseEarnings(now time.Time) {
+	released, err := ledger.ReleaseAvailable(now)
+	if err != nil {
+		utils.LogError(err, "Error releasing earnings in ReleaseEarnings")
+	}
+	if released > 0 {
+		utils.LogSuccess(fmt.Sprintf("%d payments released in ReleaseEarnings", released))
+	}
+}
@@ -0,0 +1,59 @@
+package jobs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"pec2-backend/utils"
+)
+
+// job est une tâche de fond exécutée à intervalle régulier
+type job struct {
+	name     string
+	interval time.Duration
+	run      func(now time.Time)
+}
+
+// Chaque job doit être idempotent : plusieurs instances de l'API peuvent le lancer en même temps
+var registered = []job{
+	{name: "activity_digest", interval: time.Hour, run: SendDigests},
+	{name: "broadcast_delivery", interval: 30 * time.Second, run: DeliverBroadcasts},
+	{name: "creator_suggestions", interval: time.Hour, run: RefreshSuggestions},
+	{name: "earnings_release", interval: time.Hour, run: ReleaseEarnings},
+	{name: "creator_transfers", interval: time.Hour, run: TransferEarnings},
+	{name: "stripe_event_retries", interval: time.Minute, run: RetryWebhookEvents},
+}
+
+var startOnce sync.Once
+
+// Start lance les tâches planifiées en arrière-plan
+func Start() {
+	startOnce.Do(func() {
+		for _, j := range registered {
+			go loop(j)
+		}
+	})
+}
+
+func loop(j job) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		runJob(j, now)
+	}
+}
+
+// runJob exécute un job sans qu'une panique n'arrête le planificateur
+func runJob(j job, now time.Time) {
+	defer func() {
+		if r := recover(); r != nil {
+			utils.LogError(fmt.Errorf("%v", r), "Panic in job "+j.name)
+		}
+	}()
+
+	start := time.Now()
+	j.run(now)
+	utils.LogSuccess(fmt.Sprintf("Job %s done in %s", j.name, time.Since(start).Round(time.Millisecond)))
+}
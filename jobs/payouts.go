@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/payouts"
+	"pec2-backend/utils"
+)
+
+// TransferEarnings transfère leurs gains disponibles aux créateurs dont le compte Stripe Connect est vérifié
+func TransferEarnings(now time.Time) {
+	var creators []models.User
+	if err := db.DB.Where("role = ? AND stripe_account_id <> '' AND payouts_enabled = ?", models.ContentCreator, true).
+		Find(&creators).Error; err != nil {
+		utils.LogError(err, "Error retrieving creators in TransferEarnings")
+		return
+	}
+
+	for _, creator := range creators {
+		amount, err := payouts.TransferAvailable(creator)
+		if err != nil {
+			utils.LogErrorWithUser(creator.ID, err, "Error transferring earnings in TransferEarnings")
+			continue
+		}
+		if amount > 0 {
+			utils.LogSuccessWithUser(creator.ID, fmt.Sprintf("%d cents transferred in TransferEarnings", amount))
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/suggestions"
+	"pec2-backend/utils"
+)
+
+const (
+	// Un utilisateur est actif s'il a aimé un post ou suivi quelqu'un récemment
+	suggestionsActiveWindow = 7 * 24 * time.Hour
+	// Intervalle entre deux calculs des suggestions d'un même utilisateur
+	suggestionsRefreshEvery = 24 * time.Hour
+)
+
+// RefreshSuggestions précalcule les créateurs suggérés aux utilisateurs actifs
+func RefreshSuggestions(now time.Time) {
+	activeSince := now.Add(-suggestionsActiveWindow)
+
+	var likers, followers []string
+	if err := db.DB.Model(&models.Like{}).Distinct().Where("created_at > ?", activeSince).Pluck("user_id", &likers).Error; err != nil {
+		utils.LogError(err, "Error retrieving active users in RefreshSuggestions")
+		return
+	}
+	if err := db.DB.Model(&models.UserFollow{}).Distinct().Where("created_at > ?", activeSince).Pluck("follower_id", &followers).Error; err != nil {
+		utils.LogError(err, "Error retrieving active users in RefreshSuggestions")
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, userID := range append(likers, followers...) {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		// Déjà calculées récemment, par ce job ou à la demande
+		var fresh int64
+		if err := db.DB.Model(&models.CreatorSuggestion{}).
+			Where("user_id = ? AND computed_at > ?", userID, now.Add(-suggestionsRefreshEvery)).
+			Count(&fresh).Error; err != nil {
+			utils.LogError(err, "Error checking suggestions in RefreshSuggestions")
+			continue
+		}
+		if fresh > 0 {
+			continue
+		}
+
+		if err := suggestions.Refresh(userID, now); err != nil {
+			utils.LogError(err, "Error refreshing suggestions in RefreshSuggestions")
+			continue
+		}
+	}
+}
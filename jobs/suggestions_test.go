@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshSuggestions_SkipsFreshUsers(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT DISTINCT "user_id" FROM "likes" WHERE created_at > \$1`).
+		WithArgs(now.Add(-suggestionsActiveWindow)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("user-uuid"))
+	mock.ExpectQuery(`SELECT DISTINCT "follower_id" FROM "user_follows" WHERE created_at > \$1`).
+		WithArgs(now.Add(-suggestionsActiveWindow)).
+		WillReturnRows(sqlmock.NewRows([]string{"follower_id"}).AddRow("user-uuid"))
+	// Un utilisateur à la fois liker et follower n'est traité qu'une fois
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "creator_suggestions" WHERE user_id = \$1 AND computed_at > \$2`).
+		WithArgs("user-uuid", now.Add(-suggestionsRefreshEvery)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(12))
+
+	RefreshSuggestions(now)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,20 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"pec2-backend/handlers/stripe"
+	"pec2-backend/utils"
+)
+
+// RetryWebhookEvents rejoue les évènements Stripe dont le traitement a échoué
+func RetryWebhookEvents(now time.Time) {
+	retried, err := stripe.RetryWebhookEvents(now)
+	if err != nil {
+		utils.LogError(err, "Error retrying Stripe events in RetryWebhookEvents")
+	}
+	if retried > 0 {
+		utils.LogSuccess(fmt.Sprintf("%d Stripe events retried in RetryWebhookEvents", retried))
+	}
+}
@@ -5,7 +5,12 @@ import (
 
 	"pec2-backend/db"
 	"pec2-backend/docs"
+	"pec2-backend/jobs"
 	"pec2-backend/routes"
+	"pec2-backend/services/media"
+	"pec2-backend/services/messaging"
+	"pec2-backend/services/notifications"
+	"pec2-backend/services/realtime"
 	"pec2-backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -26,6 +31,18 @@ func main() {
 	// Initialiser la base de données
 	db.InitDB()
 
+	// Rattacher les anciens messages privés à leur conversation
+	messaging.BackfillConversations()
+
+	// Diffusion des évènements temps réel entre les instances
+	realtime.Init(os.Getenv("DB_URL"), db.DB)
+
+	// Enregistrement des notifications en arrière-plan
+	notifications.Start()
+
+	// Tâches planifiées (emails récapitulatifs...)
+	jobs.Start()
+
 	// Fais en sorte que les logs de Gin et les logs logrus soient dans le même format
 	gin.DefaultWriter = utils.LogWriter()
 	gin.DefaultErrorWriter = utils.LogWriter()
@@ -38,6 +55,12 @@ func main() {
 		utils.LogError(err, "Error when initializing Cloudinary")
 	}
 
+	// Client Stripe, éventuellement dirigé vers un bouchon local
+	utils.InitStripe()
+
+	// Les URLs signées des médias payants exigent un secret
+	media.CheckSigningSecret()
+
 	// Récupérer les variables d'environnement
 	baseURL := os.Getenv("BASE_URL")
 	if baseURL == "" {
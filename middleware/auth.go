@@ -17,34 +17,86 @@ func JWTAuth() gin.HandlerFunc {
 			return
 		}
 
-		authHeader = strings.Trim(authHeader, "\"' ")
-		if !strings.HasPrefix(strings.ToLower(authHeader), "bearer ") {
-			authHeader = "Bearer " + authHeader
+		authenticateHeader(c, authHeader)
+	}
+}
+
+// JWTAuthWithQueryToken accepte aussi le token dans l'URL (?token=...), pour les balises <img> et l'EventSource
+// qui ne peuvent pas envoyer de header Authorization
+func JWTAuthWithQueryToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader != "" {
+			authenticateHeader(c, authHeader)
+			return
 		}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format, expected: Bearer <token>"})
+		tokenString := strings.Trim(c.Query("token"), "\"' ")
+		if tokenString == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header or token parameter missing"})
 			c.Abort()
 			return
 		}
 
-		tokenString := parts[1]
-		tokenString = strings.Trim(tokenString, "\"' ")
+		authenticateToken(c, tokenString)
+	}
+}
 
-		claims, err := utils.DecodeJWT(tokenString)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token: " + err.Error()})
-			c.Abort()
-			return
+// OptionalJWTAuth renseigne l'utilisateur quand un token valide est fourni (header ou ?token=),
+// sans bloquer la requête sinon
+func OptionalJWTAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := c.Query("token")
+		if authHeader := strings.Trim(c.GetHeader("Authorization"), "\"' "); authHeader != "" {
+			tokenString = authHeader
+			if len(authHeader) > 7 && strings.EqualFold(authHeader[:7], "bearer ") {
+				tokenString = authHeader[7:]
+			}
 		}
+		tokenString = strings.Trim(tokenString, "\"' ")
 
-		c.Set("user_id", claims["user_id"])
-		c.Set("role", claims["role"])
+		if tokenString != "" {
+			if claims, err := utils.DecodeJWT(tokenString); err == nil {
+				c.Set("user_id", claims["user_id"])
+				c.Set("role", claims["role"])
+			}
+		}
 		c.Next()
 	}
 }
 
+func authenticateHeader(c *gin.Context, authHeader string) {
+	authHeader = strings.Trim(authHeader, "\"' ")
+	if !strings.HasPrefix(strings.ToLower(authHeader), "bearer ") {
+		authHeader = "Bearer " + authHeader
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format, expected: Bearer <token>"})
+		c.Abort()
+		return
+	}
+
+	tokenString := parts[1]
+	tokenString = strings.Trim(tokenString, "\"' ")
+
+	authenticateToken(c, tokenString)
+}
+
+func authenticateToken(c *gin.Context, tokenString string) {
+	claims, err := utils.DecodeJWT(tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", claims["user_id"])
+	c.Set("role", claims["role"])
+	c.Next()
+}
+
 func AdminAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role, exists := c.Get("role")
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+)
+
+// BroadcastSegment est le public visé par un message groupé
+type BroadcastSegment string
+
+const (
+	BroadcastSubscribers BroadcastSegment = "subscribers"
+	BroadcastFollowers   BroadcastSegment = "followers"
+	BroadcastExpiring    BroadcastSegment = "expiring"
+	BroadcastLapsed      BroadcastSegment = "lapsed"
+)
+
+type BroadcastStatus string
+
+const (
+	BroadcastPending   BroadcastStatus = "PENDING"
+	BroadcastSending   BroadcastStatus = "SENDING"
+	BroadcastCompleted BroadcastStatus = "COMPLETED"
+	BroadcastCanceled  BroadcastStatus = "CANCELED"
+)
+
+// Broadcast est un message envoyé par un créateur à une partie de son audience,
+// livré en messages privés individuels par un job
+type Broadcast struct {
+	ID                 string           `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	CreatorID          string           `json:"creatorId" gorm:"type:uuid;not null;index"`
+	Segment            BroadcastSegment `json:"segment" gorm:"type:varchar(20);not null"`
+	ExpiringWithinDays int              `json:"expiringWithinDays,omitempty"`
+	Content            string           `json:"content" gorm:"type:text;not null"`
+	Status             BroadcastStatus  `json:"status" gorm:"type:varchar(20);default:'PENDING';index"`
+	RecipientsCount    int              `json:"recipientsCount"`
+	SentCount          int              `json:"sentCount"`
+	SkippedCount       int              `json:"skippedCount"`
+	FailedCount        int              `json:"failedCount"`
+	StartedAt          *time.Time       `json:"startedAt"`
+	CompletedAt        *time.Time       `json:"completedAt"`
+	CanceledAt         *time.Time       `json:"canceledAt"`
+	CreatedAt          time.Time        `json:"createdAt"`
+	UpdatedAt          time.Time        `json:"updatedAt"`
+}
+
+type BroadcastRecipientStatus string
+
+const (
+	BroadcastRecipientPending    BroadcastRecipientStatus = "PENDING"
+	BroadcastRecipientProcessing BroadcastRecipientStatus = "PROCESSING"
+	BroadcastRecipientSent       BroadcastRecipientStatus = "SENT"
+	BroadcastRecipientSkipped    BroadcastRecipientStatus = "SKIPPED"
+	BroadcastRecipientFailed     BroadcastRecipientStatus = "FAILED"
+	BroadcastRecipientCanceled   BroadcastRecipientStatus = "CANCELED"
+)
+
+// BroadcastRecipient est un destinataire d'un message groupé, figé à la création
+type BroadcastRecipient struct {
+	BroadcastID string                   `json:"broadcastId" gorm:"primaryKey;type:uuid"`
+	UserID      string                   `json:"userId" gorm:"primaryKey;type:uuid"`
+	Status      BroadcastRecipientStatus `json:"status" gorm:"type:varchar(20);default:'PENDING';index"`
+	MessageID   *string                  `json:"messageId" gorm:"type:uuid"`
+	ProcessedAt *time.Time               `json:"processedAt"`
+}
+
+// BroadcastCreate model for creating a broadcast
+// @Description model for sending a message to a segment of the creator's audience
+type BroadcastCreate struct {
+	Segment            BroadcastSegment `json:"segment" binding:"required,oneof=subscribers followers expiring lapsed"`
+	ExpiringWithinDays int              `json:"expiringWithinDays" binding:"omitempty,min=1,max=90"`
+	Content            string           `json:"content" binding:"required,max=2000"`
+}
@@ -5,12 +5,13 @@ import (
 )
 
 type Category struct {
-	ID         string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	Name       string    `json:"name" binding:"required"`
-	PictureURL string    `json:"pictureUrl,omitempty"`
-	Posts      []Post    `json:"posts,omitempty" gorm:"many2many:post_categories;"`
-	CreatedAt  time.Time `json:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt"`
+	ID              string        `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Name            string        `json:"name" binding:"required"`
+	PictureURL      string        `json:"pictureUrl,omitempty"`
+	PictureVariants ImageVariants `json:"pictureVariants" gorm:"embedded;embeddedPrefix:picture_"`
+	Posts           []Post        `json:"posts,omitempty" gorm:"many2many:post_categories;"`
+	CreatedAt       time.Time     `json:"createdAt"`
+	UpdatedAt       time.Time     `json:"updatedAt"`
 }
 
 type CategoryCreate struct {
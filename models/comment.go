@@ -4,13 +4,25 @@ import (
 	"time"
 )
 
+// Profondeur maximale des réponses : commentaire (0) > réponse (1) > réponse à une réponse (2)
+const MaxCommentDepth = 2
+
 type Comment struct {
-	ID            string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	PostID        string    `json:"postId" gorm:"column:post_id"`
-	UserID        string    `json:"userId" gorm:"column:user_id"`
-	Content       string    `json:"content" binding:"required"`
-	CommentsCount int       `json:"commentsCount" gorm:"column:comments_count;default:0"`
-	CreatedAt     time.Time `json:"createdAt"`
+	ID       string  `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	PostID   string  `json:"postId" gorm:"column:post_id"`
+	UserID   string  `json:"userId" gorm:"column:user_id"`
+	ParentID *string `json:"parentId" gorm:"column:parent_id;type:uuid;index"`
+	Depth    int     `json:"depth" gorm:"default:0"`
+	Content  string  `json:"content" binding:"required"`
+	// Nombre de réponses directes à ce commentaire
+	CommentsCount int        `json:"commentsCount" gorm:"column:comments_count;default:0"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	EditedAt      *time.Time `json:"editedAt"`
+	// Masqué par l'auteur du post ou un admin : visible uniquement par eux et par l'auteur du commentaire
+	HiddenAt *time.Time `json:"hiddenAt"`
+	HiddenBy *string    `json:"hiddenBy" gorm:"type:uuid"`
+	// Supprimé alors qu'il avait des réponses : on garde une trace vide pour ne pas casser le fil
+	DeletedAt *time.Time `json:"deletedAt"`
 }
 
 func (Comment) TableName() string {
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+)
+
+// Conversation regroupe les messages privés entre deux utilisateurs.
+// UserAID est toujours le plus petit des deux identifiants pour garantir une seule conversation par paire
+type Conversation struct {
+	ID            string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserAID       string     `json:"userAId" gorm:"type:uuid;not null;uniqueIndex:idx_conversation_users"`
+	UserBID       string     `json:"userBId" gorm:"type:uuid;not null;uniqueIndex:idx_conversation_users"`
+	LastMessageID *string    `json:"lastMessageId" gorm:"type:uuid"`
+	LastMessageAt *time.Time `json:"lastMessageAt" gorm:"index"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+func (Conversation) TableName() string {
+	return "conversations"
+}
+
+// OtherUserID renvoie l'identifiant de l'autre participant
+func (c Conversation) OtherUserID(userID string) string {
+	if c.UserAID == userID {
+		return c.UserBID
+	}
+	return c.UserAID
+}
+
+type MessageRequestStatus string
+
+const (
+	MessageRequestAccepted MessageRequestStatus = "ACCEPTED"
+	// Premier message d'un inconnu : la conversation attend dans les demandes du destinataire
+	MessageRequestPending MessageRequestStatus = "PENDING"
+	// Demande refusée : les messages suivants restent masqués et ne sont pas notifiés
+	MessageRequestDeclined MessageRequestStatus = "DECLINED"
+)
+
+// ConversationParticipant stocke l'état d'une conversation propre à chaque participant
+type ConversationParticipant struct {
+	ConversationID string `json:"conversationId" gorm:"primaryKey;type:uuid"`
+	UserID         string `json:"userId" gorm:"primaryKey;type:uuid;index"`
+	// Conversation archivée : masquée de la liste principale jusqu'au prochain message
+	ArchivedAt *time.Time `json:"archivedAt"`
+	// Conversation supprimée : les messages antérieurs ne sont plus visibles pour ce participant
+	ClearedAt     *time.Time           `json:"clearedAt"`
+	LastReadAt    *time.Time           `json:"lastReadAt"`
+	RequestStatus MessageRequestStatus `json:"requestStatus" gorm:"type:varchar(20);default:'ACCEPTED'"`
+}
+
+func (ConversationParticipant) TableName() string {
+	return "conversation_participants"
+}
+
+// ConversationUser est l'autre participant affiché dans une conversation
+type ConversationUser struct {
+	ID             string `json:"id"`
+	UserName       string `json:"userName"`
+	ProfilePicture string `json:"profilePicture"`
+	MessageEnable  bool   `json:"messageEnable"`
+}
+
+// ConversationResponse est une entrée de la liste des conversations
+type ConversationResponse struct {
+	ID          string            `json:"id"`
+	Participant *ConversationUser `json:"participant"`
+	LastMessage *PrivateMessage   `json:"lastMessage"`
+	UnreadCount int64             `json:"unreadCount"`
+	Archived    bool              `json:"archived"`
+	UpdatedAt   *time.Time        `json:"updatedAt"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "slices"
+
+// ImageVariants regroupe les différentes tailles générées pour une image uploadée
+// @Description URLs des variantes d'une image (miniature, fil d'actualité, taille réelle)
+type ImageVariants struct {
+	Thumbnail string `json:"thumbnail"`
+	Feed      string `json:"feed"`
+	Full      string `json:"full"`
+}
+
+// IsEmpty indique si aucune variante n'a été générée (anciennes images)
+func (v ImageVariants) IsEmpty() bool {
+	return v.Thumbnail == "" && v.Feed == "" && v.Full == ""
+}
+
+// URLs retourne la liste des URLs non vides et distinctes des variantes
+// (les GIF animés uploadés avant leur redimensionnement utilisent la même URL pour toutes leurs tailles)
+func (v ImageVariants) URLs() []string {
+	var urls []string
+	for _, url := range []string{v.Thumbnail, v.Feed, v.Full} {
+		if url != "" && !slices.Contains(urls, url) {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
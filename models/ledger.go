@@ -0,0 +1,122 @@
+package models
+
+import (
+	"time"
+)
+
+type LedgerTransactionKind string
+
+const (
+	// Paiement encaissé pour un créateur (abonnement, pourboire, déblocage)
+	LedgerCharge LedgerTransactionKind = "CHARGE"
+	// Commission de la plateforme prélevée sur un paiement
+	LedgerPlatformFee LedgerTransactionKind = "PLATFORM_FEE"
+	// Remboursement, total ou partiel, d'un paiement
+	LedgerRefund LedgerTransactionKind = "REFUND"
+	// Litige ouvert par la banque du client
+	LedgerChargeback LedgerTransactionKind = "CHARGEBACK"
+	// Litige gagné : les fonds retenus sont restitués
+	LedgerChargebackReversal LedgerTransactionKind = "CHARGEBACK_REVERSAL"
+	// Fin de la période de rétention : les fonds deviennent disponibles
+	LedgerRelease LedgerTransactionKind = "RELEASE"
+	// Versement au créateur
+	LedgerPayout LedgerTransactionKind = "PAYOUT"
+	// Versement refusé ou annulé par Stripe : les fonds reviennent au créateur
+	LedgerPayoutReversal LedgerTransactionKind = "PAYOUT_REVERSAL"
+)
+
+// LedgerAccount est un compte du grand livre. Les comptes créateurs sont propres à chaque créateur (CreatorID)
+type LedgerAccount string
+
+const (
+	// Fonds détenus sur le compte Stripe de la plateforme
+	LedgerAccountStripe LedgerAccount = "stripe"
+	// Commissions gagnées par la plateforme
+	LedgerAccountPlatformFees LedgerAccount = "platform_fees"
+	// Gains d'un créateur encore en période de rétention
+	LedgerAccountCreatorPending LedgerAccount = "creator_pending"
+	// Gains d'un créateur disponibles pour un versement
+	LedgerAccountCreatorAvailable LedgerAccount = "creator_available"
+)
+
+type LedgerSource string
+
+const (
+	LedgerSourceSubscription  LedgerSource = "subscription"
+	LedgerSourceTip           LedgerSource = "tip"
+	LedgerSourceMessageUnlock LedgerSource = "message_unlock"
+)
+
+// LedgerTransaction regroupe des écritures équilibrées : la somme de leurs montants est nulle.
+// Kind et Reference identifient l'opération Stripe d'origine, ce qui rend l'enregistrement idempotent
+type LedgerTransaction struct {
+	ID        string                `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Kind      LedgerTransactionKind `json:"kind" gorm:"type:varchar(30);not null;uniqueIndex:idx_ledger_reference"`
+	Reference string                `json:"reference" gorm:"not null;uniqueIndex:idx_ledger_reference"`
+	CreatorID string                `json:"creatorId" gorm:"type:uuid;not null;index"`
+	// Paiement d'origine, pour les commissions, remboursements, litiges et libérations
+	ChargeID        *string      `json:"chargeId" gorm:"type:uuid;index"`
+	Source          LedgerSource `json:"source" gorm:"type:varchar(20)"`
+	PaymentIntentID string       `json:"-" gorm:"index"`
+	// Montant de l'opération (en centimes), toujours positif
+	Amount int `json:"amount"`
+	// Fin de la période de rétention d'un paiement, et date à laquelle ses fonds ont été libérés
+	AvailableAt *time.Time    `json:"availableAt"`
+	ReleasedAt  *time.Time    `json:"releasedAt"`
+	Entries     []LedgerEntry `json:"entries,omitempty" gorm:"foreignKey:TransactionID"`
+	CreatedAt   time.Time     `json:"createdAt"`
+}
+
+func (LedgerTransaction) TableName() string {
+	return "ledger_transactions"
+}
+
+// LedgerEntry est une écriture : un montant positif débite le compte, un montant négatif le crédite
+type LedgerEntry struct {
+	ID            string        `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	TransactionID string        `json:"transactionId" gorm:"type:uuid;not null;index"`
+	Account       LedgerAccount `json:"account" gorm:"type:varchar(30);not null;index"`
+	// Vide pour les comptes de la plateforme
+	CreatorID *string   `json:"creatorId" gorm:"type:uuid;index"`
+	Amount    int       `json:"amount"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (LedgerEntry) TableName() string {
+	return "ledger_entries"
+}
+
+// CreatorBalance résume les gains d'un créateur (en centimes)
+type CreatorBalance struct {
+	// Gains encore en période de rétention, qui peuvent être remboursés
+	Pending int `json:"pending"`
+	// Gains qui peuvent être versés
+	Available    int `json:"available"`
+	PaidOut      int `json:"paidOut"`
+	Gross        int `json:"gross"`
+	PlatformFees int `json:"platformFees"`
+	Refunded     int `json:"refunded"`
+	Chargebacks  int `json:"chargebacks"`
+}
+
+// LedgerReconciliation est le rapport de cohérence du grand livre
+type LedgerReconciliation struct {
+	// Somme de toutes les écritures, nulle si le grand livre est équilibré
+	Total int `json:"total"`
+	// Transactions dont les écritures ne s'équilibrent pas
+	UnbalancedTransactions []string `json:"unbalancedTransactions"`
+	// Solde de chaque compte, créateurs confondus
+	Accounts map[LedgerAccount]int `json:"accounts"`
+	// Paiements réussis de chaque source comparés aux paiements du grand livre
+	Sources  map[LedgerSource]LedgerSourceCheck `json:"sources"`
+	Balanced bool                               `json:"balanced"`
+}
+
+// LedgerSourceCheck compare les montants encaissés d'une source. Le grand livre peut dépasser la table
+// de la source : les renouvellements d'abonnement y sont enregistrés depuis la facture
+type LedgerSourceCheck struct {
+	Payments int `json:"payments"`
+	Ledger   int `json:"ledger"`
+	// Paiements réussis sans transaction dans le grand livre
+	Missing int `json:"missing"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+)
+
+// Bornes du prix d'une pièce jointe payante (en centimes)
+const (
+	MinAttachmentPrice = 100
+	MaxAttachmentPrice = 50000
+)
+
+// MessageAttachment est une image jointe à un message privé.
+// Avec un prix, le destinataire doit la débloquer (paiement unique) pour la voir
+type MessageAttachment struct {
+	ID              string        `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	MessageID       string        `json:"messageId" gorm:"type:uuid;not null;index"`
+	SenderID        string        `json:"senderId" gorm:"type:uuid;not null"`
+	ReceiverID      string        `json:"receiverId" gorm:"type:uuid;not null"`
+	PictureURL      string        `json:"-"`
+	PictureVariants ImageVariants `json:"-" gorm:"embedded;embeddedPrefix:picture_"`
+	Price           int           `json:"price"`
+	CreatedAt       time.Time     `json:"createdAt"`
+}
+
+// MessageAttachmentResponse est la pièce jointe telle que la voit un participant :
+// URLs signées quand il y a accès, aucune URL tant qu'elle n'est pas débloquée
+// @Description Attachment of a private message
+type MessageAttachmentResponse struct {
+	ID              string        `json:"id"`
+	Price           int           `json:"price"`
+	Locked          bool          `json:"locked"`
+	PictureURL      string        `json:"pictureUrl,omitempty"`
+	PictureVariants ImageVariants `json:"pictureVariants"`
+}
+
+type MessageUnlockStatus string
+
+const (
+	MessageUnlockPending   MessageUnlockStatus = "PENDING"
+	MessageUnlockSucceeded MessageUnlockStatus = "SUCCEEDED"
+)
+
+// MessageUnlock est l'achat d'une pièce jointe payante par son destinataire
+type MessageUnlock struct {
+	ID                    string              `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	AttachmentID          string              `json:"attachmentId" gorm:"type:uuid;not null;uniqueIndex:idx_message_unlock"`
+	UserID                string              `json:"userId" gorm:"type:uuid;not null;uniqueIndex:idx_message_unlock"`
+	Amount                int                 `json:"amount"`
+	Status                MessageUnlockStatus `json:"status" gorm:"type:varchar(20);default:'PENDING'"`
+	StripeSessionID       string              `json:"-" gorm:"index"`
+	StripePaymentIntentID string              `json:"-"`
+	PaidAt                *time.Time          `json:"paidAt"`
+	CreatedAt             time.Time           `json:"createdAt"`
+	UpdatedAt             time.Time           `json:"updatedAt"`
+}
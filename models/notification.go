@@ -0,0 +1,172 @@
+package models
+
+import (
+	"time"
+)
+
+type NotificationType string
+
+const (
+	NotificationPostLiked          NotificationType = "post_liked"
+	NotificationNewComment         NotificationType = "new_comment"
+	NotificationCommentReply       NotificationType = "comment_reply"
+	NotificationNewFollower        NotificationType = "new_follower"
+	NotificationFollowRequest      NotificationType = "follow_request"
+	NotificationFollowAccepted     NotificationType = "follow_request_accepted"
+	NotificationNewSubscriber      NotificationType = "new_subscriber"
+	NotificationPaymentFailed      NotificationType = "subscription_payment_failed"
+	NotificationCreatorApplication NotificationType = "creator_application"
+	NotificationReportOutcome      NotificationType = "report_outcome"
+	NotificationTipReceived        NotificationType = "tip_received"
+)
+
+// Notification est une entrée du centre de notifications. Les évènements similaires non lus
+// (même type et même GroupKey) sont regroupés : ActorID est le dernier acteur et ActorsCount
+// le nombre d'acteurs distincts
+type Notification struct {
+	ID          string           `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID      string           `json:"userId" gorm:"type:uuid;index"`
+	Type        NotificationType `json:"type"`
+	GroupKey    string           `json:"-" gorm:"index"`
+	ActorID     *string          `json:"actorId" gorm:"type:uuid"`
+	ActorsCount int              `json:"actorsCount" gorm:"default:0"`
+	PostID      *string          `json:"postId" gorm:"type:uuid"`
+	CommentID   *string          `json:"commentId" gorm:"type:uuid"`
+	Detail      string           `json:"detail"`
+	ReadAt      *time.Time       `json:"readAt"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	UpdatedAt   time.Time        `json:"updatedAt" gorm:"index"`
+}
+
+func (Notification) TableName() string {
+	return "notifications"
+}
+
+// NotificationActor garde les acteurs d'une notification groupée pour ne les compter qu'une fois
+type NotificationActor struct {
+	NotificationID string    `gorm:"primaryKey;type:uuid"`
+	ActorID        string    `gorm:"primaryKey;type:uuid"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+func (NotificationActor) TableName() string {
+	return "notification_actors"
+}
+
+type DigestFrequency string
+
+const (
+	DigestNone   DigestFrequency = "none"
+	DigestDaily  DigestFrequency = "daily"
+	DigestWeekly DigestFrequency = "weekly"
+)
+
+// Period renvoie l'intervalle entre deux digests, 0 si désactivé
+func (f DigestFrequency) Period() time.Duration {
+	switch f {
+	case DigestDaily:
+		return 24 * time.Hour
+	case DigestWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// NotificationSettings regroupe les préférences de notifications d'un utilisateur, par type.
+// Elles sont enregistrées avec ses autres réglages dans la table users (colonnes notify_*)
+// et sont toutes activées par défaut
+type NotificationSettings struct {
+	PostLiked          bool `json:"postLiked" gorm:"default:true"`
+	NewComment         bool `json:"newComment" gorm:"default:true"`
+	CommentReply       bool `json:"commentReply" gorm:"default:true"`
+	NewFollower        bool `json:"newFollower" gorm:"default:true"`
+	NewSubscriber      bool `json:"newSubscriber" gorm:"default:true"`
+	TipReceived        bool `json:"tipReceived" gorm:"default:true"`
+	PaymentFailed      bool `json:"paymentFailed" gorm:"default:true"`
+	CreatorApplication bool `json:"creatorApplication" gorm:"default:true"`
+	ReportOutcome      bool `json:"reportOutcome" gorm:"default:true"`
+	// Email récapitulatif de l'activité, désactivé par défaut
+	DigestFrequency DigestFrequency `json:"digestFrequency" gorm:"type:varchar(10);default:'none';index"`
+	DigestSentAt    *time.Time      `json:"-"`
+}
+
+// Enabled indique si l'utilisateur souhaite recevoir ce type de notification
+func (s NotificationSettings) Enabled(notificationType NotificationType) bool {
+	switch notificationType {
+	case NotificationPostLiked:
+		return s.PostLiked
+	case NotificationNewComment:
+		return s.NewComment
+	case NotificationCommentReply:
+		return s.CommentReply
+	case NotificationNewFollower, NotificationFollowRequest, NotificationFollowAccepted:
+		return s.NewFollower
+	case NotificationNewSubscriber:
+		return s.NewSubscriber
+	case NotificationTipReceived:
+		return s.TipReceived
+	case NotificationPaymentFailed:
+		return s.PaymentFailed
+	case NotificationCreatorApplication:
+		return s.CreatorApplication
+	case NotificationReportOutcome:
+		return s.ReportOutcome
+	}
+	return true
+}
+
+// NotificationSettingsUpdate permet de modifier une partie des préférences
+type NotificationSettingsUpdate struct {
+	PostLiked          *bool `json:"postLiked"`
+	NewComment         *bool `json:"newComment"`
+	CommentReply       *bool `json:"commentReply"`
+	NewFollower        *bool `json:"newFollower"`
+	NewSubscriber      *bool `json:"newSubscriber"`
+	TipReceived        *bool `json:"tipReceived"`
+	PaymentFailed      *bool `json:"paymentFailed"`
+	CreatorApplication *bool `json:"creatorApplication"`
+	ReportOutcome      *bool `json:"reportOutcome"`
+	// none, daily ou weekly
+	DigestFrequency *DigestFrequency `json:"digestFrequency" binding:"omitempty,oneof=none daily weekly"`
+}
+
+// Apply applique les champs fournis sur les préférences
+func (u NotificationSettingsUpdate) Apply(s *NotificationSettings) {
+	fields := []struct {
+		value  *bool
+		target *bool
+	}{
+		{u.PostLiked, &s.PostLiked},
+		{u.NewComment, &s.NewComment},
+		{u.CommentReply, &s.CommentReply},
+		{u.NewFollower, &s.NewFollower},
+		{u.NewSubscriber, &s.NewSubscriber},
+		{u.TipReceived, &s.TipReceived},
+		{u.PaymentFailed, &s.PaymentFailed},
+		{u.CreatorApplication, &s.CreatorApplication},
+		{u.ReportOutcome, &s.ReportOutcome},
+	}
+	for _, field := range fields {
+		if field.value != nil {
+			*field.target = *field.value
+		}
+	}
+	if u.DigestFrequency != nil {
+		s.DigestFrequency = *u.DigestFrequency
+	}
+}
+
+// NotificationActorResponse est l'acteur affiché dans une notification
+type NotificationActorResponse struct {
+	ID             string `json:"id"`
+	UserName       string `json:"userName"`
+	ProfilePicture string `json:"profilePicture"`
+}
+
+// NotificationResponse est une notification prête à afficher
+type NotificationResponse struct {
+	Notification
+	Actor   *NotificationActorResponse `json:"actor"`
+	Message string                     `json:"message"`
+	Read    bool                       `json:"read"`
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+)
+
+// Montant minimal transféré au compte Stripe Connect d'un créateur (en centimes)
+const MinTransferAmount = 1000
+
+type CreatorTransferStatus string
+
+const (
+	CreatorTransferPending   CreatorTransferStatus = "pending"
+	CreatorTransferSucceeded CreatorTransferStatus = "succeeded"
+	CreatorTransferFailed    CreatorTransferStatus = "failed"
+	CreatorTransferReversed  CreatorTransferStatus = "reversed"
+)
+
+// CreatorTransfer est un transfert des gains d'un créateur vers son compte Stripe Connect.
+// Il est enregistré, et son montant réservé au grand livre, avant l'appel à Stripe :
+// un seul transfert en attente par créateur, et son identifiant sert de clé d'idempotence
+type CreatorTransfer struct {
+	ID               string                `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	CreatorID        string                `json:"creatorId" gorm:"type:uuid;not null;index;uniqueIndex:idx_creator_transfer_pending,where:status = 'pending'"`
+	StripeTransferID string                `json:"-" gorm:"index"`
+	Amount           int                   `json:"amount"`
+	Status           CreatorTransferStatus `json:"status" gorm:"type:varchar(20)"`
+	FailureMessage   string                `json:"failureMessage"`
+	CreatedAt        time.Time             `json:"createdAt"`
+	UpdatedAt        time.Time             `json:"updatedAt"`
+}
+
+func (CreatorTransfer) TableName() string {
+	return "creator_transfers"
+}
+
+type PayoutStatus string
+
+const (
+	PayoutPending   PayoutStatus = "pending"
+	PayoutInTransit PayoutStatus = "in_transit"
+	PayoutPaid      PayoutStatus = "paid"
+	PayoutFailed    PayoutStatus = "failed"
+	PayoutCanceled  PayoutStatus = "canceled"
+)
+
+// Payout est un versement Stripe du compte Connect d'un créateur vers son IBAN
+type Payout struct {
+	ID              string       `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	CreatorID       string       `json:"creatorId" gorm:"type:uuid;not null;index"`
+	StripePayoutID  string       `json:"-" gorm:"uniqueIndex"`
+	StripeAccountID string       `json:"-"`
+	Amount          int          `json:"amount"`
+	Currency        string       `json:"currency"`
+	Status          PayoutStatus `json:"status" gorm:"type:varchar(20)"`
+	ArrivalDate     *time.Time   `json:"arrivalDate"`
+	FailureMessage  string       `json:"failureMessage"`
+	CreatedAt       time.Time    `json:"createdAt"`
+	UpdatedAt       time.Time    `json:"updatedAt"`
+}
+
+func (Payout) TableName() string {
+	return "payouts"
+}
+
+// PayoutScheduleUpdate règle la fréquence des versements vers l'IBAN.
+// weeklyAnchor est requis pour un rythme hebdomadaire, monthlyAnchor pour un rythme mensuel
+type PayoutScheduleUpdate struct {
+	Interval      string `json:"interval" binding:"required,oneof=daily weekly monthly" example:"weekly"`
+	WeeklyAnchor  string `json:"weeklyAnchor" binding:"omitempty,oneof=monday tuesday wednesday thursday friday" example:"monday"`
+	MonthlyAnchor int    `json:"monthlyAnchor" binding:"omitempty,min=1,max=31" example:"1"`
+}
+
+// PayoutAccountStatus est l'état des versements d'un créateur
+type PayoutAccountStatus struct {
+	// Compte Connect créé et vérification commencée
+	Connected      bool           `json:"connected"`
+	PayoutsEnabled bool           `json:"payoutsEnabled"`
+	Balance        CreatorBalance `json:"balance"`
+	// Transfert minimal vers le compte Connect
+	MinTransferAmount int `json:"minTransferAmount"`
+}
@@ -5,20 +5,22 @@ import (
 )
 
 type Post struct {
-	ID          string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	UserID      string     `json:"userId" gorm:"column:user_id;type:uuid;references:ID;foreignKey:fk_posts_user"`
-	Name        string     `json:"name" binding:"required"`
-	Description string     `json:"description"`
-	PictureURL  string     `json:"pictureUrl" gorm:"column:picture_url"`
-	IsFree      bool       `json:"isFree" gorm:"default:false"`
-	Enable      bool       `json:"enable" gorm:"default:true"`
-	Categories  []Category `json:"categories" gorm:"many2many:post_categories;"`
-	Likes       []Like     `json:"likes,omitempty"`
-	Reports     []Report   `json:"reports,omitempty"`
-	User        User       `json:"user,omitempty" gorm:"foreignKey:UserID"`
-	CreatedAt   time.Time  `json:"createdAt"`
-	UpdatedAt   time.Time  `json:"updatedAt"`
-	DeletedAt   *time.Time `json:"deletedAt,omitempty" gorm:"index"`
+	ID              string        `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID          string        `json:"userId" gorm:"column:user_id;type:uuid;references:ID;foreignKey:fk_posts_user"`
+	Name            string        `json:"name" binding:"required"`
+	Description     string        `json:"description"`
+	PictureURL      string        `json:"pictureUrl" gorm:"column:picture_url"`
+	PictureVariants ImageVariants `json:"pictureVariants" gorm:"embedded;embeddedPrefix:picture_"`
+	IsFree          bool          `json:"isFree" gorm:"default:false"`
+	Enable          bool          `json:"enable" gorm:"default:true"`
+	MinTierID       *string       `json:"minTierId" gorm:"type:uuid"`
+	Categories      []Category    `json:"categories" gorm:"many2many:post_categories;"`
+	Likes           []Like        `json:"likes,omitempty"`
+	Reports         []Report      `json:"reports,omitempty"`
+	User            User          `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	CreatedAt       time.Time     `json:"createdAt"`
+	UpdatedAt       time.Time     `json:"updatedAt"`
+	DeletedAt       *time.Time    `json:"deletedAt,omitempty" gorm:"index"`
 }
 
 type MostLikedPost struct {
@@ -44,6 +46,7 @@ type PostCreate struct {
 	Name        string   `json:"name" binding:"required"`
 	Description string   `json:"description"`
 	IsFree      bool     `json:"isFree"`
+	MinTierID   *string  `json:"minTierId"`
 	PictureURL  string   `json:"pictureUrl"`
 	Categories  []string `json:"categories"`
 }
@@ -54,31 +57,36 @@ type PostUpdate struct {
 	IsFree      bool     `json:"isFree"`
 	Categories  []string `json:"categories"`
 	Enable      *bool    `json:"enable"`
+	MinTierID   *string  `json:"minTierId"`
 }
 
 type PostResponse struct {
-	ID             string     `json:"id"`
-	Name           string     `json:"name"`
-	Description    string     `json:"description"`
-	PictureURL     string     `json:"pictureUrl"`
-	IsFree         bool       `json:"isFree"`
-	Enable         bool       `json:"enable"`
-	Categories     []Category `json:"categories"`
-	CreatedAt      time.Time  `json:"createdAt"`
-	UpdatedAt      time.Time  `json:"updatedAt"`
-	User           UserInfo   `json:"user"`
-	LikesCount     int        `json:"likesCount"`
-	CommentsCount  int        `json:"commentsCount"`
-	ReportsCount   int        `json:"reportsCount"`
-	CommentEnabled bool       `json:"commentEnabled"`
-	MessageEnabled bool       `json:"messageEnabled"`
-	IsLikedByUser  bool       `json:"isLikedByUser"`
+	ID              string        `json:"id"`
+	Name            string        `json:"name"`
+	Description     string        `json:"description"`
+	PictureURL      string        `json:"pictureUrl"`
+	PictureVariants ImageVariants `json:"pictureVariants"`
+	IsFree          bool          `json:"isFree"`
+	Enable          bool          `json:"enable"`
+	MinTierID       *string       `json:"minTierId"`
+	Categories      []Category    `json:"categories"`
+	CreatedAt       time.Time     `json:"createdAt"`
+	UpdatedAt       time.Time     `json:"updatedAt"`
+	User            UserInfo      `json:"user"`
+	LikesCount      int           `json:"likesCount"`
+	CommentsCount   int           `json:"commentsCount"`
+	ReportsCount    int           `json:"reportsCount"`
+	CommentEnabled  bool          `json:"commentEnabled"`
+	MessageEnabled  bool          `json:"messageEnabled"`
+	IsLikedByUser   bool          `json:"isLikedByUser"`
+	Locked          bool          `json:"locked"`
 }
 
 type UserInfo struct {
-	ID             string `json:"id"`
-	UserName       string `json:"userName"`
-	ProfilePicture string `json:"profilePicture"`
+	ID                     string        `json:"id"`
+	UserName               string        `json:"userName"`
+	ProfilePicture         string        `json:"profilePicture"`
+	ProfilePictureVariants ImageVariants `json:"profilePictureVariants"`
 }
 
 func (Post) TableName() string {
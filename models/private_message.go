@@ -16,14 +16,17 @@ const (
 
 // PrivateMessage represents a message sent between two users
 type PrivateMessage struct {
-	ID         string            `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	SenderID   string            `json:"senderId" gorm:"column:sender_id"`
-	ReceiverID string            `json:"receiverId" gorm:"column:receiver_id"`
-	Content    string            `json:"content" binding:"required"`
-	Status     MessageStatusType `json:"status" gorm:"default:UNREAD"`
-	CreatedAt  time.Time         `json:"createdAt"`
-	UpdatedAt  time.Time         `json:"updatedAt"`
-	DeletedAt  *time.Time        `json:"deletedAt,omitempty" gorm:"index"`
+	ID             string            `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ConversationID *string           `json:"conversationId" gorm:"type:uuid;index"`
+	SenderID       string            `json:"senderId" gorm:"column:sender_id"`
+	ReceiverID     string            `json:"receiverId" gorm:"column:receiver_id"`
+	Content        string            `json:"content" binding:"required"`
+	Status         MessageStatusType `json:"status" gorm:"default:UNREAD"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	UpdatedAt      time.Time         `json:"updatedAt"`
+	DeletedAt      *time.Time        `json:"deletedAt,omitempty" gorm:"index"`
+
+	Attachments []MessageAttachmentResponse `json:"attachments,omitempty" gorm:"-"`
 }
 
 // PrivateMessageCreate model for creating a private message
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+)
+
+type PromoCodeKind string
+
+const (
+	// Période d'essai gratuite avant le premier prélèvement
+	PromoCodeTrial PromoCodeKind = "TRIAL"
+	// Réduction en pourcentage sur les premiers mois
+	PromoCodeDiscount PromoCodeKind = "DISCOUNT"
+)
+
+// PromoCode est un code promotionnel créé par un créateur pour une campagne d'abonnement
+type PromoCode struct {
+	ID             string        `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	CreatorID      string        `json:"creatorId" gorm:"type:uuid;not null;uniqueIndex:idx_promo_code_creator"`
+	Code           string        `json:"code" gorm:"not null;uniqueIndex:idx_promo_code_creator"`
+	Kind           PromoCodeKind `json:"kind" gorm:"type:varchar(20);not null"`
+	TrialDays      int           `json:"trialDays"`
+	PercentOff     int           `json:"percentOff"`
+	DurationMonths int           `json:"durationMonths"`
+	StartsAt       *time.Time    `json:"startsAt"`
+	EndsAt         *time.Time    `json:"endsAt"`
+	MaxRedemptions int           `json:"maxRedemptions"`
+	Redemptions    int           `json:"redemptions" gorm:"default:0"`
+	FirstTimeOnly  bool          `json:"firstTimeOnly" gorm:"default:false"`
+	Active         bool          `json:"active" gorm:"default:true"`
+	StripeCouponID string        `json:"-"`
+	CreatedAt      time.Time     `json:"createdAt"`
+	UpdatedAt      time.Time     `json:"updatedAt"`
+}
+
+func (PromoCode) TableName() string {
+	return "promo_codes"
+}
+
+// PromoCodeCreate permet à un créateur de lancer une campagne.
+// Un essai utilise trialDays, une réduction percentOff sur durationMonths mois ; maxRedemptions à 0 signifie sans limite
+type PromoCodeCreate struct {
+	Code           string        `json:"code" binding:"required,alphanum,max=32" example:"SUMMER50"`
+	Kind           PromoCodeKind `json:"kind" binding:"required,oneof=TRIAL DISCOUNT" example:"DISCOUNT"`
+	TrialDays      int           `json:"trialDays" binding:"omitempty,min=1,max=90" example:"7"`
+	PercentOff     int           `json:"percentOff" binding:"omitempty,min=1,max=100" example:"50"`
+	DurationMonths int           `json:"durationMonths" binding:"omitempty,min=1,max=12" example:"1"`
+	StartsAt       *time.Time    `json:"startsAt"`
+	EndsAt         *time.Time    `json:"endsAt"`
+	MaxRedemptions int           `json:"maxRedemptions" binding:"omitempty,min=1" example:"100"`
+	FirstTimeOnly  bool          `json:"firstTimeOnly"`
+}
+
+// PromoCodeReport résume les résultats d'une campagne
+type PromoCodeReport struct {
+	PromoCode PromoCode `json:"promoCode"`
+	// Abonnements souscrits avec le code
+	Subscriptions int `json:"subscriptions"`
+	// Abonnements restés après l'essai ou la réduction : au moins un paiement plein tarif
+	Converted      int     `json:"converted"`
+	ConversionRate float64 `json:"conversionRate"`
+	StillActive    int     `json:"stillActive"`
+	Revenue        int     `json:"revenue"`
+	DiscountGiven  int     `json:"discountGiven"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+type StripeEventStatus string
+
+const (
+	// Enregistré, pas encore traité
+	StripeEventReceived   StripeEventStatus = "RECEIVED"
+	StripeEventProcessing StripeEventStatus = "PROCESSING"
+	StripeEventProcessed  StripeEventStatus = "PROCESSED"
+	// Échec du traitement : l'évènement est rejoué à NextAttemptAt, s'il reste des tentatives
+	StripeEventFailed StripeEventStatus = "FAILED"
+)
+
+// StripeEvent est un évènement reçu sur le webhook Stripe. Son identifiant est celui de Stripe,
+// ce qui rend le traitement idempotent quand Stripe livre plusieurs fois le même évènement
+type StripeEvent struct {
+	ID   string `json:"id" gorm:"primaryKey"`
+	Type string `json:"type" gorm:"index"`
+	// Compte connecté d'un créateur, vide pour les évènements du compte de la plateforme
+	Account       string            `json:"account"`
+	Payload       string            `json:"payload,omitempty" gorm:"type:jsonb"`
+	Status        StripeEventStatus `json:"status" gorm:"type:varchar(20);index;default:'RECEIVED'"`
+	Attempts      int               `json:"attempts" gorm:"default:0"`
+	LastError     string            `json:"lastError" gorm:"type:text"`
+	Result        string            `json:"result"`
+	NextAttemptAt *time.Time        `json:"nextAttemptAt" gorm:"index"`
+	ProcessedAt   *time.Time        `json:"processedAt"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+}
+
+func (StripeEvent) TableName() string {
+	return "stripe_events"
+}
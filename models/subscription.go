@@ -12,6 +12,13 @@ const (
 	SubscriptionPending  SubscriptionStatus = "PENDING"
 )
 
+// Bornes du prix mensuel d'un abonnement (en centimes). Le prix par défaut est l'ancien prix unique de la plateforme
+const (
+	MinSubscriptionPrice     = 300
+	MaxSubscriptionPrice     = 5000
+	DefaultSubscriptionPrice = 700
+)
+
 type Subscription struct {
 	ID                   string             `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
 	UserID               string             `json:"userId" gorm:"column:user_id;type:uuid;references:ID;foreignKey:fk_subscription"`
@@ -19,8 +26,20 @@ type Subscription struct {
 	ContentCreatorID     string             `json:"contentCreatorId" gorm:"type:uuid;not null"`
 	Status               SubscriptionStatus `json:"status" gorm:"type:varchar(20);default:'PENDING'"`
 	StripeSubscriptionId string             `json:"stripeSubscriptionId"`
-	StartDate            time.Time          `json:"startDate"`
-	EndDate              *time.Time         `json:"endDate"`
-	CreatedAt            time.Time          `json:"createdAt"`
-	UpdatedAt            time.Time          `json:"updatedAt"`
+	// Prix mensuel payé par l'abonné, figé à la souscription : un changement de prix du créateur ne s'applique qu'aux nouveaux abonnés
+	Price int `json:"price" gorm:"default:700"`
+	// Niveau souscrit, nil pour l'abonnement de base
+	TierID    *string    `json:"tierId" gorm:"type:uuid"`
+	StartDate time.Time  `json:"startDate"`
+	EndDate   *time.Time `json:"endDate"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	// Code promo utilisé à la souscription, pour le rapport de conversion de la campagne
+	PromoCodeID *string `json:"promoCodeId" gorm:"type:uuid"`
+}
+
+// SubscriptionPriceUpdate permet au créateur de changer le prix de son abonnement
+type SubscriptionPriceUpdate struct {
+	// Prix mensuel en centimes
+	Price int `json:"price" binding:"required" example:"900"`
 }
@@ -13,6 +13,9 @@ type SubscriptionPayment struct {
 	Status                SubscriptionPaymentStatus `json:"status"`
 	CreatedAt             time.Time                 `json:"createdAt"`
 	UpdatedAt             time.Time                 `json:"updatedAt"`
+	// Code promo appliqué au paiement et montant de la réduction (en centimes)
+	PromoCodeID    *string `json:"promoCodeId" gorm:"type:uuid"`
+	DiscountAmount int     `json:"discountAmount" gorm:"default:0"`
 }
 
 type SubscriptionPaymentStatus string
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// SubscriptionTier est un niveau d'abonnement d'un créateur (Basic, Premium, VIP...).
+// Un post réservé à un niveau est visible des abonnés de ce niveau ou d'un niveau de rang supérieur ;
+// l'abonnement de base au prix du créateur (sans niveau) a le rang 0
+type SubscriptionTier struct {
+	ID          string `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	CreatorID   string `json:"creatorId" gorm:"type:uuid;not null;index"`
+	Name        string `json:"name" gorm:"not null"`
+	Description string `json:"description" gorm:"type:text"`
+	// Prix mensuel en centimes
+	Price         int    `json:"price"`
+	Rank          int    `json:"rank"`
+	StripePriceID string `json:"-"`
+	// Un niveau archivé n'est plus proposé, ses abonnés le gardent
+	Archived  bool      `json:"archived" gorm:"default:false"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (SubscriptionTier) TableName() string {
+	return "subscription_tiers"
+}
+
+// SubscriptionTierCreate permet à un créateur d'ajouter un niveau d'abonnement
+type SubscriptionTierCreate struct {
+	Name        string `json:"name" binding:"required" example:"Premium"`
+	Description string `json:"description" example:"Accès aux lives et aux posts Premium"`
+	Price       int    `json:"price" binding:"required" example:"1500"`
+	// Rang du niveau, unique parmi les niveaux du créateur (1 = le plus bas)
+	Rank int `json:"rank" binding:"required,min=1" example:"2"`
+}
+
+// SubscriptionTierUpdate permet de modifier une partie d'un niveau ; un nouveau prix ne s'applique qu'aux nouveaux abonnés
+type SubscriptionTierUpdate struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Price       *int    `json:"price"`
+}
+
+// SubscriptionTierChange permet à un abonné de changer de niveau ; sans tierId il revient à l'abonnement de base
+type SubscriptionTierChange struct {
+	TierID *string `json:"tierId"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// CreatorSuggestion est un créateur suggéré à un utilisateur, précalculé par le job de suggestions
+type CreatorSuggestion struct {
+	UserID    string  `json:"-" gorm:"primaryKey;type:uuid"`
+	CreatorID string  `json:"creatorId" gorm:"primaryKey;type:uuid"`
+	Score     float64 `json:"score"`
+	// Nombre de personnes suivies par l'utilisateur qui suivent ce créateur
+	MutualFollowers int       `json:"mutualFollowers"`
+	Followers       int       `json:"followers"`
+	ComputedAt      time.Time `json:"computedAt" gorm:"index"`
+}
+
+func (CreatorSuggestion) TableName() string {
+	return "creator_suggestions"
+}
+
+// CreatorSuggestionResponse est une suggestion prête à afficher
+type CreatorSuggestionResponse struct {
+	Creator         UserInfo `json:"creator"`
+	Bio             string   `json:"bio"`
+	Score           float64  `json:"score"`
+	MutualFollowers int      `json:"mutualFollowers"`
+	Followers       int      `json:"followers"`
+}
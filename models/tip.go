@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+// Bornes d'un pourboire libre (en centimes)
+const (
+	MinTipAmount = 100
+	MaxTipAmount = 50000
+)
+
+// TipPresetAmounts sont les montants proposés par défaut dans l'interface (en centimes)
+var TipPresetAmounts = []int{200, 500, 1000, 2000}
+
+type TipContext string
+
+const (
+	TipOnPost    TipContext = "POST"
+	TipOnProfile TipContext = "PROFILE"
+	TipInMessage TipContext = "MESSAGE"
+)
+
+type TipStatus string
+
+const (
+	TipPending   TipStatus = "PENDING"
+	TipSucceeded TipStatus = "SUCCEEDED"
+)
+
+// Tip est un pourboire ponctuel d'un fan à un créateur, depuis un post, son profil ou une conversation
+type Tip struct {
+	ID                    string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	SenderID              string     `json:"senderId" gorm:"type:uuid;not null;index"`
+	CreatorID             string     `json:"creatorId" gorm:"type:uuid;not null;index"`
+	Context               TipContext `json:"context" gorm:"type:varchar(10);not null"`
+	PostID                *string    `json:"postId" gorm:"type:uuid"`
+	Amount                int        `json:"amount"`
+	Message               string     `json:"message" gorm:"type:text"`
+	Status                TipStatus  `json:"status" gorm:"type:varchar(20);default:'PENDING'"`
+	StripeSessionID       string     `json:"-" gorm:"index"`
+	StripePaymentIntentID string     `json:"-"`
+	PaidAt                *time.Time `json:"paidAt"`
+	CreatedAt             time.Time  `json:"createdAt"`
+	UpdatedAt             time.Time  `json:"updatedAt"`
+}
+
+func (Tip) TableName() string {
+	return "tips"
+}
+
+// TipCreate est la demande de pourboire d'un fan ; postId est requis pour un pourboire sur un post
+type TipCreate struct {
+	Amount  int        `json:"amount" binding:"required" example:"500"`
+	Message string     `json:"message" binding:"max=280" example:"Merci pour ce post !"`
+	Context TipContext `json:"context" binding:"required,oneof=POST PROFILE MESSAGE" example:"POST"`
+	PostID  *string    `json:"postId"`
+}
+
+// TipResponse est un pourboire reçu tel que le voit le créateur
+type TipResponse struct {
+	ID      string     `json:"id"`
+	Sender  UserInfo   `json:"sender"`
+	Context TipContext `json:"context"`
+	PostID  *string    `json:"postId"`
+	Amount  int        `json:"amount"`
+	Message string     `json:"message"`
+	PaidAt  *time.Time `json:"paidAt"`
+}
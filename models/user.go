@@ -19,23 +19,46 @@ const (
 	Other  Sexe = "OTHER"
 )
 
+// DirectMessages définit qui peut écrire directement à un créateur ; les autres messages arrivent dans ses demandes
+type DirectMessages string
+
+const (
+	DirectMessagesEveryone DirectMessages = "everyone"
+	// Personnes suivies et abonnés (par défaut)
+	DirectMessagesSubscribers DirectMessages = "subscribers"
+	// Personnes suivies uniquement
+	DirectMessagesFollowing DirectMessages = "following"
+)
+
 type User struct {
-	ID                   string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	Email                string     `json:"email" binding:"required,email" gorm:"uniqueIndex"`
-	Password             string     `json:"password" binding:"required,min=6"`
-	UserName             string     `json:"userName" binding:"required" gorm:"uniqueIndex"`
-	FirstName            string     `json:"firstName" binding:"required"`
-	LastName             string     `json:"lastName" binding:"required"`
-	BirthDayDate         time.Time  `json:"birthDayDate" binding:"required"`
-	Sexe                 Sexe       `json:"sexe" binding:"required"`
-	Role                 Role       `json:"role"`
-	Bio                  string     `json:"bio"`
-	ProfilePicture       string     `json:"profilePicture"`
-	StripeCustomerId     string     `json:"stripeCustomerId"`
-	Enable               bool       `json:"enable"`
-	SubscriptionEnable   bool       `json:"subscriptionEnable"`
-	CommentsEnable       bool       `json:"commentsEnable"`
-	MessageEnable        bool       `json:"messageEnable"`
+	ID                     string        `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Email                  string        `json:"email" binding:"required,email" gorm:"uniqueIndex"`
+	Password               string        `json:"password" binding:"required,min=6"`
+	UserName               string        `json:"userName" binding:"required" gorm:"uniqueIndex"`
+	FirstName              string        `json:"firstName" binding:"required"`
+	LastName               string        `json:"lastName" binding:"required"`
+	BirthDayDate           time.Time     `json:"birthDayDate" binding:"required"`
+	Sexe                   Sexe          `json:"sexe" binding:"required"`
+	Role                   Role          `json:"role"`
+	Bio                    string        `json:"bio"`
+	ProfilePicture         string        `json:"profilePicture"`
+	ProfilePictureVariants ImageVariants `json:"profilePictureVariants" gorm:"embedded;embeddedPrefix:profile_picture_"`
+	StripeCustomerId       string        `json:"stripeCustomerId"`
+	// Prix mensuel de l'abonnement en centimes, choisi par le créateur
+	SubscriptionPrice int `json:"subscriptionPrice" gorm:"default:700"`
+	// Produit et prix Stripe actifs du créateur, créés au premier abonnement ou changement de prix
+	StripeProductID    string         `json:"-"`
+	StripePriceID      string         `json:"-"`
+	Enable             bool           `json:"enable"`
+	SubscriptionEnable bool           `json:"subscriptionEnable"`
+	CommentsEnable     bool           `json:"commentsEnable"`
+	MessageEnable      bool           `json:"messageEnable"`
+	DirectMessages     DirectMessages `json:"directMessages" gorm:"type:varchar(20);default:'subscribers'"`
+	// Compte Stripe Connect du créateur, qui reçoit ses gains et les verse sur son IBAN
+	StripeAccountID string `json:"-"`
+	PayoutsEnabled  bool   `json:"payoutsEnabled" gorm:"default:false"`
+	// Profil privé : les follows doivent être acceptés, le profil et les posts sont réservés aux followers
+	PrivateProfile       bool       `json:"privateProfile" gorm:"default:false"`
 	EmailVerifiedAt      *time.Time `json:"emailVerifiedAt"`
 	Siret                string     `json:"siret"`
 	CreatedAt            time.Time  `json:"createdAt"`
@@ -45,22 +68,26 @@ type User struct {
 	ConfirmationCodeEnd  time.Time  `json:"ConfirmationCodeEnd"`
 	ResetPasswordCode    string     `json:"resetPasswordCode"`
 	ResetPasswordCodeEnd time.Time  `json:"resetPasswordCodeEnd"`
+
+	// Préférences de notifications, enregistrées avec les autres réglages et exposées par /user-settings
+	NotificationSettings NotificationSettings `json:"-" gorm:"embedded;embeddedPrefix:notify_"`
 }
 
 type UserLogin struct {
-	ID                 string    `json:"id"`
-	Email              string    `json:"email"`
-	UserName           string    `json:"userName"`
-	Role               Role      `json:"role"`
-	Bio                string    `json:"bio"`
-	ProfilePicture     string    `json:"profilePicture"`
-	FirstName          string    `json:"firstName"`
-	LastName           string    `json:"lastName"`
-	BirthDayDate       time.Time `json:"birthDayDate"`
-	Sexe               Sexe      `json:"sexe"`
-	CommentsEnable     bool      `json:"commentsEnable"`
-	MessageEnable      bool      `json:"messageEnable"`
-	SubscriptionEnable bool      `json:"subscriptionEnable"`
+	ID                     string        `json:"id"`
+	Email                  string        `json:"email"`
+	UserName               string        `json:"userName"`
+	Role                   Role          `json:"role"`
+	Bio                    string        `json:"bio"`
+	ProfilePicture         string        `json:"profilePicture"`
+	ProfilePictureVariants ImageVariants `json:"profilePictureVariants"`
+	FirstName              string        `json:"firstName"`
+	LastName               string        `json:"lastName"`
+	BirthDayDate           time.Time     `json:"birthDayDate"`
+	Sexe                   Sexe          `json:"sexe"`
+	CommentsEnable         bool          `json:"commentsEnable"`
+	MessageEnable          bool          `json:"messageEnable"`
+	SubscriptionEnable     bool          `json:"subscriptionEnable"`
 }
 
 func (User) TableName() string {
@@ -113,6 +140,29 @@ type UserFollow struct {
 	CreatedAt  time.Time `gorm:"autoCreateTime" json:"createdAt"`
 }
 
+// UserBlock empêche toute interaction entre deux utilisateurs (messages, commentaires, follow, abonnement, posts)
+type UserBlock struct {
+	ID        string    `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	BlockerID string    `gorm:"type:uuid;not null;uniqueIndex:idx_user_block" json:"blockerId"`
+	BlockedID string    `gorm:"type:uuid;not null;uniqueIndex:idx_user_block;index" json:"blockedId"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// FollowRequest est une demande de follow en attente vers un profil privé ; elle devient un UserFollow une fois acceptée
+type FollowRequest struct {
+	ID         string    `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	FollowerID string    `gorm:"type:uuid;not null;uniqueIndex:idx_follow_request" json:"followerId"`
+	FollowedID string    `gorm:"type:uuid;not null;uniqueIndex:idx_follow_request;index" json:"followedId"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// FollowRequestResponse est une demande de follow reçue, avec son auteur
+type FollowRequestResponse struct {
+	ID        string    `json:"id"`
+	Follower  UserInfo  `json:"follower"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
 type StatisticsUsers struct {
 	Subscribers []User
 }
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"pec2-backend/handlers/broadcasts"
+	"pec2-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func BroadcastsRoutes(r *gin.Engine) {
+	broadcastsRoutes := r.Group("/broadcasts")
+	broadcastsRoutes.Use(middleware.JWTAuth())
+	{
+		broadcastsRoutes.POST("", broadcasts.CreateBroadcast)
+		broadcastsRoutes.GET("", broadcasts.GetBroadcasts)
+		broadcastsRoutes.GET("/:id", broadcasts.GetBroadcast)
+		broadcastsRoutes.POST("/:id/cancel", broadcasts.CancelBroadcast)
+	}
+}
@@ -14,6 +14,7 @@ func ContentCreatorsRoutes(r *gin.Engine) {
 		// Routes publiques (accessibles à tous les utilisateurs authentifiés)
 		contentCreatorRoutes.POST("", content_creators.Apply)
 		contentCreatorRoutes.PUT("", content_creators.UpdateContentCreatorInfo)
+		contentCreatorRoutes.GET("/suggestions", content_creators.GetSuggestedCreators)
 
 		// Routes admin
 		contentCreatorRoutes.GET("/all", middleware.AdminAuth(), content_creators.GetAllContentCreators)
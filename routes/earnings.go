@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"pec2-backend/handlers/stripe"
+	"pec2-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func EarningsRoutes(r *gin.Engine) {
+	earningsRoutes := r.Group("/earnings")
+	earningsRoutes.Use(middleware.JWTAuth())
+	{
+		earningsRoutes.GET("/balance", stripe.GetEarningsBalance)
+		earningsRoutes.GET("/transactions", stripe.GetEarningsTransactions)
+
+		// Routes admin
+		earningsRoutes.GET("/reconciliation", middleware.AdminAuth(), stripe.GetLedgerReconciliation)
+	}
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"pec2-backend/handlers/media"
+	"pec2-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func MediaRoutes(r *gin.Engine) {
+	// Les balises <img> n'envoient pas de header : l'accès se fait par URL signée ou token dans l'URL
+	mediaRoutes := r.Group("/media")
+	mediaRoutes.Use(middleware.OptionalJWTAuth())
+	{
+		mediaRoutes.GET("/posts/:id", media.GetPostMedia)
+		mediaRoutes.GET("/messages/:id", media.GetMessageAttachmentMedia)
+	}
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"pec2-backend/handlers/notifications"
+	"pec2-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func NotificationsRoutes(r *gin.Engine) {
+	// Lien signé des emails récapitulatifs, sans authentification
+	r.GET("/notifications/digest/unsubscribe", notifications.UnsubscribeFromDigest)
+	r.POST("/notifications/digest/unsubscribe", notifications.UnsubscribeFromDigest)
+
+	notificationsRoutes := r.Group("/notifications")
+	notificationsRoutes.Use(middleware.JWTAuth())
+	{
+		notificationsRoutes.GET("", notifications.GetNotifications)
+		notificationsRoutes.GET("/unread-count", notifications.GetUnreadCount)
+		notificationsRoutes.PATCH("/read-all", notifications.MarkAllAsRead)
+		notificationsRoutes.PATCH("/:id/read", notifications.MarkAsRead)
+	}
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"pec2-backend/handlers/stripe"
+	"pec2-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PayoutsRoutes(r *gin.Engine) {
+	payoutRoutes := r.Group("/payouts")
+	payoutRoutes.Use(middleware.JWTAuth())
+	{
+		payoutRoutes.GET("", stripe.GetPayouts)
+		payoutRoutes.POST("/account", stripe.CreatePayoutAccount)
+		payoutRoutes.GET("/account", stripe.GetPayoutAccount)
+		payoutRoutes.PUT("/schedule", stripe.UpdatePayoutSchedule)
+	}
+}
@@ -12,7 +12,7 @@ import (
 
 func PostsRoutes(r *gin.Engine) { // Routes publiques
 	// r.GET("/posts", posts.GetAllPosts)
-	r.GET("/posts/:id", posts.GetPostByID)
+	r.GET("/posts/:id", middleware.OptionalJWTAuth(), posts.GetPostByID)
 	// J'ai pas trouvé la solution pour faire la vérification avec le middleware
 	// J'ai l'impression qu'en SSE on peut pas envoyer de token dans le header
 	// Du coup middleware = useless
@@ -26,6 +26,10 @@ func PostsRoutes(r *gin.Engine) { // Routes publiques
 		// postsRoutes.GET("/:id", posts.GetPostByID)
 		postsRoutes.POST("/:id/comments", comment.CreateComment)
 		postsRoutes.GET("/:id/comments", comment.GetCommentsByPostID)
+		postsRoutes.GET("/:id/comments/:commentId/replies", comment.GetCommentReplies)
+		postsRoutes.PUT("/:id/comments/:commentId", comment.UpdateComment)
+		postsRoutes.DELETE("/:id/comments/:commentId", comment.DeleteComment)
+		postsRoutes.PATCH("/:id/comments/:commentId/hide", comment.HideComment)
 		postsRoutes.POST("", posts.CreatePost)
 		postsRoutes.PUT("/:id", posts.UpdatePost)
 		postsRoutes.DELETE("/:id", posts.DeletePost)
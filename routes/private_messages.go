@@ -2,6 +2,7 @@ package routes
 
 import (
 	"pec2-backend/handlers/privateMessages"
+	"pec2-backend/handlers/stripe"
 	"pec2-backend/middleware"
 
 	"github.com/gin-gonic/gin"
@@ -16,5 +17,21 @@ func PrivateMessagesRoutes(r *gin.Engine) {
 		privateMessagesGroup.GET("/received", privateMessages.GetReceivedMessages)
 		privateMessagesGroup.GET("/sent", privateMessages.GetSentMessages)
 		privateMessagesGroup.PATCH("/:id/read", privateMessages.MarkMessageAsRead)
+		privateMessagesGroup.POST("/attachments", privateMessages.CreatePrivateMessageWithAttachment)
+		privateMessagesGroup.POST("/attachments/:id/unlock", stripe.CreateMessageUnlockCheckoutSession)
+
+		privateMessagesGroup.GET("/conversations", privateMessages.GetConversations)
+		privateMessagesGroup.GET("/conversations/:id/messages", privateMessages.GetConversationMessages)
+		privateMessagesGroup.PATCH("/conversations/:id/read", privateMessages.MarkConversationAsRead)
+		privateMessagesGroup.PATCH("/conversations/:id/archive", privateMessages.ArchiveConversation)
+		privateMessagesGroup.DELETE("/conversations/:id", privateMessages.DeleteConversation)
+
+		privateMessagesGroup.GET("/requests", privateMessages.GetMessageRequests)
+		privateMessagesGroup.POST("/requests/:id/accept", privateMessages.AcceptMessageRequest)
+		privateMessagesGroup.POST("/requests/:id/decline", privateMessages.DeclineMessageRequest)
+		privateMessagesGroup.POST("/requests/:id/block", privateMessages.BlockMessageRequest)
 	}
+
+	// Les WebSockets du navigateur ne peuvent pas envoyer de header : token accepté en paramètre
+	r.GET("/private-messages/ws", middleware.JWTAuthWithQueryToken(), privateMessages.MessagesWebSocket)
 }
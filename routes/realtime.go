@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"pec2-backend/handlers/realtime"
+	"pec2-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RealtimeRoutes(r *gin.Engine) {
+	realtimeRoutes := r.Group("/realtime")
+	realtimeRoutes.Use(middleware.JWTAuth(), middleware.AdminAuth())
+	{
+		realtimeRoutes.GET("/metrics", realtime.GetMetrics)
+	}
+
+	r.GET("/events", middleware.JWTAuthWithQueryToken(), realtime.StreamUserEvents)
+}
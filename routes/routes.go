@@ -34,6 +34,13 @@ func SetupRouter() *gin.Engine {
 	StripeRoutes(r)
 	UserSettingsRoutes(r)
 	LikesRoutes(r)
+	MediaRoutes(r)
+	RealtimeRoutes(r)
+	NotificationsRoutes(r)
+	BroadcastsRoutes(r)
+	TipsRoutes(r)
+	EarningsRoutes(r)
+	PayoutsRoutes(r)
 
 	return r
 }
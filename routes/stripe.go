@@ -14,9 +14,27 @@ func StripeRoutes(r *gin.Engine) {
 		subscriptionRoutes.POST("/checkout/:contentCreatorId", stripe.CreateSubscriptionCheckoutSession)
 		subscriptionRoutes.DELETE("/:creatorId", stripe.CancelSubscription)
 		subscriptionRoutes.GET("/user", stripe.GetUserSubscriptions)
+		subscriptionRoutes.PUT("/price", stripe.UpdateSubscriptionPrice)
+		subscriptionRoutes.POST("/tiers", stripe.CreateSubscriptionTier)
+		subscriptionRoutes.GET("/tiers/:creatorId", stripe.GetSubscriptionTiers)
+		subscriptionRoutes.PUT("/tiers/:id", stripe.UpdateSubscriptionTier)
+		subscriptionRoutes.DELETE("/tiers/:id", stripe.DeleteSubscriptionTier)
+		subscriptionRoutes.PUT("/:creatorId/tier", stripe.ChangeSubscriptionTier)
+		subscriptionRoutes.POST("/promo-codes", stripe.CreatePromoCode)
+		subscriptionRoutes.GET("/promo-codes", stripe.GetPromoCodes)
+		subscriptionRoutes.GET("/promo-codes/report", stripe.GetPromoCodesReport)
+		subscriptionRoutes.DELETE("/promo-codes/:id", stripe.DeactivatePromoCode)
 		subscriptionRoutes.GET("/:subscriptionId", stripe.GetSubscriptionDetail)
 		subscriptionRoutes.GET("/revenue", middleware.AdminAuth(), stripe.GetTotalRevenue)
 		subscriptionRoutes.GET("/top-creators", middleware.AdminAuth(), stripe.GetTopContentCreators)
 	}
 	r.POST("/stripe/webhook", stripe.StripeWebhookHandler)
+
+	stripeEventRoutes := r.Group("/stripe/events")
+	stripeEventRoutes.Use(middleware.JWTAuth(), middleware.AdminAuth())
+	{
+		stripeEventRoutes.GET("", stripe.GetWebhookEvents)
+		stripeEventRoutes.GET("/:id", stripe.GetWebhookEvent)
+		stripeEventRoutes.POST("/:id/replay", stripe.ReplayWebhookEvent)
+	}
 }
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"pec2-backend/handlers/stripe"
+	"pec2-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TipsRoutes(r *gin.Engine) {
+	tipRoutes := r.Group("/tips")
+	tipRoutes.Use(middleware.JWTAuth())
+	{
+		tipRoutes.GET("/amounts", stripe.GetTipAmounts)
+		tipRoutes.GET("/received", stripe.GetReceivedTips)
+		tipRoutes.POST("/:creatorId", stripe.CreateTipCheckoutSession)
+	}
+}
@@ -31,6 +31,13 @@ func UsersRoutes(r *gin.Engine) {
 		userRoutes.GET("/:username", users.GetUserByUsername)
 		userRoutes.POST(":id/follow", users.FollowUser)
 		userRoutes.DELETE(":id/follow", users.UnfollowUser)
+		userRoutes.DELETE(":id/follow-request", users.CancelFollowRequest)
+		userRoutes.GET("/follow-requests", users.GetFollowRequests)
+		userRoutes.POST("/follow-requests/:id/approve", users.ApproveFollowRequest)
+		userRoutes.POST("/follow-requests/:id/reject", users.RejectFollowRequest)
+		userRoutes.POST(":id/block", users.BlockUser)
+		userRoutes.DELETE(":id/block", users.UnblockUser)
+		userRoutes.GET("/blocked", users.GetBlockedUsers)
 		userRoutes.GET("/followings", users.GetMyFollowings)
 		userRoutes.GET("/followers", users.GetMyFollowers)
 		userRoutes.GET("/id/:id/follow-counts", users.GetUserFollowCounts)
@@ -0,0 +1,110 @@
+package access
+
+import (
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+)
+
+// HasActiveSubscription indique si l'utilisateur a accès au contenu payant du créateur.
+// Un abonnement annulé reste valable jusqu'à sa date de fin.
+func HasActiveSubscription(userID string, creatorID string) (bool, error) {
+	if userID == "" || creatorID == "" {
+		return false, nil
+	}
+
+	var count int64
+	err := db.DB.Model(&models.Subscription{}).
+		Where("user_id = ? AND content_creator_id = ? AND (status = ? OR (status = ? AND end_date > ?))",
+			userID, creatorID, models.SubscriptionActive, models.SubscriptionCanceled, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// CanViewPost vérifie si un utilisateur peut voir le contenu (image) d'un post.
+// Un blocage dans un sens ou dans l'autre et un profil privé masquent aussi les posts gratuits
+func CanViewPost(viewerID string, role string, post models.Post) (bool, error) {
+	if viewerID != "" && viewerID == post.UserID {
+		return true, nil
+	}
+	if role == string(models.AdminRole) {
+		return true, nil
+	}
+	if !post.Enable {
+		return false, nil
+	}
+
+	blocked, err := IsBlocked(viewerID, post.UserID)
+	if err != nil || blocked {
+		return false, err
+	}
+
+	// L'auteur n'est pas toujours préchargé avec le post
+	owner := post.User
+	if owner.ID == "" {
+		if err := db.DB.Select("id", "private_profile").First(&owner, "id = ?", post.UserID).Error; err != nil {
+			return false, err
+		}
+	}
+	canSee, err := CanSeeProfile(viewerID, role, owner)
+	if err != nil || !canSee {
+		return false, err
+	}
+
+	if post.IsFree {
+		return true, nil
+	}
+	if post.MinTierID != nil {
+		return canViewTier(viewerID, post)
+	}
+
+	return HasActiveSubscription(viewerID, post.UserID)
+}
+
+// CanViewAttachment vérifie si un utilisateur peut voir une pièce jointe de message :
+// l'expéditeur toujours, le destinataire si elle est gratuite ou qu'il l'a débloquée
+func CanViewAttachment(viewerID string, role string, attachment models.MessageAttachment) (bool, error) {
+	if viewerID == "" {
+		return false, nil
+	}
+	if viewerID == attachment.SenderID || role == string(models.AdminRole) {
+		return true, nil
+	}
+	if viewerID != attachment.ReceiverID {
+		return false, nil
+	}
+	if attachment.Price == 0 {
+		return true, nil
+	}
+
+	unlocked, err := UnlockedAttachments(viewerID, []string{attachment.ID})
+	if err != nil {
+		return false, err
+	}
+	return unlocked[attachment.ID], nil
+}
+
+// UnlockedAttachments renvoie, parmi les pièces jointes données, celles que l'utilisateur a payées
+func UnlockedAttachments(userID string, attachmentIDs []string) (map[string]bool, error) {
+	unlocked := map[string]bool{}
+	if userID == "" || len(attachmentIDs) == 0 {
+		return unlocked, nil
+	}
+
+	var ids []string
+	err := db.DB.Model(&models.MessageUnlock{}).
+		Where("user_id = ? AND attachment_id IN ? AND status = ?", userID, attachmentIDs, models.MessageUnlockSucceeded).
+		Pluck("attachment_id", &ids).Error
+	if err != nil {
+		return unlocked, err
+	}
+	for _, id := range ids {
+		unlocked[id] = true
+	}
+	return unlocked, nil
+}
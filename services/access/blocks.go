@@ -0,0 +1,70 @@
+package access
+
+import (
+	"pec2-backend/db"
+	"pec2-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Block ajoute blockedID à la liste de blocage de blockerID et supprime les follows et demandes de follow entre eux
+func Block(blockerID string, blockedID string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		// Bloquer deux fois le même utilisateur n'est pas une erreur
+		block := models.UserBlock{BlockerID: blockerID, BlockedID: blockedID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&block).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("(follower_id = ? AND followed_id = ?) OR (follower_id = ? AND followed_id = ?)",
+			blockerID, blockedID, blockedID, blockerID).
+			Delete(&models.UserFollow{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("(follower_id = ? AND followed_id = ?) OR (follower_id = ? AND followed_id = ?)",
+			blockerID, blockedID, blockedID, blockerID).
+			Delete(&models.FollowRequest{}).Error
+	})
+}
+
+// HasBlocked indique si blockerID a bloqué blockedID
+func HasBlocked(blockerID string, blockedID string) (bool, error) {
+	if blockerID == "" || blockedID == "" {
+		return false, nil
+	}
+
+	var count int64
+	err := db.DB.Model(&models.UserBlock{}).
+		Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// IsBlocked indique si l'un des deux utilisateurs a bloqué l'autre : plus aucune interaction n'est possible entre eux
+func IsBlocked(userID string, otherID string) (bool, error) {
+	if userID == "" || otherID == "" {
+		return false, nil
+	}
+
+	var count int64
+	err := db.DB.Model(&models.UserBlock{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", userID, otherID, otherID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// BlockedUserIDs renvoie les utilisateurs que userID a bloqués ou qui l'ont bloqué
+func BlockedUserIDs(userID string) ([]string, error) {
+	if userID == "" {
+		return nil, nil
+	}
+
+	var blocked, blockers []string
+	if err := db.DB.Model(&models.UserBlock{}).Where("blocker_id = ?", userID).Pluck("blocked_id", &blocked).Error; err != nil {
+		return nil, err
+	}
+	if err := db.DB.Model(&models.UserBlock{}).Where("blocked_id = ?", userID).Pluck("blocker_id", &blockers).Error; err != nil {
+		return nil, err
+	}
+	return append(blocked, blockers...), nil
+}
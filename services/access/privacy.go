@@ -0,0 +1,86 @@
+package access
+
+import (
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// IsFollowing indique si followerID suit followedID
+func IsFollowing(followerID string, followedID string) (bool, error) {
+	if followerID == "" || followedID == "" {
+		return false, nil
+	}
+
+	var count int64
+	err := db.DB.Model(&models.UserFollow{}).
+		Where("follower_id = ? AND followed_id = ?", followerID, followedID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CanSeeProfile indique si viewerID peut voir le profil, les posts et les follows de owner.
+// Un profil privé n'est visible que par ses followers acceptés et ses abonnés
+func CanSeeProfile(viewerID string, role string, owner models.User) (bool, error) {
+	if !owner.PrivateProfile || viewerID == owner.ID || role == string(models.AdminRole) {
+		return true, nil
+	}
+
+	following, err := IsFollowing(viewerID, owner.ID)
+	if err != nil || following {
+		return following, err
+	}
+	return HasActiveSubscription(viewerID, owner.ID)
+}
+
+// HiddenProfilesQuery renvoie la sous-requête des profils privés que viewerID ne peut pas voir,
+// à utiliser dans un filtre "user_id NOT IN (?)"
+func HiddenProfilesQuery(viewerID string) *gorm.DB {
+	query := db.DB.Model(&models.User{}).Select("id").Where("private_profile = ?", true)
+	if viewerID == "" {
+		return query
+	}
+
+	return query.
+		Where("id <> ?", viewerID).
+		Where("id NOT IN (?)", db.DB.Model(&models.UserFollow{}).Select("followed_id").Where("follower_id = ?", viewerID)).
+		Where("id NOT IN (?)", db.DB.Model(&models.Subscription{}).Select("content_creator_id").
+			Where("user_id = ? AND (status = ? OR (status = ? AND end_date > ?))",
+				viewerID, models.SubscriptionActive, models.SubscriptionCanceled, time.Now()))
+}
+
+// ApproveFollowRequest transforme une demande de follow en follow
+func ApproveFollowRequest(request models.FollowRequest) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		follow := models.UserFollow{FollowerID: request.FollowerID, FollowedID: request.FollowedID}
+		if err := tx.Create(&follow).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&request).Error
+	})
+}
+
+// ApproveAllFollowRequests accepte toutes les demandes en attente de followedID, quand son profil repasse en public
+func ApproveAllFollowRequests(followedID string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var followerIDs []string
+		if err := tx.Model(&models.FollowRequest{}).Where("followed_id = ?", followedID).Pluck("follower_id", &followerIDs).Error; err != nil {
+			return err
+		}
+		if len(followerIDs) == 0 {
+			return nil
+		}
+
+		follows := make([]models.UserFollow, 0, len(followerIDs))
+		for _, followerID := range followerIDs {
+			follows = append(follows, models.UserFollow{FollowerID: followerID, FollowedID: followedID})
+		}
+		if err := tx.Create(&follows).Error; err != nil {
+			return err
+		}
+		return tx.Where("followed_id = ?", followedID).Delete(&models.FollowRequest{}).Error
+	})
+}
@@ -0,0 +1,104 @@
+package access
+
+import (
+	"sort"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+)
+
+// SubscriptionRanks calcule, pour chaque créateur, le rang de l'abonnement le plus élevé parmi ceux donnés :
+// 0 pour l'abonnement de base, sinon le rang du niveau souscrit
+func SubscriptionRanks(subscriptions []models.Subscription) (map[string]int, error) {
+	ranks := map[string]int{}
+	var tierIDs []string
+	for _, sub := range subscriptions {
+		if sub.TierID != nil {
+			tierIDs = append(tierIDs, *sub.TierID)
+		}
+	}
+
+	tierRanks := map[string]int{}
+	if len(tierIDs) > 0 {
+		var tiers []models.SubscriptionTier
+		if err := db.DB.Where("id IN ?", tierIDs).Find(&tiers).Error; err != nil {
+			return ranks, err
+		}
+		for _, tier := range tiers {
+			tierRanks[tier.ID] = tier.Rank
+		}
+	}
+
+	for _, sub := range subscriptions {
+		rank := 0
+		if sub.TierID != nil {
+			rank = tierRanks[*sub.TierID]
+		}
+		if current, ok := ranks[sub.ContentCreatorID]; !ok || rank > current {
+			ranks[sub.ContentCreatorID] = rank
+		}
+	}
+	return ranks, nil
+}
+
+// SubscriptionRank renvoie le rang de l'abonnement de l'utilisateur au créateur, -1 s'il n'y est pas abonné.
+// Un abonnement annulé reste valable jusqu'à sa date de fin.
+func SubscriptionRank(userID string, creatorID string) (int, error) {
+	if userID == "" || creatorID == "" {
+		return -1, nil
+	}
+
+	var subscriptions []models.Subscription
+	if err := db.DB.Where("user_id = ? AND content_creator_id = ? AND (status = ? OR (status = ? AND end_date > ?))",
+		userID, creatorID, models.SubscriptionActive, models.SubscriptionCanceled, time.Now()).
+		Find(&subscriptions).Error; err != nil {
+		return -1, err
+	}
+	if len(subscriptions) == 0 {
+		return -1, nil
+	}
+
+	ranks, err := SubscriptionRanks(subscriptions)
+	if err != nil {
+		return -1, err
+	}
+	return ranks[creatorID], nil
+}
+
+// AccessibleTierIDs renvoie les niveaux dont les posts sont visibles avec les rangs d'abonnement donnés par créateur
+func AccessibleTierIDs(ranks map[string]int) ([]string, error) {
+	if len(ranks) == 0 {
+		return nil, nil
+	}
+	creatorIDs := make([]string, 0, len(ranks))
+	for creatorID := range ranks {
+		creatorIDs = append(creatorIDs, creatorID)
+	}
+	sort.Strings(creatorIDs)
+
+	var tiers []models.SubscriptionTier
+	if err := db.DB.Where("creator_id IN ?", creatorIDs).Find(&tiers).Error; err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, tier := range tiers {
+		if tier.Rank <= ranks[tier.CreatorID] {
+			ids = append(ids, tier.ID)
+		}
+	}
+	return ids, nil
+}
+
+// canViewTier vérifie que l'abonnement de l'utilisateur atteint le niveau minimum du post
+func canViewTier(viewerID string, post models.Post) (bool, error) {
+	var tier models.SubscriptionTier
+	if err := db.DB.First(&tier, "id = ?", *post.MinTierID).Error; err != nil {
+		return false, err
+	}
+	rank, err := SubscriptionRank(viewerID, post.UserID)
+	if err != nil || rank < 0 {
+		return false, err
+	}
+	return rank >= tier.Rank, nil
+}
@@ -0,0 +1,137 @@
+package broadcasts
+
+import (
+	"errors"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/access"
+
+	"gorm.io/gorm"
+)
+
+// Taille des lots d'insertion des destinataires
+const recipientsBatchSize = 500
+
+var (
+	ErrNoRecipients  = errors.New("no recipient in this segment")
+	ErrNotCancelable = errors.New("broadcast already completed or canceled")
+	ErrMissingExpiry = errors.New("expiringWithinDays is required for the expiring segment")
+)
+
+// activeSubscriptions sélectionne les abonnements qui donnent encore accès au créateur, comme
+// access.HasActiveSubscription. Un abonnement annulé reste valable jusqu'à sa date de fin,
+// un abonnement en attente (paiement jamais abouti) ne compte pas
+func activeSubscriptions(creatorID string, now time.Time) *gorm.DB {
+	return db.DB.Model(&models.Subscription{}).
+		Where("content_creator_id = ? AND (status = ? OR (status = ? AND end_date > ?))",
+			creatorID, models.SubscriptionActive, models.SubscriptionCanceled, now)
+}
+
+// Recipients renvoie les utilisateurs du segment au moment de l'appel
+func Recipients(creatorID string, segment models.BroadcastSegment, expiringWithinDays int, now time.Time) ([]string, error) {
+	var ids []string
+	var err error
+
+	switch segment {
+	case models.BroadcastSubscribers:
+		err = activeSubscriptions(creatorID, now).Distinct().Pluck("user_id", &ids).Error
+	case models.BroadcastFollowers:
+		err = db.DB.Model(&models.UserFollow{}).Distinct().Where("followed_id = ?", creatorID).Pluck("follower_id", &ids).Error
+	case models.BroadcastExpiring:
+		// Les abonnements actifs se renouvellent : seuls les abonnements annulés arrivent à échéance
+		if expiringWithinDays <= 0 {
+			return nil, ErrMissingExpiry
+		}
+		err = db.DB.Model(&models.Subscription{}).Distinct().
+			Where("content_creator_id = ? AND status = ? AND end_date > ? AND end_date <= ?",
+				creatorID, models.SubscriptionCanceled, now, now.AddDate(0, 0, expiringWithinDays)).
+			Pluck("user_id", &ids).Error
+	case models.BroadcastLapsed:
+		err = db.DB.Model(&models.Subscription{}).Distinct().
+			Where("content_creator_id = ? AND status = ? AND end_date <= ?", creatorID, models.SubscriptionCanceled, now).
+			Where("user_id NOT IN (?)", activeSubscriptions(creatorID, now).Select("user_id")).
+			Pluck("user_id", &ids).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Les utilisateurs bloqués dans un sens ou dans l'autre ne reçoivent pas le message
+	blockedIDs, err := access.BlockedUserIDs(creatorID)
+	if err != nil {
+		return nil, err
+	}
+	excluded := map[string]bool{creatorID: true}
+	for _, id := range blockedIDs {
+		excluded[id] = true
+	}
+
+	recipients := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !excluded[id] {
+			recipients = append(recipients, id)
+		}
+	}
+	return recipients, nil
+}
+
+// Create enregistre le message groupé et fige la liste de ses destinataires.
+// L'envoi est fait ensuite par le job de livraison
+func Create(creatorID string, input models.BroadcastCreate, now time.Time) (models.Broadcast, error) {
+	recipientIDs, err := Recipients(creatorID, input.Segment, input.ExpiringWithinDays, now)
+	if err != nil {
+		return models.Broadcast{}, err
+	}
+	if len(recipientIDs) == 0 {
+		return models.Broadcast{}, ErrNoRecipients
+	}
+
+	broadcast := models.Broadcast{
+		CreatorID:       creatorID,
+		Segment:         input.Segment,
+		Content:         input.Content,
+		Status:          models.BroadcastPending,
+		RecipientsCount: len(recipientIDs),
+	}
+	if input.Segment == models.BroadcastExpiring {
+		broadcast.ExpiringWithinDays = input.ExpiringWithinDays
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&broadcast).Error; err != nil {
+			return err
+		}
+
+		recipients := make([]models.BroadcastRecipient, 0, len(recipientIDs))
+		for _, userID := range recipientIDs {
+			recipients = append(recipients, models.BroadcastRecipient{
+				BroadcastID: broadcast.ID,
+				UserID:      userID,
+				Status:      models.BroadcastRecipientPending,
+			})
+		}
+		return tx.CreateInBatches(&recipients, recipientsBatchSize).Error
+	})
+	return broadcast, err
+}
+
+// Cancel arrête un envoi en cours : les destinataires pas encore traités ne recevront rien
+func Cancel(broadcastID string, now time.Time) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Broadcast{}).
+			Where("id = ? AND status IN ?", broadcastID, []models.BroadcastStatus{models.BroadcastPending, models.BroadcastSending}).
+			Updates(map[string]any{"status": models.BroadcastCanceled, "canceled_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotCancelable
+		}
+
+		return tx.Model(&models.BroadcastRecipient{}).
+			Where("broadcast_id = ? AND status = ?", broadcastID, models.BroadcastRecipientPending).
+			Update("status", models.BroadcastRecipientCanceled).Error
+	})
+}
@@ -0,0 +1,377 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Commission de la plateforme si PLATFORM_FEE_PERCENT n'est pas défini
+	defaultFeePercent = 20
+	// Délai avant qu'un paiement soit disponible pour un versement, le temps des remboursements
+	HoldPeriod = 7 * 24 * time.Hour
+)
+
+var ErrChargeNotFound = errors.New("charge not found in ledger")
+
+// FeePercent renvoie la commission de la plateforme en pourcentage
+func FeePercent() int {
+	if percent, err := strconv.Atoi(os.Getenv("PLATFORM_FEE_PERCENT")); err == nil && percent >= 0 && percent <= 100 {
+		return percent
+	}
+	return defaultFeePercent
+}
+
+// PlatformFee calcule la commission sur un paiement, arrondie en faveur du créateur
+func PlatformFee(gross int) int {
+	return gross * FeePercent() / 100
+}
+
+// Charge décrit un paiement encaissé pour un créateur
+type Charge struct {
+	CreatorID string
+	// Identifiant de l'opération d'origine : facture, pourboire ou déblocage
+	Reference       string
+	PaymentIntentID string
+	Source          models.LedgerSource
+	Amount          int
+	At              time.Time
+}
+
+// side est un compte du grand livre, éventuellement propre à un créateur
+type side struct {
+	account   models.LedgerAccount
+	creatorID *string
+}
+
+func platform(account models.LedgerAccount) side {
+	return side{account: account}
+}
+
+func creator(account models.LedgerAccount, creatorID string) side {
+	return side{account: account, creatorID: &creatorID}
+}
+
+// move débite un compte et crédite l'autre du même montant
+func move(debit, credit side, amount int) []models.LedgerEntry {
+	return []models.LedgerEntry{
+		{Account: debit.account, CreatorID: debit.creatorID, Amount: amount},
+		{Account: credit.account, CreatorID: credit.creatorID, Amount: -amount},
+	}
+}
+
+// RecordCharge enregistre un paiement et la commission de la plateforme.
+// Un paiement déjà enregistré est ignoré : la session Checkout et la facture d'un abonnement arrivent toutes les deux
+func RecordCharge(ch Charge) error {
+	if ch.Amount <= 0 || ch.Reference == "" {
+		return nil
+	}
+
+	var existing models.LedgerTransaction
+	err := db.DB.First(&existing, "kind = ? AND reference = ?", models.LedgerCharge, ch.Reference).Error
+	if err == nil {
+		// La facture apporte parfois le PaymentIntent absent de la session, utile pour les remboursements
+		if existing.PaymentIntentID == "" && ch.PaymentIntentID != "" {
+			return db.DB.Model(&existing).Update("payment_intent_id", ch.PaymentIntentID).Error
+		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	availableAt := ch.At.Add(HoldPeriod)
+	pending := creator(models.LedgerAccountCreatorPending, ch.CreatorID)
+	fee := PlatformFee(ch.Amount)
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		charge := models.LedgerTransaction{
+			Kind:            models.LedgerCharge,
+			Reference:       ch.Reference,
+			CreatorID:       ch.CreatorID,
+			Source:          ch.Source,
+			PaymentIntentID: ch.PaymentIntentID,
+			Amount:          ch.Amount,
+			AvailableAt:     &availableAt,
+			Entries:         move(platform(models.LedgerAccountStripe), pending, ch.Amount),
+		}
+		if err := tx.Create(&charge).Error; err != nil {
+			return err
+		}
+		if fee == 0 {
+			return nil
+		}
+
+		return tx.Create(&models.LedgerTransaction{
+			Kind:      models.LedgerPlatformFee,
+			Reference: ch.Reference,
+			CreatorID: ch.CreatorID,
+			ChargeID:  &charge.ID,
+			Source:    ch.Source,
+			Amount:    fee,
+			Entries:   move(pending, platform(models.LedgerAccountPlatformFees), fee),
+		}).Error
+	})
+}
+
+// findCharge retrouve le paiement d'origine d'un remboursement ou d'un litige
+func findCharge(paymentIntentID string) (*models.LedgerTransaction, error) {
+	if paymentIntentID == "" {
+		return nil, ErrChargeNotFound
+	}
+	var charge models.LedgerTransaction
+	if err := db.DB.First(&charge, "kind = ? AND payment_intent_id = ?", models.LedgerCharge, paymentIntentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrChargeNotFound
+		}
+		return nil, err
+	}
+	return &charge, nil
+}
+
+// chargeFee renvoie la commission prélevée sur un paiement
+func chargeFee(charge *models.LedgerTransaction) (int, error) {
+	var fee int
+	err := db.DB.Model(&models.LedgerTransaction{}).
+		Where("kind = ? AND charge_id = ?", models.LedgerPlatformFee, charge.ID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&fee).Error
+	return fee, err
+}
+
+// reversalEntries retire un montant du compte Stripe. La plateforme rend sa commission au prorata,
+// le reste est prélevé sur les gains du créateur, en attente ou disponibles selon que le paiement a été libéré
+func reversalEntries(charge *models.LedgerTransaction, fee, amount int) []models.LedgerEntry {
+	returnedFee := fee * amount / charge.Amount
+	account := models.LedgerAccountCreatorPending
+	if charge.ReleasedAt != nil {
+		account = models.LedgerAccountCreatorAvailable
+	}
+
+	entries := []models.LedgerEntry{
+		{Account: models.LedgerAccountStripe, Amount: -amount},
+		{Account: account, CreatorID: &charge.CreatorID, Amount: amount - returnedFee},
+	}
+	if returnedFee > 0 {
+		entries = append(entries, models.LedgerEntry{Account: models.LedgerAccountPlatformFees, Amount: returnedFee})
+	}
+	return entries
+}
+
+// RecordRefund enregistre le remboursement d'un paiement.
+// totalRefunded est le cumul remboursé indiqué par Stripe : seule la différence avec ce qui est déjà enregistré est ajoutée
+func RecordRefund(paymentIntentID, stripeChargeID string, totalRefunded int) error {
+	charge, err := findCharge(paymentIntentID)
+	if err != nil {
+		return err
+	}
+
+	var alreadyRefunded int
+	if err := db.DB.Model(&models.LedgerTransaction{}).
+		Where("kind = ? AND charge_id = ?", models.LedgerRefund, charge.ID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&alreadyRefunded).Error; err != nil {
+		return err
+	}
+	amount := min(totalRefunded, charge.Amount) - alreadyRefunded
+	if amount <= 0 {
+		return nil
+	}
+
+	fee, err := chargeFee(charge)
+	if err != nil {
+		return err
+	}
+
+	return db.DB.Create(&models.LedgerTransaction{
+		Kind:            models.LedgerRefund,
+		Reference:       fmt.Sprintf("%s:%d", stripeChargeID, totalRefunded),
+		CreatorID:       charge.CreatorID,
+		ChargeID:        &charge.ID,
+		Source:          charge.Source,
+		PaymentIntentID: paymentIntentID,
+		Amount:          amount,
+		Entries:         reversalEntries(charge, fee, amount),
+	}).Error
+}
+
+// RecordChargeback enregistre les fonds retenus par un litige
+func RecordChargeback(paymentIntentID, disputeID string, amount int) error {
+	charge, err := findCharge(paymentIntentID)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if err := db.DB.Model(&models.LedgerTransaction{}).
+		Where("kind = ? AND reference = ?", models.LedgerChargeback, disputeID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	fee, err := chargeFee(charge)
+	if err != nil {
+		return err
+	}
+
+	return db.DB.Create(&models.LedgerTransaction{
+		Kind:            models.LedgerChargeback,
+		Reference:       disputeID,
+		CreatorID:       charge.CreatorID,
+		ChargeID:        &charge.ID,
+		Source:          charge.Source,
+		PaymentIntentID: paymentIntentID,
+		Amount:          min(amount, charge.Amount),
+		Entries:         reversalEntries(charge, fee, min(amount, charge.Amount)),
+	}).Error
+}
+
+// ReverseChargeback annule les écritures d'un litige gagné
+func ReverseChargeback(disputeID string) error {
+	var chargeback models.LedgerTransaction
+	if err := db.DB.Preload("Entries").First(&chargeback, "kind = ? AND reference = ?", models.LedgerChargeback, disputeID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrChargeNotFound
+		}
+		return err
+	}
+
+	var count int64
+	if err := db.DB.Model(&models.LedgerTransaction{}).
+		Where("kind = ? AND reference = ?", models.LedgerChargebackReversal, disputeID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	entries := make([]models.LedgerEntry, 0, len(chargeback.Entries))
+	for _, entry := range chargeback.Entries {
+		entries = append(entries, models.LedgerEntry{Account: entry.Account, CreatorID: entry.CreatorID, Amount: -entry.Amount})
+	}
+
+	return db.DB.Create(&models.LedgerTransaction{
+		Kind:            models.LedgerChargebackReversal,
+		Reference:       disputeID,
+		CreatorID:       chargeback.CreatorID,
+		ChargeID:        chargeback.ChargeID,
+		Source:          chargeback.Source,
+		PaymentIntentID: chargeback.PaymentIntentID,
+		Amount:          chargeback.Amount,
+		Entries:         entries,
+	}).Error
+}
+
+// ReleaseAvailable rend disponibles les gains des paiements sortis de la période de rétention
+func ReleaseAvailable(now time.Time) (int, error) {
+	var charges []models.LedgerTransaction
+	if err := db.DB.Where("kind = ? AND released_at IS NULL AND available_at <= ?", models.LedgerCharge, now).
+		Find(&charges).Error; err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, charge := range charges {
+		if err := release(charge, now); err != nil {
+			return released, err
+		}
+		released++
+	}
+	return released, nil
+}
+
+// release transfère vers les gains disponibles ce qui reste en attente d'un paiement, après remboursements et commission
+func release(charge models.LedgerTransaction, now time.Time) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		// Une autre instance a déjà libéré ce paiement
+		result := tx.Model(&models.LedgerTransaction{}).
+			Where("id = ? AND released_at IS NULL", charge.ID).
+			Update("released_at", now)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		var pending int
+		if err := tx.Model(&models.LedgerEntry{}).
+			Joins("JOIN ledger_transactions ON ledger_transactions.id = ledger_entries.transaction_id").
+			Where("(ledger_transactions.id = ? OR ledger_transactions.charge_id = ?) AND ledger_entries.account = ?",
+				charge.ID, charge.ID, models.LedgerAccountCreatorPending).
+			Select("COALESCE(SUM(ledger_entries.amount), 0)").Scan(&pending).Error; err != nil {
+			return err
+		}
+
+		// Les gains sont au crédit du créateur : un solde négatif
+		amount := -pending
+		if amount <= 0 {
+			return nil
+		}
+		return tx.Create(&models.LedgerTransaction{
+			Kind:      models.LedgerRelease,
+			Reference: charge.ID,
+			CreatorID: charge.CreatorID,
+			ChargeID:  &charge.ID,
+			Source:    charge.Source,
+			Amount:    amount,
+			Entries: move(
+				creator(models.LedgerAccountCreatorPending, charge.CreatorID),
+				creator(models.LedgerAccountCreatorAvailable, charge.CreatorID),
+				amount,
+			),
+		}).Error
+	})
+}
+
+// RecordPayout réserve un versement au créateur sur ses gains disponibles.
+// Appelé dans la transaction qui enregistre le transfert, avant l'appel à Stripe
+func RecordPayout(tx *gorm.DB, creatorID, reference string, amount int) error {
+	if amount <= 0 {
+		return nil
+	}
+	return tx.Create(&models.LedgerTransaction{
+		Kind:      models.LedgerPayout,
+		Reference: reference,
+		CreatorID: creatorID,
+		Amount:    amount,
+		Entries: move(
+			creator(models.LedgerAccountCreatorAvailable, creatorID),
+			platform(models.LedgerAccountStripe),
+			amount,
+		),
+	}).Error
+}
+
+// ReversePayout rend aux gains disponibles un versement refusé ou annulé par Stripe.
+// reference identifie le transfert refusé ou l'annulation : un même retour n'est enregistré qu'une fois
+func ReversePayout(tx *gorm.DB, creatorID, reference string, amount int) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	var existing int64
+	if err := tx.Model(&models.LedgerTransaction{}).
+		Where("kind = ? AND reference = ?", models.LedgerPayoutReversal, reference).
+		Count(&existing).Error; err != nil || existing > 0 {
+		return err
+	}
+	return tx.Create(&models.LedgerTransaction{
+		Kind:      models.LedgerPayoutReversal,
+		Reference: reference,
+		CreatorID: creatorID,
+		Amount:    amount,
+		Entries: move(
+			platform(models.LedgerAccountStripe),
+			creator(models.LedgerAccountCreatorAvailable, creatorID),
+			amount,
+		),
+	}).Error
+}
@@ -0,0 +1,148 @@
+package ledger
+
+import (
+	"testing"
+	"time"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReversalEntries(t *testing.T) {
+	released := time.Now()
+
+	tests := []struct {
+		name            string
+		releasedAt      *time.Time
+		amount          int
+		expectedAccount models.LedgerAccount
+		expectedCreator int
+		expectedFee     int
+	}{
+		{"full refund before release", nil, 1000, models.LedgerAccountCreatorPending, 800, 200},
+		{"partial refund after release", &released, 250, models.LedgerAccountCreatorAvailable, 200, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			charge := &models.LedgerTransaction{ID: "charge-uuid", CreatorID: "creator-uuid", Amount: 1000, ReleasedAt: tt.releasedAt}
+
+			entries := reversalEntries(charge, 200, tt.amount)
+
+			sum := 0
+			for _, entry := range entries {
+				sum += entry.Amount
+			}
+			assert.Equal(t, 0, sum)
+			assert.Len(t, entries, 3)
+			assert.Equal(t, models.LedgerAccountStripe, entries[0].Account)
+			assert.Equal(t, -tt.amount, entries[0].Amount)
+			assert.Equal(t, tt.expectedAccount, entries[1].Account)
+			assert.Equal(t, "creator-uuid", *entries[1].CreatorID)
+			assert.Equal(t, tt.expectedCreator, entries[1].Amount)
+			assert.Equal(t, tt.expectedFee, entries[2].Amount)
+		})
+	}
+}
+
+func TestRecordCharge_SplitsPlatformFee(t *testing.T) {
+	t.Setenv("PLATFORM_FEE_PERCENT", "20")
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	paidAt := time.Date(2026, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT \* FROM "ledger_transactions" WHERE kind = \$1 AND reference = \$2`).
+		WithArgs(models.LedgerCharge, "in_123", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "ledger_transactions"`).
+		WithArgs(models.LedgerCharge, "in_123", "creator-uuid", nil, models.LedgerSourceSubscription, "pi_123", 1000, paidAt.Add(HoldPeriod), nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("charge-uuid"))
+	mock.ExpectQuery(`INSERT INTO "ledger_entries"`).
+		WithArgs(
+			"charge-uuid", models.LedgerAccountStripe, nil, 1000, sqlmock.AnyArg(),
+			"charge-uuid", models.LedgerAccountCreatorPending, "creator-uuid", -1000, sqlmock.AnyArg(),
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("entry-1").AddRow("entry-2"))
+	mock.ExpectQuery(`INSERT INTO "ledger_transactions"`).
+		WithArgs(models.LedgerPlatformFee, "in_123", "creator-uuid", "charge-uuid", models.LedgerSourceSubscription, "", 200, nil, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("fee-uuid"))
+	mock.ExpectQuery(`INSERT INTO "ledger_entries"`).
+		WithArgs(
+			"fee-uuid", models.LedgerAccountCreatorPending, "creator-uuid", 200, sqlmock.AnyArg(),
+			"fee-uuid", models.LedgerAccountPlatformFees, nil, -200, sqlmock.AnyArg(),
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("entry-3").AddRow("entry-4"))
+	mock.ExpectCommit()
+
+	err := RecordCharge(Charge{
+		CreatorID:       "creator-uuid",
+		Reference:       "in_123",
+		PaymentIntentID: "pi_123",
+		Source:          models.LedgerSourceSubscription,
+		Amount:          1000,
+		At:              paidAt,
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRecordCharge_AlreadyRecordedAddsPaymentIntent(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "ledger_transactions" WHERE kind = \$1 AND reference = \$2`).
+		WithArgs(models.LedgerCharge, "in_123", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "reference", "payment_intent_id"}).
+			AddRow("charge-uuid", models.LedgerCharge, "in_123", ""))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "ledger_transactions" SET "payment_intent_id"=\$1 WHERE "id" = \$2`).
+		WithArgs("pi_123", "charge-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := RecordCharge(Charge{CreatorID: "creator-uuid", Reference: "in_123", PaymentIntentID: "pi_123", Amount: 1000, At: time.Now()})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReleaseAvailable_MovesRemainingPendingFunds(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT \* FROM "ledger_transactions" WHERE kind = \$1 AND released_at IS NULL AND available_at <= \$2`).
+		WithArgs(models.LedgerCharge, now).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "creator_id", "source", "amount"}).
+			AddRow("charge-uuid", models.LedgerCharge, "creator-uuid", models.LedgerSourceTip, 1000))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "ledger_transactions" SET "released_at"=\$1 WHERE id = \$2 AND released_at IS NULL`).
+		WithArgs(now, "charge-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// 1000 encaissés, 200 de commission et 250 remboursés
+	mock.ExpectQuery(`SELECT COALESCE\(SUM\(ledger_entries.amount\), 0\) FROM "ledger_entries" JOIN ledger_transactions`).
+		WithArgs("charge-uuid", "charge-uuid", models.LedgerAccountCreatorPending).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(-600))
+	mock.ExpectQuery(`INSERT INTO "ledger_transactions"`).
+		WithArgs(models.LedgerRelease, "charge-uuid", "creator-uuid", "charge-uuid", models.LedgerSourceTip, "", 600, nil, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("release-uuid"))
+	mock.ExpectQuery(`INSERT INTO "ledger_entries"`).
+		WithArgs(
+			"release-uuid", models.LedgerAccountCreatorPending, "creator-uuid", 600, sqlmock.AnyArg(),
+			"release-uuid", models.LedgerAccountCreatorAvailable, "creator-uuid", -600, sqlmock.AnyArg(),
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("entry-1").AddRow("entry-2"))
+	mock.ExpectCommit()
+
+	released, err := ReleaseAvailable(now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
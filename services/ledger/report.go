@@ -0,0 +1,127 @@
+package ledger
+
+import (
+	"pec2-backend/db"
+	"pec2-backend/models"
+)
+
+// Balance calcule les gains d'un créateur à partir de ses écritures
+func Balance(creatorID string) (models.CreatorBalance, error) {
+	var rows []struct {
+		Kind    models.LedgerTransactionKind
+		Account models.LedgerAccount
+		Total   int
+	}
+	if err := db.DB.Model(&models.LedgerEntry{}).
+		Select("ledger_transactions.kind, ledger_entries.account, SUM(ledger_entries.amount) AS total").
+		Joins("JOIN ledger_transactions ON ledger_transactions.id = ledger_entries.transaction_id").
+		Where("ledger_entries.creator_id = ?", creatorID).
+		Group("ledger_transactions.kind, ledger_entries.account").
+		Scan(&rows).Error; err != nil {
+		return models.CreatorBalance{}, err
+	}
+
+	var balance models.CreatorBalance
+	for _, row := range rows {
+		// Les comptes créateurs sont créditeurs : leur solde est l'opposé de la somme des écritures
+		switch row.Account {
+		case models.LedgerAccountCreatorPending:
+			balance.Pending -= row.Total
+		case models.LedgerAccountCreatorAvailable:
+			balance.Available -= row.Total
+		}
+
+		switch row.Kind {
+		case models.LedgerCharge:
+			balance.Gross -= row.Total
+		case models.LedgerPlatformFee:
+			balance.PlatformFees += row.Total
+		case models.LedgerRefund:
+			balance.Refunded += row.Total
+		case models.LedgerChargeback, models.LedgerChargebackReversal:
+			balance.Chargebacks += row.Total
+		case models.LedgerPayout, models.LedgerPayoutReversal:
+			balance.PaidOut += row.Total
+		}
+	}
+	return balance, nil
+}
+
+// sourceCheck décrit la table où une source de paiements enregistre ses paiements réussis
+type sourceCheck struct {
+	source    models.LedgerSource
+	model     interface{}
+	status    interface{}
+	reference string
+}
+
+var sourceChecks = []sourceCheck{
+	// Les paiements d'abonnement gardent l'identifiant de la facture
+	{models.LedgerSourceSubscription, &models.SubscriptionPayment{}, models.SubscriptionPaymentSucceeded, "stripe_payment_intent_id"},
+	{models.LedgerSourceTip, &models.Tip{}, models.TipSucceeded, "CAST(id AS text)"},
+	{models.LedgerSourceMessageUnlock, &models.MessageUnlock{}, models.MessageUnlockSucceeded, "CAST(id AS text)"},
+}
+
+// Reconcile vérifie que le grand livre est équilibré et qu'il couvre tous les paiements réussis
+func Reconcile() (models.LedgerReconciliation, error) {
+	report := models.LedgerReconciliation{
+		UnbalancedTransactions: []string{},
+		Accounts:               map[models.LedgerAccount]int{},
+		Sources:                map[models.LedgerSource]models.LedgerSourceCheck{},
+	}
+
+	var accounts []struct {
+		Account models.LedgerAccount
+		Total   int
+	}
+	if err := db.DB.Model(&models.LedgerEntry{}).
+		Select("account, SUM(amount) AS total").
+		Group("account").
+		Scan(&accounts).Error; err != nil {
+		return report, err
+	}
+	for _, row := range accounts {
+		report.Accounts[row.Account] = row.Total
+		report.Total += row.Total
+	}
+
+	if err := db.DB.Model(&models.LedgerEntry{}).
+		Group("transaction_id").
+		Having("SUM(amount) <> 0").
+		Pluck("transaction_id", &report.UnbalancedTransactions).Error; err != nil {
+		return report, err
+	}
+
+	report.Balanced = report.Total == 0 && len(report.UnbalancedTransactions) == 0
+	for _, check := range sourceChecks {
+		var result models.LedgerSourceCheck
+		if err := db.DB.Model(check.model).
+			Where("status = ? AND amount > 0", check.status).
+			Select("COALESCE(SUM(amount), 0)").Scan(&result.Payments).Error; err != nil {
+			return report, err
+		}
+
+		if err := db.DB.Model(&models.LedgerTransaction{}).
+			Where("kind = ? AND source = ?", models.LedgerCharge, check.source).
+			Select("COALESCE(SUM(amount), 0)").Scan(&result.Ledger).Error; err != nil {
+			return report, err
+		}
+
+		var missing int64
+		charges := db.DB.Model(&models.LedgerTransaction{}).Select("reference").
+			Where("kind = ? AND source = ?", models.LedgerCharge, check.source)
+		if err := db.DB.Model(check.model).
+			Where("status = ? AND amount > 0 AND "+check.reference+" NOT IN (?)", check.status, charges).
+			Count(&missing).Error; err != nil {
+			return report, err
+		}
+		result.Missing = int(missing)
+
+		report.Sources[check.source] = result
+		if result.Missing > 0 {
+			report.Balanced = false
+		}
+	}
+
+	return report, nil
+}
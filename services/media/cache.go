@@ -0,0 +1,70 @@
+package media
+
+import (
+	"container/list"
+	"sync"
+)
+
+// renderCache est un cache LRU borné en octets pour les images filigranées
+type renderCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	size     int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key  string
+	data []byte
+}
+
+func newRenderCache(maxBytes int) *renderCache {
+	return &renderCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *renderCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).data, true
+}
+
+func (c *renderCache) Set(key string, data []byte) {
+	if len(data) > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		c.size += len(data) - len(entry.data)
+		entry.data = data
+		c.order.MoveToFront(element)
+	} else {
+		c.items[key] = c.order.PushFront(&cacheEntry{key: key, data: data})
+		c.size += len(data)
+	}
+
+	for c.size > c.maxBytes {
+		oldest := c.order.Back()
+		if oldest == nil {
+			break
+		}
+		entry := oldest.Value.(*cacheEntry)
+		c.order.Remove(oldest)
+		delete(c.items, entry.key)
+		c.size -= len(entry.data)
+	}
+}
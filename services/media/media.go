@@ -0,0 +1,145 @@
+package media
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"pec2-backend/models"
+	"pec2-backend/utils"
+)
+
+// Taille maximale du cache des rendus filigranés (en octets)
+const cacheMaxBytes = 128 * 1024 * 1024
+
+var cache = newRenderCache(cacheMaxBytes)
+
+// PostMediaPath renvoie l'URL de l'endpoint de diffusion de l'image d'un post
+func PostMediaPath(postID string, size string) string {
+	path := fmt.Sprintf("%s/media/posts/%s", strings.TrimRight(os.Getenv("API_PUBLIC_URL"), "/"), postID)
+	if size != "" && size != "full" {
+		path += "?size=" + size
+	}
+	return path
+}
+
+// AttachmentMediaPath renvoie l'URL de l'endpoint de diffusion d'une pièce jointe de message
+func AttachmentMediaPath(attachmentID string) string {
+	return fmt.Sprintf("%s/media/messages/%s", strings.TrimRight(os.Getenv("API_PUBLIC_URL"), "/"), attachmentID)
+}
+
+// ProtectPostResponse remplace les URLs Cloudinary d'un post payant :
+// URLs signées de courte durée pour un lecteur autorisé, rien du tout sinon.
+// Les posts gratuits gardent leurs URLs permanentes.
+func ProtectPostResponse(response *models.PostResponse, viewerID string, canView bool) {
+	if response.IsFree || response.PictureURL == "" {
+		return
+	}
+
+	if !canView || viewerID == "" {
+		response.PictureURL = ""
+		response.PictureVariants = models.ImageVariants{}
+		response.Locked = true
+		return
+	}
+
+	response.PictureURL = SignedPostURL(response.ID, "full", viewerID)
+	if !response.PictureVariants.IsEmpty() {
+		response.PictureVariants = models.ImageVariants{
+			Thumbnail: SignedPostURL(response.ID, "thumbnail", viewerID),
+			Feed:      SignedPostURL(response.ID, "feed", viewerID),
+			Full:      response.PictureURL,
+		}
+	}
+}
+
+// AttachmentResponse prépare la pièce jointe pour un participant : URLs signées s'il y a accès,
+// pièce jointe verrouillée (sans URL) sinon
+func AttachmentResponse(attachment models.MessageAttachment, viewerID string, canView bool) models.MessageAttachmentResponse {
+	response := models.MessageAttachmentResponse{
+		ID:     attachment.ID,
+		Price:  attachment.Price,
+		Locked: !canView,
+	}
+	if !canView {
+		return response
+	}
+
+	response.PictureURL = SignedAttachmentURL(attachment.ID, "full", viewerID)
+	if !attachment.PictureVariants.IsEmpty() {
+		response.PictureVariants = models.ImageVariants{
+			Thumbnail: SignedAttachmentURL(attachment.ID, "thumbnail", viewerID),
+			Feed:      SignedAttachmentURL(attachment.ID, "feed", viewerID),
+			Full:      response.PictureURL,
+		}
+	}
+	return response
+}
+
+func pictureSource(pictureURL string, variants models.ImageVariants, size string) string {
+	switch size {
+	case "thumbnail":
+		if variants.Thumbnail != "" {
+			return variants.Thumbnail
+		}
+	case "feed":
+		if variants.Feed != "" {
+			return variants.Feed
+		}
+	}
+	if variants.Full != "" {
+		return variants.Full
+	}
+	return pictureURL
+}
+
+// SourceURL choisit l'URL de stockage correspondant à la taille demandée
+func SourceURL(post models.Post, size string) string {
+	return pictureSource(post.PictureURL, post.PictureVariants, size)
+}
+
+// AttachmentSourceURL choisit l'URL de stockage d'une pièce jointe pour la taille demandée
+func AttachmentSourceURL(attachment models.MessageAttachment, size string) string {
+	return pictureSource(attachment.PictureURL, attachment.PictureVariants, size)
+}
+
+// WatermarkedPicture renvoie l'image du post avec le filigrane propre au lecteur (encodée en JPEG ou PNG).
+// Le rendu est mis en cache par post, taille, lecteur et version de l'image.
+func WatermarkedPicture(post models.Post, size string, viewer models.User) ([]byte, string, error) {
+	return watermarked(SourceURL(post, size), size, viewer)
+}
+
+// WatermarkedAttachment renvoie la pièce jointe payante avec le filigrane du lecteur
+func WatermarkedAttachment(attachment models.MessageAttachment, size string, viewer models.User) ([]byte, string, error) {
+	return watermarked(AttachmentSourceURL(attachment, size), size, viewer)
+}
+
+func watermarked(sourceURL string, size string, viewer models.User) ([]byte, string, error) {
+	if sourceURL == "" {
+		return nil, "", fmt.Errorf("no picture to render")
+	}
+
+	key := fmt.Sprintf("%s|%s|%s", viewer.ID, size, sourceURL)
+	if data, ok := cache.Get(key); ok {
+		return data, utils.DetectFileType(data), nil
+	}
+
+	raw, _, err := utils.FetchRemoteFile(sourceURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	img, err := utils.DecodeImage(raw)
+	if err != nil {
+		return nil, "", err
+	}
+
+	marked := utils.WatermarkImage(img, utils.WatermarkLogo(), utils.WatermarkLabel(viewer.UserName, viewer.ID))
+	data, _, err := utils.EncodeImage(marked)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cache.Set(key, data)
+	return data, utils.DetectFileType(data), nil
+}
@@ -0,0 +1,108 @@
+package media
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"pec2-backend/utils"
+)
+
+// Durée de validité des URLs signées des images payantes
+const SignedURLTTL = 10 * time.Minute
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpiredSignature = errors.New("signed URL expired")
+	ErrSigningDisabled  = errors.New("signed URLs are disabled: no signing secret configured")
+)
+
+func signingSecret() []byte {
+	if secret := os.Getenv("MEDIA_SIGNING_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte(os.Getenv("JWT_SECRET"))
+}
+
+// SigningEnabled indique si un secret est configuré : avec une clé vide, n'importe qui pourrait signer
+func SigningEnabled() bool {
+	return len(signingSecret()) > 0
+}
+
+// CheckSigningSecret signale au démarrage que les URLs signées sont désactivées
+func CheckSigningSecret() {
+	if !SigningEnabled() {
+		utils.LogError(ErrSigningDisabled, "MEDIA_SIGNING_SECRET and JWT_SECRET are empty, paid media is only served to authenticated requests")
+	}
+}
+
+// resource identifie ce qui est signé : l'ID du post, ou "attachment:<id>" pour une pièce jointe
+func computeSignature(resource string, size string, viewerID string, expires int64) string {
+	mac := hmac.New(sha256.New, signingSecret())
+	fmt.Fprintf(mac, "%s|%s|%s|%d", resource, size, viewerID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedURL retourne le chemin sans signature si aucun secret n'est configuré :
+// l'endpoint média n'est alors accessible qu'avec le JWT du lecteur
+func signedURL(path string, resource string, size string, viewerID string) string {
+	if !SigningEnabled() {
+		return path + "?" + url.Values{"size": {size}}.Encode()
+	}
+	expires := time.Now().Add(SignedURLTTL).Unix()
+
+	params := url.Values{}
+	params.Set("size", size)
+	params.Set("viewer", viewerID)
+	params.Set("expires", strconv.FormatInt(expires, 10))
+	params.Set("sig", computeSignature(resource, size, viewerID, expires))
+
+	return path + "?" + params.Encode()
+}
+
+// SignedPostURL génère une URL courte durée vers l'endpoint média, liée au lecteur
+func SignedPostURL(postID string, size string, viewerID string) string {
+	return signedURL(PostMediaPath(postID, ""), postID, size, viewerID)
+}
+
+// SignedAttachmentURL génère une URL courte durée vers une pièce jointe de message, liée au lecteur
+func SignedAttachmentURL(attachmentID string, size string, viewerID string) string {
+	return signedURL(AttachmentMediaPath(attachmentID), "attachment:"+attachmentID, size, viewerID)
+}
+
+// VerifySignedPostURL vérifie la signature et l'expiration des paramètres d'une URL signée
+func VerifySignedPostURL(postID string, size string, viewerID string, expiresParam string, signature string) error {
+	return verifySignature(postID, size, viewerID, expiresParam, signature)
+}
+
+// VerifySignedAttachmentURL vérifie une URL signée de pièce jointe
+func VerifySignedAttachmentURL(attachmentID string, size string, viewerID string, expiresParam string, signature string) error {
+	return verifySignature("attachment:"+attachmentID, size, viewerID, expiresParam, signature)
+}
+
+func verifySignature(resource string, size string, viewerID string, expiresParam string, signature string) error {
+	if !SigningEnabled() {
+		return ErrSigningDisabled
+	}
+
+	expires, err := strconv.ParseInt(expiresParam, 10, 64)
+	if err != nil || viewerID == "" {
+		return ErrInvalidSignature
+	}
+
+	expected := computeSignature(resource, size, viewerID, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() > expires {
+		return ErrExpiredSignature
+	}
+
+	return nil
+}
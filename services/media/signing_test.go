@@ -0,0 +1,55 @@
+package media
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedPostURL(t *testing.T) {
+	t.Setenv("MEDIA_SIGNING_SECRET", "test-secret")
+
+	signedURL := SignedPostURL("post-uuid", "feed", "viewer-uuid")
+	assert.True(t, strings.HasPrefix(signedURL, "/media/posts/post-uuid?"))
+
+	parsed, err := url.Parse(signedURL)
+	assert.NoError(t, err)
+	params := parsed.Query()
+
+	assert.NoError(t, VerifySignedPostURL("post-uuid", "feed", "viewer-uuid", params.Get("expires"), params.Get("sig")))
+	assert.ErrorIs(t, VerifySignedPostURL("other-post", "feed", "viewer-uuid", params.Get("expires"), params.Get("sig")), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifySignedPostURL("post-uuid", "full", "viewer-uuid", params.Get("expires"), params.Get("sig")), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifySignedPostURL("post-uuid", "feed", "other-viewer", params.Get("expires"), params.Get("sig")), ErrInvalidSignature)
+
+	// Une URL signée avec un autre secret est refusée
+	t.Setenv("MEDIA_SIGNING_SECRET", "another-secret")
+	assert.ErrorIs(t, VerifySignedPostURL("post-uuid", "feed", "viewer-uuid", params.Get("expires"), params.Get("sig")), ErrInvalidSignature)
+}
+
+func TestVerifySignedPostURL_Expired(t *testing.T) {
+	t.Setenv("MEDIA_SIGNING_SECRET", "test-secret")
+
+	expires := time.Now().Add(-time.Minute).Unix()
+	signature := computeSignature("post-uuid", "full", "viewer-uuid", expires)
+
+	err := VerifySignedPostURL("post-uuid", "full", "viewer-uuid", strconv.FormatInt(expires, 10), signature)
+	assert.ErrorIs(t, err, ErrExpiredSignature)
+}
+
+func TestSignedPostURL_NoSecret(t *testing.T) {
+	t.Setenv("MEDIA_SIGNING_SECRET", "")
+	t.Setenv("JWT_SECRET", "")
+
+	// Sans secret, aucune signature n'est émise...
+	assert.Equal(t, "/media/posts/post-uuid?size=feed", SignedPostURL("post-uuid", "feed", "viewer-uuid"))
+
+	// ... ni acceptée, même calculée avec une clé vide
+	expires := time.Now().Add(time.Minute).Unix()
+	signature := computeSignature("post-uuid", "feed", "viewer-uuid", expires)
+	err := VerifySignedPostURL("post-uuid", "feed", "viewer-uuid", strconv.FormatInt(expires, 10), signature)
+	assert.ErrorIs(t, err, ErrSigningDisabled)
+}
@@ -0,0 +1,84 @@
+package messaging
+
+import (
+	"encoding/json"
+	"time"
+
+	"pec2-backend/models"
+	"pec2-backend/services/realtime"
+	"pec2-backend/utils"
+)
+
+// Types des évènements envoyés sur les WebSockets de messagerie
+const (
+	ChatMessage  = "message"
+	ChatTyping   = "typing"
+	ChatRead     = "read"
+	ChatUnlocked = "unlocked"
+)
+
+// ChatEvent est un évènement de messagerie diffusé à tous les appareils connectés d'un utilisateur
+type ChatEvent struct {
+	Type           string                 `json:"type"`
+	ConversationID string                 `json:"conversationId,omitempty"`
+	Message        *models.PrivateMessage `json:"message,omitempty"`
+	UserID         string                 `json:"userId,omitempty"`
+	Typing         *bool                  `json:"typing,omitempty"`
+	MessageIDs     []string               `json:"messageIds,omitempty"`
+	ReadAt         *time.Time             `json:"readAt,omitempty"`
+	MessageID      string                 `json:"messageId,omitempty"`
+	AttachmentID   string                 `json:"attachmentId,omitempty"`
+}
+
+// ChatTopic est le topic de messagerie d'un utilisateur, partagé par tous ses appareils
+func ChatTopic(userID string) string {
+	return "chat:" + userID
+}
+
+func publishChat(event ChatEvent, userIDs ...string) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		utils.LogError(err, "Error marshaling chat event "+event.Type)
+		return
+	}
+	for _, userID := range userIDs {
+		if err := realtime.Publish(ChatTopic(userID), data); err != nil {
+			utils.LogError(err, "Error publishing chat event "+event.Type)
+		}
+	}
+}
+
+// PublishTyping prévient l'autre participant que l'utilisateur écrit (ou a arrêté d'écrire)
+func PublishTyping(conversation models.Conversation, userID string, typing bool) {
+	publishChat(ChatEvent{
+		Type:           ChatTyping,
+		ConversationID: conversation.ID,
+		UserID:         userID,
+		Typing:         &typing,
+	}, conversation.OtherUserID(userID))
+}
+
+// PublishReadReceipt envoie l'accusé de lecture à l'expéditeur et aux autres appareils du lecteur
+func PublishReadReceipt(conversationID string, readerID string, senderID string, messageIDs []string) {
+	if len(messageIDs) == 0 {
+		return
+	}
+	readAt := time.Now()
+	publishChat(ChatEvent{
+		Type:           ChatRead,
+		ConversationID: conversationID,
+		UserID:         readerID,
+		MessageIDs:     messageIDs,
+		ReadAt:         &readAt,
+	}, senderID, readerID)
+}
+
+// PublishUnlock prévient tous les appareils de l'acheteur qu'une pièce jointe est débloquée,
+// pour qu'ils rechargent le message avec ses URLs
+func PublishUnlock(attachment models.MessageAttachment, buyerID string) {
+	publishChat(ChatEvent{
+		Type:         ChatUnlocked,
+		MessageID:    attachment.MessageID,
+		AttachmentID: attachment.ID,
+	}, buyerID)
+}
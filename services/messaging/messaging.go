@@ -0,0 +1,400 @@
+package messaging
+
+import (
+	"errors"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/access"
+	"pec2-backend/services/media"
+	"pec2-backend/services/realtime"
+	"pec2-backend/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSelfMessage          = errors.New("you cannot send a message to yourself")
+	ErrMessagesDisabled     = errors.New("receiver has disabled private messages")
+	ErrBlocked              = errors.New("you cannot send a message to this user")
+	ErrConversationNotFound = errors.New("conversation not found")
+)
+
+// pair ordonne les deux identifiants : une seule conversation par paire d'utilisateurs
+func pair(userID string, otherID string) (string, string) {
+	if userID < otherID {
+		return userID, otherID
+	}
+	return otherID, userID
+}
+
+// GetOrCreateConversation renvoie la conversation entre deux utilisateurs, en la créant si besoin
+func GetOrCreateConversation(tx *gorm.DB, userID string, otherID string) (models.Conversation, error) {
+	a, b := pair(userID, otherID)
+
+	var conversation models.Conversation
+	err := tx.Where("user_a_id = ? AND user_b_id = ?", a, b).First(&conversation).Error
+	if err == nil {
+		return conversation, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return conversation, err
+	}
+
+	conversation = models.Conversation{UserAID: a, UserBID: b}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&conversation).Error; err != nil {
+		return conversation, err
+	}
+	// Créée entre temps par une autre requête
+	if conversation.ID == "" {
+		if err := tx.Where("user_a_id = ? AND user_b_id = ?", a, b).First(&conversation).Error; err != nil {
+			return conversation, err
+		}
+	}
+
+	participants := []models.ConversationParticipant{
+		{ConversationID: conversation.ID, UserID: a},
+		{ConversationID: conversation.ID, UserID: b},
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&participants).Error; err != nil {
+		return conversation, err
+	}
+
+	return conversation, nil
+}
+
+// SendMessage enregistre un message dans la conversation des deux utilisateurs et prévient le destinataire.
+// La conversation revient dans la liste principale des deux participants si elle était archivée
+func SendMessage(senderID string, receiver models.User, content string) (models.PrivateMessage, error) {
+	return SendMessageWithAttachment(senderID, receiver, content, nil)
+}
+
+// SendMessageWithAttachment envoie un message accompagné d'une image déjà uploadée (attachment peut être nil)
+func SendMessageWithAttachment(senderID string, receiver models.User, content string, attachment *models.MessageAttachment) (models.PrivateMessage, error) {
+	if senderID == receiver.ID {
+		return models.PrivateMessage{}, ErrSelfMessage
+	}
+	if !receiver.MessageEnable {
+		return models.PrivateMessage{}, ErrMessagesDisabled
+	}
+	blocked, err := access.IsBlocked(senderID, receiver.ID)
+	if err != nil {
+		return models.PrivateMessage{}, err
+	}
+	if blocked {
+		return models.PrivateMessage{}, ErrBlocked
+	}
+
+	var message models.PrivateMessage
+	requestStatus := models.MessageRequestAccepted
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		conversation, err := GetOrCreateConversation(tx, senderID, receiver.ID)
+		if err != nil {
+			return err
+		}
+
+		requestStatus, err = requestStatusFor(tx, conversation, senderID, receiver)
+		if err != nil {
+			return err
+		}
+
+		message = models.PrivateMessage{
+			ConversationID: &conversation.ID,
+			SenderID:       senderID,
+			ReceiverID:     receiver.ID,
+			Content:        content,
+			Status:         models.MessageStatusUnread,
+		}
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+
+		if attachment != nil {
+			attachment.MessageID = message.ID
+			attachment.SenderID = senderID
+			attachment.ReceiverID = receiver.ID
+			if err := tx.Create(attachment).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&conversation).Updates(map[string]any{
+			"last_message_id": message.ID,
+			"last_message_at": message.CreatedAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.ConversationParticipant{}).
+			Where("conversation_id = ? AND archived_at IS NOT NULL", conversation.ID).
+			Update("archived_at", nil).Error
+	})
+	if err != nil {
+		return message, err
+	}
+
+	// Une demande refusée reste silencieuse pour le destinataire
+	if requestStatus != models.MessageRequestDeclined {
+		realtime.PublishToUser(receiver.ID, realtime.EventPrivateMessage, map[string]any{
+			"messageId":      message.ID,
+			"conversationId": message.ConversationID,
+			"senderId":       message.SenderID,
+			"content":        message.Content,
+			"request":        requestStatus == models.MessageRequestPending,
+		})
+		// Tous les appareils des deux participants, y compris les autres appareils de l'expéditeur,
+		// chacun avec sa vue de la pièce jointe (verrouillée pour le destinataire si elle est payante)
+		receiverView := withAttachment(message, attachment, receiver.ID, attachment != nil && attachment.Price == 0)
+		publishChat(ChatEvent{Type: ChatMessage, ConversationID: *message.ConversationID, Message: &receiverView}, receiver.ID)
+	}
+	message = withAttachment(message, attachment, senderID, true)
+	publishChat(ChatEvent{Type: ChatMessage, ConversationID: *message.ConversationID, Message: &message}, senderID)
+
+	return message, nil
+}
+
+// CanMessageDirectly indique si les messages de l'expéditeur arrivent dans la boîte principale du destinataire
+// plutôt que dans ses demandes : personnes qu'il suit, et ses abonnés selon son réglage
+func CanMessageDirectly(senderID string, receiver models.User) (bool, error) {
+	if receiver.DirectMessages == models.DirectMessagesEveryone {
+		return true, nil
+	}
+
+	var follows int64
+	if err := db.DB.Model(&models.UserFollow{}).
+		Where("follower_id = ? AND followed_id = ?", receiver.ID, senderID).
+		Count(&follows).Error; err != nil {
+		return false, err
+	}
+	if follows > 0 || receiver.DirectMessages == models.DirectMessagesFollowing {
+		return follows > 0, nil
+	}
+
+	return access.HasActiveSubscription(senderID, receiver.ID)
+}
+
+// requestStatusFor renvoie l'état de la conversation côté destinataire. Le premier message d'un inconnu
+// ouvre une demande ; répondre à une demande revient à l'accepter
+func requestStatusFor(tx *gorm.DB, conversation models.Conversation, senderID string, receiver models.User) (models.MessageRequestStatus, error) {
+	if err := tx.Model(&models.ConversationParticipant{}).
+		Where("conversation_id = ? AND user_id = ? AND request_status = ?", conversation.ID, senderID, models.MessageRequestPending).
+		UpdateColumn("request_status", models.MessageRequestAccepted).Error; err != nil {
+		return "", err
+	}
+
+	if conversation.LastMessageID == nil {
+		direct, err := CanMessageDirectly(senderID, receiver)
+		if err != nil || direct {
+			return models.MessageRequestAccepted, err
+		}
+		return models.MessageRequestPending, tx.Model(&models.ConversationParticipant{}).
+			Where("conversation_id = ? AND user_id = ?", conversation.ID, receiver.ID).
+			UpdateColumn("request_status", models.MessageRequestPending).Error
+	}
+
+	var participant models.ConversationParticipant
+	if err := tx.Where("conversation_id = ? AND user_id = ?", conversation.ID, receiver.ID).First(&participant).Error; err != nil {
+		return "", err
+	}
+	if participant.RequestStatus == "" {
+		return models.MessageRequestAccepted, nil
+	}
+	return participant.RequestStatus, nil
+}
+
+// SetRequestStatus accepte ou refuse une demande de message pour l'utilisateur
+func SetRequestStatus(conversationID string, userID string, status models.MessageRequestStatus) error {
+	return db.DB.Model(&models.ConversationParticipant{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		UpdateColumn("request_status", status).Error
+}
+
+func withAttachment(message models.PrivateMessage, attachment *models.MessageAttachment, viewerID string, canView bool) models.PrivateMessage {
+	if attachment != nil {
+		message.Attachments = []models.MessageAttachmentResponse{media.AttachmentResponse(*attachment, viewerID, canView)}
+	}
+	return message
+}
+
+// LoadAttachments ajoute aux messages leurs pièces jointes, telles que le lecteur peut les voir
+func LoadAttachments(messages []models.PrivateMessage, viewerID string) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	messageIDs := make([]string, 0, len(messages))
+	for _, message := range messages {
+		messageIDs = append(messageIDs, message.ID)
+	}
+
+	var attachments []models.MessageAttachment
+	if err := db.DB.Where("message_id IN ?", messageIDs).Order("created_at").Find(&attachments).Error; err != nil {
+		return err
+	}
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	paidIDs := []string{}
+	for _, attachment := range attachments {
+		if attachment.Price > 0 && attachment.ReceiverID == viewerID {
+			paidIDs = append(paidIDs, attachment.ID)
+		}
+	}
+	unlocked, err := access.UnlockedAttachments(viewerID, paidIDs)
+	if err != nil {
+		return err
+	}
+
+	byMessage := map[string][]models.MessageAttachmentResponse{}
+	for _, attachment := range attachments {
+		canView := attachment.SenderID == viewerID || attachment.Price == 0 || unlocked[attachment.ID]
+		byMessage[attachment.MessageID] = append(byMessage[attachment.MessageID], media.AttachmentResponse(attachment, viewerID, canView))
+	}
+	for i := range messages {
+		messages[i].Attachments = byMessage[messages[i].ID]
+	}
+	return nil
+}
+
+// GetParticipant vérifie que l'utilisateur participe à la conversation
+func GetParticipant(conversationID string, userID string) (models.Conversation, models.ConversationParticipant, error) {
+	var conversation models.Conversation
+	var participant models.ConversationParticipant
+
+	err := db.DB.Where("conversation_id = ? AND user_id = ?", conversationID, userID).First(&participant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return conversation, participant, ErrConversationNotFound
+	}
+	if err != nil {
+		return conversation, participant, err
+	}
+
+	if err := db.DB.First(&conversation, "id = ?", conversationID).Error; err != nil {
+		return conversation, participant, err
+	}
+
+	return conversation, participant, nil
+}
+
+// MarkConversationRead passe les messages reçus non lus de la conversation au statut READ,
+// envoie l'accusé de lecture et renvoie les identifiants des messages concernés
+func MarkConversationRead(conversation models.Conversation, userID string) ([]string, error) {
+	conversationID := conversation.ID
+	var messageIDs []string
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PrivateMessage{}).
+			Where("conversation_id = ? AND receiver_id = ? AND status = ?", conversationID, userID, models.MessageStatusUnread).
+			Pluck("id", &messageIDs).Error; err != nil {
+			return err
+		}
+		if len(messageIDs) > 0 {
+			if err := tx.Model(&models.PrivateMessage{}).Where("id IN ?", messageIDs).
+				Update("status", models.MessageStatusRead).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.ConversationParticipant{}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+			Update("last_read_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	PublishReadReceipt(conversationID, userID, conversation.OtherUserID(userID), messageIDs)
+	return messageIDs, nil
+}
+
+// ArchiveConversation archive (ou désarchive) la conversation pour l'utilisateur.
+// Les messages qu'il a reçus passent au statut ARCHIVED (READ au désarchivage)
+func ArchiveConversation(conversationID string, userID string, archived bool) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		messages := tx.Model(&models.PrivateMessage{}).Where("conversation_id = ? AND receiver_id = ?", conversationID, userID)
+
+		if archived {
+			if err := tx.Model(&models.ConversationParticipant{}).
+				Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+				Update("archived_at", time.Now()).Error; err != nil {
+				return err
+			}
+			return messages.Where("status IN ?", []models.MessageStatusType{models.MessageStatusUnread, models.MessageStatusRead}).
+				Update("status", models.MessageStatusArchived).Error
+		}
+
+		if err := tx.Model(&models.ConversationParticipant{}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+			Update("archived_at", nil).Error; err != nil {
+			return err
+		}
+		return messages.Where("status = ?", models.MessageStatusArchived).
+			Update("status", models.MessageStatusRead).Error
+	})
+}
+
+// DeleteConversation supprime la conversation pour l'utilisateur uniquement : l'historique est masqué
+// pour lui et les messages qu'il a reçus passent au statut DELETED. L'autre participant garde tout
+func DeleteConversation(conversationID string, userID string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.ConversationParticipant{}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+			Updates(map[string]any{"cleared_at": time.Now(), "archived_at": nil}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.PrivateMessage{}).
+			Where("conversation_id = ? AND receiver_id = ? AND status <> ?", conversationID, userID, models.MessageStatusDeleted).
+			Update("status", models.MessageStatusDeleted).Error
+	})
+}
+
+// BackfillConversations rattache les messages envoyés avant l'ajout des conversations
+func BackfillConversations() {
+	var pairs []struct {
+		UserA string
+		UserB string
+	}
+	if err := db.DB.Model(&models.PrivateMessage{}).
+		Select("LEAST(sender_id, receiver_id) AS user_a, GREATEST(sender_id, receiver_id) AS user_b").
+		Where("conversation_id IS NULL").
+		Group("user_a, user_b").
+		Scan(&pairs).Error; err != nil {
+		utils.LogError(err, "Error retrieving messages without conversation in BackfillConversations")
+		return
+	}
+
+	for _, p := range pairs {
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			conversation, err := GetOrCreateConversation(tx, p.UserA, p.UserB)
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Model(&models.PrivateMessage{}).
+				Where("conversation_id IS NULL AND ((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?))",
+					p.UserA, p.UserB, p.UserB, p.UserA).
+				UpdateColumn("conversation_id", conversation.ID).Error; err != nil {
+				return err
+			}
+
+			var last models.PrivateMessage
+			if err := tx.Where("conversation_id = ? AND deleted_at IS NULL", conversation.ID).
+				Order("created_at DESC").First(&last).Error; err != nil {
+				return err
+			}
+			return tx.Model(&conversation).Updates(map[string]any{
+				"last_message_id": last.ID,
+				"last_message_at": last.CreatedAt,
+			}).Error
+		})
+		if err != nil {
+			utils.LogError(err, "Error backfilling conversation in BackfillConversations")
+		}
+	}
+
+	if len(pairs) > 0 {
+		utils.LogSuccess("Private messages attached to their conversations in BackfillConversations")
+	}
+}
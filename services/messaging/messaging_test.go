@@ -0,0 +1,238 @@
+package messaging
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"pec2-backend/models"
+	"pec2-backend/services/realtime"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	testutils.InitTestMain()
+
+	log.SetOutput(io.Discard)
+
+	exitCode := m.Run()
+
+	log.SetOutput(os.Stdout)
+
+	os.Exit(exitCode)
+}
+
+func TestSendMessage_CreatesConversation(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	realtime.SetBroker(realtime.NewMemoryBroker())
+	subscription := realtime.Subscribe(realtime.UserTopic("bbbb"), 0)
+	defer subscription.Close()
+	senderDevice := realtime.Subscribe(ChatTopic("aaaa"), 0)
+	defer senderDevice.Close()
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks"`).
+		WithArgs("aaaa", "bbbb", "bbbb", "aaaa").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "conversations" WHERE user_a_id = \$1 AND user_b_id = \$2`).
+		WithArgs("aaaa", "bbbb", 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+	mock.ExpectQuery(`INSERT INTO "conversations" .* ON CONFLICT DO NOTHING RETURNING "id"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("conversation-uuid"))
+	mock.ExpectExec(`INSERT INTO "conversation_participants" .* ON CONFLICT DO NOTHING`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE "conversation_participants" SET "request_status"=\$1 WHERE conversation_id = \$2 AND user_id = \$3 AND request_status = \$4`).
+		WithArgs(models.MessageRequestAccepted, "conversation-uuid", "aaaa", models.MessageRequestPending).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// bbbb suit aaaa : le message arrive directement dans sa boîte principale
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_follows" WHERE follower_id = \$1 AND followed_id = \$2`).
+		WithArgs("bbbb", "aaaa").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`INSERT INTO "private_messages" .* RETURNING "id"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow("message-uuid", "UNREAD"))
+	mock.ExpectExec(`UPDATE "conversations" SET "last_message_at"=\$1,"last_message_id"=\$2,"updated_at"=\$3 WHERE "id" = \$4`).
+		WithArgs(sqlmock.AnyArg(), "message-uuid", sqlmock.AnyArg(), "conversation-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "conversation_participants" SET "archived_at"=\$1 WHERE conversation_id = \$2 AND archived_at IS NOT NULL`).
+		WithArgs(nil, "conversation-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	message, err := SendMessage("aaaa", models.User{ID: "bbbb", MessageEnable: true}, "Bonjour")
+	assert.NoError(t, err)
+	assert.Equal(t, "message-uuid", message.ID)
+	assert.Equal(t, "conversation-uuid", *message.ConversationID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var event realtime.UserEvent
+	assert.NoError(t, json.Unmarshal((<-subscription.C).Data, &event))
+	assert.Equal(t, realtime.EventPrivateMessage, event.Type)
+	assert.Equal(t, "conversation-uuid", event.Payload.(map[string]any)["conversationId"])
+
+	var chatEvent ChatEvent
+	assert.NoError(t, json.Unmarshal((<-senderDevice.C).Data, &chatEvent))
+	assert.Equal(t, ChatMessage, chatEvent.Type)
+	assert.Equal(t, "message-uuid", chatEvent.Message.ID)
+}
+
+func TestSendMessage_ToSelf(t *testing.T) {
+	_, err := SendMessage("aaaa", models.User{ID: "aaaa", MessageEnable: true}, "Bonjour")
+	assert.ErrorIs(t, err, ErrSelfMessage)
+}
+
+func TestSendMessage_MessagesDisabled(t *testing.T) {
+	_, err := SendMessage("aaaa", models.User{ID: "bbbb", MessageEnable: false}, "Bonjour")
+	assert.ErrorIs(t, err, ErrMessagesDisabled)
+}
+
+func TestSendMessage_OpensRequest(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	realtime.SetBroker(realtime.NewMemoryBroker())
+	subscription := realtime.Subscribe(realtime.UserTopic("bbbb"), 0)
+	defer subscription.Close()
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "conversations" WHERE user_a_id = \$1 AND user_b_id = \$2`).
+		WithArgs("aaaa", "bbbb", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_a_id", "user_b_id"}).AddRow("conversation-uuid", "aaaa", "bbbb"))
+	mock.ExpectExec(`UPDATE "conversation_participants" SET "request_status"=\$1`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// Ni suivi ni abonné : la conversation arrive dans les demandes de bbbb
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_follows"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "subscriptions"`).
+		WithArgs("aaaa", "bbbb", models.SubscriptionActive, models.SubscriptionCanceled, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`UPDATE "conversation_participants" SET "request_status"=\$1 WHERE conversation_id = \$2 AND user_id = \$3`).
+		WithArgs(models.MessageRequestPending, "conversation-uuid", "bbbb").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "private_messages" .* RETURNING "id"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow("message-uuid", "UNREAD"))
+	mock.ExpectExec(`UPDATE "conversations" SET`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "conversation_participants" SET "archived_at"=\$1`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	_, err := SendMessage("aaaa", models.User{ID: "bbbb", MessageEnable: true, DirectMessages: models.DirectMessagesSubscribers}, "Bonjour")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var event realtime.UserEvent
+	assert.NoError(t, json.Unmarshal((<-subscription.C).Data, &event))
+	assert.Equal(t, true, event.Payload.(map[string]any)["request"])
+}
+
+func TestSendMessage_Blocked(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks" WHERE \(blocker_id = \$1 AND blocked_id = \$2\) OR \(blocker_id = \$3 AND blocked_id = \$4\)`).
+		WithArgs("aaaa", "bbbb", "bbbb", "aaaa").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	_, err := SendMessage("aaaa", models.User{ID: "bbbb", MessageEnable: true}, "Bonjour")
+	assert.Equal(t, ErrBlocked, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMarkConversationRead_SendsReadReceipt(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	realtime.SetBroker(realtime.NewMemoryBroker())
+	sender := realtime.Subscribe(ChatTopic("aaaa"), 0)
+	defer sender.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "id" FROM "private_messages" WHERE conversation_id = \$1 AND receiver_id = \$2 AND status = \$3`).
+		WithArgs("conversation-uuid", "bbbb", models.MessageStatusUnread).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("message-1").AddRow("message-2"))
+	mock.ExpectExec(`UPDATE "private_messages" SET "status"=\$1,"updated_at"=\$2 WHERE id IN \(\$3,\$4\)`).
+		WithArgs(models.MessageStatusRead, sqlmock.AnyArg(), "message-1", "message-2").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE "conversation_participants" SET "last_read_at"=\$1 WHERE conversation_id = \$2 AND user_id = \$3`).
+		WithArgs(sqlmock.AnyArg(), "conversation-uuid", "bbbb").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	conversation := models.Conversation{ID: "conversation-uuid", UserAID: "aaaa", UserBID: "bbbb"}
+	messageIDs, err := MarkConversationRead(conversation, "bbbb")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"message-1", "message-2"}, messageIDs)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var receipt ChatEvent
+	select {
+	case event := <-sender.C:
+		assert.NoError(t, json.Unmarshal(event.Data, &receipt))
+	case <-time.After(time.Second):
+		t.Fatal("read receipt not published")
+	}
+	assert.Equal(t, ChatRead, receipt.Type)
+	assert.Equal(t, "bbbb", receipt.UserID)
+	assert.Equal(t, []string{"message-1", "message-2"}, receipt.MessageIDs)
+}
+
+func TestGetOrCreateConversation_OrdersUsers(t *testing.T) {
+	gormDB, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT \* FROM "conversations" WHERE user_a_id = \$1 AND user_b_id = \$2`).
+		WithArgs("aaaa", "bbbb", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_a_id", "user_b_id", "created_at"}).
+			AddRow("conversation-uuid", "aaaa", "bbbb", time.Now()))
+
+	conversation, err := GetOrCreateConversation(gormDB, "bbbb", "aaaa")
+	assert.NoError(t, err)
+	assert.Equal(t, "conversation-uuid", conversation.ID)
+	assert.Equal(t, "aaaa", conversation.OtherUserID("bbbb"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteConversation(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "conversation_participants" SET "archived_at"=\$1,"cleared_at"=\$2 WHERE conversation_id = \$3 AND user_id = \$4`).
+		WithArgs(nil, sqlmock.AnyArg(), "conversation-uuid", "aaaa").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "private_messages" SET "status"=\$1,"updated_at"=\$2 WHERE conversation_id = \$3 AND receiver_id = \$4 AND status <> \$5`).
+		WithArgs(models.MessageStatusDeleted, sqlmock.AnyArg(), "conversation-uuid", "aaaa", models.MessageStatusDeleted).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectCommit()
+
+	assert.NoError(t, DeleteConversation("conversation-uuid", "aaaa"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestArchiveConversation(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "conversation_participants" SET "archived_at"=\$1 WHERE conversation_id = \$2 AND user_id = \$3`).
+		WithArgs(sqlmock.AnyArg(), "conversation-uuid", "aaaa").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "private_messages" SET "status"=\$1,"updated_at"=\$2 WHERE \(conversation_id = \$3 AND receiver_id = \$4\) AND status IN \(\$5,\$6\)`).
+		WithArgs(models.MessageStatusArchived, sqlmock.AnyArg(), "conversation-uuid", "aaaa", models.MessageStatusUnread, models.MessageStatusRead).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	assert.NoError(t, ArchiveConversation("conversation-uuid", "aaaa", true))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
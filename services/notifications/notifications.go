@@ -0,0 +1,246 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/realtime"
+	"pec2-backend/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const queueSize = 1024
+
+// Event décrit une action à notifier à un utilisateur
+type Event struct {
+	// Destinataire de la notification
+	UserID string
+	Type   models.NotificationType
+	// Les évènements non lus avec la même clé sont regroupés ("X et 12 autres ont aimé votre post").
+	// Vide : pas de regroupement
+	GroupKey  string
+	ActorID   string
+	PostID    string
+	CommentID string
+	Detail    string
+}
+
+var (
+	queue     = make(chan Event, queueSize)
+	started   atomic.Bool
+	startOnce sync.Once
+)
+
+// Start lance l'enregistrement des notifications en arrière-plan. Tant qu'il n'est pas lancé
+// (tests), Notify ignore les évènements
+func Start() {
+	startOnce.Do(func() {
+		started.Store(true)
+		go func() {
+			for event := range queue {
+				if _, err := Record(event); err != nil {
+					utils.LogError(err, "Error recording notification "+string(event.Type))
+				}
+			}
+		}()
+	})
+}
+
+// Notify met en file une notification sans bloquer la requête en cours.
+// On ne notifie jamais un utilisateur de ses propres actions
+func Notify(event Event) {
+	if !started.Load() || event.UserID == "" || event.UserID == event.ActorID {
+		return
+	}
+
+	select {
+	case queue <- event:
+	default:
+		utils.LogError(nil, "Notification queue full, dropping "+string(event.Type))
+	}
+}
+
+// Record enregistre la notification (ou la regroupe avec une notification non lue similaire)
+// si l'utilisateur ne l'a pas désactivée, puis la pousse sur son flux /events
+func Record(event Event) (*models.Notification, error) {
+	settings, err := GetSettings(event.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enabled(event.Type) {
+		return nil, nil
+	}
+
+	var notification models.Notification
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if event.GroupKey != "" {
+			err := tx.Where("user_id = ? AND type = ? AND group_key = ? AND read_at IS NULL",
+				event.UserID, event.Type, event.GroupKey).
+				Order("updated_at DESC").First(&notification).Error
+			if err == nil {
+				return addActor(tx, &notification, event.ActorID)
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		notification = models.Notification{
+			UserID:    event.UserID,
+			Type:      event.Type,
+			GroupKey:  event.GroupKey,
+			PostID:    optional(event.PostID),
+			CommentID: optional(event.CommentID),
+			Detail:    event.Detail,
+		}
+		if err := tx.Create(&notification).Error; err != nil {
+			return err
+		}
+		return addActor(tx, &notification, event.ActorID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	responses, err := BuildResponses([]models.Notification{notification})
+	if err == nil {
+		realtime.PublishToUser(event.UserID, realtime.EventNotification, responses[0])
+	}
+
+	return &notification, nil
+}
+
+// addActor ajoute un acteur à la notification, une seule fois par acteur
+func addActor(tx *gorm.DB, notification *models.Notification, actorID string) error {
+	if actorID == "" {
+		return nil
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.NotificationActor{
+		NotificationID: notification.ID,
+		ActorID:        actorID,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	notification.ActorID = &actorID
+	notification.ActorsCount++
+	notification.UpdatedAt = time.Now()
+	return tx.Model(notification).Updates(map[string]any{
+		"actor_id":     actorID,
+		"actors_count": notification.ActorsCount,
+		"updated_at":   notification.UpdatedAt,
+	}).Error
+}
+
+func optional(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// GetSettings renvoie les préférences de notifications de l'utilisateur
+func GetSettings(userID string) (models.NotificationSettings, error) {
+	var user models.User
+	err := db.DB.Select("id", "notify_post_liked", "notify_new_comment", "notify_comment_reply", "notify_new_follower",
+		"notify_new_subscriber", "notify_tip_received", "notify_payment_failed", "notify_creator_application", "notify_report_outcome",
+		"notify_digest_frequency", "notify_digest_sent_at").
+		Where("id = ?", userID).First(&user).Error
+	return user.NotificationSettings, err
+}
+
+// BuildResponses ajoute à chaque notification son dernier acteur et le message à afficher
+func BuildResponses(notifications []models.Notification) ([]models.NotificationResponse, error) {
+	actorIDs := []string{}
+	for _, notification := range notifications {
+		if notification.ActorID != nil {
+			actorIDs = append(actorIDs, *notification.ActorID)
+		}
+	}
+
+	actors := map[string]models.NotificationActorResponse{}
+	if len(actorIDs) > 0 {
+		var users []models.NotificationActorResponse
+		if err := db.DB.Model(&models.User{}).Select("id, user_name, profile_picture").
+			Where("id IN ?", actorIDs).Find(&users).Error; err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			actors[user.ID] = user
+		}
+	}
+
+	responses := make([]models.NotificationResponse, 0, len(notifications))
+	for _, notification := range notifications {
+		response := models.NotificationResponse{
+			Notification: notification,
+			Read:         notification.ReadAt != nil,
+		}
+		actorName := "Someone"
+		if notification.ActorID != nil {
+			if actor, ok := actors[*notification.ActorID]; ok {
+				response.Actor = &actor
+				actorName = actor.UserName
+			}
+		}
+		response.Message = Message(notification, actorName)
+		responses = append(responses, response)
+	}
+
+	return responses, nil
+}
+
+// Message construit le texte d'une notification, par exemple "alice and 12 others liked your post"
+func Message(notification models.Notification, actorName string) string {
+	actors := actorName
+	if others := notification.ActorsCount - 1; others == 1 {
+		actors = actorName + " and 1 other"
+	} else if others > 1 {
+		actors = fmt.Sprintf("%s and %d others", actorName, others)
+	}
+
+	switch notification.Type {
+	case models.NotificationPostLiked:
+		return actors + " liked your post"
+	case models.NotificationNewComment:
+		return actors + " commented on your post"
+	case models.NotificationCommentReply:
+		return actors + " replied to your comment"
+	case models.NotificationNewFollower:
+		return actors + " started following you"
+	case models.NotificationFollowRequest:
+		return actors + " requested to follow you"
+	case models.NotificationFollowAccepted:
+		return actors + " accepted your follow request"
+	case models.NotificationNewSubscriber:
+		return actors + " subscribed to you"
+	case models.NotificationPaymentFailed:
+		return "The payment of your subscription to " + actorName + " failed"
+	case models.NotificationCreatorApplication:
+		if notification.Detail == string(models.ContentCreatorStatusApproved) {
+			return "Your content creator application has been approved"
+		}
+		return "Your content creator application has been rejected"
+	case models.NotificationReportOutcome:
+		return "A post you reported has been removed"
+	case models.NotificationTipReceived:
+		if amount, err := strconv.Atoi(notification.Detail); err == nil {
+			return fmt.Sprintf("%s sent you a %.2f € tip", actorName, float64(amount)/100)
+		}
+		return actorName + " sent you a tip"
+	}
+	return ""
+}
@@ -0,0 +1,154 @@
+package notifications
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"pec2-backend/models"
+	"pec2-backend/services/realtime"
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	testutils.InitTestMain()
+
+	log.SetOutput(io.Discard)
+
+	exitCode := m.Run()
+
+	log.SetOutput(os.Stdout)
+
+	os.Exit(exitCode)
+}
+
+func TestMessage(t *testing.T) {
+	notification := models.Notification{Type: models.NotificationPostLiked, ActorsCount: 1}
+	assert.Equal(t, "alice liked your post", Message(notification, "alice"))
+
+	notification.ActorsCount = 2
+	assert.Equal(t, "alice and 1 other liked your post", Message(notification, "alice"))
+
+	notification.ActorsCount = 13
+	assert.Equal(t, "alice and 12 others liked your post", Message(notification, "alice"))
+
+	notification = models.Notification{Type: models.NotificationCreatorApplication, Detail: "APPROVED"}
+	assert.Equal(t, "Your content creator application has been approved", Message(notification, "Someone"))
+}
+
+func TestRecord_TipReceivedHasItsOwnPreference(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	// Les nouveaux abonnés restent notifiés, les pourboires non
+	mock.ExpectQuery(`SELECT "id",.*"notify_tip_received".* FROM "users" WHERE id = \$1`).
+		WithArgs("creator-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "notify_new_subscriber", "notify_tip_received"}).AddRow("creator-uuid", true, false))
+
+	notification, err := Record(Event{
+		UserID:  "creator-uuid",
+		Type:    models.NotificationTipReceived,
+		ActorID: "fan-uuid",
+		Detail:  "500",
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, notification)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRecord_GroupsWithUnreadNotification(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	realtime.SetBroker(realtime.NewMemoryBroker())
+	subscription := realtime.Subscribe(realtime.UserTopic("author-uuid"), 0)
+	defer subscription.Close()
+
+	mock.ExpectQuery(`SELECT "id",.*"notify_post_liked".* FROM "users" WHERE id = \$1`).
+		WithArgs("author-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "notify_post_liked"}).AddRow("author-uuid", true))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "notifications" WHERE user_id = \$1 AND type = \$2 AND group_key = \$3 AND read_at IS NULL ORDER BY updated_at DESC`).
+		WithArgs("author-uuid", models.NotificationPostLiked, "post:post-uuid", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "type", "group_key", "actor_id", "actors_count", "created_at", "updated_at"}).
+			AddRow("notification-uuid", "author-uuid", "post_liked", "post:post-uuid", "first-liker", 12, time.Now(), time.Now()))
+	mock.ExpectExec(`INSERT INTO "notification_actors" .* ON CONFLICT DO NOTHING`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "notifications" SET "actor_id"=\$1,"actors_count"=\$2,"updated_at"=\$3 WHERE "id" = \$4`).
+		WithArgs("liker-uuid", 13, sqlmock.AnyArg(), "notification-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(`SELECT id, user_name, profile_picture FROM "users" WHERE id IN \(\$1\)`).
+		WithArgs("liker-uuid").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_name", "profile_picture"}).AddRow("liker-uuid", "alice", ""))
+
+	notification, err := Record(Event{
+		UserID:   "author-uuid",
+		Type:     models.NotificationPostLiked,
+		GroupKey: "post:post-uuid",
+		ActorID:  "liker-uuid",
+		PostID:   "post-uuid",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "notification-uuid", notification.ID)
+	assert.Equal(t, 13, notification.ActorsCount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var event realtime.UserEvent
+	assert.NoError(t, json.Unmarshal((<-subscription.C).Data, &event))
+	assert.Equal(t, realtime.EventNotification, event.Type)
+	assert.Equal(t, "alice and 12 others liked your post", event.Payload.(map[string]any)["message"])
+}
+
+func TestRecord_SameActorCountedOnce(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT "id",.* FROM "users" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "notify_post_liked"}).AddRow("author-uuid", true))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "notifications" WHERE user_id = \$1 AND type = \$2 AND group_key = \$3 AND read_at IS NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "type", "actor_id", "actors_count"}).
+			AddRow("notification-uuid", "author-uuid", "post_liked", "liker-uuid", 1))
+	mock.ExpectExec(`INSERT INTO "notification_actors" .* ON CONFLICT DO NOTHING`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT id, user_name, profile_picture FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_name", "profile_picture"}))
+
+	notification, err := Record(Event{
+		UserID:   "author-uuid",
+		Type:     models.NotificationPostLiked,
+		GroupKey: "post:post-uuid",
+		ActorID:  "liker-uuid",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, notification.ActorsCount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRecord_DisabledType(t *testing.T) {
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT "id",.* FROM "users" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "notify_post_liked", "notify_new_comment", "notify_new_follower"}).
+			AddRow("author-uuid", false, true, true))
+
+	notification, err := Record(Event{
+		UserID:  "author-uuid",
+		Type:    models.NotificationPostLiked,
+		ActorID: "liker-uuid",
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, notification)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
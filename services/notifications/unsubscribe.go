@@ -0,0 +1,83 @@
+package notifications
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+)
+
+// Durée de validité d'un lien de désinscription, largement plus longue que l'intervalle entre deux digests
+const UnsubscribeLinkTTL = 60 * 24 * time.Hour
+
+var ErrUnsubscribeDisabled = errors.New("unsubscribe links are disabled: no signing secret configured")
+
+func unsubscribeSecret() []byte {
+	if secret := os.Getenv("UNSUBSCRIBE_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte(os.Getenv("JWT_SECRET"))
+}
+
+// UnsubscribeToken signe l'identifiant de l'utilisateur et l'expiration du lien de désinscription.
+// Sans secret, n'importe qui pourrait signer : aucun jeton n'est émis
+func UnsubscribeToken(userID string, expires int64) (string, error) {
+	secret := unsubscribeSecret()
+	if len(secret) == 0 {
+		return "", ErrUnsubscribeDisabled
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "digest-unsubscribe|%s|%d", userID, expires)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifyUnsubscribeToken vérifie le jeton et l'expiration d'un lien de désinscription
+func VerifyUnsubscribeToken(userID string, expiresParam string, token string) bool {
+	expires, err := strconv.ParseInt(expiresParam, 10, 64)
+	if err != nil || userID == "" || token == "" || time.Now().Unix() > expires {
+		return false
+	}
+
+	expected, err := UnsubscribeToken(userID, expires)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(expected), []byte(token))
+}
+
+// UnsubscribeURL est le lien en un clic inclus dans les emails récapitulatifs
+func UnsubscribeURL(userID string) (string, error) {
+	expires := time.Now().Add(UnsubscribeLinkTTL).Unix()
+	token, err := UnsubscribeToken(userID, expires)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("user", userID)
+	params.Set("expires", strconv.FormatInt(expires, 10))
+	params.Set("token", token)
+	return os.Getenv("API_PUBLIC_URL") + "/notifications/digest/unsubscribe?" + params.Encode(), nil
+}
+
+// UnsubscribeFromDigest désactive l'email récapitulatif de l'utilisateur
+func UnsubscribeFromDigest(userID string) error {
+	settings, err := GetSettings(userID)
+	if err != nil {
+		return err
+	}
+	if settings.DigestFrequency == models.DigestNone {
+		return nil
+	}
+	return db.DB.Model(&models.User{}).Where("id = ?", userID).
+		Update("notify_digest_frequency", models.DigestNone).Error
+}
@@ -0,0 +1,162 @@
+package payouts
+
+import (
+	"errors"
+	"net/http"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/ledger"
+
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/transfer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Le solde lu une fois le transfert réservé est sous le minimum : rien n'est transféré
+var errNothingToTransfer = errors.New("nothing to transfer")
+
+// TransferAvailable transfère la part disponible d'un créateur vers son compte Stripe Connect,
+// qui la verse ensuite sur son IBAN selon son rythme de versement. Renvoie le montant transféré
+func TransferAvailable(creator models.User) (int, error) {
+	if creator.StripeAccountID == "" || !creator.PayoutsEnabled {
+		return 0, nil
+	}
+
+	// Un transfert resté en attente (erreur réseau, arrêt de l'instance) est renvoyé avec la même clé
+	var pending models.CreatorTransfer
+	err := db.DB.Where("creator_id = ? AND status = ?", creator.ID, models.CreatorTransferPending).First(&pending).Error
+	if err == nil {
+		return send(creator, pending)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+
+	balance, err := ledger.Balance(creator.ID)
+	if err != nil {
+		return 0, err
+	}
+	if balance.Available < models.MinTransferAmount {
+		return 0, nil
+	}
+
+	reserved, err := reserve(creator.ID)
+	if err != nil || reserved == nil {
+		return 0, err
+	}
+	return send(creator, *reserved)
+}
+
+// reserve enregistre un transfert en attente et réserve son montant au grand livre dans la même transaction.
+// L'index unique sur les transferts en attente empêche deux instances de réserver les mêmes gains
+func reserve(creatorID string) (*models.CreatorTransfer, error) {
+	var reserved *models.CreatorTransfer
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		pending := models.CreatorTransfer{CreatorID: creatorID, Status: models.CreatorTransferPending}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&pending)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		// Relu une fois la réservation acquise : il compte les transferts validés entre-temps
+		balance, err := ledger.Balance(creatorID)
+		if err != nil {
+			return err
+		}
+		if balance.Available < models.MinTransferAmount {
+			return errNothingToTransfer
+		}
+
+		pending.Amount = balance.Available
+		if err := tx.Model(&pending).Update("amount", pending.Amount).Error; err != nil {
+			return err
+		}
+		if err := ledger.RecordPayout(tx, creatorID, pending.ID, pending.Amount); err != nil {
+			return err
+		}
+		reserved = &pending
+		return nil
+	})
+	if errors.Is(err, errNothingToTransfer) {
+		return nil, nil
+	}
+	return reserved, err
+}
+
+// send crée le transfert Stripe d'un transfert réservé, puis le valide,
+// ou rend les fonds au créateur si Stripe le refuse
+func send(creator models.User, pending models.CreatorTransfer) (int, error) {
+	params := &stripe.TransferParams{
+		Amount:        stripe.Int64(int64(pending.Amount)),
+		Currency:      stripe.String(string(stripe.CurrencyEUR)),
+		Destination:   stripe.String(creator.StripeAccountID),
+		TransferGroup: stripe.String("creator-" + creator.ID),
+	}
+	params.AddMetadata("creator_id", creator.ID)
+	params.AddMetadata("transfer_id", pending.ID)
+	params.SetIdempotencyKey("creator-transfer-" + pending.ID)
+
+	tr, err := transfer.New(params)
+	if err != nil {
+		// Refus de Stripe : le transfert n'a pas eu lieu. Sinon (réseau, panne), il reste en attente et sera renvoyé
+		var stripeErr *stripe.Error
+		if errors.As(err, &stripeErr) && stripeErr.Type == stripe.ErrorTypeInvalidRequest &&
+			stripeErr.HTTPStatusCode != http.StatusTooManyRequests {
+			if failErr := Fail(pending, stripeErr.Msg); failErr != nil {
+				return 0, failErr
+			}
+		}
+		return 0, err
+	}
+
+	if err := Confirm(pending.ID, tr.ID); err != nil {
+		return 0, err
+	}
+	return pending.Amount, nil
+}
+
+// Confirm valide un transfert en attente que Stripe a créé
+func Confirm(transferID string, stripeTransferID string) error {
+	return db.DB.Model(&models.CreatorTransfer{}).
+		Where("id = ? AND status = ?", transferID, models.CreatorTransferPending).
+		Updates(map[string]interface{}{
+			"status":             models.CreatorTransferSucceeded,
+			"stripe_transfer_id": stripeTransferID,
+		}).Error
+}
+
+// Fail marque un transfert en attente refusé par Stripe et rend son montant aux gains disponibles
+func Fail(pending models.CreatorTransfer, reason string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.CreatorTransfer{}).
+			Where("id = ? AND status = ?", pending.ID, models.CreatorTransferPending).
+			Updates(map[string]interface{}{
+				"status":          models.CreatorTransferFailed,
+				"failure_message": reason,
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return ledger.ReversePayout(tx, pending.CreatorID, pending.ID, pending.Amount)
+	})
+}
+
+// RecordReversals rend aux gains disponibles les annulations d'un transfert déjà effectué
+func RecordReversals(sent models.CreatorTransfer, tr stripe.Transfer) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if tr.Reversals != nil {
+			for _, reversal := range tr.Reversals.Data {
+				if err := ledger.ReversePayout(tx, sent.CreatorID, reversal.ID, int(reversal.Amount)); err != nil {
+					return err
+				}
+			}
+		}
+		if !tr.Reversed {
+			return nil
+		}
+		return tx.Model(&models.CreatorTransfer{}).Where("id = ?", sent.ID).
+			Update("status", models.CreatorTransferReversed).Error
+	})
+}
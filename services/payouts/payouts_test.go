@@ -0,0 +1,182 @@
+package payouts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pec2-backend/models"
+	"pec2-backend/testutils"
+	"pec2-backend/utils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stripe/stripe-go/v82"
+)
+
+// stripeStandIn remplace l'API Stripe le temps d'un test, comme stripe-mock en local
+func stripeStandIn(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	t.Setenv("STRIPE_SECRET_KEY", "sk_test_local")
+	t.Setenv("STRIPE_API_BASE", server.URL)
+	utils.InitStripe()
+	t.Cleanup(func() {
+		server.Close()
+		stripe.SetBackend(stripe.APIBackend, nil)
+	})
+}
+
+func expectBalance(mock sqlmock.Sqlmock, available, paidOut int) {
+	mock.ExpectQuery(`SELECT ledger_transactions.kind, ledger_entries.account, SUM\(ledger_entries.amount\) AS total FROM "ledger_entries"`).
+		WithArgs("creator-uuid").
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "account", "total"}).
+			AddRow(models.LedgerRelease, models.LedgerAccountCreatorAvailable, -(available+paidOut)).
+			AddRow(models.LedgerPayout, models.LedgerAccountCreatorAvailable, paidOut))
+}
+
+func expectNoPendingTransfer(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT \* FROM "creator_transfers" WHERE creator_id = \$1 AND status = \$2`).
+		WithArgs("creator-uuid", models.CreatorTransferPending, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+// expectReservation attend le transfert en attente et la réservation de son montant au grand livre
+func expectReservation(mock sqlmock.Sqlmock, available, paidOut int) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "creator_transfers" .* ON CONFLICT DO NOTHING`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("transfer-uuid"))
+	expectBalance(mock, available, paidOut)
+	mock.ExpectExec(`UPDATE "creator_transfers" SET "amount"=\$1,"updated_at"=\$2 WHERE "id" = \$3`).
+		WithArgs(available, sqlmock.AnyArg(), "transfer-uuid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "ledger_transactions"`).
+		WithArgs(models.LedgerPayout, "transfer-uuid", "creator-uuid", nil, "", "", available, nil, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("payout-uuid"))
+	mock.ExpectQuery(`INSERT INTO "ledger_entries"`).
+		WithArgs(
+			"payout-uuid", models.LedgerAccountCreatorAvailable, "creator-uuid", available, sqlmock.AnyArg(),
+			"payout-uuid", models.LedgerAccountStripe, nil, -available, sqlmock.AnyArg(),
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("entry-1").AddRow("entry-2"))
+	mock.ExpectCommit()
+}
+
+func TestTransferAvailable_TransfersToConnectedAccount(t *testing.T) {
+	var form map[string][]string
+	var idempotencyKey string
+	stripeStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/transfers", r.URL.Path)
+		_ = r.ParseForm()
+		form = r.PostForm
+		idempotencyKey = r.Header.Get("Idempotency-Key")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": "tr_local", "object": "transfer", "amount": 1500, "currency": "eur"}`))
+	})
+
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectNoPendingTransfer(mock)
+	expectBalance(mock, 1500, 3000)
+	expectReservation(mock, 1500, 3000)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "creator_transfers" SET "status"=\$1,"stripe_transfer_id"=\$2,"updated_at"=\$3 WHERE id = \$4 AND status = \$5`).
+		WithArgs(models.CreatorTransferSucceeded, "tr_local", sqlmock.AnyArg(), "transfer-uuid", models.CreatorTransferPending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	amount, err := TransferAvailable(models.User{ID: "creator-uuid", StripeAccountID: "acct_creator", PayoutsEnabled: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1500, amount)
+	assert.Equal(t, []string{"1500"}, form["amount"])
+	assert.Equal(t, []string{"acct_creator"}, form["destination"])
+	assert.Equal(t, []string{"transfer-uuid"}, form["metadata[transfer_id]"])
+	assert.Equal(t, "creator-transfer-transfer-uuid", idempotencyKey)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransferAvailable_RefusedTransferReleasesFunds(t *testing.T) {
+	stripeStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error": {"type": "invalid_request_error", "code": "balance_insufficient", "message": "Insufficient funds"}}`))
+	})
+
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectNoPendingTransfer(mock)
+	expectBalance(mock, 1500, 0)
+	expectReservation(mock, 1500, 0)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "creator_transfers" SET "failure_message"=\$1,"status"=\$2,"updated_at"=\$3 WHERE id = \$4 AND status = \$5`).
+		WithArgs("Insufficient funds", models.CreatorTransferFailed, sqlmock.AnyArg(), "transfer-uuid", models.CreatorTransferPending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "ledger_transactions" WHERE kind = \$1 AND reference = \$2`).
+		WithArgs(models.LedgerPayoutReversal, "transfer-uuid").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`INSERT INTO "ledger_transactions"`).
+		WithArgs(models.LedgerPayoutReversal, "transfer-uuid", "creator-uuid", nil, "", "", 1500, nil, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("reversal-uuid"))
+	mock.ExpectQuery(`INSERT INTO "ledger_entries"`).
+		WithArgs(
+			"reversal-uuid", models.LedgerAccountStripe, nil, 1500, sqlmock.AnyArg(),
+			"reversal-uuid", models.LedgerAccountCreatorAvailable, "creator-uuid", -1500, sqlmock.AnyArg(),
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("entry-3").AddRow("entry-4"))
+	mock.ExpectCommit()
+
+	amount, err := TransferAvailable(models.User{ID: "creator-uuid", StripeAccountID: "acct_creator", PayoutsEnabled: true})
+
+	assert.Error(t, err)
+	assert.Equal(t, 0, amount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransferAvailable_ResendsPendingTransfer(t *testing.T) {
+	var idempotencyKey string
+	stripeStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey = r.Header.Get("Idempotency-Key")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": "tr_local", "object": "transfer", "amount": 1500, "currency": "eur"}`))
+	})
+
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	// L'instance précédente s'est arrêtée après la réservation : aucun nouveau montant n'est réservé
+	mock.ExpectQuery(`SELECT \* FROM "creator_transfers" WHERE creator_id = \$1 AND status = \$2`).
+		WithArgs("creator-uuid", models.CreatorTransferPending, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "creator_id", "amount", "status"}).
+			AddRow("transfer-uuid", "creator-uuid", 1500, models.CreatorTransferPending))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "creator_transfers" SET "status"=\$1,"stripe_transfer_id"=\$2`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	amount, err := TransferAvailable(models.User{ID: "creator-uuid", StripeAccountID: "acct_creator", PayoutsEnabled: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1500, amount)
+	assert.Equal(t, "creator-transfer-transfer-uuid", idempotencyKey)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransferAvailable_WaitsForMinimumAmount(t *testing.T) {
+	stripeStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected Stripe call %s", r.URL.Path)
+	})
+
+	_, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	expectNoPendingTransfer(mock)
+	expectBalance(mock, models.MinTransferAmount-1, 0)
+
+	amount, err := TransferAvailable(models.User{ID: "creator-uuid", StripeAccountID: "acct_creator", PayoutsEnabled: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, amount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,75 @@
+package realtime
+
+import (
+	"os"
+	"sync"
+
+	"pec2-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// Broker diffuse les évènements temps réel (SSE) à tous les abonnés d'un topic,
+// quelle que soit l'instance de l'API sur laquelle ils sont connectés. Les payloads sont du JSON.
+type Broker interface {
+	Publish(topic string, payload []byte) error
+	// Subscribe s'abonne au topic. Avec lastEventID > 0, la souscription contient les évènements manqués.
+	Subscribe(topic string, lastEventID uint64) *Subscription
+	// Stats renvoie le nombre d'abonnés et de topics en historique sur cette instance
+	Stats() (int, int)
+	Close() error
+}
+
+var (
+	defaultBroker Broker = NewMemoryBroker()
+	brokerMutex   sync.RWMutex
+)
+
+// Init choisit le broker selon REALTIME_BROKER : "postgres" (par défaut, nécessaire avec plusieurs instances)
+// ou "memory" (une seule instance)
+func Init(dsn string, gormDB *gorm.DB) {
+	if os.Getenv("REALTIME_BROKER") == "memory" {
+		utils.LogInfo("Realtime broker: memory")
+		return
+	}
+
+	broker, err := NewPostgresBroker(dsn, gormDB)
+	if err != nil {
+		utils.LogError(err, "Error starting the PostgreSQL realtime broker, falling back to memory")
+		return
+	}
+	SetBroker(broker)
+	utils.LogSuccess("Realtime broker: PostgreSQL LISTEN/NOTIFY")
+}
+
+// SetBroker remplace le broker utilisé par l'application (utile pour les tests)
+func SetBroker(broker Broker) {
+	brokerMutex.Lock()
+	previous := defaultBroker
+	defaultBroker = broker
+	brokerMutex.Unlock()
+
+	if previous != nil && previous != broker {
+		previous.Close()
+	}
+}
+
+func getBroker() Broker {
+	brokerMutex.RLock()
+	defer brokerMutex.RUnlock()
+	return defaultBroker
+}
+
+// Publish envoie un message à tous les abonnés du topic
+func Publish(topic string, payload []byte) error {
+	if err := getBroker().Publish(topic, payload); err != nil {
+		return err
+	}
+	metrics.eventsPublished.Add(1)
+	return nil
+}
+
+// Subscribe s'abonne à un topic (lastEventID à 0 pour ne rien rejouer), la souscription doit être fermée avec Close
+func Subscribe(topic string, lastEventID uint64) *Subscription {
+	return getBroker().Subscribe(topic, lastEventID)
+}
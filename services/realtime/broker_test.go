@@ -0,0 +1,273 @@
+package realtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"pec2-backend/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func receive(t *testing.T, sub *Subscription) Event {
+	select {
+	case event, ok := <-sub.C:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+	return Event{}
+}
+
+func TestMemoryBroker_PublishSubscribe(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+
+	first := broker.Subscribe("post:1:comments", 0)
+	second := broker.Subscribe("post:1:comments", 0)
+	other := broker.Subscribe("post:2:comments", 0)
+
+	assert.NoError(t, broker.Publish("post:1:comments", []byte(`{"type":"new_comment"}`)))
+
+	event := receive(t, first)
+	assert.Equal(t, `{"type":"new_comment"}`, string(event.Data))
+	assert.Equal(t, event.ID, receive(t, second).ID)
+	assert.Len(t, other.C, 0)
+
+	// Après Close, le channel est fermé et plus rien n'est reçu
+	first.Close()
+	first.Close()
+	_, ok := <-first.C
+	assert.False(t, ok)
+	assert.NoError(t, first.Err())
+
+	assert.NoError(t, broker.Publish("post:1:comments", []byte(`{"type":"comment_deleted"}`)))
+	next := receive(t, second)
+	assert.Equal(t, `{"type":"comment_deleted"}`, string(next.Data))
+	assert.Greater(t, next.ID, event.ID)
+}
+
+func TestMemoryBroker_ResumeFromLastEventID(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+
+	sub := broker.Subscribe("topic", 0)
+	assert.NoError(t, broker.Publish("topic", []byte(`{"n":1}`)))
+	first := receive(t, sub)
+	sub.Close()
+
+	// Évènements publiés pendant la déconnexion
+	assert.NoError(t, broker.Publish("topic", []byte(`{"n":2}`)))
+	assert.NoError(t, broker.Publish("other", []byte(`{"n":0}`)))
+	assert.NoError(t, broker.Publish("topic", []byte(`{"n":3}`)))
+
+	resumed := broker.Subscribe("topic", first.ID)
+	defer resumed.Close()
+	assert.True(t, resumed.Resumed)
+	assert.Len(t, resumed.Missed, 2)
+	assert.Equal(t, `{"n":2}`, string(resumed.Missed[0].Data))
+	assert.Equal(t, `{"n":3}`, string(resumed.Missed[1].Data))
+}
+
+func TestMemoryBroker_ResumeTooOld(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+
+	assert.NoError(t, broker.Publish("topic", []byte(`{"n":1}`)))
+	for i := 0; i < topicHistorySize+5; i++ {
+		assert.NoError(t, broker.Publish("topic", []byte(`{}`)))
+	}
+
+	// Le premier évènement n'est plus dans l'historique : reprise impossible
+	sub := broker.Subscribe("topic", broker.hub.floor+1)
+	defer sub.Close()
+	assert.False(t, sub.Resumed)
+
+	// Un identifiant antérieur au démarrage de l'instance ne peut pas être repris non plus
+	old := broker.Subscribe("other", 42)
+	defer old.Close()
+	assert.False(t, old.Resumed)
+}
+
+func TestMemoryBroker_SlowConsumerDisconnected(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+
+	slow := broker.Subscribe("topic", 0)
+	fast := broker.Subscribe("topic", 0)
+	for i := 0; i < subscriptionBufferSize+10; i++ {
+		assert.NoError(t, broker.Publish("topic", []byte(`{}`)))
+		<-fast.C
+	}
+
+	// Le buffer plein entraîne la déconnexion, les messages déjà bufferisés restent lisibles
+	count := 0
+	for range slow.C {
+		count++
+	}
+	assert.Equal(t, subscriptionBufferSize, count)
+	assert.ErrorIs(t, slow.Err(), ErrSlowConsumer)
+
+	subscriptions, _ := broker.Stats()
+	assert.Equal(t, 1, subscriptions)
+}
+
+func TestEnvelope(t *testing.T) {
+	data, err := encodeEnvelope(Event{ID: 12, Topic: "post:1:comments", Data: []byte(`{"type":"new_comment"}`)})
+	assert.NoError(t, err)
+
+	event, stored, err := decodeEnvelope(data)
+	assert.NoError(t, err)
+	assert.False(t, stored)
+	assert.Equal(t, uint64(12), event.ID)
+	assert.Equal(t, "post:1:comments", event.Topic)
+	assert.JSONEq(t, `{"type":"new_comment"}`, string(event.Data))
+
+	_, err = encodeEnvelope(Event{ID: 1, Topic: "topic", Data: []byte("not json")})
+	assert.ErrorIs(t, err, ErrInvalidPayload)
+
+	_, stored, err = decodeEnvelope([]byte(`{"id":3,"topic":"topic","stored":true}`))
+	assert.NoError(t, err)
+	assert.True(t, stored)
+
+	_, _, err = decodeEnvelope([]byte(`{"id":1,"payload":{}}`))
+	assert.Error(t, err)
+}
+
+func TestPostgresBroker_DispatchesNotifications(t *testing.T) {
+	broker := &PostgresBroker{hub: newHub(0)}
+	sub := broker.Subscribe("post:1:comments", 0)
+	defer sub.Close()
+
+	data, _ := encodeEnvelope(Event{ID: 7, Topic: "post:1:comments", Data: []byte(`{"type":"new_comment"}`)})
+	broker.handleNotification(string(data))
+	broker.handleNotification("invalid")
+
+	event := receive(t, sub)
+	assert.Equal(t, uint64(7), event.ID)
+	assert.JSONEq(t, `{"type":"new_comment"}`, string(event.Data))
+}
+
+func TestPostgresBroker_LargePayloadStored(t *testing.T) {
+	gormDB, mock, cleanup := testutils.SetupTestDB(t)
+	defer cleanup()
+
+	broker := &PostgresBroker{hub: newHub(0), db: gormDB}
+	payload := `{"content":"` + strings.Repeat("a", maxNotifyPayload) + `"}`
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM realtime_payloads WHERE created_at < \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO realtime_payloads \(id, topic, payload\) VALUES \(nextval\('realtime_event_seq'\), \$1, \$2::json\) RETURNING id`).
+		WithArgs("topic", payload).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectExec(`SELECT pg_notify\(\$1, json_build_object\('id', \$2::bigint, 'topic', \$3::text, 'stored', true\)::text\)`).
+		WithArgs(notifyChannel, 42, "topic").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	assert.NoError(t, broker.Publish("topic", []byte(payload)))
+
+	// Les instances qui reçoivent la notification chargent le payload
+	sub := broker.Subscribe("topic", 0)
+	defer sub.Close()
+	mock.ExpectQuery(`SELECT payload FROM realtime_payloads WHERE id = \$1`).
+		WithArgs(42).
+		WillReturnRows(sqlmock.NewRows([]string{"payload"}).AddRow(payload))
+
+	broker.handleNotification(`{"id":42,"topic":"topic","stored":true}`)
+
+	event := receive(t, sub)
+	assert.Equal(t, uint64(42), event.ID)
+	assert.JSONEq(t, payload, string(event.Data))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Lance ServeSSE et renvoie le flux reçu une fois la requête annulée
+func serveSSE(t *testing.T, lastEventID string, whileConnected func()) string {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil).WithContext(ctx)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		ServeSSE(w, req, "topic", SSEOptions{
+			EventName: "comment",
+			Snapshot: func(send func(data []byte)) {
+				send([]byte(`{"type":"existing_comment"}`))
+			},
+		})
+		close(done)
+	}()
+
+	// Laisse le temps à l'abonnement de s'établir
+	time.Sleep(50 * time.Millisecond)
+	whileConnected()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	return w.Body.String()
+}
+
+func TestServeSSE(t *testing.T) {
+	broker := NewMemoryBroker()
+	SetBroker(broker)
+	defer SetBroker(NewMemoryBroker())
+
+	var lastID uint64
+	body := serveSSE(t, "", func() {
+		assert.NoError(t, Publish("topic", []byte(`{"type":"new_comment"}`)))
+		lastID = broker.lastID.Load()
+	})
+
+	assert.Contains(t, body, "retry: 3000")
+	assert.Contains(t, body, `"resumed":false`)
+	assert.Contains(t, body, "event: comment\ndata: {\"type\":\"existing_comment\"}")
+	assert.Contains(t, body, "id: "+strconv.FormatUint(lastID, 10)+"\nevent: comment\ndata: {\"type\":\"new_comment\"}")
+
+	// Évènement manqué pendant la déconnexion
+	assert.NoError(t, Publish("topic", []byte(`{"type":"comment_updated"}`)))
+
+	resumed := serveSSE(t, strconv.FormatUint(lastID, 10), func() {})
+	assert.Contains(t, resumed, `"resumed":true`)
+	assert.Contains(t, resumed, `{"type":"comment_updated"}`)
+	assert.NotContains(t, resumed, "existing_comment")
+	assert.NotContains(t, resumed, `{"type":"new_comment"}`)
+
+	// Identifiant inconnu : le client doit tout recharger
+	resync := serveSSE(t, "42", func() {})
+	assert.Contains(t, resync, "event: resync")
+	assert.Contains(t, resync, "existing_comment")
+
+	metrics := GetMetrics()
+	assert.GreaterOrEqual(t, metrics.TotalConnections, int64(3))
+	assert.GreaterOrEqual(t, metrics.ResumedConnections, int64(1))
+	assert.GreaterOrEqual(t, metrics.ResyncedConnections, int64(1))
+	assert.Equal(t, int64(0), metrics.ActiveConnections)
+}
+
+func TestLastEventID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/sse?lastEventId=15", nil)
+	assert.Equal(t, uint64(15), LastEventID(req))
+
+	req.Header.Set("Last-Event-ID", "20")
+	assert.Equal(t, uint64(20), LastEventID(req))
+
+	req = httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	assert.Equal(t, uint64(0), LastEventID(req))
+}
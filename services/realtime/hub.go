@@ -0,0 +1,229 @@
+package realtime
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// Taille du buffer de chaque abonné : au-delà, le client est considéré comme trop lent et déconnecté
+	subscriptionBufferSize = 64
+	// Nombre d'évènements gardés par topic pour la reprise (Last-Event-ID)
+	topicHistorySize = 256
+	// Durée de conservation de l'historique d'un topic sans activité
+	topicHistoryTTL = 15 * time.Minute
+)
+
+// ErrSlowConsumer indique que l'abonné a été déconnecté car son buffer était plein
+var ErrSlowConsumer = errors.New("slow consumer disconnected")
+
+// Event est un message publié sur un topic, avec un identifiant croissant partagé par toutes les instances
+type Event struct {
+	ID    uint64
+	Topic string
+	Data  []byte
+}
+
+// Subscription reçoit les évènements d'un topic sur C jusqu'à sa fermeture
+type Subscription struct {
+	Topic string
+	C     <-chan Event
+
+	// Évènements manqués depuis le Last-Event-ID demandé
+	Missed []Event
+	// false si des évènements manqués ne sont plus dans l'historique : le client doit tout recharger
+	Resumed bool
+	// Dernier identifiant connu au moment de l'abonnement
+	LatestID uint64
+
+	ch   chan Event
+	hub  *hub
+	once sync.Once
+	err  error
+}
+
+// Close désabonne et ferme le channel C
+func (s *Subscription) Close() {
+	s.closeWithError(nil)
+}
+
+// Err renvoie la raison de la fermeture (ErrSlowConsumer) une fois C fermé
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.err
+}
+
+func (s *Subscription) closeWithError(err error) {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		defer s.hub.mu.Unlock()
+		s.hub.removeLocked(s)
+		s.err = err
+		close(s.ch)
+	})
+}
+
+type topicHistory struct {
+	events []Event
+	// Identifiant du dernier évènement sorti de l'historique
+	evictedUpTo uint64
+	updatedAt   time.Time
+}
+
+// hub distribue les évènements aux abonnés connectés à cette instance et garde un historique par topic
+type hub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[*Subscription]struct{}
+	history     map[string]*topicHistory
+	// Tous les évènements d'identifiant supérieur à floor ont été vus par cette instance
+	floor uint64
+	// Plus grand identifiant d'évènement supprimé avec l'historique d'un topic inactif
+	prunedUpTo uint64
+	latestID   uint64
+	lastPrune  time.Time
+}
+
+func newHub(floor uint64) *hub {
+	return &hub{
+		subscribers: make(map[string]map[*Subscription]struct{}),
+		history:     make(map[string]*topicHistory),
+		floor:       floor,
+		latestID:    floor,
+		lastPrune:   time.Now(),
+	}
+}
+
+// setFloor est appelé quand des évènements ont pu être manqués (reconnexion du listener)
+func (h *hub) setFloor(floor uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.floor = max(h.floor, floor)
+	h.latestID = max(h.latestID, floor)
+}
+
+// subscribe enregistre l'abonné et calcule les évènements manqués de façon atomique,
+// pour qu'aucun évènement ne soit perdu ni reçu en double entre l'historique et le channel
+func (h *hub) subscribe(topic string, lastEventID uint64) *Subscription {
+	ch := make(chan Event, subscriptionBufferSize)
+	sub := &Subscription{Topic: topic, C: ch, ch: ch, hub: h, Resumed: true}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers[topic] == nil {
+		h.subscribers[topic] = make(map[*Subscription]struct{})
+	}
+	h.subscribers[topic][sub] = struct{}{}
+	sub.LatestID = h.latestID
+
+	if lastEventID == 0 {
+		return sub
+	}
+
+	available := max(h.floor, h.prunedUpTo)
+	history := h.history[topic]
+	if history != nil {
+		available = max(h.floor, history.evictedUpTo)
+		for _, event := range history.events {
+			if event.ID > lastEventID {
+				sub.Missed = append(sub.Missed, event)
+			}
+		}
+	}
+	sub.Resumed = lastEventID >= available
+
+	return sub
+}
+
+func (h *hub) removeLocked(sub *Subscription) {
+	if subscribers, ok := h.subscribers[sub.Topic]; ok {
+		delete(subscribers, sub)
+		if len(subscribers) == 0 {
+			delete(h.subscribers, sub.Topic)
+		}
+	}
+}
+
+func (h *hub) dispatch(event Event) {
+	var slowConsumers []*Subscription
+
+	h.mu.Lock()
+	h.latestID = max(h.latestID, event.ID)
+	h.appendHistoryLocked(event)
+
+	for sub := range h.subscribers[event.Topic] {
+		select {
+		case sub.ch <- event:
+			metrics.eventsDelivered.Add(1)
+		default:
+			slowConsumers = append(slowConsumers, sub)
+		}
+	}
+	h.pruneLocked()
+	h.mu.Unlock()
+
+	// Le client se reconnectera avec son Last-Event-ID et récupérera les évènements manqués
+	for _, sub := range slowConsumers {
+		metrics.slowConsumerDisconnects.Add(1)
+		sub.closeWithError(ErrSlowConsumer)
+	}
+}
+
+func (h *hub) appendHistoryLocked(event Event) {
+	history := h.history[event.Topic]
+	if history == nil {
+		history = &topicHistory{}
+		h.history[event.Topic] = history
+	}
+	history.events = append(history.events, event)
+	if len(history.events) > topicHistorySize {
+		history.evictedUpTo = history.events[0].ID
+		history.events = history.events[1:]
+	}
+	history.updatedAt = time.Now()
+}
+
+// pruneLocked supprime régulièrement l'historique des topics inactifs
+func (h *hub) pruneLocked() {
+	if time.Since(h.lastPrune) < time.Minute {
+		return
+	}
+	h.lastPrune = time.Now()
+
+	for topic, history := range h.history {
+		if time.Since(history.updatedAt) > topicHistoryTTL && len(h.subscribers[topic]) == 0 {
+			if len(history.events) > 0 {
+				h.prunedUpTo = max(h.prunedUpTo, history.events[len(history.events)-1].ID)
+			}
+			delete(h.history, topic)
+		}
+	}
+}
+
+func (h *hub) stats() (int, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subscriptions := 0
+	for _, subscribers := range h.subscribers {
+		subscriptions += len(subscribers)
+	}
+	return subscriptions, len(h.history)
+}
+
+func (h *hub) closeAll() {
+	h.mu.Lock()
+	var all []*Subscription
+	for _, subscribers := range h.subscribers {
+		for sub := range subscribers {
+			all = append(all, sub)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, sub := range all {
+		sub.Close()
+	}
+}
@@ -0,0 +1,38 @@
+package realtime
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// MemoryBroker diffuse les évènements uniquement aux clients connectés à cette instance
+type MemoryBroker struct {
+	hub    *hub
+	lastID atomic.Uint64
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	// Identifiants basés sur l'heure de démarrage pour rester croissants après un redémarrage
+	seed := uint64(time.Now().UnixMilli()) * 1000
+	broker := &MemoryBroker{hub: newHub(seed)}
+	broker.lastID.Store(seed)
+	return broker
+}
+
+func (b *MemoryBroker) Publish(topic string, payload []byte) error {
+	b.hub.dispatch(Event{ID: b.lastID.Add(1), Topic: topic, Data: payload})
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(topic string, lastEventID uint64) *Subscription {
+	return b.hub.subscribe(topic, lastEventID)
+}
+
+func (b *MemoryBroker) Stats() (int, int) {
+	return b.hub.stats()
+}
+
+func (b *MemoryBroker) Close() error {
+	b.hub.closeAll()
+	return nil
+}
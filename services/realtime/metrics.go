@@ -0,0 +1,42 @@
+package realtime
+
+import "sync/atomic"
+
+var metrics struct {
+	activeConnections       atomic.Int64
+	totalConnections        atomic.Int64
+	resumedConnections      atomic.Int64
+	resyncedConnections     atomic.Int64
+	eventsPublished         atomic.Int64
+	eventsDelivered         atomic.Int64
+	slowConsumerDisconnects atomic.Int64
+}
+
+// Metrics sont les compteurs des flux SSE de cette instance depuis son démarrage
+type Metrics struct {
+	ActiveConnections       int64 `json:"activeConnections"`
+	TotalConnections        int64 `json:"totalConnections"`
+	ResumedConnections      int64 `json:"resumedConnections"`
+	ResyncedConnections     int64 `json:"resyncedConnections"`
+	EventsPublished         int64 `json:"eventsPublished"`
+	EventsDelivered         int64 `json:"eventsDelivered"`
+	SlowConsumerDisconnects int64 `json:"slowConsumerDisconnects"`
+	Subscriptions           int   `json:"subscriptions"`
+	BufferedTopics          int   `json:"bufferedTopics"`
+}
+
+// GetMetrics renvoie un instantané des compteurs
+func GetMetrics() Metrics {
+	subscriptions, topics := getBroker().Stats()
+	return Metrics{
+		ActiveConnections:       metrics.activeConnections.Load(),
+		TotalConnections:        metrics.totalConnections.Load(),
+		ResumedConnections:      metrics.resumedConnections.Load(),
+		ResyncedConnections:     metrics.resyncedConnections.Load(),
+		EventsPublished:         metrics.eventsPublished.Load(),
+		EventsDelivered:         metrics.eventsDelivered.Load(),
+		SlowConsumerDisconnects: metrics.slowConsumerDisconnects.Load(),
+		Subscriptions:           subscriptions,
+		BufferedTopics:          topics,
+	}
+}
@@ -0,0 +1,227 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"pec2-backend/utils"
+
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// Canal PostgreSQL partagé par toutes les instances
+const notifyChannel = "realtime_events"
+
+// Limite de PostgreSQL pour le payload d'un NOTIFY (8000 octets), en gardant de la marge pour l'enveloppe
+const maxNotifyPayload = 7900
+
+var ErrInvalidPayload = errors.New("realtime payload must be valid JSON")
+
+// Séquence partagée par les instances pour numéroter les évènements
+const eventSequence = "realtime_event_seq"
+
+// Les payloads trop gros pour un NOTIFY y sont stockés : la notification ne porte que leur identifiant
+const payloadTable = "realtime_payloads"
+
+// Durée de conservation des payloads stockés, largement suffisante pour que toutes les instances les lisent
+const payloadRetention = time.Hour
+
+type envelope struct {
+	ID      uint64          `json:"id"`
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Le payload est à charger depuis realtime_payloads
+	Stored bool `json:"stored,omitempty"`
+}
+
+// PostgresBroker publie via NOTIFY et écoute via LISTEN : chaque instance reçoit tous les messages
+// et les distribue à ses propres clients
+type PostgresBroker struct {
+	hub    *hub
+	dsn    string
+	db     *gorm.DB
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewPostgresBroker(dsn string, gormDB *gorm.DB) (*PostgresBroker, error) {
+	if err := gormDB.Exec("CREATE SEQUENCE IF NOT EXISTS " + eventSequence).Error; err != nil {
+		return nil, fmt.Errorf("error creating %s: %v", eventSequence, err)
+	}
+	if err := gormDB.Exec("CREATE TABLE IF NOT EXISTS " + payloadTable +
+		" (id bigint PRIMARY KEY, topic text NOT NULL, payload json NOT NULL, created_at timestamptz NOT NULL DEFAULT now())").Error; err != nil {
+		return nil, fmt.Errorf("error creating %s: %v", payloadTable, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	broker := &PostgresBroker{
+		hub:    newHub(0),
+		dsn:    dsn,
+		db:     gormDB,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	// Première connexion synchrone pour remonter une configuration invalide
+	conn, err := broker.listen(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go broker.run(ctx, conn)
+	return broker, nil
+}
+
+func (b *PostgresBroker) Publish(topic string, payload []byte) error {
+	// L'identifiant (20 chiffres max) est ajouté par PostgreSQL, on le compte dans la taille
+	data, err := encodeEnvelope(Event{ID: 1<<64 - 1, Topic: topic, Data: payload})
+	if err != nil {
+		return err
+	}
+	if len(data) > maxNotifyPayload {
+		return b.publishStored(topic, payload)
+	}
+
+	return b.db.Exec(
+		"SELECT pg_notify(?, json_build_object('id', nextval('"+eventSequence+"'), 'topic', ?::text, 'payload', ?::json)::text)",
+		notifyChannel, topic, string(payload),
+	).Error
+}
+
+// publishStored enregistre le payload en base et ne notifie que son identifiant
+func (b *PostgresBroker) publishStored(topic string, payload []byte) error {
+	return b.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM "+payloadTable+" WHERE created_at < ?", time.Now().Add(-payloadRetention)).Error; err != nil {
+			return err
+		}
+
+		var id uint64
+		if err := tx.Raw(
+			"INSERT INTO "+payloadTable+" (id, topic, payload) VALUES (nextval('"+eventSequence+"'), ?, ?::json) RETURNING id",
+			topic, string(payload),
+		).Scan(&id).Error; err != nil {
+			return err
+		}
+
+		// NOTIFY n'est délivré qu'au commit : les autres instances trouveront la ligne
+		return tx.Exec(
+			"SELECT pg_notify(?, json_build_object('id', ?::bigint, 'topic', ?::text, 'stored', true)::text)",
+			notifyChannel, id, topic,
+		).Error
+	})
+}
+
+func (b *PostgresBroker) Subscribe(topic string, lastEventID uint64) *Subscription {
+	return b.hub.subscribe(topic, lastEventID)
+}
+
+func (b *PostgresBroker) Stats() (int, int) {
+	return b.hub.stats()
+}
+
+func (b *PostgresBroker) Close() error {
+	b.cancel()
+	<-b.done
+	b.hub.closeAll()
+	return nil
+}
+
+func (b *PostgresBroker) listen(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting realtime listener: %v", err)
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		conn.Close(context.Background())
+		return nil, fmt.Errorf("error listening on %s: %v", notifyChannel, err)
+	}
+
+	// Les évènements publiés avant l'écoute n'ont pas été reçus : les reprises antérieures devront tout recharger
+	var lastValue uint64
+	if err := conn.QueryRow(ctx, "SELECT last_value FROM "+eventSequence).Scan(&lastValue); err != nil {
+		conn.Close(context.Background())
+		return nil, fmt.Errorf("error reading %s: %v", eventSequence, err)
+	}
+	b.hub.setFloor(lastValue)
+
+	return conn, nil
+}
+
+// run attend les notifications et se reconnecte en cas de coupure
+func (b *PostgresBroker) run(ctx context.Context, conn *pgx.Conn) {
+	defer close(b.done)
+
+	backoff := time.Second
+	for {
+		if conn == nil {
+			var err error
+			conn, err = b.listen(ctx)
+			if err != nil {
+				utils.LogError(err, "Realtime listener reconnection failed")
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(backoff*2, 30*time.Second)
+				continue
+			}
+			backoff = time.Second
+			utils.LogInfo("Realtime listener reconnected")
+		}
+
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			conn.Close(context.Background())
+			conn = nil
+			if ctx.Err() != nil {
+				return
+			}
+			utils.LogError(err, "Realtime listener disconnected")
+			continue
+		}
+
+		b.handleNotification(notification.Payload)
+	}
+}
+
+func (b *PostgresBroker) handleNotification(data string) {
+	event, stored, err := decodeEnvelope([]byte(data))
+	if err != nil {
+		utils.LogError(err, "Invalid realtime notification")
+		return
+	}
+	if stored {
+		var payload string
+		if err := b.db.Raw("SELECT payload FROM "+payloadTable+" WHERE id = ?", event.ID).Scan(&payload).Error; err != nil || payload == "" {
+			utils.LogError(err, fmt.Sprintf("Stored realtime payload %d not found", event.ID))
+			return
+		}
+		event.Data = []byte(payload)
+	}
+	b.hub.dispatch(event)
+}
+
+func encodeEnvelope(event Event) ([]byte, error) {
+	if !json.Valid(event.Data) {
+		return nil, ErrInvalidPayload
+	}
+	return json.Marshal(envelope{ID: event.ID, Topic: event.Topic, Payload: event.Data})
+}
+
+// decodeEnvelope indique aussi si le payload est à charger depuis realtime_payloads
+func decodeEnvelope(data []byte) (Event, bool, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return Event{}, false, err
+	}
+	if env.Topic == "" || env.ID == 0 {
+		return Event{}, false, errors.New("missing topic or id")
+	}
+	return Event{ID: env.ID, Topic: env.Topic, Data: env.Payload}, env.Stored, nil
+}
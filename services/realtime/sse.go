@@ -0,0 +1,139 @@
+package realtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Intervalle des commentaires de heartbeat, pour garder la connexion ouverte à travers les proxys
+	HeartbeatInterval = 15 * time.Second
+	// Délai de reconnexion conseillé au navigateur (en ms)
+	retryMilliseconds = 3000
+)
+
+// SSEOptions configure un flux SSE
+type SSEOptions struct {
+	// Nom des évènements envoyés (champ "event:"). Vide : le champ "type" du payload est utilisé
+	EventName string
+	// Snapshot envoie l'état initial, pour une nouvelle connexion ou quand la reprise est impossible
+	Snapshot func(send func(data []byte))
+}
+
+// LastEventID lit l'identifiant de reprise envoyé par le navigateur (header Last-Event-ID),
+// ou le paramètre lastEventId pour les clients qui ne peuvent pas envoyer de header
+func LastEventID(r *http.Request) uint64 {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// ServeSSE diffuse les évènements d'un topic jusqu'à la déconnexion du client.
+// À la reconnexion, seuls les évènements manqués depuis Last-Event-ID sont renvoyés.
+// Un client trop lent est déconnecté et reprendra là où il en était.
+func ServeSSE(w http.ResponseWriter, r *http.Request, topic string, options SSEOptions) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error":"Streaming not supported"}`)
+		return
+	}
+
+	lastEventID := LastEventID(r)
+	subscription := Subscribe(topic, lastEventID)
+	defer subscription.Close()
+
+	metrics.totalConnections.Add(1)
+	metrics.activeConnections.Add(1)
+	defer metrics.activeConnections.Add(-1)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	// Désactive le buffering de nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	fmt.Fprintf(w, "retry: %d\n\n", retryMilliseconds)
+
+	resumed := lastEventID > 0 && subscription.Resumed
+	switch {
+	case resumed:
+		metrics.resumedConnections.Add(1)
+		fmt.Fprintf(w, "event: connected\ndata: {\"status\":\"connected\",\"resumed\":true}\n\n")
+		for _, event := range subscription.Missed {
+			writeEvent(w, event.ID, options.EventName, event.Data)
+		}
+	default:
+		if lastEventID > 0 {
+			// Trop d'évènements manqués : le client doit vider son état avant de recevoir l'état complet
+			metrics.resyncedConnections.Add(1)
+			io.WriteString(w, "event: resync\ndata: {}\n\n")
+		}
+		// L'identifiant sert de point de reprise si aucun évènement n'arrive avant la déconnexion
+		fmt.Fprintf(w, "id: %d\nevent: connected\ndata: {\"status\":\"connected\",\"resumed\":false}\n\n", subscription.LatestID)
+		if options.Snapshot != nil {
+			options.Snapshot(func(data []byte) {
+				writeEvent(w, 0, options.EventName, data)
+			})
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	ctx := r.Context()
+	for {
+		select {
+		case event, ok := <-subscription.C:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, event.ID, options.EventName, event.Data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w io.Writer, id uint64, eventName string, data []byte) error {
+	if eventName == "" {
+		var typed struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal(data, &typed)
+		eventName = typed.Type
+		if eventName == "" {
+			eventName = "message"
+		}
+	}
+
+	var err error
+	if id > 0 {
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, eventName, data)
+	} else {
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventName, data)
+	}
+	return err
+}
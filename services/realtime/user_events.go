@@ -0,0 +1,54 @@
+package realtime
+
+import (
+	"encoding/json"
+	"time"
+
+	"pec2-backend/utils"
+)
+
+// Types des évènements du flux /events de l'utilisateur
+const (
+	EventPrivateMessage      = "private_message"
+	EventPostLiked           = "post_liked"
+	EventNewFollower         = "new_follower"
+	EventFollowRequest       = "follow_request"
+	EventNewSubscriber       = "new_subscriber"
+	EventSubscriptionRenewed = "subscription_renewed"
+	EventSubscriptionFailed  = "subscription_payment_failed"
+	EventModerationDecision  = "moderation_decision"
+	EventNotification        = "notification"
+	EventMessageUnlocked     = "message_unlocked"
+	EventBroadcastCompleted  = "broadcast_completed"
+	EventTipReceived         = "tip_received"
+	EventPayoutUpdated       = "payout_updated"
+)
+
+// UserEvent est un évènement destiné à un utilisateur
+type UserEvent struct {
+	Type      string    `json:"type"`
+	Payload   any       `json:"payload"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// UserTopic est le topic du flux personnel d'un utilisateur
+func UserTopic(userID string) string {
+	return "user:" + userID
+}
+
+// PublishToUser envoie un évènement sur le flux de l'utilisateur. Une erreur de diffusion
+// ne doit pas faire échouer l'action d'origine : elle est seulement loguée.
+func PublishToUser(userID string, eventType string, payload any) {
+	if userID == "" {
+		return
+	}
+
+	data, err := json.Marshal(UserEvent{Type: eventType, Payload: payload, CreatedAt: time.Now()})
+	if err != nil {
+		utils.LogError(err, "Error marshaling user event "+eventType)
+		return
+	}
+	if err := Publish(UserTopic(userID), data); err != nil {
+		utils.LogError(err, "Error publishing user event "+eventType)
+	}
+}
@@ -0,0 +1,38 @@
+package realtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishToUser(t *testing.T) {
+	SetBroker(NewMemoryBroker())
+	defer SetBroker(NewMemoryBroker())
+
+	sub := Subscribe(UserTopic("user-1"), 0)
+	defer sub.Close()
+	other := Subscribe(UserTopic("user-2"), 0)
+	defer other.Close()
+
+	PublishToUser("user-1", EventNewFollower, map[string]string{"followerId": "user-3"})
+
+	var event UserEvent
+	assert.NoError(t, json.Unmarshal(receive(t, sub).Data, &event))
+	assert.Equal(t, EventNewFollower, event.Type)
+	assert.Equal(t, map[string]any{"followerId": "user-3"}, event.Payload)
+	assert.False(t, event.CreatedAt.IsZero())
+	assert.Empty(t, other.C)
+}
+
+func TestWriteEvent_UsesPayloadType(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, writeEvent(&buf, 7, "", []byte(`{"type":"post_liked","payload":{}}`)))
+	assert.Equal(t, "id: 7\nevent: post_liked\ndata: {\"type\":\"post_liked\",\"payload\":{}}\n\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, writeEvent(&buf, 8, "", []byte(`{}`)))
+	assert.Contains(t, buf.String(), "event: message\n")
+}
@@ -0,0 +1,313 @@
+package suggestions
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"pec2-backend/db"
+	"pec2-backend/models"
+	"pec2-backend/services/access"
+
+	"gorm.io/gorm"
+)
+
+// Poids des signaux dans le score d'un créateur, chaque signal étant ramené entre 0 et 1
+const (
+	friendsWeight    = 0.5
+	categoriesWeight = 0.3
+	popularityWeight = 0.2
+)
+
+const (
+	// Nombre de suggestions gardées par utilisateur
+	maxSuggestions = 20
+	// Créateurs les plus suivis ajoutés aux candidats, pour les utilisateurs qui ne suivent et n'aiment encore rien
+	popularCandidates = 50
+	// Au-delà, les suggestions sont recalculées à la demande
+	maxAge = 48 * time.Hour
+)
+
+// signals regroupe les signaux bruts d'un créateur candidat
+type signals struct {
+	mutualFollowers int
+	// Part des likes de l'utilisateur dans les catégories où le créateur publie, entre 0 et 1
+	categoryAffinity float64
+	followers        int
+}
+
+type countRow struct {
+	ID    string
+	Count int
+}
+
+// rank calcule le score de chaque candidat et garde les meilleurs
+func rank(userID string, candidates map[string]*signals, now time.Time) []models.CreatorSuggestion {
+	maxMutual, maxFollowers := 0, 0
+	for _, s := range candidates {
+		maxMutual = max(maxMutual, s.mutualFollowers)
+		maxFollowers = max(maxFollowers, s.followers)
+	}
+
+	suggestions := make([]models.CreatorSuggestion, 0, len(candidates))
+	for creatorID, s := range candidates {
+		score := categoriesWeight * s.categoryAffinity
+		if maxMutual > 0 {
+			score += friendsWeight * math.Log1p(float64(s.mutualFollowers)) / math.Log1p(float64(maxMutual))
+		}
+		if maxFollowers > 0 {
+			score += popularityWeight * math.Log1p(float64(s.followers)) / math.Log1p(float64(maxFollowers))
+		}
+		suggestions = append(suggestions, models.CreatorSuggestion{
+			UserID:          userID,
+			CreatorID:       creatorID,
+			Score:           math.Round(score*1000) / 1000,
+			MutualFollowers: s.mutualFollowers,
+			Followers:       s.followers,
+			ComputedAt:      now,
+		})
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].CreatorID < suggestions[j].CreatorID
+	})
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	return suggestions
+}
+
+// excludedCreators renvoie les créateurs à ne jamais suggérer : l'utilisateur lui-même, ceux qu'il suit et les bloqués
+func excludedCreators(userID string) (map[string]bool, error) {
+	var followed []string
+	if err := db.DB.Model(&models.UserFollow{}).Where("follower_id = ?", userID).Pluck("followed_id", &followed).Error; err != nil {
+		return nil, err
+	}
+	blockedIDs, err := access.BlockedUserIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := map[string]bool{userID: true}
+	for _, id := range append(followed, blockedIDs...) {
+		excluded[id] = true
+	}
+	return excluded, nil
+}
+
+// Compute classe les créateurs à suggérer à l'utilisateur à partir des créateurs suivis par ses follows,
+// des catégories des posts qu'il a aimés et de la popularité des créateurs
+func Compute(userID string, now time.Time) ([]models.CreatorSuggestion, error) {
+	excluded, err := excludedCreators(userID)
+	if err != nil {
+		return nil, err
+	}
+	candidates := map[string]*signals{}
+	candidate := func(id string) *signals {
+		if candidates[id] == nil {
+			candidates[id] = &signals{}
+		}
+		return candidates[id]
+	}
+
+	// Amis d'amis : créateurs suivis par les personnes que l'utilisateur suit
+	var mutual []countRow
+	if err := db.DB.Model(&models.UserFollow{}).
+		Select("followed_id AS id, COUNT(*) AS count").
+		Where("follower_id IN (?)", db.DB.Model(&models.UserFollow{}).Select("followed_id").Where("follower_id = ?", userID)).
+		Group("followed_id").
+		Scan(&mutual).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range mutual {
+		candidate(row.ID).mutualFollowers = row.Count
+	}
+
+	// Catégories des posts aimés, pondérées par le nombre de likes
+	var likedCategories []countRow
+	if err := db.DB.Table("likes").
+		Select("post_categories.category_id AS id, COUNT(*) AS count").
+		Joins("JOIN post_categories ON post_categories.post_id = likes.post_id").
+		Where("likes.user_id = ?", userID).
+		Group("post_categories.category_id").
+		Scan(&likedCategories).Error; err != nil {
+		return nil, err
+	}
+	if len(likedCategories) > 0 {
+		weights := map[string]float64{}
+		total := 0
+		categoryIDs := make([]string, 0, len(likedCategories))
+		for _, row := range likedCategories {
+			total += row.Count
+			categoryIDs = append(categoryIDs, row.ID)
+		}
+		for _, row := range likedCategories {
+			weights[row.ID] = float64(row.Count) / float64(total)
+		}
+
+		var creatorCategories []struct {
+			CreatorID  string
+			CategoryID string
+		}
+		if err := db.DB.Table("posts").
+			Select("DISTINCT posts.user_id AS creator_id, post_categories.category_id").
+			Joins("JOIN post_categories ON post_categories.post_id = posts.id").
+			Where("post_categories.category_id IN ? AND posts.enable = ? AND posts.deleted_at IS NULL", categoryIDs, true).
+			Scan(&creatorCategories).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range creatorCategories {
+			candidate(row.CreatorID).categoryAffinity += weights[row.CategoryID]
+		}
+	}
+
+	// Créateurs les plus suivis
+	var popular []countRow
+	if err := db.DB.Model(&models.UserFollow{}).
+		Select("followed_id AS id, COUNT(*) AS count").
+		Group("followed_id").
+		Order("count DESC").
+		Limit(popularCandidates).
+		Scan(&popular).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range popular {
+		candidate(row.ID)
+	}
+
+	ids := make([]string, 0, len(candidates))
+	for id := range candidates {
+		if !excluded[id] {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// Seuls les créateurs actifs peuvent être suggérés
+	var eligible []string
+	if err := db.DB.Model(&models.User{}).
+		Where("id IN ? AND role = ? AND enable = ? AND deleted_at IS NULL", ids, models.ContentCreator, true).
+		Pluck("id", &eligible).Error; err != nil {
+		return nil, err
+	}
+	if len(eligible) == 0 {
+		return nil, nil
+	}
+
+	var followers []countRow
+	if err := db.DB.Model(&models.UserFollow{}).
+		Select("followed_id AS id, COUNT(*) AS count").
+		Where("followed_id IN ?", eligible).
+		Group("followed_id").
+		Scan(&followers).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range followers {
+		candidate(row.ID).followers = row.Count
+	}
+
+	scored := make(map[string]*signals, len(eligible))
+	for _, id := range eligible {
+		scored[id] = candidates[id]
+	}
+	return rank(userID, scored, now), nil
+}
+
+// Refresh recalcule et enregistre les suggestions de l'utilisateur
+func Refresh(userID string, now time.Time) error {
+	suggestions, err := Compute(userID, now)
+	if err != nil {
+		return err
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.CreatorSuggestion{}).Error; err != nil {
+			return err
+		}
+		if len(suggestions) == 0 {
+			return nil
+		}
+		return tx.Create(&suggestions).Error
+	})
+}
+
+// ForUser renvoie les suggestions de l'utilisateur, recalculées si elles manquent ou sont trop anciennes.
+// Les créateurs suivis, bloqués ou désactivés depuis le calcul sont retirés
+func ForUser(userID string, limit int, now time.Time) ([]models.CreatorSuggestionResponse, error) {
+	var fresh int64
+	if err := db.DB.Model(&models.CreatorSuggestion{}).
+		Where("user_id = ? AND computed_at > ?", userID, now.Add(-maxAge)).
+		Count(&fresh).Error; err != nil {
+		return nil, err
+	}
+	if fresh == 0 {
+		if err := Refresh(userID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	excluded, err := excludedCreators(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []models.CreatorSuggestion
+	if err := db.DB.Where("user_id = ?", userID).Order("score DESC").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	suggestions := make([]models.CreatorSuggestion, 0, len(stored))
+	creatorIDs := make([]string, 0, len(stored))
+	for _, suggestion := range stored {
+		if !excluded[suggestion.CreatorID] {
+			suggestions = append(suggestions, suggestion)
+			creatorIDs = append(creatorIDs, suggestion.CreatorID)
+		}
+	}
+
+	responses := make([]models.CreatorSuggestionResponse, 0, limit)
+	if len(creatorIDs) == 0 {
+		return responses, nil
+	}
+
+	var creators []models.User
+	if err := db.DB.Where("id IN ? AND enable = ? AND deleted_at IS NULL", creatorIDs, true).Find(&creators).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.User, len(creators))
+	for _, creator := range creators {
+		byID[creator.ID] = creator
+	}
+
+	for _, suggestion := range suggestions {
+		creator, ok := byID[suggestion.CreatorID]
+		if !ok {
+			continue
+		}
+		// La bio d'un profil privé est réservée à ses followers
+		bio := creator.Bio
+		if creator.PrivateProfile {
+			bio = ""
+		}
+		responses = append(responses, models.CreatorSuggestionResponse{
+			Creator: models.UserInfo{
+				ID:                     creator.ID,
+				UserName:               creator.UserName,
+				ProfilePicture:         creator.ProfilePicture,
+				ProfilePictureVariants: creator.ProfilePictureVariants,
+			},
+			Bio:             bio,
+			Score:           suggestion.Score,
+			MutualFollowers: suggestion.MutualFollowers,
+			Followers:       suggestion.Followers,
+		})
+		if len(responses) == limit {
+			break
+		}
+	}
+	return responses, nil
+}
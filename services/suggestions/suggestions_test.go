@@ -0,0 +1,45 @@
+package suggestions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRank(t *testing.T) {
+	now := time.Now()
+	candidates := map[string]*signals{
+		// Suivi par plusieurs follows de l'utilisateur
+		"friend-creator": {mutualFollowers: 4, followers: 10},
+		// Publie dans les catégories aimées par l'utilisateur
+		"category-creator": {categoryAffinity: 0.9, followers: 5},
+		// Seulement populaire
+		"popular-creator": {followers: 1000},
+		"unknown-creator": {},
+	}
+
+	ranked := rank("user-uuid", candidates, now)
+
+	assert.Len(t, ranked, 4)
+	assert.Equal(t, "friend-creator", ranked[0].CreatorID)
+	assert.Equal(t, "category-creator", ranked[1].CreatorID)
+	assert.Equal(t, "popular-creator", ranked[2].CreatorID)
+	assert.Equal(t, "unknown-creator", ranked[3].CreatorID)
+	assert.Equal(t, 0.0, ranked[3].Score)
+	assert.Equal(t, 4, ranked[0].MutualFollowers)
+	assert.Equal(t, "user-uuid", ranked[0].UserID)
+	assert.Equal(t, now, ranked[0].ComputedAt)
+}
+
+func TestRank_KeepsBestSuggestions(t *testing.T) {
+	candidates := map[string]*signals{}
+	for i := 0; i < maxSuggestions+5; i++ {
+		candidates[string(rune('a'+i))] = &signals{followers: i}
+	}
+
+	ranked := rank("user-uuid", candidates, time.Now())
+
+	assert.Len(t, ranked, maxSuggestions)
+	assert.Equal(t, string(rune('a'+maxSuggestions+4)), ranked[0].CreatorID)
+}
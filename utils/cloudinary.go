@@ -1,13 +1,14 @@
 package utils
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"os"
+	"pec2-backend/models"
 	"regexp"
-	"strings"
 	"time"
 
 	"github.com/cloudinary/cloudinary-go/v2"
@@ -49,17 +50,9 @@ func boolPointer(b bool) *bool {
 	return &b
 }
 
-// Vérifie si l'extension du fichier est supportée
-func isValidImageType(filename string) bool {
-	validExtensions := []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp", ".svg", ".pdf"}
-	lowerFilename := strings.ToLower(filename)
-
-	for _, ext := range validExtensions {
-		if strings.HasSuffix(lowerFilename, ext) {
-			return true
-		}
-	}
-	return false
+// Vérifie via les magic bytes que le fichier est une image ou un PDF supporté
+func isValidUploadType(mimeType string) bool {
+	return IsAllowedImageType(mimeType) || mimeType == "application/pdf"
 }
 
 // ExtractPublicIDFromURL extrait l'ID public à partir d'une URL Cloudinary
@@ -103,43 +96,128 @@ func DeleteImage(imageURL string) error {
 	return err
 }
 
+// UploadImage upload un document (image ou PDF) sur Cloudinary.
+// Les images sont décodées puis ré-encodées pour supprimer leurs métadonnées EXIF,
+// les GIF animés le sont image par image pour garder leur animation.
 func UploadImage(file *multipart.FileHeader, folder, prefix string) (string, error) {
-	if !isValidImageType(file.Filename) {
-		return "", fmt.Errorf("unsupported image format. Use JPG, PNG, GIF, WEBP, BMP or SVG")
+	data, mimeType, err := readUploadedFile(file)
+	if err != nil {
+		return "", err
 	}
 
-	if file.Size > 10*1024*1024 {
-		return "", fmt.Errorf("image size too large. Maximum 10MB allowed")
+	if !isValidUploadType(mimeType) {
+		return "", fmt.Errorf("unsupported file format. Use JPG, PNG, GIF, WEBP, BMP or PDF")
 	}
 
-	if cld == nil {
-		if err := InitCloudinary(); err != nil {
+	animated, _, err := ReencodeAnimatedGIF(data)
+	if err != nil {
+		return "", err
+	}
+	if animated != nil {
+		data = animated
+	} else if IsAllowedImageType(mimeType) {
+		img, err := DecodeImage(data)
+		if err != nil {
 			return "", err
 		}
+		img = ResizeToFit(img, ImageVariantSpecs[0].MaxSize)
+		if data, _, err = EncodeImage(img); err != nil {
+			return "", fmt.Errorf("error encoding the image: %v", err)
+		}
+	}
+
+	publicID := fmt.Sprintf("%s_%d", prefix, time.Now().Unix())
+	return uploadBytes(data, folder, publicID)
+}
+
+// UploadPicture traite une image (validation, suppression EXIF, redimensionnement)
+// et upload ses variantes miniature, fil d'actualité et taille réelle
+func UploadPicture(file *multipart.FileHeader, folder, prefix string) (models.ImageVariants, error) {
+	var variants models.ImageVariants
+
+	data, mimeType, err := readUploadedFile(file)
+	if err != nil {
+		return variants, err
+	}
+
+	if !IsAllowedImageType(mimeType) {
+		return variants, fmt.Errorf("unsupported image format. Use JPG, PNG, GIF, WEBP or BMP")
+	}
+
+	processed, err := ProcessImageVariants(data)
+	if err != nil {
+		return variants, err
+	}
+
+	timestamp := time.Now().Unix()
+	for _, p := range processed {
+		publicID := fmt.Sprintf("%s_%d_%s", prefix, timestamp, p.Name)
+		url, err := uploadBytes(p.Data, folder, publicID)
+		if err != nil {
+			// On ne laisse pas de variantes orphelines sur Cloudinary
+			DeletePicture("", variants)
+			return models.ImageVariants{}, err
+		}
+
+		switch p.Name {
+		case "thumbnail":
+			variants.Thumbnail = url
+		case "feed":
+			variants.Feed = url
+		case "full":
+			variants.Full = url
+		}
+	}
+
+	return variants, nil
+}
+
+// DeletePicture supprime une image et toutes ses variantes
+func DeletePicture(imageURL string, variants models.ImageVariants) {
+	urls := variants.URLs()
+	if imageURL != "" && imageURL != variants.Full {
+		urls = append(urls, imageURL)
+	}
+
+	for _, url := range urls {
+		if err := DeleteImage(url); err != nil {
+			LogError(err, "Error deleting image "+url)
+		}
+	}
+}
+
+func readUploadedFile(file *multipart.FileHeader) ([]byte, string, error) {
+	if file.Size > 10*1024*1024 {
+		return nil, "", fmt.Errorf("image size too large. Maximum 10MB allowed")
 	}
 
 	src, err := file.Open()
 	if err != nil {
-		return "", fmt.Errorf("error opening the file: %v", err)
+		return nil, "", fmt.Errorf("error opening the file: %v", err)
 	}
 	defer src.Close()
 
-	buffer := make([]byte, 512)
-	_, err = src.Read(buffer)
-	if err != nil && err != io.EOF {
-		return "", fmt.Errorf("error reading the file: %v", err)
+	data, err := io.ReadAll(io.LimitReader(src, 10*1024*1024+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading the file: %v", err)
 	}
+	if len(data) > 10*1024*1024 {
+		return nil, "", fmt.Errorf("image size too large. Maximum 10MB allowed")
+	}
+
+	return data, DetectFileType(data), nil
+}
 
-	if _, err = src.Seek(0, io.SeekStart); err != nil {
-		return "", fmt.Errorf("error resetting the file cursor: %v", err)
+func uploadBytes(data []byte, folder, publicID string) (string, error) {
+	if cld == nil {
+		if err := InitCloudinary(); err != nil {
+			return "", err
+		}
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	timestamp := time.Now().Unix()
-	publicID := fmt.Sprintf("%s_%d", prefix, timestamp)
-
 	uploadParams := uploader.UploadParams{
 		Folder:         folder,
 		PublicID:       publicID,
@@ -149,7 +227,7 @@ func UploadImage(file *multipart.FileHeader, folder, prefix string) (string, err
 		ResourceType:   "auto",
 	}
 
-	uploadResult, err := cld.Upload.Upload(ctx, src, uploadParams)
+	uploadResult, err := cld.Upload.Upload(ctx, bytes.NewReader(data), uploadParams)
 	if err != nil {
 		return "", fmt.Errorf("error uploading to Cloudinary: %v", err)
 	}
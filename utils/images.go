@@ -0,0 +1,481 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	_ "golang.org/x/image/bmp"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Limite en nombre de pixels pour éviter les "decompression bombs"
+const maxImagePixels = 50_000_000
+
+// Limite pour un GIF animé, toutes images confondues
+const maxAnimationPixels = 100_000_000
+
+// ImageVariantSpec décrit une variante à générer (côté le plus long en pixels)
+type ImageVariantSpec struct {
+	Name    string
+	MaxSize int
+}
+
+// Variantes générées pour chaque image uploadée, de la plus grande à la plus petite
+var ImageVariantSpecs = []ImageVariantSpec{
+	{Name: "full", MaxSize: 2048},
+	{Name: "feed", MaxSize: 1080},
+	{Name: "thumbnail", MaxSize: 320},
+}
+
+// ProcessedImage est une variante ré-encodée prête à être uploadée
+type ProcessedImage struct {
+	Name      string
+	Data      []byte
+	Extension string
+	Width     int
+	Height    int
+}
+
+// Le SVG n'est plus accepté : il peut embarquer du JavaScript servi tel quel depuis le stockage,
+// et il ne peut pas être décodé côté serveur pour en retirer les métadonnées
+var allowedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+}
+
+// DetectFileType détermine le type MIME à partir des premiers octets (magic bytes) du fichier
+func DetectFileType(header []byte) string {
+	return http.DetectContentType(header)
+}
+
+// IsAllowedImageType vérifie que le type détecté correspond à une image décodable côté serveur
+func IsAllowedImageType(mimeType string) bool {
+	return allowedImageTypes[mimeType]
+}
+
+// ProcessImageVariants décode l'image, applique l'orientation EXIF puis génère les variantes.
+// Le ré-encodage supprime toutes les métadonnées (EXIF, GPS, ...).
+// Un GIF animé est redimensionné image par image pour garder son animation dans chaque variante.
+func ProcessImageVariants(data []byte) ([]ProcessedImage, error) {
+	animation, err := decodeAnimatedGIF(data)
+	if err != nil {
+		return nil, err
+	}
+	if animation != nil {
+		return animatedVariants(animation)
+	}
+
+	img, err := DecodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []ProcessedImage
+	source := img
+	for _, spec := range ImageVariantSpecs {
+		resized := ResizeToFit(source, spec.MaxSize)
+		encoded, ext, err := EncodeImage(resized)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding %s variant: %v", spec.Name, err)
+		}
+		variants = append(variants, ProcessedImage{
+			Name:      spec.Name,
+			Data:      encoded,
+			Extension: ext,
+			Width:     resized.Bounds().Dx(),
+			Height:    resized.Bounds().Dy(),
+		})
+		// Les variantes suivantes sont plus petites, on repart de celle-ci pour aller plus vite
+		source = resized
+	}
+
+	return variants, nil
+}
+
+// ReencodeAnimatedGIF ré-encode image par image un GIF animé, réduit à la taille de la variante "full" :
+// l'animation est conservée et les extensions (commentaires, XMP) sont supprimées.
+// Retourne nil si le fichier n'est pas un GIF animé.
+func ReencodeAnimatedGIF(data []byte) ([]byte, image.Config, error) {
+	animation, err := decodeAnimatedGIF(data)
+	if err != nil || animation == nil {
+		return nil, image.Config{}, err
+	}
+
+	resized := ResizeAnimation(animation, ImageVariantSpecs[0].MaxSize)
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, resized); err != nil {
+		return nil, resized.Config, fmt.Errorf("error encoding the image: %v", err)
+	}
+	return buf.Bytes(), resized.Config, nil
+}
+
+func animatedVariants(animation *gif.GIF) ([]ProcessedImage, error) {
+	var variants []ProcessedImage
+	for _, spec := range ImageVariantSpecs {
+		resized := ResizeAnimation(animation, spec.MaxSize)
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, resized); err != nil {
+			return nil, fmt.Errorf("error encoding %s variant: %v", spec.Name, err)
+		}
+		variants = append(variants, ProcessedImage{
+			Name:      spec.Name,
+			Data:      buf.Bytes(),
+			Extension: "gif",
+			Width:     resized.Config.Width,
+			Height:    resized.Config.Height,
+		})
+	}
+	return variants, nil
+}
+
+// decodeAnimatedGIF décode un GIF animé, nil si le fichier n'en est pas un.
+// Les images sont comptées avant le décodage : chacune peut couvrir tout le canevas,
+// c'est le produit images × pixels du canevas qui est limité
+func decodeAnimatedGIF(data []byte) (*gif.GIF, error) {
+	if DetectFileType(data) != "image/gif" {
+		return nil, nil
+	}
+
+	config, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %v", err)
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, fmt.Errorf("image dimensions too large (%dx%d)", config.Width, config.Height)
+	}
+
+	frames, err := countGIFFrames(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %v", err)
+	}
+	if frames < 2 {
+		return nil, nil
+	}
+	if frames*config.Width*config.Height > maxAnimationPixels {
+		return nil, fmt.Errorf("animation too large (%d frames of %dx%d)", frames, config.Width, config.Height)
+	}
+
+	animation, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %v", err)
+	}
+	return animation, nil
+}
+
+// countGIFFrames parcourt les blocs du fichier sans décompresser les images
+func countGIFFrames(data []byte) (int, error) {
+	errTruncated := fmt.Errorf("truncated gif")
+	if len(data) < 13 {
+		return 0, errTruncated
+	}
+	pos := 13
+	// Table de couleurs globale
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&0x07 + 1)
+	}
+
+	skipSubBlocks := func() error {
+		for {
+			if pos >= len(data) {
+				return errTruncated
+			}
+			size := int(data[pos])
+			pos += 1 + size
+			if size == 0 {
+				return nil
+			}
+		}
+	}
+
+	frames := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // extension : étiquette puis sous-blocs
+			pos += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x2C: // descripteur d'image, table locale éventuelle, taille de code LZW puis sous-blocs
+			if pos+10 > len(data) {
+				return 0, errTruncated
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos++
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+			frames++
+		case 0x3B: // fin du fichier
+			return frames, nil
+		default:
+			return 0, fmt.Errorf("unknown gif block 0x%02x", data[pos])
+		}
+	}
+	return frames, nil
+}
+
+// ResizeAnimation réduit chaque image d'un GIF animé pour que le canevas tienne dans maxSize.
+// Les images sont recomposées sur le canevas avant d'être réduites, puis remises dans leur palette
+func ResizeAnimation(animation *gif.GIF, maxSize int) *gif.GIF {
+	width, height := animation.Config.Width, animation.Config.Height
+	if width <= maxSize && height <= maxSize {
+		return animation
+	}
+
+	canvasBounds := image.Rect(0, 0, width, height)
+	canvas := image.NewNRGBA(canvasBounds)
+	var previous *image.NRGBA
+
+	resized := &gif.GIF{
+		LoopCount:       animation.LoopCount,
+		Delay:           animation.Delay,
+		BackgroundIndex: animation.BackgroundIndex,
+	}
+	for i, frame := range animation.Image {
+		disposal := byte(gif.DisposalNone)
+		if i < len(animation.Disposal) {
+			disposal = animation.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewNRGBA(canvasBounds)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		scaled := ResizeToFit(canvas, maxSize)
+		paletted := image.NewPaletted(scaled.Bounds(), frame.Palette)
+		draw.Draw(paletted, paletted.Bounds(), scaled, scaled.Bounds().Min, draw.Src)
+		resized.Image = append(resized.Image, paletted)
+		// Chaque image couvre tout le canevas : on efface avant la suivante pour garder la transparence
+		resized.Disposal = append(resized.Disposal, gif.DisposalBackground)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	resized.Config = image.Config{
+		ColorModel: animation.Config.ColorModel,
+		Width:      resized.Image[0].Bounds().Dx(),
+		Height:     resized.Image[0].Bounds().Dy(),
+	}
+	return resized
+}
+
+// DecodeImage valide le type par magic bytes, décode l'image et la remet dans le bon sens
+func DecodeImage(data []byte) (image.Image, error) {
+	mimeType := DetectFileType(data)
+	if !IsAllowedImageType(mimeType) {
+		return nil, fmt.Errorf("unsupported image format (%s). Use JPG, PNG, GIF, WEBP or BMP", mimeType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %v", err)
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, fmt.Errorf("image dimensions too large (%dx%d)", config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %v", err)
+	}
+
+	if mimeType == "image/jpeg" {
+		img = applyOrientation(img, readJPEGOrientation(data))
+	}
+
+	return img, nil
+}
+
+// ResizeToFit réduit l'image pour que son plus grand côté fasse au maximum maxSize (jamais d'agrandissement)
+func ResizeToFit(img image.Image, maxSize int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return img
+	}
+
+	var newWidth, newHeight int
+	if width >= height {
+		newWidth = maxSize
+		newHeight = max(1, height*maxSize/width)
+	} else {
+		newHeight = maxSize
+		newWidth = max(1, width*maxSize/height)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, newWidth, newHeight))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Over, nil)
+	return dst
+}
+
+// EncodeImage encode en JPEG les images opaques et en PNG celles qui ont de la transparence
+func EncodeImage(img image.Image) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	if isOpaque(img) {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "jpg", nil
+	}
+
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "png", nil
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Bounds().Min == (image.Point{}) {
+		return nrgba
+	}
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+// applyOrientation applique l'une des 8 orientations EXIF pour que l'image s'affiche à l'endroit
+// une fois les métadonnées supprimées
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	src := toNRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // miroir horizontal
+				dx, dy = w-1-x, y
+			case 3: // rotation 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // miroir vertical
+				dx, dy = x, h-1-y
+			case 5: // transposition
+				dx, dy = y, x
+			case 6: // rotation 90° horaire
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotation 90° anti-horaire
+				dx, dy = y, w-1-x
+			}
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
+
+// readJPEGOrientation lit le tag EXIF Orientation (0x0112) d'un JPEG, 1 par défaut
+func readJPEGOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		// Début des données de l'image, plus de métadonnées après
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		segmentLength := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if segmentLength < 2 || pos+2+segmentLength > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : pos+2+segmentLength]
+
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return parseTIFFOrientation(segment[6:])
+		}
+		pos += 2 + segmentLength
+	}
+
+	return 1
+}
+
+func parseTIFFOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	if order.Uint16(tiff[2:4]) != 42 {
+		return 1
+	}
+
+	ifdOffset := int(order.Uint32(tiff[4:8]))
+	if ifdOffset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifdOffset : ifdOffset+2]))
+
+	for i := 0; i < entries; i++ {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+
+	return 1
+}
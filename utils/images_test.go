@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Construit un JPEG avec un segment EXIF contenant l'orientation et une fausse position GPS
+func jpegWithOrientation(t *testing.T, width, height int, orientation uint16) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("Erreur lors de l'encodage JPEG: %s", err)
+	}
+	raw := buf.Bytes()
+
+	// En-tête TIFF little endian avec une seule entrée IFD (Orientation)
+	tiff := []byte("II")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 42)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 0)
+	tiff = append(tiff, []byte("GPS 48.8566N 2.3522E")...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	result := append([]byte{}, raw[:2]...)
+	result = append(result, segment...)
+	return append(result, raw[2:]...)
+}
+
+func TestReadJPEGOrientation(t *testing.T) {
+	data := jpegWithOrientation(t, 40, 20, 6)
+	assert.Equal(t, 6, readJPEGOrientation(data))
+
+	assert.Equal(t, 1, readJPEGOrientation([]byte("not a jpeg")))
+}
+
+func TestProcessImageVariants_StripsExifAndRotates(t *testing.T) {
+	data := jpegWithOrientation(t, 400, 200, 6)
+
+	variants, err := ProcessImageVariants(data)
+	assert.NoError(t, err)
+	assert.Len(t, variants, len(ImageVariantSpecs))
+
+	for _, variant := range variants {
+		assert.Equal(t, "jpg", variant.Extension)
+		assert.False(t, bytes.Contains(variant.Data, []byte("Exif")), "EXIF should be removed from %s", variant.Name)
+		assert.False(t, bytes.Contains(variant.Data, []byte("GPS")), "GPS data should be removed from %s", variant.Name)
+	}
+
+	// Rotation de 90° : l'image paysage devient portrait
+	full := variants[0]
+	assert.Equal(t, 200, full.Width)
+	assert.Equal(t, 400, full.Height)
+
+	thumbnail := variants[len(variants)-1]
+	assert.Equal(t, "thumbnail", thumbnail.Name)
+	assert.LessOrEqual(t, thumbnail.Height, 320)
+}
+
+func TestProcessImageVariants_KeepsTransparency(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 50, 50))
+	img.Set(10, 10, color.NRGBA{R: 255, A: 128})
+
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+
+	variants, err := ProcessImageVariants(buf.Bytes())
+	assert.NoError(t, err)
+	for _, variant := range variants {
+		assert.Equal(t, "png", variant.Extension)
+		assert.Equal(t, 50, variant.Width)
+	}
+}
+
+func TestProcessImageVariants_RejectsNonImage(t *testing.T) {
+	// Un fichier texte renommé en .jpg ne doit pas passer
+	_, err := ProcessImageVariants([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"))
+	assert.Error(t, err)
+
+	_, err = ProcessImageVariants([]byte("%PDF-1.4 fake pdf"))
+	assert.Error(t, err)
+}
+
+func animatedGIF(t *testing.T, width, height, frames int) []byte {
+	animation := &gif.GIF{LoopCount: 0}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, width, height), palette.Plan9)
+		frame.SetColorIndex(i, i, uint8(i+1))
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 10)
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, gif.EncodeAll(&buf, animation))
+	return buf.Bytes()
+}
+
+func TestProcessImageVariants_KeepsGIFAnimation(t *testing.T) {
+	variants, err := ProcessImageVariants(animatedGIF(t, 600, 400, 3))
+	assert.NoError(t, err)
+	assert.Len(t, variants, 3)
+
+	expected := map[string]int{"full": 600, "feed": 600, "thumbnail": 320}
+	for _, v := range variants {
+		assert.Equal(t, "gif", v.Extension)
+		assert.Equal(t, expected[v.Name], v.Width, v.Name)
+
+		decoded, err := gif.DecodeAll(bytes.NewReader(v.Data))
+		assert.NoError(t, err)
+		assert.Len(t, decoded.Image, 3)
+		assert.Equal(t, v.Width, decoded.Config.Width)
+	}
+}
+
+func TestProcessImageVariants_RejectsTooManyGIFFrames(t *testing.T) {
+	// Chaque image fait moins que la limite, mais toutes ensemble la dépassent
+	data := animatedGIF(t, 2000, 2000, maxAnimationPixels/(2000*2000)+1)
+
+	frames, err := countGIFFrames(data)
+	assert.NoError(t, err)
+	assert.Equal(t, maxAnimationPixels/(2000*2000)+1, frames)
+
+	_, err = ProcessImageVariants(data)
+	assert.ErrorContains(t, err, "animation too large")
+}
+
+func TestIsValidUploadType_RejectsSVG(t *testing.T) {
+	// Le SVG était accepté sur la seule foi de son extension : il ne l'est plus
+	svg := []byte("<?xml version=\"1.0\"?><svg xmlns=\"http://www.w3.org/2000/svg\"><script>alert(1)</script></svg>")
+	assert.False(t, isValidUploadType(DetectFileType(svg)))
+
+	assert.True(t, isValidUploadType(DetectFileType([]byte("%PDF-1.4 document"))))
+}
+
+func TestResizeToFit(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3000, 1500))
+
+	resized := ResizeToFit(img, 1080)
+	assert.Equal(t, 1080, resized.Bounds().Dx())
+	assert.Equal(t, 540, resized.Bounds().Dy())
+
+	// Pas d'agrandissement pour les petites images
+	small := image.NewNRGBA(image.Rect(0, 0, 100, 80))
+	assert.Equal(t, small, ResizeToFit(small, 1080))
+}
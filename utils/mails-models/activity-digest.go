@@ -0,0 +1,85 @@
+package mailsmodels
+
+import (
+	"fmt"
+	"html"
+	"pec2-backend/utils"
+	"strings"
+)
+
+type DigestPost struct {
+	CreatorName string
+	PostName    string
+}
+
+type ActivityDigestData struct {
+	Email          string
+	FirstName      string
+	Weekly         bool
+	NewPostsCount  int64
+	Posts          []DigestPost
+	UnreadMessages int64
+	IsCreator      bool
+	NewSubscribers int64
+	// Revenus en centimes
+	Revenue        int64
+	UnsubscribeURL string
+}
+
+func ActivityDigest(data ActivityDigestData) {
+	period := "de la journée"
+	if data.Weekly {
+		period = "de la semaine"
+	}
+
+	subject := fmt.Sprintf("Subject: Votre récapitulatif %s sur OnlyFlick \r\n", period)
+	unsubscribe := fmt.Sprintf("List-Unsubscribe: <%s>\r\nList-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n", data.UnsubscribeURL)
+	mime := "MIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n"
+	body := fmt.Sprintf(`
+	<div style="background-color: #722ED1; width: 100%%; min-height: 300px; padding: 30px; box-sizing:border-box">
+		<table style="background-color: #ffffff; width: 100%%; min-height: 300px; border-radius: 10px;">
+			<tbody>
+				<tr>
+					<td style="padding: 20px;">
+						<h1 style="text-align:center; color: #333; margin-bottom: 30px;">Votre activité %s</h1>
+						<p style="font-size: 16px; color: #444; text-align:center;">Bonjour %s, voici ce que vous avez manqué sur OnlyFlick.</p>
+						%s
+						<div style="text-align:center; margin-top: 30px; color: #999; font-size: 12px;">
+							<p>Vous recevez cet email car vous avez activé le récapitulatif d'activité.</p>
+							<p><a href="%s" style="color: #722ED1;">Se désinscrire en un clic</a></p>
+						</div>
+					</td>
+				</tr>
+			</tbody>
+		</table>
+	</div>
+`, period, html.EscapeString(data.FirstName), digestSections(data), html.EscapeString(data.UnsubscribeURL))
+
+	message := []byte(subject + unsubscribe + mime + body)
+
+	utils.SendMail(data.Email, message)
+}
+
+func digestSections(data ActivityDigestData) string {
+	var sections strings.Builder
+
+	if data.NewPostsCount > 0 {
+		sections.WriteString(fmt.Sprintf(`<h2 style="color: #722ED1; font-size: 18px;">%d nouveau(x) post(s) de vos créateurs</h2><ul style="color: #444;">`, data.NewPostsCount))
+		for _, post := range data.Posts {
+			sections.WriteString(fmt.Sprintf(`<li><strong>%s</strong> : %s</li>`, html.EscapeString(post.CreatorName), html.EscapeString(post.PostName)))
+		}
+		sections.WriteString(`</ul>`)
+	}
+
+	if data.UnreadMessages > 0 {
+		sections.WriteString(fmt.Sprintf(`<h2 style="color: #722ED1; font-size: 18px;">%d message(s) non lu(s)</h2>`, data.UnreadMessages))
+	}
+
+	if data.IsCreator {
+		sections.WriteString(fmt.Sprintf(`<h2 style="color: #722ED1; font-size: 18px;">Votre activité de créateur</h2>`+
+			`<p style="color: #444;">Nouveaux abonnés : <strong>%d</strong></p>`+
+			`<p style="color: #444;">Revenus : <strong>%.2f €</strong></p>`, data.NewSubscribers, float64(data.Revenue)/100))
+	}
+
+	return sections.String()
+}
@@ -0,0 +1,10 @@
+package mailsmodels
+
+import (
+	"fmt"
+)
+
+// formatPrice affiche un montant en centimes, par exemple "7.00 €"
+func formatPrice(cents int) string {
+	return fmt.Sprintf("%.2f €", float64(cents)/100)
+}
@@ -5,7 +5,7 @@ import (
 	"pec2-backend/utils"
 )
 
-func SubscriptionCancellation(email string, creatorName string) {
+func SubscriptionCancellation(email string, creatorName string, price int) {
 	subject := "Subject: Confirmation d'annulation d'abonnement OnlyFlick \r\n"
 	mime := "MIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n"
 	body := fmt.Sprintf(`
@@ -20,7 +20,7 @@ func SubscriptionCancellation(email string, creatorName string) {
 				</tr>
 				<tr>
 					<td style="text-align:center; padding-bottom: 20px;">
-						<p>Vous ne serez plus débité de 7€ par mois pour cet abonnement.</p>
+						<p>Vous ne serez plus débité de %s par mois pour cet abonnement.</p>
 						<p>Vous pouvez continuer à profiter du contenu jusqu'à la fin de votre période d'abonnement en cours.</p>
 					</td>
 				</tr>
@@ -32,7 +32,7 @@ func SubscriptionCancellation(email string, creatorName string) {
 			</tbody>
 		</table>
 	</div>
-`, creatorName)
+`, creatorName, formatPrice(price))
 
 	message := []byte(subject + mime + body)
 
@@ -5,7 +5,7 @@ import (
 	"pec2-backend/utils"
 )
 
-func SubscriptionConfirmation(email string, creatorName string) {
+func SubscriptionConfirmation(email string, creatorName string, price int) {
 	subject := "Subject: Confirmation d'abonnement OnlyFlick \r\n"
 	mime := "MIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n"
 	body := fmt.Sprintf(`
@@ -20,7 +20,7 @@ func SubscriptionConfirmation(email string, creatorName string) {
 				</tr>
 				<tr>
 					<td style="text-align:center; padding-bottom: 20px;">
-						<p>Votre abonnement mensuel de 7€ vous donne accès à tout le contenu exclusif de ce créateur.</p>
+						<p>Votre abonnement mensuel de %s vous donne accès à tout le contenu exclusif de ce créateur.</p>
 						<p>Le prochain prélèvement sera effectué dans un mois.</p>
 					</td>
 				</tr>
@@ -32,7 +32,7 @@ func SubscriptionConfirmation(email string, creatorName string) {
 			</tbody>
 		</table>
 	</div>
-`, creatorName)
+`, creatorName, formatPrice(price))
 
 	message := []byte(subject + mime + body)
 
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPagination lit les paramètres "page" (1 par défaut) et "limit" (20 par défaut, 100 au maximum)
+func GetPagination(c *gin.Context) (int, int) {
+	limit := 20
+	if limitParam := c.Query("limit"); limitParam != "" {
+		fmt.Sscanf(limitParam, "%d", &limit)
+		if limit <= 0 {
+			limit = 20
+		}
+		if limit > 100 {
+			limit = 100
+		}
+	}
+
+	page := 1
+	if pageParam := c.Query("page"); pageParam != "" {
+		fmt.Sscanf(pageParam, "%d", &page)
+		if page <= 0 {
+			page = 1
+		}
+	}
+
+	return page, limit
+}
+
+// PaginationResponse construit le bloc "pagination" des réponses paginées
+func PaginationResponse(total int64, page int, limit int) gin.H {
+	return gin.H{
+		"total":       total,
+		"limit":       limit,
+		"page":        page,
+		"total_pages": (total + int64(limit) - 1) / int64(limit),
+	}
+}
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"os"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+// InitStripe configure le client Stripe. STRIPE_API_BASE permet de viser un
+// bouchon local comme stripe-mock plutôt que l'API de Stripe
+func InitStripe() {
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+
+	if base := os.Getenv("STRIPE_API_BASE"); base != "" {
+		stripe.SetBackend(stripe.APIBackend, stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+			URL: stripe.String(base),
+		}))
+		LogSuccess("Stripe API redirected to " + base)
+	}
+}
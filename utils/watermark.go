@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+const maxRemoteImageSize = 20 * 1024 * 1024
+
+var (
+	watermarkLogo     image.Image
+	watermarkLogoOnce sync.Once
+
+	watermarkFont     *sfnt.Font
+	watermarkFace     font.Face
+	watermarkFontOnce sync.Once
+
+	mediaHTTPClient = &http.Client{Timeout: 20 * time.Second}
+)
+
+// FetchRemoteFile télécharge un fichier depuis le stockage (Cloudinary)
+func FetchRemoteFile(url string) ([]byte, string, error) {
+	resp, err := mediaHTTPClient.Get(url)
+	if err != nil {
+		return nil, "", fmt.Errorf("error fetching media: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("storage returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteImageSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading media: %v", err)
+	}
+	if len(data) > maxRemoteImageSize {
+		return nil, "", fmt.Errorf("media too large")
+	}
+
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// WatermarkLogo charge le logo de la plateforme (PNG) défini par WATERMARK_LOGO_PATH, nil si absent
+func WatermarkLogo() image.Image {
+	watermarkLogoOnce.Do(func() {
+		path := os.Getenv("WATERMARK_LOGO_PATH")
+		if path == "" {
+			return
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			LogError(err, "Impossible to open the watermark logo")
+			return
+		}
+		defer file.Close()
+
+		logo, _, err := image.Decode(file)
+		if err != nil {
+			LogError(err, "Impossible to decode the watermark logo")
+			return
+		}
+		watermarkLogo = logo
+	})
+	return watermarkLogo
+}
+
+// WatermarkImage ajoute un filigrane visible : le nom de l'abonné répété en diagonale sur toute l'image
+// et un bandeau en bas à droite avec le logo de la plateforme et le nom de l'abonné
+func WatermarkImage(src image.Image, logo image.Image, label string) *image.NRGBA {
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+
+	width, height := dst.Bounds().Dx(), dst.Bounds().Dy()
+	scale := max(1, width/500)
+
+	// Motif répété, discret mais présent partout pour empêcher de le rogner
+	tile := renderText(label, color.NRGBA{R: 255, G: 255, B: 255, A: 55}, scale)
+	tileW, tileH := tile.Bounds().Dx(), tile.Bounds().Dy()
+	stepX := tileW + 60*scale
+	stepY := tileH * 6
+	row := 0
+	for y := tileH; y < height; y += stepY {
+		offset := (row % 2) * stepX / 2
+		for x := -offset; x < width; x += stepX {
+			r := image.Rect(x, y, x+tileW, y+tileH)
+			draw.Draw(dst, r, tile, image.Point{}, draw.Over)
+		}
+		row++
+	}
+
+	// Bandeau en bas à droite
+	margin := 12 * scale
+	badge := renderText(label, color.NRGBA{R: 255, G: 255, B: 255, A: 200}, scale*2)
+	badgeW, badgeH := badge.Bounds().Dx(), badge.Bounds().Dy()
+	x := width - badgeW - margin
+	y := height - badgeH - margin
+
+	if logo != nil {
+		logoH := badgeH * 2
+		logoW := logo.Bounds().Dx() * logoH / max(1, logo.Bounds().Dy())
+		logoRect := image.Rect(width-logoW-margin, y-logoH-margin/2, width-margin, y-margin/2)
+		xdraw.ApproxBiLinear.Scale(dst, logoRect, logo, logo.Bounds(), xdraw.Over, nil)
+	} else {
+		brand := renderText("OnlyFlick", color.NRGBA{R: 114, G: 46, B: 209, A: 200}, scale*2)
+		brandRect := image.Rect(width-brand.Bounds().Dx()-margin, y-brand.Bounds().Dy()-margin/2, width-margin, y-margin/2)
+		draw.Draw(dst, brandRect, brand, image.Point{}, draw.Over)
+	}
+
+	shadow := renderText(label, color.NRGBA{A: 140}, scale*2)
+	draw.Draw(dst, image.Rect(x+scale, y+scale, x+scale+badgeW, y+scale+badgeH), shadow, image.Point{}, draw.Over)
+	draw.Draw(dst, image.Rect(x, y, x+badgeW, y+badgeH), badge, image.Point{}, draw.Over)
+
+	return dst
+}
+
+// WatermarkLabel retourne le texte du filigrane d'un abonné : son nom d'utilisateur,
+// ou son identifiant si la police ne sait pas dessiner tous les caractères du nom
+func WatermarkLabel(userName, userID string) string {
+	fontData, _ := loadWatermarkFace()
+	if fontData == nil {
+		return "@" + userName
+	}
+
+	var buf sfnt.Buffer
+	for _, r := range userName {
+		if index, err := fontData.GlyphIndex(&buf, r); err != nil || index == 0 {
+			return "#" + userID
+		}
+	}
+	return "@" + userName
+}
+
+// loadWatermarkFace charge la police Go Regular intégrée (latin étendu, grec, cyrillique)
+func loadWatermarkFace() (*sfnt.Font, font.Face) {
+	watermarkFontOnce.Do(func() {
+		parsed, err := opentype.Parse(goregular.TTF)
+		if err != nil {
+			LogError(err, "Impossible to parse the watermark font")
+			return
+		}
+		face, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: 13, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			LogError(err, "Impossible to load the watermark font")
+			return
+		}
+		watermarkFont, watermarkFace = parsed, face
+	})
+	return watermarkFont, watermarkFace
+}
+
+// renderText dessine un texte avec la police intégrée puis l'agrandit
+func renderText(text string, textColor color.NRGBA, scale int) *image.NRGBA {
+	_, face := loadWatermarkFace()
+	if face == nil {
+		face = basicfont.Face7x13
+	}
+	textWidth := font.MeasureString(face, text).Ceil()
+	textHeight := face.Metrics().Height.Ceil()
+
+	small := image.NewNRGBA(image.Rect(0, 0, max(1, textWidth), max(1, textHeight)))
+	drawer := &font.Drawer{
+		Dst:  small,
+		Src:  image.NewUniform(textColor),
+		Face: face,
+		Dot:  fixed.P(0, face.Metrics().Ascent.Ceil()),
+	}
+	drawer.DrawString(text)
+
+	if scale <= 1 {
+		return small
+	}
+
+	big := image.NewNRGBA(image.Rect(0, 0, small.Bounds().Dx()*scale, small.Bounds().Dy()*scale))
+	xdraw.NearestNeighbor.Scale(big, big.Bounds(), small, small.Bounds(), xdraw.Src, nil)
+	return big
+}
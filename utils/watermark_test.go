@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/font/sfnt"
+)
+
+func TestWatermarkImage(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 800, 600))
+	for y := 0; y < 600; y++ {
+		for x := 0; x < 800; x++ {
+			src.Set(x, y, color.NRGBA{A: 255})
+		}
+	}
+
+	marked := WatermarkImage(src, nil, "@subscriber42")
+	assert.Equal(t, src.Bounds(), marked.Bounds())
+
+	// Le bandeau en bas à droite doit contenir des pixels clairs
+	changed := 0
+	for y := 500; y < 600; y++ {
+		for x := 500; x < 800; x++ {
+			if marked.NRGBAAt(x, y).R > 100 {
+				changed++
+			}
+		}
+	}
+	assert.Greater(t, changed, 0)
+
+	// L'image source n'est pas modifiée
+	assert.Equal(t, uint8(0), src.NRGBAAt(790, 590).R)
+}
+
+func TestWatermarkLabel(t *testing.T) {
+	// Les accents et le cyrillique sont couverts par la police
+	assert.Equal(t, "@élodie_mü", WatermarkLabel("élodie_mü", "user-1"))
+	assert.Equal(t, "@Дмитрий", WatermarkLabel("Дмитрий", "user-1"))
+
+	// Sinon on retombe sur l'identifiant plutôt que de dessiner des carrés
+	assert.Equal(t, "#user-1", WatermarkLabel("さくら", "user-1"))
+}
+
+func TestWatermarkImage_NonASCIILabel(t *testing.T) {
+	ascii := renderText("@elodie", color.NRGBA{R: 255, A: 255}, 1)
+	accented := renderText("@élodie", color.NRGBA{R: 255, A: 255}, 1)
+
+	// "é" est dessiné comme un "e" surmonté d'un accent, pas comme un carré de remplacement
+	assert.Equal(t, ascii.Bounds(), accented.Bounds())
+	assert.NotEqual(t, ascii.Pix, accented.Pix)
+
+	var notdef sfnt.Buffer
+	fontData, _ := loadWatermarkFace()
+	index, err := fontData.GlyphIndex(&notdef, 'é')
+	assert.NoError(t, err)
+	assert.NotZero(t, index)
+}